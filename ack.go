@@ -0,0 +1,171 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Acknowledgements are forgotten after ackTTL, and at most maxAcks are kept.
+// Clients whose acknowledgements were dropped resume like any other.
+const (
+	ackTTL  = 24 * time.Hour
+	maxAcks = 100000
+)
+
+// acknowledgements records the last event id each client has processed, per stream
+type acknowledgements struct {
+	mu   sync.Mutex
+	last map[string]acknowledgement
+}
+
+type acknowledgement struct {
+	id    string
+	acked time.Time
+}
+
+func (a *acknowledgements) key(stream, client string) string {
+	return stream + "\x00" + client
+}
+
+// ack records an event id, unless the client already acknowledged a later one.
+// Expired acknowledgements are removed when there is no room for a new one.
+func (a *acknowledgements) ack(stream, client, id string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.last == nil {
+		a.last = make(map[string]acknowledgement)
+	}
+
+	k := a.key(stream, client)
+	prev, ok := a.last[k]
+	if ok && now.Sub(prev.acked) <= ackTTL && compareID(prev.id, id) >= 0 {
+		return
+	}
+	if !ok && len(a.last) >= maxAcks {
+		for k, ack := range a.last {
+			if now.Sub(ack.acked) > ackTTL {
+				delete(a.last, k)
+			}
+		}
+		if len(a.last) >= maxAcks {
+			return
+		}
+	}
+	a.last[k] = acknowledgement{id: id, acked: now}
+}
+
+// resume returns the id redelivery should start from, or false if the client
+// has not acknowledged any events on the stream
+func (a *acknowledgements) resume(stream, client string, now time.Time) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ack, ok := a.last[a.key(stream, client)]
+	if !ok || now.Sub(ack.acked) > ackTTL {
+		return "", false
+	}
+	// Replay includes the event matching the id, so start after it
+	return idAfter(ack.id), true
+}
+
+// AckParameter is the query parameter marking POST requests to HTTPHandler as
+// acknowledgements, telling them apart from subscriptions made with POST, see
+// Client.Method
+const AckParameter = "ack"
+
+// AckHandler records the events a client has processed. It accepts POST
+// requests carrying the stream, client and id parameters, either in the query
+// or as a form. When TrackAcks is enabled, a client reconnecting with the same
+// client parameter is sent every event after the last one it acknowledged.
+// HTTPHandler hands it the POST requests carrying AckParameter.
+func (s *Server) AckHandler(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamID := r.FormValue("stream")
+	client := r.FormValue("client")
+	id := r.FormValue("id")
+	if streamID == "" || client == "" || id == "" {
+		http.Error(w, "Please specify a stream, client and id!", http.StatusBadRequest)
+		return
+	}
+
+	if !s.allowed(w, r, streamID) || !s.authorize(w, r, streamID) {
+		return
+	}
+
+	if !s.StreamExists(streamID) {
+		http.Error(w, "Stream not found!", http.StatusNotFound)
+		return
+	}
+
+	s.acks.ack(streamID, client, id, clockOrSystem(s.clock).Now())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Ack acknowledges that an event received from the stream has been processed.
+// It requires ClientID to be set, and is sent to AckURL, or to URL if no
+// separate acknowledgement endpoint is configured.
+func (c *Client) Ack(stream string, id []byte) error {
+	if c.ClientID == "" {
+		return errors.New("acknowledging events requires a client id")
+	}
+
+	target := c.AckURL
+	if target == "" {
+		var err error
+		if target, err = c.endpoint(); err != nil {
+			return err
+		}
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set(AckParameter, "1")
+	u.RawQuery = query.Encode()
+
+	form := url.Values{}
+	form.Set("stream", stream)
+	form.Set("client", c.ClientID)
+	form.Set("id", string(id))
+
+	req, err := http.NewRequest("POST", u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Add user specified headers
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.connection().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("could not acknowledge event: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAcknowledgements(t *testing.T) {
+	Convey("Given a server tracking acknowledgements", t, func() {
+		s := New()
+		s.TrackAcks = true
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/events", s.HTTPHandler)
+		server := httptest.NewServer(mux)
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		s.CreateStream("acks")
+
+		s.Publish("acks", &Event{Data: []byte("test 1")})
+		s.Publish("acks", &Event{Data: []byte("test 2")})
+		s.Publish("acks", &Event{Data: []byte("test 3")})
+		time.Sleep(time.Millisecond * 100)
+
+		c := NewClient(server.URL + "/events")
+		c.ClientID = "worker-1"
+
+		Convey("When acknowledging without a client id", func() {
+			c.ClientID = ""
+
+			Convey("It should return an error", func() {
+				So(c.Ack("acks", []byte("0")), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When acknowledging an event on an unknown stream", func() {
+			Convey("It should return an error", func() {
+				So(c.Ack("unknown", []byte("0")), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When more clients acknowledge events than are kept", func() {
+			for i := 0; i < maxAcks+1; i++ {
+				s.acks.ack("acks", strconv.Itoa(i), "1", time.Now())
+			}
+
+			Convey("Later ones should be dropped", func() {
+				So(s.acks.last, ShouldHaveLength, maxAcks)
+				_, ok := s.acks.resume("acks", strconv.Itoa(maxAcks), time.Now())
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When an event with a generated id is acknowledged", func() {
+			generate := NewULIDGenerator()
+			acked, next := generate("acks", 0), generate("acks", 1)
+			s.acks.ack("acks", "worker-1", acked, time.Now())
+
+			Convey("Replay should start after it", func() {
+				id, ok := s.acks.resume("acks", "worker-1", time.Now())
+				So(ok, ShouldBeTrue)
+				So(compareID(acked, id), ShouldBeLessThan, 0)
+				So(compareID(next, id), ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When an acknowledgement has expired", func() {
+			s.acks.ack("acks", "worker-1", "1", time.Now().Add(-ackTTL-time.Second))
+
+			Convey("It should not be resumed from", func() {
+				_, ok := s.acks.resume("acks", "worker-1", time.Now())
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When a client subscribes with POST", func() {
+			post := NewClient(server.URL + "/events")
+			post.Method = http.MethodPost
+			post.Body = []byte(`{"prompt":"test"}`)
+
+			events := make(chan *Event)
+			_, err := post.SubscribeChan("acks", events)
+			So(err, ShouldBeNil)
+
+			Convey("It should be subscribed rather than taken as an acknowledgement", func() {
+				msg, err := wait(events, time.Millisecond*500)
+				So(err, ShouldBeNil)
+				So(string(msg), ShouldEqual, "test 1")
+			})
+		})
+
+		Convey("When the client reconnects after acknowledging an event", func() {
+			So(c.Ack("acks", []byte("0")), ShouldBeNil)
+
+			events := make(chan *Event)
+			_, err := c.SubscribeChan("acks", events)
+			So(err, ShouldBeNil)
+
+			Convey("It should receive every unacknowledged event", func() {
+				msg, err := wait(events, time.Millisecond*500)
+				So(err, ShouldBeNil)
+				So(string(msg), ShouldEqual, "test 2")
+
+				msg, err = wait(events, time.Millisecond*500)
+				So(err, ShouldBeNil)
+				So(string(msg), ShouldEqual, "test 3")
+			})
+		})
+	})
+}
@@ -0,0 +1,64 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "net/http"
+
+const (
+	// AffinityHeader carries the affinity token of the server a client is
+	// connected to, see Server.AffinityToken
+	AffinityHeader = "X-SSE-Affinity"
+	// AffinityCookie carries the same token as a cookie, which most load
+	// balancers can route on
+	AffinityCookie = "sse-affinity"
+)
+
+// setAffinity issues the server's affinity token with a response
+func (s *Server) setAffinity(w http.ResponseWriter) {
+	if s.AffinityToken == "" {
+		return
+	}
+
+	w.Header().Set(AffinityHeader, s.AffinityToken)
+	http.SetCookie(w, &http.Cookie{
+		Name:     AffinityCookie,
+		Value:    s.AffinityToken,
+		Path:     "/",
+		HttpOnly: true,
+	})
+}
+
+// captureAffinity remembers the affinity token of a response, preferring the
+// header over the cookie
+func (c *Client) captureAffinity(resp *http.Response) {
+	token := resp.Header.Get(AffinityHeader)
+	if token == "" {
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == AffinityCookie {
+				token = cookie.Value
+			}
+		}
+	}
+	if token == "" {
+		return
+	}
+
+	c.mu.Lock()
+	c.affinity = token
+	c.mu.Unlock()
+}
+
+// presentAffinity adds the captured affinity token to a request
+func (c *Client) presentAffinity(req *http.Request) {
+	c.mu.Lock()
+	token := c.affinity
+	c.mu.Unlock()
+
+	if token == "" {
+		return
+	}
+	req.Header.Set(AffinityHeader, token)
+	req.AddCookie(&http.Cookie{Name: AffinityCookie, Value: token})
+}
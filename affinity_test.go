@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAffinity(t *testing.T) {
+	Convey("Given a server issuing affinity tokens", t, func() {
+		srv := New()
+		srv.AffinityToken = "node-1"
+		srv.CreateStream("test")
+
+		var presented []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(AffinityHeader)
+			if cookie, err := r.Cookie(AffinityCookie); err == nil {
+				token += "/" + cookie.Value
+			}
+			presented = append(presented, token)
+			srv.HTTPHandler(w, r)
+		}))
+
+		connect := func(c *Client) {
+			resp, err := c.request(context.Background(), "test", "")
+			So(err, ShouldBeNil)
+			So(resp.Header.Get(AffinityHeader), ShouldEqual, "node-1")
+			resp.Body.Close()
+		}
+
+		Convey("A client with affinity should present the token when reconnecting", func() {
+			c := NewClient(server.URL)
+			c.Affinity = true
+			connect(c)
+			connect(c)
+			So(presented, ShouldResemble, []string{"", "node-1/node-1"})
+		})
+
+		Convey("A client without affinity should ignore the token", func() {
+			c := NewClient(server.URL)
+			connect(c)
+			connect(c)
+			So(presented, ShouldResemble, []string{"", ""})
+		})
+
+		Reset(func() {
+			srv.Close()
+		})
+	})
+}
@@ -0,0 +1,154 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the batches passed to Server.Audit
+const (
+	DefaultAuditBatchSize = 100
+	DefaultAuditInterval  = time.Second
+)
+
+// AuditRecord records that an event was written to a subscriber
+type AuditRecord struct {
+	Stream string
+	// Client parameter the subscriber identified itself with, or its remote
+	// address
+	Subscriber string
+	// Identifies the subscriber within its stream, see Server.Subscribers
+	SubscriberID uint64
+	EventID      string
+	// When the event was written
+	Delivered time.Time
+}
+
+// auditLog collects audit records, passing them on in batches
+type auditLog struct {
+	records chan AuditRecord
+	quit    chan struct{}
+	// Closed once the remaining records have been passed on
+	done     chan struct{}
+	once     sync.Once
+	dropped  *atomic.Uint64
+	handle   func([]AuditRecord)
+	size     int
+	interval time.Duration
+	clock    clock
+}
+
+// auditor returns the server's audit log, starting it if needed
+func (s *Server) auditor() *auditLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.audit == nil {
+		s.audit = &auditLog{
+			records:  make(chan AuditRecord, DefaultBufferSize),
+			quit:     make(chan struct{}),
+			done:     make(chan struct{}),
+			dropped:  &s.auditDropped,
+			handle:   s.Audit,
+			size:     s.AuditBatchSize,
+			interval: s.AuditInterval,
+			clock:    clockOrSystem(s.clock),
+		}
+		if s.audit.size <= 0 {
+			s.audit.size = DefaultAuditBatchSize
+		}
+		if s.audit.interval <= 0 {
+			s.audit.interval = DefaultAuditInterval
+		}
+		s.background(s.audit.run)
+	}
+	return s.audit
+}
+
+// subscriber returns the function recording deliveries to a subscriber
+func (a *auditLog) subscriber(stream string, sub *Subscriber) func(ev *Event) {
+	return func(ev *Event) {
+		if isCommentOnly(ev) {
+			return
+		}
+
+		record := AuditRecord{
+			Stream:       stream,
+			Subscriber:   sub.name,
+			SubscriberID: sub.id,
+			EventID:      string(ev.ID),
+			Delivered:    a.clock.Now(),
+		}
+		// Deliveries do not wait for a log that falls behind, nor are
+		// they recorded after the server has been closed
+		select {
+		case <-a.quit:
+			return
+		default:
+		}
+		select {
+		case a.records <- record:
+		default:
+			a.dropped.Add(1)
+		}
+	}
+}
+
+// AuditDropped returns the number of deliveries that went unrecorded, as
+// Server.Audit fell behind
+func (s *Server) AuditDropped() uint64 {
+	return s.auditDropped.Load()
+}
+
+// run passes records on once a batch is full or the interval has passed, and
+// the remaining records once the log is stopped
+func (a *auditLog) run() {
+	defer close(a.done)
+	ticker := a.clock.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	batch := make([]AuditRecord, 0, a.size)
+	flush := func() {
+		if len(batch) > 0 {
+			a.handle(batch)
+			batch = make([]AuditRecord, 0, a.size)
+		}
+	}
+
+	for {
+		select {
+		case record := <-a.records:
+			batch = append(batch, record)
+			if len(batch) >= a.size {
+				flush()
+			}
+		case <-ticker.C():
+			flush()
+		case <-a.quit:
+			for {
+				select {
+				case record := <-a.records:
+					batch = append(batch, record)
+					if len(batch) >= a.size {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// stop stops the log, which passes on the remaining records
+func (a *auditLog) stop() {
+	a.once.Do(func() {
+		close(a.quit)
+	})
+}
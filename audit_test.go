@@ -0,0 +1,108 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAudit(t *testing.T) {
+	Convey("Given a server auditing deliveries", t, func() {
+		batches := make(chan []AuditRecord, 10)
+		s := New()
+		s.Audit = func(records []AuditRecord) {
+			batches <- records
+		}
+		s.AuditBatchSize = 2
+		s.AuditInterval = time.Hour
+		s.CreateStream("test")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest(http.MethodGet, "/events?stream=test&client=alice", nil)
+		go s.HTTPHandler(httptest.NewRecorder(), r.WithContext(ctx))
+
+		Reset(func() {
+			cancel()
+			s.Close()
+		})
+
+		for s.StreamExists("test") && len(s.Subscribers("test")) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		next := func() []AuditRecord {
+			select {
+			case batch := <-batches:
+				return batch
+			case <-time.After(time.Second):
+				return nil
+			}
+		}
+
+		Convey("Full batches should be passed on", func() {
+			for i := 0; i < 3; i++ {
+				s.Publish("test", &Event{Data: []byte("hello")})
+			}
+
+			batch := next()
+			So(batch, ShouldHaveLength, 2)
+			So(batch[0].Stream, ShouldEqual, "test")
+			So(batch[0].Subscriber, ShouldEqual, "alice")
+			So(batch[0].SubscriberID, ShouldEqual, s.Subscribers("test")[0].ID)
+			So(batch[0].EventID, ShouldEqual, "0")
+			So(batch[0].Delivered, ShouldHappenWithin, time.Second, time.Now())
+			So(batch[1].EventID, ShouldEqual, "1")
+
+			Convey("And the rest once the server is closed", func() {
+				for len(s.Subscribers("test")) > 0 && s.Subscribers("test")[0].LastEventID != "2" {
+					time.Sleep(time.Millisecond)
+				}
+				s.Close()
+
+				select {
+				case batch := <-batches:
+					So(batch, ShouldHaveLength, 1)
+					So(batch[0].EventID, ShouldEqual, "2")
+				default:
+					So("Close returned before the last batch", ShouldBeEmpty)
+				}
+			})
+		})
+	})
+
+	Convey("Given an audit log that has fallen behind", t, func() {
+		s := New()
+		a := &auditLog{
+			records: make(chan AuditRecord, 1),
+			quit:    make(chan struct{}),
+			dropped: &s.auditDropped,
+			clock:   newFakeClock(),
+		}
+		record := a.subscriber("test", &Subscriber{})
+
+		Convey("Deliveries should be counted as dropped rather than wait", func() {
+			done := make(chan struct{})
+			go func() {
+				for i := 0; i < 3; i++ {
+					record(&Event{ID: []byte("1"), Data: []byte("hello")})
+				}
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				So("delivery waited", ShouldBeEmpty)
+			}
+			So(s.AuditDropped(), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,198 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Credentials authenticate a client with HTTP authentication, see
+// Client.Credentials
+type Credentials struct {
+	Username string
+	Password string
+	// Answers the Digest challenges of the server, instead of sending the
+	// password with Basic authentication. The first request is sent without
+	// credentials to receive a challenge, which later requests reuse until
+	// the server marks it stale.
+	Digest bool
+}
+
+// digestChallenge is a Digest challenge received from the server, along with
+// the number of requests it has been answered for
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	count     int
+}
+
+// authorize adds the client's credentials to a request, reporting false if
+// they can not be added before the server has sent a challenge
+func (c *Client) authorize(req *http.Request) bool {
+	creds := c.Credentials
+	if !creds.Digest {
+		req.SetBasicAuth(creds.Username, creds.Password)
+		return true
+	}
+
+	c.mu.Lock()
+	challenge := c.digest
+	if challenge != nil {
+		challenge.count++
+	}
+	var answer string
+	if challenge != nil {
+		answer = challenge.answer(creds, req.Method, req.URL.RequestURI())
+	}
+	c.mu.Unlock()
+
+	if challenge == nil {
+		return false
+	}
+	req.Header.Set("Authorization", answer)
+	return true
+}
+
+// challenged takes the Digest challenge of a 401 Unauthorized response,
+// reporting whether the request should be sent again to answer it. A request
+// already answering a challenge is only sent again if the server marked that
+// challenge stale, as the credentials are wrong otherwise.
+func (c *Client) challenged(resp *http.Response, answered bool) bool {
+	if resp.StatusCode != http.StatusUnauthorized || c.Credentials == nil || !c.Credentials.Digest {
+		return false
+	}
+
+	for _, header := range resp.Header.Values("WWW-Authenticate") {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+
+		params := parseAuthParams(rest)
+		if answered && !strings.EqualFold(params["stale"], "true") {
+			return false
+		}
+
+		c.mu.Lock()
+		c.digest = &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+			qop:       selectQop(params["qop"]),
+		}
+		c.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+// answer returns the Authorization header answering the challenge, following
+// RFC 7616
+func (d *digestChallenge) answer(creds *Credentials, method, uri string) string {
+	algorithm := strings.ToUpper(d.algorithm)
+	h := md5.New
+	if strings.HasPrefix(algorithm, "SHA-256") {
+		h = sha256.New
+	}
+
+	cnonce := newCnonce()
+	nc := fmt.Sprintf("%08x", d.count)
+
+	ha1 := digestHash(h, creds.Username, d.realm, creds.Password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = digestHash(h, ha1, d.nonce, cnonce)
+	}
+	ha2 := digestHash(h, method, uri)
+
+	var response string
+	if d.qop != "" {
+		response = digestHash(h, ha1, d.nonce, nc, cnonce, d.qop, ha2)
+	} else {
+		response = digestHash(h, ha1, d.nonce, ha2)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username=%q, realm=%q, nonce=%q, uri=%q, response=%q`,
+		creds.Username, d.realm, d.nonce, uri, response)
+	if d.algorithm != "" {
+		fmt.Fprintf(&b, ", algorithm=%s", d.algorithm)
+	}
+	if d.opaque != "" {
+		fmt.Fprintf(&b, ", opaque=%q", d.opaque)
+	}
+	if d.qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce=%q`, d.qop, nc, cnonce)
+	}
+	return b.String()
+}
+
+// digestHash returns the hex encoded hash of values joined by colons
+func digestHash(h func() hash.Hash, values ...string) string {
+	sum := h()
+	io.WriteString(sum, strings.Join(values, ":"))
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// newCnonce returns a random client nonce
+func newCnonce() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// selectQop picks auth from the qop options of a challenge, or none if the
+// server does not offer it, such as servers following RFC 2069
+func selectQop(options string) string {
+	for _, qop := range strings.Split(options, ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			return "auth"
+		}
+	}
+	return ""
+}
+
+// parseAuthParams parses the comma separated name=value parameters of a
+// challenge, whose values may be quoted
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value, s = b.String(), rest[min(i+1, len(rest)):]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[name] = value
+	}
+}
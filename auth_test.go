@@ -0,0 +1,137 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// digestServer accepts requests answering its current challenge, issuing a
+// new nonce after every accepted request, so the previous one becomes stale
+type digestServer struct {
+	mu       sync.Mutex
+	nonce    int
+	requests int
+	// X-Attempt headers of the requests
+	attempts []string
+}
+
+func (d *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests++
+	d.attempts = append(d.attempts, r.Header.Get("X-Attempt"))
+
+	nonce := fmt.Sprintf("nonce%d", d.nonce)
+	auth := r.Header.Get("Authorization")
+	stale := false
+	if strings.HasPrefix(auth, "Digest ") {
+		p := parseAuthParams(strings.TrimPrefix(auth, "Digest "))
+		ha1 := digestHash(md5.New, "alice", "sse", "secret")
+		ha2 := digestHash(md5.New, r.Method, p["uri"])
+		expected := digestHash(md5.New, ha1, p["nonce"], p["nc"], p["cnonce"], "auth", ha2)
+		if p["response"] == expected && p["opaque"] == "opaque" {
+			if p["nonce"] == nonce {
+				d.nonce++
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			stale = true
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="sse"`)
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="sse", qop="auth,auth-int", nonce=%q, opaque="opaque", stale=%t`, nonce, stale))
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func TestCredentials(t *testing.T) {
+	Convey("Digest answers should match RFC 2617", t, func() {
+		ha1 := digestHash(md5.New, "Mufasa", "testrealm@host.com", "Circle Of Life")
+		ha2 := digestHash(md5.New, "GET", "/dir/index.html")
+		response := digestHash(md5.New, ha1, "dcd98b7102dd2f0e8b11d0f600bfb0c093", "00000001", "0a4f113b", "auth", ha2)
+		So(response, ShouldEqual, "6629fae49393a05397450978507c4ef1")
+	})
+
+	Convey("Challenge parameters should be parsed", t, func() {
+		params := parseAuthParams(`realm="a, \"b\"", qop="auth,auth-int", algorithm=MD5, stale=TRUE`)
+		So(params["realm"], ShouldEqual, `a, "b"`)
+		So(params["qop"], ShouldEqual, "auth,auth-int")
+		So(params["algorithm"], ShouldEqual, "MD5")
+		So(params["stale"], ShouldEqual, "TRUE")
+	})
+
+	Convey("Given a client with Basic credentials", t, func() {
+		var user, pass string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, _ = r.BasicAuth()
+		}))
+		defer server.Close()
+
+		c := NewClient(server.URL)
+		c.Credentials = &Credentials{Username: "alice", Password: "secret"}
+
+		Convey("They should be sent with every request", func() {
+			resp, err := c.request(context.Background(), "test", "")
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(user, ShouldEqual, "alice")
+			So(pass, ShouldEqual, "secret")
+		})
+	})
+
+	Convey("Given a server requiring Digest authentication", t, func() {
+		digest := &digestServer{}
+		server := httptest.NewServer(digest)
+		defer server.Close()
+
+		c := NewClient(server.URL)
+		c.Credentials = &Credentials{Username: "alice", Password: "secret", Digest: true}
+
+		get := func() int {
+			resp, err := c.request(context.Background(), "test", "")
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		Convey("The client should answer its challenge", func() {
+			So(get(), ShouldEqual, http.StatusOK)
+			So(digest.requests, ShouldEqual, 2)
+
+			Convey("And a new one once the previous is stale", func() {
+				So(get(), ShouldEqual, http.StatusOK)
+				So(digest.requests, ShouldEqual, 4)
+			})
+		})
+
+		Convey("The answer should be modified like the first request", func() {
+			modified := 0
+			c.RequestModifier = func(req *http.Request) error {
+				modified++
+				req.Header.Set("X-Attempt", strconv.Itoa(modified))
+				return nil
+			}
+			So(get(), ShouldEqual, http.StatusOK)
+			So(digest.attempts, ShouldResemble, []string{"1", "2"})
+		})
+
+		Convey("Wrong credentials should not be retried", func() {
+			c.Credentials.Password = "wrong"
+			So(get(), ShouldEqual, http.StatusUnauthorized)
+			So(digest.requests, ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,51 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// backfill fetches the events between the position a subscriber resumes from
+// and the first event in the eventlog, if the eventlog no longer reaches back
+// that far. It returns the position replay continues from along with the
+// events, which are processed like published ones. Failures are reported and
+// leave the gap as it is.
+func (s *Server) backfill(r *http.Request, streamID string, str *Stream, eventid string) (string, []*Event) {
+	oldest := str.oldest.Load()
+	if oldest == nil || compareID(eventid, string(oldest.ID)) >= 0 {
+		return eventid, nil
+	}
+	until := string(oldest.ID)
+
+	events, err := s.Backfill(r.Context(), streamID, eventid, until)
+	if err != nil {
+		s.reportError(r, fmt.Errorf("failed to backfill stream %s: %s", streamID, err))
+		return eventid, nil
+	}
+
+	backlog := make([]*Event, 0, len(events))
+	for _, event := range events {
+		processed := s.process(event)
+		if err := s.seal(streamID, processed); err != nil {
+			s.reportError(r, err)
+			continue
+		}
+		backlog = append(backlog, processed)
+	}
+	return until, backlog
+}
+
+// popBacklog returns the next backfilled event, or nil if there is none
+func (s *Subscriber) popBacklog() *Event {
+	if len(s.backlog) == 0 {
+		return nil
+	}
+	ev := s.backlog[0]
+	s.backlog[0] = nil
+	s.backlog = s.backlog[1:]
+	return ev
+}
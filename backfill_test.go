@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackfill(t *testing.T) {
+	Convey("Given a stream whose eventlog has dropped its first events", t, func() {
+		s := New()
+		s.ReplaySize = 2
+		str := s.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		for i := 0; i < 5; i++ {
+			s.Publish("test", &Event{Data: []byte(strconv.Itoa(i))})
+		}
+		for str.Sequence() < 5 {
+			str.SubscriberCount()
+		}
+		str.SubscriberCount()
+
+		var calls [][2]string
+		s.Backfill = func(ctx context.Context, stream, from, until string) ([]*Event, error) {
+			calls = append(calls, [2]string{from, until})
+			first, _ := strconv.Atoi(from)
+			last, _ := strconv.Atoi(until)
+			var events []*Event
+			for i := first; i < last; i++ {
+				id := []byte(strconv.Itoa(i))
+				events = append(events, &Event{ID: id, Data: id})
+			}
+			return events, nil
+		}
+
+		Reset(func() {
+			s.Close()
+			server.Close()
+		})
+
+		receive := func(c *Client, n int) []string {
+			events := make(chan *Event, 10)
+			go c.Subscribe("test", func(msg *Event) {
+				events <- msg
+			})
+
+			var data []string
+			for i := 0; i < n; i++ {
+				msg, err := wait(events, time.Second)
+				if err != nil {
+					break
+				}
+				data = append(data, string(msg))
+			}
+			return data
+		}
+
+		Convey("A client resuming before the eventlog should be backfilled", func() {
+			c := NewClient(server.URL)
+			c.EventID = "1"
+			So(receive(c, 4), ShouldResemble, []string{"1", "2", "3", "4"})
+			So(calls, ShouldResemble, [][2]string{{"1", "3"}})
+		})
+
+		Convey("A client resuming within the eventlog should not be backfilled", func() {
+			c := NewClient(server.URL)
+			c.EventID = "4"
+			So(receive(c, 1), ShouldResemble, []string{"4"})
+			So(calls, ShouldBeEmpty)
+		})
+
+		Convey("A new client should not be backfilled", func() {
+			So(receive(NewClient(server.URL), 2), ShouldResemble, []string{"3", "4"})
+			So(calls, ShouldBeEmpty)
+		})
+
+		Convey("A failing backfill should leave the gap", func() {
+			s.Backfill = func(ctx context.Context, stream, from, until string) ([]*Event, error) {
+				return nil, errors.New("database unavailable")
+			}
+			c := NewClient(server.URL)
+			c.EventID = "1"
+			So(receive(c, 2), ShouldResemble, []string{"3", "4"})
+		})
+	})
+}
@@ -0,0 +1,147 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultSubscriberBuffer is the number of events queued for each subscriber
+// of streams without a SubscriberBuffer
+const DefaultSubscriberBuffer = 64
+
+// ErrSlowSubscriber is reported to the instrumentation and debug log of a
+// subscriber for events dropped by its stream's Backpressure
+var ErrSlowSubscriber = errors.New("subscriber too slow")
+
+// Backpressure decides what a stream does with events for a subscriber whose
+// queue is full, as it is not reading them as fast as they are published
+type Backpressure int
+
+const (
+	// BackpressureBlock waits for room in the queue, which holds up every
+	// subscriber of the stream and eventually Publish until the slow one
+	// catches up
+	BackpressureBlock Backpressure = iota
+	// BackpressureDropOldest drops the oldest event queued for the
+	// subscriber to make room for the new one. Replay markers, control
+	// events and history queued for paginated replay are not dropped, and
+	// the new event is if nothing else can be.
+	BackpressureDropOldest
+	// BackpressureDropNewest drops the new event
+	BackpressureDropNewest
+	// BackpressureDisconnect drops the subscriber, whose client can then
+	// reconnect and catch up through replay
+	BackpressureDisconnect
+)
+
+// subscriberBuffer returns the size of the queue of each subscriber
+func (str *Stream) subscriberBuffer() int {
+	if str.SubscriberBuffer > 0 {
+		return str.SubscriberBuffer
+	}
+	return DefaultSubscriberBuffer
+}
+
+// deliver queues an event for every subscriber, removing those disconnected
+// by the Backpressure policy
+func (str *Stream) deliver(event *Event) {
+	var slow []*Subscriber
+	for _, sub := range str.subscribers {
+		if !str.push(sub, event) {
+			slow = append(slow, sub)
+		}
+	}
+	str.disconnect(slow)
+}
+
+// disconnect removes the subscribers dropped by the Backpressure policy
+func (str *Stream) disconnect(slow []*Subscriber) {
+	for _, sub := range slow {
+		if i := str.getSubIndex(sub); i != -1 {
+			str.removeSubscriber(i)
+		}
+	}
+}
+
+// push queues an event for a subscriber, reporting false if the subscriber is
+// to be disconnected
+func (str *Stream) push(sub *Subscriber, event *Event) bool {
+	if !sub.wants(event) || !str.admit(sub, event) {
+		return true
+	}
+	return str.send(sub, sub.connection, event)
+}
+
+// send queues an event in one of a subscriber's queues according to the
+// Backpressure policy, reporting false if the subscriber is to be disconnected
+func (str *Stream) send(sub *Subscriber, queue chan *Event, event *Event) bool {
+	if str.Backpressure == BackpressureBlock {
+		queue <- event
+		sub.notify()
+		return true
+	}
+
+	for {
+		select {
+		case queue <- event:
+			sub.notify()
+			return true
+		default:
+		}
+
+		switch str.Backpressure {
+		case BackpressureDropNewest:
+			str.dropped(sub, event)
+			return true
+		case BackpressureDisconnect:
+			str.dropped(sub, event)
+			return false
+		}
+
+		// Make room, unless the subscriber just did
+		if !str.dropOldest(sub, queue) {
+			str.dropped(sub, event)
+			return true
+		}
+	}
+}
+
+// dropOldest drops the oldest event in a subscriber's queue that the stream
+// did not queue itself, keeping the others in order. It reports false if
+// every queued event is to be kept.
+func (str *Stream) dropOldest(sub *Subscriber, queue chan *Event) bool {
+	queued := make([]*Event, 0, len(queue))
+drain:
+	for {
+		select {
+		case ev := <-queue:
+			queued = append(queued, ev)
+		default:
+			break drain
+		}
+	}
+
+	// Only the stream queues events, so they all fit back in
+	dropped := false
+	for _, ev := range queued {
+		if !dropped && !ev.kept {
+			dropped = true
+			str.dropped(sub, ev)
+			continue
+		}
+		queue <- ev
+	}
+	return dropped || len(queued) == 0
+}
+
+// dropped reports an event a subscriber missed
+func (str *Stream) dropped(sub *Subscriber, event *Event) {
+	sub.delivered(event, time.Time{}, ErrSlowSubscriber)
+	if str.OnDrop != nil {
+		str.OnDrop(str.id, sub, event)
+	}
+}
@@ -0,0 +1,118 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackpressure(t *testing.T) {
+	Convey("Given a stream with a subscriber that does not read", t, func() {
+		s := New()
+		s.SubscriberBuffer = 2
+		drops := make(chan string, 10)
+		s.OnDrop = func(stream string, sub *Subscriber, event *Event) {
+			drops <- stream + ":" + string(event.Data)
+		}
+
+		Reset(func() {
+			s.Close()
+		})
+
+		publish := func(str *Stream, n int) *Subscriber {
+			sub := str.addSubscriber("0")
+			for i := 0; i < n; i++ {
+				s.Publish(str.id, &Event{Data: []byte(strconv.Itoa(i))})
+			}
+			return sub
+		}
+		dropped := func(n int) []string {
+			var events []string
+			for i := 0; i < n; i++ {
+				select {
+				case ev := <-drops:
+					events = append(events, ev)
+				case <-time.After(time.Second):
+					return events
+				}
+			}
+			return events
+		}
+		data := func(sub *Subscriber) string {
+			return string((<-sub.connection).Data)
+		}
+
+		Convey("Subscribers should have a queue of the configured size", func() {
+			So(cap(s.CreateStream("test").addSubscriber("0").connection), ShouldEqual, 2)
+		})
+
+		Convey("Subscribers should have a queue of the default size otherwise", func() {
+			s.SubscriberBuffer = 0
+			So(cap(s.CreateStream("test").addSubscriber("0").connection), ShouldEqual, DefaultSubscriberBuffer)
+		})
+
+		Convey("When dropping the newest events", func() {
+			s.Backpressure = BackpressureDropNewest
+			sub := publish(s.CreateStream("test"), 4)
+
+			Convey("The events published once the queue was full should be dropped", func() {
+				So(dropped(2), ShouldResemble, []string{"test:2", "test:3"})
+				So(data(sub), ShouldEqual, "0")
+				So(data(sub), ShouldEqual, "1")
+			})
+		})
+
+		Convey("When dropping the oldest events", func() {
+			s.Backpressure = BackpressureDropOldest
+			sub := publish(s.CreateStream("test"), 4)
+
+			Convey("The queued events should make room for new ones", func() {
+				So(dropped(2), ShouldResemble, []string{"test:0", "test:1"})
+				So(data(sub), ShouldEqual, "2")
+				So(data(sub), ShouldEqual, "3")
+			})
+		})
+
+		Convey("When dropping the oldest events behind replay markers", func() {
+			s.Backpressure = BackpressureDropOldest
+			s.SubscriberBuffer = 3
+			s.ReplayMarkers = true
+			sub := publish(s.CreateStream("test"), 3)
+
+			Convey("The markers should be kept", func() {
+				So(dropped(2), ShouldResemble, []string{"test:0", "test:1"})
+				So(string((<-sub.connection).Event), ShouldEqual, ReplayStartEvent)
+				So(string((<-sub.connection).Event), ShouldEqual, ReplayEndEvent)
+				So(data(sub), ShouldEqual, "2")
+			})
+		})
+
+		Convey("When disconnecting slow subscribers", func() {
+			s.Backpressure = BackpressureDisconnect
+			str := s.CreateStream("test")
+			sub := publish(str, 3)
+
+			Convey("The subscriber should be removed after its queued events", func() {
+				So(dropped(1), ShouldResemble, []string{"test:2"})
+				So(data(sub), ShouldEqual, "0")
+				So(data(sub), ShouldEqual, "1")
+				_, open := <-sub.connection
+				So(open, ShouldBeFalse)
+				So(str.SubscriberCount(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("Templates should set the policy of their streams", func() {
+			s.DefineTemplate("lossy", StreamTemplate{AutoReplay: true, Backpressure: BackpressureDropNewest})
+			str, err := s.CreateStreamFrom("lossy", "test")
+			So(err, ShouldBeNil)
+			So(str.Backpressure, ShouldEqual, BackpressureDropNewest)
+		})
+	})
+}
@@ -0,0 +1,54 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "errors"
+
+// errQueueFull is returned by enqueue for events not queued without waiting
+var errQueueFull = errors.New("stream queue is full")
+
+// TryPublish sends an event to every client of a stream like Publish, but
+// never waits: it reports false without publishing the event if the stream's
+// queue is full, the event is over the limit of its Limiter, the stream does
+// not exist or the server has been closed. Events held back by LimitCoalesce
+// count as published. Publishing through a Broker may wait on the broker, so
+// servers with one always report false and have to use Publish.
+func (s *Server) TryPublish(id string, event *Event) bool {
+	if s.isClosed() || s.Broker != nil {
+		return false
+	}
+
+	str := s.getStream(id)
+	limited := str != nil && str.Limiter != nil
+	if limited && str.LimitPolicy != LimitCoalesce && !str.Limiter.Allow() {
+		return false
+	}
+	s.observePublish(id, event)
+
+	if limited && str.LimitPolicy == LimitCoalesce && !str.coalesce(event, func(ev *Event) { s.publish(id, ev) }) {
+		return true
+	}
+	return s.enqueue(id, event, false) == nil
+}
+
+// PublishBatch sends several events to every client of a stream like Publish,
+// in order. Subscribers that are sent the events in one go have them flushed
+// once, rather than after each event.
+func (s *Server) PublishBatch(id string, events []*Event) error {
+	for i, event := range events {
+		batched := *event
+		batched.batched = i < len(events)-1
+		if err := s.Publish(id, &batched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waiting reports whether an event is waiting to be written to the subscriber
+// right away
+func (s *Subscriber) waiting() bool {
+	return s.pages == nil && (len(s.connection) > 0 || len(s.urgent) > 0 || len(s.backlog) > 0)
+}
@@ -0,0 +1,149 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// gatedWriter holds back writes until its gate is closed, counting flushes
+type gatedWriter struct {
+	header  http.Header
+	gate    chan struct{}
+	mu      sync.Mutex
+	body    bytes.Buffer
+	flushes int
+}
+
+func (w *gatedWriter) Header() http.Header { return w.header }
+func (w *gatedWriter) WriteHeader(int)     {}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.Write(p)
+}
+
+func (w *gatedWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushes++
+}
+
+func (w *gatedWriter) state() (string, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.String(), w.flushes
+}
+
+func TestTryPublish(t *testing.T) {
+	Convey("Given a stream whose subscriber does not read", t, func() {
+		s := New()
+		s.BufferSize = 1
+		str := s.CreateStream("test")
+		str.SubscriberBuffer = 1
+		sub := str.addSubscriber("0")
+
+		Reset(func() {
+			go func() {
+				for range sub.connection {
+				}
+			}()
+			s.Close()
+		})
+
+		Convey("Events should be published until the queue is full", func() {
+			published := 0
+			for published < 10 && s.TryPublish("test", &Event{Data: []byte("msg")}) {
+				published++
+			}
+			So(published, ShouldBeGreaterThan, 0)
+			So(published, ShouldBeLessThan, 10)
+		})
+
+		Convey("Events for unknown streams should not be published", func() {
+			So(s.TryPublish("other", &Event{Data: []byte("msg")}), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a server with a broker", t, func() {
+		s := NewServerWithBroker(NewMemoryBroker())
+		s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("Events should not be published without waiting", func() {
+			So(s.TryPublish("test", &Event{Data: []byte("msg")}), ShouldBeFalse)
+		})
+	})
+}
+
+func TestPublishBatch(t *testing.T) {
+	Convey("Given a subscriber over HTTP", t, func() {
+		s := New()
+		s.CreateStream("test")
+		subs := make(chan *Subscriber, 1)
+		s.OnSubscribe = func(stream string, sub *Subscriber) {
+			subs <- sub
+		}
+
+		w := &gatedWriter{header: make(http.Header), gate: make(chan struct{})}
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest(http.MethodGet, "/events?stream=test", nil).WithContext(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.HTTPHandler(w, r)
+		}()
+		sub := <-subs
+
+		Reset(func() {
+			cancel()
+			<-done
+			s.Close()
+		})
+
+		Convey("A batch should be flushed once", func() {
+			var events []*Event
+			for _, data := range []string{"a", "b", "c", "d"} {
+				events = append(events, &Event{Data: []byte(data)})
+			}
+			So(s.PublishBatch("test", events), ShouldBeNil)
+			for _, ev := range events {
+				So(ev.batched, ShouldBeFalse)
+			}
+
+			// The first event is held in the writer while the rest queue up
+			for len(sub.connection) < 3 {
+				time.Sleep(time.Millisecond)
+			}
+			close(w.gate)
+
+			var body string
+			var flushes int
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+				if body, flushes = w.state(); strings.Contains(body, "data: d") && flushes > 1 {
+					break
+				}
+			}
+			So(body, ShouldContainSubstring, "data: a")
+			So(body, ShouldContainSubstring, "data: d")
+			// Once for the headers and once for the batch
+			So(flushes, ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,146 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"sync"
+	"time"
+)
+
+// Broker carries published events to the servers holding a stream, so that
+// several servers can serve the same streams, such as through a message
+// broker like Redis Streams or NATS JetStream. Servers without a broker
+// deliver published events to their own streams directly. To keep the
+// ordering guarantee of Server.Publish, brokers have to deliver the events of
+// a stream to every server in the same order.
+type Broker interface {
+	// Publish delivers an event to every subscriber of a stream, including
+	// the publishing server itself
+	Publish(stream string, event *Event) error
+	// Subscribe calls deliver with every event published to a stream, until
+	// the returned function is called. Implementations are expected to
+	// recover from failures of the underlying broker on their own.
+	Subscribe(stream string, deliver func(event *Event)) (unsubscribe func())
+}
+
+// NewServerWithBroker creates a server whose published events are carried by
+// a broker, so they reach the subscribers of every server sharing it
+func NewServerWithBroker(broker Broker) *Server {
+	s := New()
+	s.Broker = broker
+	return s
+}
+
+// MemoryBroker is a Broker connecting servers within a single process
+type MemoryBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*memorySubscriber]struct{}
+	// Serializes publications, so every server receives the events of a
+	// stream in the same order
+	order sync.Mutex
+}
+
+type memorySubscriber struct {
+	deliver func(event *Event)
+}
+
+// NewMemoryBroker creates a broker without subscribers
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: make(map[string]map[*memorySubscriber]struct{}),
+	}
+}
+
+// Publish passes a copy of the event to every subscriber of the stream
+func (b *MemoryBroker) Publish(stream string, event *Event) error {
+	b.order.Lock()
+	defer b.order.Unlock()
+
+	b.mu.Lock()
+	subscribers := make([]*memorySubscriber, 0, len(b.subscribers[stream]))
+	for sub := range b.subscribers[stream] {
+		subscribers = append(subscribers, sub)
+	}
+	b.mu.Unlock()
+
+	// Servers number and encode the events they are given, so each gets
+	// one of its own
+	for _, sub := range subscribers {
+		sub.deliver(event.Clone())
+	}
+	return nil
+}
+
+// Subscribe registers deliver for the events published to a stream
+func (b *MemoryBroker) Subscribe(stream string, deliver func(event *Event)) func() {
+	sub := &memorySubscriber{deliver: deliver}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[stream] == nil {
+		b.subscribers[stream] = make(map[*memorySubscriber]struct{})
+	}
+	b.subscribers[stream][sub] = struct{}{}
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers[stream], sub)
+		if len(b.subscribers[stream]) == 0 {
+			delete(b.subscribers, stream)
+		}
+	}
+}
+
+// startStream runs a new stream and registers it, claiming it in the server's
+// registry and subscribing it to the server's broker if there are any. The
+// server lock must be held.
+func (s *Server) startStream(id string, str *Stream) {
+	str.expire = func() {
+		s.removeIdle(id, str)
+	}
+	str.report = func(err error) {
+		s.reportError(nil, err)
+	}
+	if s.Keys != nil {
+		str.seal = func(event *Event) error {
+			return s.seal(id, event)
+		}
+	}
+	str.id = id
+	str.background = s.background
+	str.run()
+	s.Streams[id] = str
+
+	if s.Registry != nil {
+		s.background(func() {
+			s.claim(id, str)
+		})
+	}
+
+	if s.Broker == nil {
+		return
+	}
+
+	unsubscribe := s.Broker.Subscribe(id, func(event *Event) {
+		if s.unwatched(id, str, event) {
+			return
+		}
+		// Events published by other servers are queued from here on
+		if s.Instrumentation != nil && event.queued.IsZero() {
+			event.queued = time.Now()
+		}
+		select {
+		case str.queue(event) <- s.process(event):
+		case <-str.done:
+		}
+	})
+	s.background(func() {
+		<-str.done
+		unsubscribe()
+	})
+}
@@ -0,0 +1,120 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type failingBroker struct{}
+
+func (failingBroker) Publish(stream string, event *Event) error {
+	return errors.New("broker unavailable")
+}
+
+func (failingBroker) Subscribe(stream string, deliver func(event *Event)) func() {
+	return func() {}
+}
+
+func TestBrokerFailure(t *testing.T) {
+	Convey("Given a server whose broker fails to publish", t, func() {
+		var reported error
+		s := NewServerWithBroker(failingBroker{})
+		s.OnError = func(r *http.Request, err error) {
+			reported = err
+		}
+		s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("The failure should be reported", func() {
+			err := s.Publish("test", &Event{Data: []byte("hello")})
+			So(err, ShouldNotBeNil)
+			So(reported, ShouldEqual, err)
+			So(reported.Error(), ShouldContainSubstring, "broker unavailable")
+		})
+	})
+}
+
+func TestMemoryBroker(t *testing.T) {
+	Convey("Given two servers sharing a broker", t, func() {
+		broker := NewMemoryBroker()
+
+		first, second := New(), New()
+		first.Broker, second.Broker = broker, broker
+		first.CreateStream("test")
+		second.CreateStream("test")
+
+		receive := func(sub *Subscriber) *Event {
+			select {
+			case ev := <-sub.connection:
+				return ev
+			case <-time.After(time.Second):
+				return nil
+			}
+		}
+
+		Convey("Events published on either should reach the subscribers of both", func() {
+			a := first.getStream("test").addSubscriber("0")
+			b := second.getStream("test").addSubscriber("0")
+
+			second.Publish("test", &Event{Data: []byte("hello")})
+
+			for _, sub := range []*Subscriber{a, b} {
+				ev := receive(sub)
+				So(ev, ShouldNotBeNil)
+				So(string(ev.Data), ShouldEqual, "hello")
+				So(string(ev.ID), ShouldEqual, "0")
+			}
+		})
+
+		Convey("Concurrent publications should reach both servers in the same order", func() {
+			a := first.getStream("test").addSubscriber("0")
+			b := second.getStream("test").addSubscriber("0")
+
+			const events = 100
+			for _, s := range []*Server{first, second} {
+				go func(s *Server) {
+					for i := 0; i < events; i++ {
+						s.Publish("test", &Event{Data: []byte(strconv.Itoa(i))})
+					}
+				}(s)
+			}
+
+			received := collect([]*Subscriber{a, b}, 2*events)
+			for i := range received[0] {
+				So(string(received[1][i].ID), ShouldEqual, string(received[0][i].ID))
+				So(string(received[1][i].Data), ShouldEqual, string(received[0][i].Data))
+			}
+		})
+
+		Convey("Removed streams should no longer be subscribed", func() {
+			subscribed := func() int {
+				broker.mu.Lock()
+				defer broker.mu.Unlock()
+				return len(broker.subscribers["test"])
+			}
+
+			first.RemoveStream("test")
+			for i := 0; i < 100 && subscribed() > 1; i++ {
+				time.Sleep(time.Millisecond * 10)
+			}
+			So(subscribed(), ShouldEqual, 1)
+		})
+
+		Reset(func() {
+			first.Close()
+			second.Close()
+		})
+	})
+}
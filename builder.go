@@ -0,0 +1,96 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// EventBuilder assembles an Event field by field. The first mistake, such as a
+// line break in the id or name, is reported by Build.
+type EventBuilder struct {
+	event Event
+	err   error
+}
+
+// NewEvent starts building an event
+func NewEvent() *EventBuilder {
+	return &EventBuilder{}
+}
+
+// ID sets the event's id. Clients ignore ids containing NUL, so they are
+// rejected.
+func (b *EventBuilder) ID(id string) *EventBuilder {
+	if bytes.IndexByte([]byte(id), 0) >= 0 {
+		b.fail(errors.New("event id contains NUL"))
+		return b
+	}
+	b.event.ID = []byte(id)
+	return b
+}
+
+// Name sets the event's type
+func (b *EventBuilder) Name(name string) *EventBuilder {
+	b.event.Event = []byte(name)
+	return b
+}
+
+// Data sets the event's payload. Line breaks are allowed, each line is sent
+// as a separate data field.
+func (b *EventBuilder) Data(data []byte) *EventBuilder {
+	b.event.Data = data
+	return b
+}
+
+// DataJSON sets the event's payload to the JSON encoding of v
+func (b *EventBuilder) DataJSON(v interface{}) *EventBuilder {
+	data, err := json.Marshal(v)
+	if err != nil {
+		b.fail(err)
+		return b
+	}
+	b.event.Data = data
+	return b
+}
+
+// Retry sets the reconnection time clients should use, with millisecond
+// precision
+func (b *EventBuilder) Retry(retry time.Duration) *EventBuilder {
+	if retry < 0 {
+		b.fail(errors.New("event retry is negative"))
+		return b
+	}
+	b.event.Retry = []byte(strconv.FormatInt(int64(retry/time.Millisecond), 10))
+	return b
+}
+
+// Comment sets a comment sent along with the event
+func (b *EventBuilder) Comment(comment string) *EventBuilder {
+	b.event.Comment = []byte(comment)
+	return b
+}
+
+// Build returns the event, or the first error encountered while building it
+func (b *EventBuilder) Build() (*Event, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if err := validateEvent(&b.event); err != nil {
+		return nil, err
+	}
+
+	e := b.event
+	return &e, nil
+}
+
+func (b *EventBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
@@ -0,0 +1,63 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventBuilder(t *testing.T) {
+	Convey("Given an event builder", t, func() {
+		Convey("When every field is valid", func() {
+			ev, err := NewEvent().ID("1").Name("update").Data([]byte("a\nb")).Retry(2 * time.Second).Build()
+
+			Convey("It should build the event", func() {
+				So(err, ShouldBeNil)
+				So(ev.Equal(&Event{
+					ID:    []byte("1"),
+					Event: []byte("update"),
+					Data:  []byte("a\nb"),
+					Retry: []byte("2000"),
+				}), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the payload is set from a value", func() {
+			ev, err := NewEvent().DataJSON(map[string]int{"count": 3}).Build()
+
+			Convey("It should be encoded as JSON", func() {
+				So(err, ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, `{"count":3}`)
+			})
+		})
+
+		Convey("When the value can not be encoded as JSON", func() {
+			_, err := NewEvent().DataJSON(make(chan int)).Build()
+
+			Convey("It should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the name contains a line break", func() {
+			_, err := NewEvent().Name("up\ndate").Build()
+
+			Convey("It should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the id contains NUL", func() {
+			_, err := NewEvent().ID("1\x00").Build()
+
+			Convey("It should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
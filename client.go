@@ -6,35 +6,202 @@ package sse
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
-	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
 	"gopkg.in/cenkalti/backoff.v1"
 )
 
-var (
-	headerID    = []byte("id:")
-	headerData  = []byte("data:")
-	headerEvent = []byte("event:")
-	headerRetry = []byte("retry:")
-)
+// ErrDeadlineExceeded is returned by subscriptions that ran for longer than
+// Client.MaxDuration
+var ErrDeadlineExceeded = errors.New("subscription deadline exceeded")
 
 // Client handles an incoming server stream
 type Client struct {
 	URL            string
 	Connection     *http.Client
 	Retry          time.Time
-	subscribed     map[chan *Event]chan bool
+	subscribed     map[chan *Event]*chanSubscription
 	Headers        map[string]string
 	EncodingBase64 bool
-	EventID        string
-	mu             sync.Mutex
-	withRetry      bool
+	// Decompresses the data of events with gzip, after decoding it from
+	// base64 if enabled, see Server.CompressData
+	DecompressData bool
+	// Decrypts the data of events, after decoding it from base64 if enabled
+	// and before decompressing it, see Server.Keys. Events only decrypt on
+	// the stream they were published to, which has to be subscribed to by
+	// name.
+	Keys KeyProvider
+	// Verifies the signature of every event, see Server.SigningKeys. Events
+	// without a valid signature are dropped and reported to OnError as
+	// ErrInvalidSignature. SubscribeReader can only check the signature once
+	// the data has been read, so Read returns ErrInvalidSignature instead of
+	// io.EOF. The signature is kept in the event's Fields.
+	SigningKeys KeyProvider
+	EventID     string
+	// Decides whether a failed subscription is retried, given the error and
+	// the response, if one was received, whose body has been closed. By
+	// default every failure is retried until the backoff policy gives up.
+	ShouldReconnect func(err error, resp *http.Response) bool
+	// Creates the policy of waiting between attempts to reconnect, called
+	// once for every subscription, such as to cap the number of attempts
+	// with backoff.WithMaxTries. Nil backs off exponentially, starting from
+	// the retry interval sent by the server, while other strategies wait
+	// exactly that interval before the first attempt after receiving it.
+	ReconnectStrategy func() backoff.BackOff
+	// Ends connections on which nothing, keep-alive comments included, has
+	// been received for this long with ErrReadTimeout, after which the
+	// client reconnects as usual. Only time spent waiting for data counts,
+	// not time spent in handlers. It should be a few times the server's
+	// keep-alive interval. Zero waits indefinitely.
+	ReadTimeout time.Duration
+	// Bounds the total time Subscribe and SubscribeReader run for, including
+	// reconnects, after which they return ErrDeadlineExceeded. Zero means
+	// no limit.
+	MaxDuration time.Duration
+	// Serves SubscribeChan calls for the same stream of URL from a single
+	// connection, whose events are sent to every channel in turn. The
+	// connection is closed once every channel has been unsubscribed.
+	ShareConnections bool
+	// Selects what SubscribeChan does with events arriving while the
+	// channel is full, see ChanStats for how often that happens
+	ChanOverflow ChanOverflow
+	// Tunes the sockets of connections made through Connection's transport,
+	// which has to be an *http.Transport, or nil for the default one
+	TCP *TCPOptions
+	// Name of the DNS SRV records the host of URL is resolved from, such as
+	// "_events._tcp.example.com". The records are resolved again before
+	// every connection attempt, honoring their priorities and weights.
+	SRVName string
+	// Checks the events with each name before they are handled, such as
+	// against the schema of their payload. Events without a name are checked
+	// by the validator registered for "message". Events failing validation
+	// are reported to OnError as a *ValidationError instead of being handled.
+	Validators map[string]func(ev *Event) error
+	// Maps the names of control events to the action taken on receiving
+	// them, such as DefaultControlEvents. Control events are not passed to
+	// handlers. If nil, no events are treated as control events.
+	ControlEvents map[string]ControlAction
+	// Called with every control event before acting on it
+	OnControl func(ev *Event)
+	// Spools events to disk while Subscribe handlers run, replaying the ones
+	// that were not handled, such as after a crash, before subscribing
+	Journal *Journal
+	// Keeps the id of the last event handled on each stream, which
+	// subscriptions resume from, so a restarted client continues where it
+	// left off. Ids are saved once Subscribe handlers return, or once events
+	// are passed to SubscribeChan channels.
+	EventIDStore EventIDStore
+	// Captures the affinity token servers issue with their responses and
+	// presents it when reconnecting, so load balancers can route the client
+	// back to the node holding its replay state, see Server.AffinityToken
+	Affinity bool
+	// Authenticates the client with HTTP Basic or Digest authentication.
+	// Digest challenges are answered anew for every connection attempt.
+	Credentials *Credentials
+	// Accept header of subscription requests, ContentTypeEventStream if
+	// empty. Once set, responses of other types are rejected with
+	// ErrUnacceptableContentType, and servers may pick any framing it lists,
+	// such as ContentTypeNDJSON, which is decoded accordingly.
+	Accept string
+	// Called whenever a subscription connects, with the framing the server
+	// sends events in
+	OnConnect func(c *Client, framing Framing)
+	// Called whenever the connection of a subscription ends, with the error
+	// that ended it, or nil if the server ended the stream
+	OnDisconnect func(c *Client, err error)
+	// Called before waiting to reconnect after a failed connection attempt
+	// or a lost connection, with the error and the time until the attempt
+	OnRetry func(err error, next time.Duration)
+	// Called with the comment of every frame that carries one, keep-alive
+	// comments included, whether or not the frame is dispatched as an event
+	OnComment func(comment []byte)
+	// Called whenever the server sets the reconnection time with a retry
+	// field
+	OnRetryInterval func(retry time.Duration)
+	// Logs connections and disconnections at LevelInfo, and reconnect
+	// attempts along with the errors reported to OnError at LevelWarn. Nil
+	// logs nothing.
+	Logger *slog.Logger
+	// Checks responses to subscription requests before their events are
+	// read, ValidateResponse if nil. Errors wrapping
+	// ErrUnacceptableContentType end the subscription, while others are
+	// retried like failed connections, see ShouldReconnect.
+	ResponseValidator func(resp *http.Response) error
+	// Names the stream by appending it to the path of URL, as in
+	// /events/{stream}, instead of with the stream query parameter, for
+	// servers routing by path, see Server.StreamFromRequest
+	StreamInPath bool
+	// Method of subscription requests, GET if empty, such as POST for APIs
+	// taking the parameters of a subscription in the request body
+	Method string
+	// Body of subscription requests, sent anew with every connection
+	// attempt. Its Content-Type can be set in Headers.
+	Body []byte
+	// Modifies every subscription request before it is sent, such as to add
+	// query parameters or a token refreshed for every connection attempt.
+	// Requests it returns an error for are not sent, and are retried like
+	// failed connections.
+	RequestModifier func(req *http.Request) error
+	// Accept-Encoding header of subscription requests, such as "gzip",
+	// for gateways compressing responses only when asked to. Responses
+	// compressed with gzip or deflate are decompressed whether or not it is
+	// set.
+	AcceptEncoding string
+	// Identifies the client to servers tracking acknowledgements
+	ClientID string
+	// Endpoint acknowledgements are sent to, defaults to URL
+	AckURL string
+	// Passes the same Event to every handler call instead of allocating a
+	// new one per event. The event and its fields are only valid until the
+	// next event is read, so handlers must Clone any event they keep.
+	ReuseEvents bool
+	// Restores the parsing behavior of earlier releases, which combined
+	// multiple data fields in reverse order and dropped events without data
+	LegacyParsing bool
+	// Captures fields other than the standard ones in Event.Fields, instead
+	// of discarding them
+	CaptureFields bool
+	// Strips all leading spaces and tabs from field values. By default only
+	// the single space following the colon is removed, as required by the
+	// spec, and any further whitespace is kept as part of the value.
+	TrimLeadingSpace bool
+	// Shares a single copy of the ids and names that repeat across events,
+	// instead of allocating them for every event. Events then share memory,
+	// so handlers must not modify their ID or Event fields.
+	InternValues bool
+	// Bounds the size of a single event, which is dropped and reported to
+	// OnError as ErrEventTooLarge if larger, see
+	// EventStreamReader.MaxBufferSize. Zero means 64KiB. Events streamed
+	// with SubscribeReader are not bounded.
+	MaxBufferSize int
+	// Ends subscriptions with the first error reported to OnError, such as
+	// an event that can not be parsed or fails validation, instead of
+	// dropping the event. Such errors are not retried.
+	AbortOnError bool
+	// Called with events that can not be parsed, along with the raw frame,
+	// such as when the stream has been corrupted. Such events are dropped
+	// and the subscription resumes with the next event, see AbortOnError.
+	OnError   func(err error, raw []byte)
+	mu        sync.Mutex
+	withRetry bool
+	clock     clock
+	affinity  string
+	tuned     *http.Client
+	tunedFrom *http.Client
+	sharedMu  sync.Mutex
+	shared    map[string]*sharedConnection
+	chanStats map[chan *Event]*chanStats
+	digest    *digestChallenge
+	events    map[string]*eventSubscription
+	counters  clientCounters
 }
 
 // NewClient creates a new client
@@ -43,7 +210,7 @@ func NewClient(url string) *Client {
 		URL:        url,
 		Connection: &http.Client{},
 		Headers:    make(map[string]string),
-		subscribed: make(map[chan *Event]chan bool),
+		subscribed: make(map[chan *Event]*chanSubscription),
 	}
 }
 
@@ -53,21 +220,85 @@ func NewClientWithoutRetry(url string) *Client {
 		URL:        url,
 		Connection: &http.Client{},
 		Headers:    make(map[string]string),
-		subscribed: make(map[chan *Event]chan bool),
+		subscribed: make(map[chan *Event]*chanSubscription),
 		withRetry:  false,
 	}
 }
 
 // Subscribe to a data stream
 func (c *Client) Subscribe(stream string, handler func(msg *Event)) error {
-	operation := func() error {
-		resp, err := c.request(stream)
+	return c.subscribe(context.Background(), c.position(), stream, handler)
+}
+
+// SubscribeWithContext subscribes to a data stream like Subscribe, until ctx
+// is done. Cancelling ctx aborts the request, including while waiting to
+// reconnect, and returns the cause of the cancellation, see Run.
+func (c *Client) SubscribeWithContext(ctx context.Context, stream string, handler func(msg *Event)) error {
+	return c.subscribe(ctx, c.position(), stream, handler)
+}
+
+// Run subscribes to a stream like Subscribe until ctx is done, so the
+// subscription can be managed alongside other components, such as with an
+// errgroup. It returns nil once ctx is done, or the error that ended the
+// subscription before that.
+func (c *Client) Run(ctx context.Context, stream string, handler func(msg *Event)) error {
+	err := c.subscribe(ctx, c.position(), stream, handler)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// subscribe runs a subscription resuming from pos until it ends or ctx is
+// done
+func (c *Client) subscribe(ctx context.Context, pos *position, stream string, handler func(msg *Event)) error {
+	if err := c.restoreID(pos, stream); err != nil {
+		return err
+	}
+	if c.Journal != nil {
+		err := c.Journal.replay(func(msg *Event) {
+			if len(msg.ID) > 0 {
+				pos.set(string(msg.ID))
+			}
+			handler(msg)
+			c.saveID(stream, msg)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := c.subscriptionContext(ctx)
+	defer cancel(nil)
+
+	reconnect := c.newBackOff()
+
+	var resp *http.Response
+	var connectedBefore bool
+	operation := func() (err error) {
+		resp, err = c.request(ctx, stream, pos.get())
 		if err != nil {
 			return err
 		}
 		defer resp.Body.Close()
 
-		reader := NewEventStreamReader(resp.Body)
+		if err := c.validateResponse(resp); err != nil {
+			if errors.Is(err, ErrUnacceptableContentType) {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+
+		body, err := c.connected(resp)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		c.countReconnect(&connectedBefore)
+		defer func() {
+			c.disconnected(err)
+		}()
+		reader := c.newReader(body)
+		parser := c.newParser(stream)
 
 		for {
 			// Read each new line and process the type of event
@@ -76,66 +307,309 @@ func (c *Client) Subscribe(stream string, handler func(msg *Event)) error {
 				if err == io.EOF {
 					return nil
 				}
+				if err == ErrEventTooLarge {
+					return backoff.Permanent(err)
+				}
 				return err
 			}
 
-			// If we get an error, ignore it.
-			if msg, err := c.processEvent(event); err == nil {
-				if len(msg.ID) > 0 {
-					c.EventID = string(msg.ID)
-				} else {
-					msg.ID = []byte(c.EventID)
+			msg, err := parser.parse(event)
+			c.reportError(err, event)
+			if c.aborts(err) {
+				return backoff.Permanent(err)
+			}
+			c.observeFields(msg)
+
+			// Reconnect after the interval specified by the server, even if
+			// the event is otherwise invalid.
+			if retry, ok := msg.RetryInterval(); ok {
+				reconnect.setRetry(retry)
+			}
+			pos.resume(msg, err)
+
+			// Events that could not be parsed have been reported
+			if err == nil {
+				if action, ok := c.control(msg); ok {
+					if stop, err := endsSubscription(action); stop {
+						return err
+					}
+					continue
 				}
 
+				pos.track(parser, msg)
+				c.counters.events.Add(1)
+
+				if err := c.validate(msg); err != nil {
+					c.reportError(err, event)
+					if c.aborts(err) {
+						return backoff.Permanent(err)
+					}
+					continue
+				}
+
+				if c.Journal == nil {
+					handler(msg)
+					c.saveID(stream, msg)
+					continue
+				}
+				if err := c.Journal.append(msg); err != nil {
+					return backoff.Permanent(err)
+				}
 				handler(msg)
+				c.saveID(stream, msg)
+				if err := c.Journal.done(); err != nil {
+					return backoff.Permanent(err)
+				}
+			}
+		}
+	}
+	return c.retry(ctx, operation, reconnect, func() *http.Response {
+		return resp
+	})
+}
+
+// SubscribeReader subscribes to a data stream, streaming the data of each event
+// from the connection as the handler reads it. Unlike Subscribe, no event is
+// held in memory in full, which suits very large payloads. Data the handler
+// does not read is discarded once it returns.
+func (c *Client) SubscribeReader(stream string, handler func(ev *EventReader)) error {
+	return c.SubscribeReaderWithContext(context.Background(), stream, handler)
+}
+
+// SubscribeReaderWithContext streams the data of each event like
+// SubscribeReader, until ctx is done, see SubscribeWithContext
+func (c *Client) SubscribeReaderWithContext(ctx context.Context, stream string, handler func(ev *EventReader)) error {
+	ctx, cancel := c.subscriptionContext(ctx)
+	defer cancel(nil)
+
+	reconnect := c.newBackOff()
+	pos := c.position()
+	if err := c.restoreID(pos, stream); err != nil {
+		return err
+	}
+
+	var resp *http.Response
+	var connectedBefore bool
+	operation := func() (err error) {
+		resp, err = c.request(ctx, stream, pos.get())
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if err := c.validateResponse(resp); err != nil {
+			if errors.Is(err, ErrUnacceptableContentType) {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+
+		body, err := c.connected(resp)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		c.countReconnect(&connectedBefore)
+		defer func() {
+			c.disconnected(err)
+		}()
+		parser := newLazyParser(body)
+		parser.fields = c.newParser(stream).fields
+
+		retry := func(ev *Event) {
+			if retry, ok := ev.RetryInterval(); ok {
+				reconnect.setRetry(retry)
+			}
+		}
+		skipped := func(ev *Event) {
+			retry(ev)
+			c.observeFields(ev)
+		}
+
+		for {
+			ev, err := parser.next(skipped)
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+
+			retry(&ev.Event)
+			if action, ok := c.control(&ev.Event); ok {
+				if stop, err := endsSubscription(action); stop {
+					return err
+				}
+				continue
+			}
+			// Encryption is bound to the id the event was sent with
+			aad := sealedAAD(stream, ev.ID)
+			if len(ev.ID) == 0 {
+				ev.ID = []byte(pos.get())
+			}
+
+			data := ev.data
+			if c.SigningKeys != nil {
+				ev.data = newVerifyReader(c.SigningKeys, &ev.Event, ev.data)
+			}
+			if c.EncodingBase64 {
+				ev.data = base64.NewDecoder(base64.StdEncoding, ev.data)
+			}
+			if c.Keys != nil {
+				ev.data = &openReader{src: ev.data, keys: c.Keys, aad: aad}
+			}
+			if c.DecompressData {
+				ev.data = &gunzipReader{src: ev.data}
 			}
+
+			c.counters.events.Add(1)
+			handler(ev)
+
+			// Fields following the data are only known once it has been read
+			if _, err := io.Copy(io.Discard, data); err != nil {
+				if err == io.ErrUnexpectedEOF {
+					return nil
+				}
+				return err
+			}
+			retry(&ev.Event)
+			c.observeFields(&ev.Event)
+			if len(ev.ID) > 0 {
+				pos.set(string(ev.ID))
+			}
+			c.saveID(stream, &ev.Event)
 		}
 	}
-	return backoff.Retry(operation, backoff.NewExponentialBackOff())
+	return c.retry(ctx, operation, reconnect, func() *http.Response {
+		return resp
+	})
 }
 
 // SubscribeChan sends all events to the provided channel
 func (c *Client) SubscribeChan(stream string, ch chan *Event) (io.Closer, error) {
-	c.subscribed[ch] = make(chan bool)
+	return c.SubscribeChanWithContext(context.Background(), stream, ch)
+}
 
+// SubscribeChanWithContext sends all events to the provided channel like
+// SubscribeChan, until ctx is done. Cancelling ctx aborts connecting, and
+// once subscribed, ends the subscription like Unsubscribe, closing ch.
+func (c *Client) SubscribeChanWithContext(ctx context.Context, stream string, ch chan *Event) (io.Closer, error) {
+	if c.ShareConnections {
+		return c.subscribeShared(ctx, stream, ch)
+	}
+	return c.subscribeChan(ctx, c.position(), stream, ch, c.ChanOverflow, c.trackChan(ch), nil)
+}
+
+// chanSubscription is a channel subscribed to with subscribeChan
+type chanSubscription struct {
+	quit   chan bool
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// stop ends the subscription, which closes its channel
+func (s *chanSubscription) stop() {
+	s.once.Do(func() {
+		close(s.quit)
+		s.cancel()
+	})
+}
+
+// subscribeChan sends the events of a connection of its own to a channel,
+// resuming from pos, applying the overflow policy and counting deliveries in
+// st. The channel is closed once the subscription ends, and its error is
+// passed to onEnd if it is set.
+func (c *Client) subscribeChan(ctx context.Context, pos *position, stream string, ch chan *Event, policy ChanOverflow, st *chanStats, onEnd func(error)) (io.Closer, error) {
+	if err := c.restoreID(pos, stream); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &chanSubscription{quit: make(chan bool), cancel: cancel}
+	quit := sub.quit
+	c.mu.Lock()
+	c.subscribed[ch] = sub
+	c.mu.Unlock()
+
+	var connectedBefore bool
 	operation := func() (io.Closer, error) {
-		resp, err := c.request(stream)
+		resp, err := c.request(ctx, stream, pos.get())
 		if err != nil {
-			c.cleanup(resp, ch)
 			return nil, err
 		}
 
-		if resp.StatusCode != 200 {
-			c.cleanup(resp, ch)
-			return nil, errors.New("could not connect to stream")
+		if err := c.validateResponse(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
 		}
 
-		reader := NewEventStreamReader(resp.Body)
+		body, err := c.connected(resp)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		c.countReconnect(&connectedBefore)
+		reader := c.newReader(body)
+		parser := c.newParser(stream)
 
 		go func() {
+			var ended error
+			defer func() {
+				c.disconnected(ended)
+			}()
+			if onEnd != nil {
+				defer func() {
+					onEnd(ended)
+				}()
+			}
+
 			for {
 				// Read each new line and process the type of event
 				event, err := reader.ReadEvent()
 				if err != nil {
+					ended = err
 					c.cleanup(resp, ch)
 					return
 				}
 
-				// If we get an error, ignore it.
-				if msg, err := c.processEvent(event); err == nil {
-					if len(msg.ID) > 0 {
-						c.EventID = string(msg.ID)
-					} else {
-						msg.ID = []byte(c.EventID)
+				msg, err := parser.parse(event)
+				c.reportError(err, event)
+				if c.aborts(err) {
+					ended = err
+					c.cleanup(resp, ch)
+					return
+				}
+				c.observeFields(msg)
+				pos.resume(msg, err)
+
+				// Events that could not be parsed have been reported
+				if err == nil {
+					// Connections are not reestablished, so any action
+					// other than notifying ends the subscription
+					if action, ok := c.control(msg); ok {
+						if action != ControlNotify {
+							c.cleanup(resp, ch)
+							return
+						}
+						continue
 					}
 
-					select {
-					case <-c.subscribed[ch]:
+					pos.track(parser, msg)
+					c.counters.events.Add(1)
+
+					if err := c.validate(msg); err != nil {
+						c.reportError(err, event)
+						if c.aborts(err) {
+							ended = err
+							c.cleanup(resp, ch)
+							return
+						}
+						continue
+					}
+
+					if !st.send(ch, msg, policy, quit, ctx.Done()) {
 						c.cleanup(resp, ch)
 						return
-					case ch <- msg:
-						// message sent
 					}
+					c.saveID(stream, msg)
 				}
 			}
 		}()
@@ -143,14 +617,24 @@ func (c *Client) SubscribeChan(stream string, ch chan *Event) (io.Closer, error)
 		return resp.Body, nil
 	}
 
+	var closer io.Closer
+	var err error
 	if c.withRetry {
-		return nil, backoff.Retry(func() error {
-			_, err := operation()
+		err = c.retry(ctx, func() error {
+			closer, err = operation()
+			if errors.Is(err, ErrUnacceptableContentType) {
+				return backoff.Permanent(err)
+			}
 			return err
-		}, backoff.NewExponentialBackOff())
+		}, c.newBackOff(), nil)
+	} else {
+		closer, err = operation()
 	}
-
-	return operation()
+	if err != nil {
+		c.cleanup(nil, ch)
+		return nil, err
+	}
+	return closer, nil
 }
 
 // SubscribeRaw to an sse endpoint
@@ -158,97 +642,304 @@ func (c *Client) SubscribeRaw(handler func(msg *Event)) error {
 	return c.Subscribe("", handler)
 }
 
+// SubscribeRawWithContext subscribes to an sse endpoint until ctx is done, see
+// SubscribeWithContext
+func (c *Client) SubscribeRawWithContext(ctx context.Context, handler func(msg *Event)) error {
+	return c.SubscribeWithContext(ctx, "", handler)
+}
+
 // SubscribeChanRaw sends all events to the provided channel
 func (c *Client) SubscribeChanRaw(ch chan *Event) (io.Closer, error) {
 	return c.SubscribeChan("", ch)
 }
 
+// SubscribeChanRawWithContext sends all events to the provided channel until
+// ctx is done, see SubscribeChanWithContext
+func (c *Client) SubscribeChanRawWithContext(ctx context.Context, ch chan *Event) (io.Closer, error) {
+	return c.SubscribeChanWithContext(ctx, "", ch)
+}
+
 // Unsubscribe unsubscribes a channel
 func (c *Client) Unsubscribe(ch chan *Event) {
+	if c.ShareConnections && c.unsubscribeShared(ch) {
+		return
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.subscribed[ch] != nil {
-		c.subscribed[ch] <- true
+	delete(c.chanStats, ch)
+	// The subscription is stopped without waiting for it, it closes the
+	// channel on its own
+	if sub := c.subscribed[ch]; sub != nil {
+		sub.stop()
 	}
 }
 
-func (c *Client) request(stream string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", c.URL, nil)
+// request connects to a stream, resuming after the event with the given id
+func (c *Client) request(ctx context.Context, stream, eventID string) (*http.Response, error) {
+	target, err := c.endpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	method := c.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if c.Body != nil {
+		body = bytes.NewReader(c.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
 	if err != nil {
 		return nil, err
 	}
 
 	// Setup request, specify stream to connect to
-	if stream != "" {
+	if stream != "" && c.StreamInPath {
+		req.URL = req.URL.JoinPath(url.PathEscape(stream))
+		stream = ""
+	}
+	if stream != "" || c.ClientID != "" {
 		query := req.URL.Query()
-		query.Add("stream", stream)
+		if stream != "" {
+			query.Add("stream", stream)
+		}
+		if c.ClientID != "" {
+			query.Add("client", c.ClientID)
+		}
 		req.URL.RawQuery = query.Encode()
 	}
 
 	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Accept", c.accept())
 	req.Header.Set("Connection", "keep-alive")
+	if c.AcceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", c.AcceptEncoding)
+	}
+
+	if eventID != "" {
+		req.Header.Set("Last-Event-ID", eventID)
+	}
 
-	if c.EventID != "" {
-		req.Header.Set("Last-Event-ID", c.EventID)
+	if c.Affinity {
+		c.presentAffinity(req)
 	}
 
-	// Add user specified headers
-	for k, v := range c.Headers {
-		req.Header.Set(k, v)
+	// Credentials come first, so user specified headers and the request
+	// modifier can override them, also when answering a challenge
+	var answered bool
+	prepare := func() error {
+		answered = c.Credentials != nil && c.authorize(req)
+
+		// Add user specified headers
+		for k, v := range c.Headers {
+			req.Header.Set(k, v)
+		}
+
+		if c.RequestModifier != nil {
+			return c.RequestModifier(req)
+		}
+		return nil
+	}
+	if err := prepare(); err != nil {
+		return nil, err
 	}
 
-	return c.Connection.Do(req)
+	resp, err := c.connection().Do(req)
+	if err == nil && c.challenged(resp, answered) {
+		resp.Body.Close()
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		if err := prepare(); err != nil {
+			return nil, err
+		}
+		resp, err = c.connection().Do(req)
+	}
+	if err == nil && c.Affinity {
+		c.captureAffinity(resp)
+	}
+	if err == nil && c.ReadTimeout > 0 {
+		resp.Body = c.watchIdle(resp.Body)
+	}
+	if err == nil {
+		err = decodeContent(resp)
+	}
+	return resp, err
 }
 
-func (c *Client) processEvent(msg []byte) (event *Event, err error) {
-	var e Event
-
-	if len(msg) < 1 {
-		return nil, errors.New("event message was empty")
-	}
-
-	// Normalize the crlf to lf to make it easier to split the lines.
-	bytes.Replace(msg, []byte("\n\r"), []byte("\n"), -1)
-	// Split the line by "\n" or "\r", per the spec.
-	for _, line := range bytes.FieldsFunc(msg, func(r rune) bool { return r == '\n' || r == '\r' }) {
-		switch {
-		case bytes.HasPrefix(line, headerID):
-			e.ID = trimHeader(len(headerID), line)
-		case bytes.HasPrefix(line, headerData):
-			// The spec allows for multiple data fields per event, concatenated them with "\n".
-			e.Data = append(append(trimHeader(len(headerData), line), e.Data[:]...), byte('\n'))
-		// The spec says that a line that simply contains the string "data" should be treated as a data field with an empty body.
-		case bytes.Equal(line, bytes.TrimSuffix(headerData, []byte(":"))):
-			e.Data = append(e.Data, byte('\n'))
-		case bytes.HasPrefix(line, headerEvent):
-			e.Event = trimHeader(len(headerEvent), line)
-		case bytes.HasPrefix(line, headerRetry):
-			e.Retry = trimHeader(len(headerRetry), line)
-		default:
-			// Ignore any garbage that doesn't match what we're looking for.
-		}
-	}
-
-	// Trim the last "\n" per the spec.
-	e.Data = bytes.TrimSuffix(e.Data, []byte("\n"))
-
-	if len(e.Data) > 0 {
-		if c.EncodingBase64 {
-			buf := make([]byte, base64.StdEncoding.DecodedLen(len(e.Data)))
-
-			_, err := base64.StdEncoding.Decode(buf, e.Data)
-			if err != nil {
-				err = fmt.Errorf("failed to decode event message: %s", err)
+// subscriptionContext returns the context a subscription runs in, derived from
+// parent, which is cancelled with ErrDeadlineExceeded once MaxDuration has
+// passed
+func (c *Client) subscriptionContext(parent context.Context) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	if c.MaxDuration <= 0 {
+		return ctx, cancel
+	}
+
+	deadline := clockOrSystem(c.clock).NewTimer(c.MaxDuration)
+	go func() {
+		select {
+		case <-deadline.C():
+			cancel(ErrDeadlineExceeded)
+		case <-ctx.Done():
+			deadline.Stop()
+		}
+	}()
+	return ctx, cancel
+}
+
+// retry runs operation until it succeeds or b gives up, like backoff.Retry,
+// but waiting on the client's clock. Failures are only retried if
+// ShouldReconnect agrees, which is passed the response of the failed attempt
+// if response is not nil. Once ctx is done, the cause is returned.
+func (c *Client) retry(ctx context.Context, operation backoff.Operation, b backoff.BackOff, response func() *http.Response) error {
+	clk := clockOrSystem(c.clock)
+
+	b.Reset()
+	for {
+		err := operation()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if permanent, ok := err.(*backoff.PermanentError); ok {
+			return permanent.Err
+		}
+		if err == errReconnect {
+			b.Reset()
+			continue
+		}
+		if errors.Is(err, ErrNoContent) {
+			return err
+		}
+		if c.ShouldReconnect != nil {
+			var resp *http.Response
+			if response != nil {
+				resp = response()
+			}
+			if !c.ShouldReconnect(err, resp) {
+				return err
 			}
-			e.Data = buf
 		}
-		return &e, err
+
+		next := b.NextBackOff()
+		if next == backoff.Stop {
+			return err
+		}
+		var rejected *ResponseError
+		if errors.As(err, &rejected) {
+			// Dates are taken relative to the client's clock
+			if wait := retryAfter(rejected.Response.Header.Get("Retry-After"), clk.Now()); wait > next {
+				next = wait
+			}
+		}
+		c.log(slog.LevelWarn, "reconnecting", "error", err, "delay", next)
+		if c.OnRetry != nil {
+			c.OnRetry(err, next)
+		}
+		wait := clk.NewTimer(next)
+		select {
+		case <-wait.C():
+		case <-ctx.Done():
+			wait.Stop()
+			return context.Cause(ctx)
+		}
 	}
+}
+
+func (c *Client) processEvent(msg []byte) (event *Event, err error) {
+	return c.newParser("").parse(msg)
+}
 
-	// If we made it here, then the event had a problem.
-	return nil, errors.New("invalid event message")
+// newReader creates a reader splitting a stream into frames, reporting the
+// ones that are dropped for being too large
+func (c *Client) newReader(r io.Reader) *EventStreamReader {
+	reader := NewEventStreamReader(r)
+	reader.MaxBufferSize = c.MaxBufferSize
+	reader.tooLarge = func(raw []byte) {
+		c.reportError(ErrEventTooLarge, raw)
+		if c.AbortOnError {
+			reader.err = ErrEventTooLarge
+		}
+	}
+	return reader
+}
+
+// reportError passes errors to OnError, except for events that are simply
+// not dispatched, such as ones only carrying a retry interval
+func (c *Client) reportError(err error, raw []byte) {
+	if err == nil || err == errInvalidEvent || err == errEmptyEvent {
+		return
+	}
+	c.counters.errors.Add(1)
+	c.log(slog.LevelWarn, "event error", "error", err)
+	if c.OnError != nil {
+		c.OnError(err, raw)
+	}
+}
+
+// aborts reports whether an error reported to OnError ends the subscription,
+// see AbortOnError
+func (c *Client) aborts(err error) bool {
+	return c.AbortOnError && err != nil && err != errInvalidEvent && err != errEmptyEvent
+}
+
+// newParser creates a parser for a single subscription to a stream
+func (c *Client) newParser(stream string) *eventParser {
+	var intern *interner
+	if c.InternValues {
+		intern = &interner{}
+	}
+
+	return &eventParser{
+		intern:  intern,
+		base64:  c.EncodingBase64,
+		verify:  c.SigningKeys,
+		keys:    c.Keys,
+		stream:  stream,
+		gunzip:  c.DecompressData,
+		maxSize: c.MaxBufferSize,
+		borrow:  c.ReuseEvents,
+		fields: fieldParser{
+			legacy:    c.LegacyParsing,
+			capture:   c.CaptureFields,
+			trimSpace: c.TrimLeadingSpace,
+			signed:    c.SigningKeys != nil,
+		},
+	}
+}
+
+// countReconnect counts a connection as a reconnect if its subscription has
+// been connected before
+func (c *Client) countReconnect(connectedBefore *bool) {
+	if *connectedBefore {
+		c.counters.reconnects.Add(1)
+	}
+	*connectedBefore = true
+}
+
+// disconnected reports the end of a connection to OnDisconnect
+func (c *Client) disconnected(err error) {
+	if c.OnDisconnect == nil && c.Logger == nil {
+		return
+	}
+	if permanent, ok := err.(*backoff.PermanentError); ok {
+		err = permanent.Err
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	c.log(slog.LevelInfo, "disconnected", "error", err)
+	if c.OnDisconnect != nil {
+		c.OnDisconnect(c, err)
+	}
 }
 
 func (c *Client) cleanup(resp *http.Response, ch chan *Event) {
@@ -259,22 +950,9 @@ func (c *Client) cleanup(resp *http.Response, ch chan *Event) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.subscribed[ch] != nil {
-		close(c.subscribed[ch])
+	if sub := c.subscribed[ch]; sub != nil {
+		sub.stop()
 		close(ch)
 		delete(c.subscribed, ch)
 	}
 }
-
-func trimHeader(size int, data []byte) []byte {
-	data = data[size:]
-	// Remove optional leading whitespace
-	if data[0] == 32 {
-		data = data[1:]
-	}
-	// Remove trailing new line
-	if data[len(data)-1] == 10 {
-		data = data[:len(data)-1]
-	}
-	return data
-}
@@ -5,15 +5,24 @@
 package sse
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/cenkalti/backoff.v1"
 )
 
-var url string
+var urlPath string
 
 func setup() {
 	// New Server
@@ -22,7 +31,7 @@ func setup() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/events", s.HTTPHandler)
 	server := httptest.NewServer(mux)
-	url = server.URL + "/events"
+	urlPath = server.URL + "/events"
 
 	s.CreateStream("test")
 
@@ -39,7 +48,7 @@ func TestClient(t *testing.T) {
 	setup()
 
 	Convey("Given a new Subscribe Client", t, func() {
-		c := NewClient(url)
+		c := NewClient(urlPath)
 
 		Convey("When connecting to a new stream", func() {
 			Convey("It should receive events ", func() {
@@ -65,7 +74,7 @@ func TestClient(t *testing.T) {
 	})
 
 	Convey("Given a new Chan Subscribe Client", t, func() {
-		c := NewClient(url)
+		c := NewClient(urlPath)
 
 		Convey("It should receive events", func() {
 			events := make(chan *Event)
@@ -96,3 +105,573 @@ func TestClient(t *testing.T) {
 		})
 	})
 }
+
+func TestClientProcessEvent(t *testing.T) {
+	Convey("Given a new client", t, func() {
+		c := NewClient(urlPath)
+
+		Convey("When processing an event with comments", func() {
+			ev, err := c.processEvent([]byte(": first\n:second\ndata: test"))
+
+			Convey("The comments should be kept", func() {
+				So(err, ShouldBeNil)
+				So(string(ev.Comment), ShouldEqual, "first\nsecond")
+				So(string(ev.Data), ShouldEqual, "test")
+			})
+		})
+
+		Convey("When processing an event corrupted by garbage", func() {
+			ev, err := c.processEvent([]byte("data: a\n\x00\x8f\x12\xff\ndata: b"))
+
+			Convey("It should be reported as malformed", func() {
+				So(ev, ShouldBeNil)
+				So(err, ShouldEqual, ErrMalformedEvent)
+			})
+		})
+
+		Convey("When processing an event with indented data", func() {
+			msg := []byte("data:   indented\ndata:\ttabbed")
+
+			Convey("Only the space after the colon should be stripped by default", func() {
+				ev, err := c.processEvent(msg)
+				So(err, ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, "  indented\n\ttabbed")
+			})
+
+			Convey("All leading whitespace should be stripped when enabled", func() {
+				c.TrimLeadingSpace = true
+				ev, err := c.processEvent(msg)
+				So(err, ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, "indented\ntabbed")
+			})
+		})
+
+		Convey("When processing an event with non-standard fields", func() {
+			msg := []byte("meta: a\nx-vendor\nmeta: b\ndata: test")
+
+			Convey("They should be discarded by default", func() {
+				ev, err := c.processEvent(msg)
+				So(err, ShouldBeNil)
+				So(ev.Fields, ShouldBeNil)
+			})
+
+			Convey("They should be captured when enabled", func() {
+				c.CaptureFields = true
+				ev, err := c.processEvent(msg)
+				So(err, ShouldBeNil)
+				So(string(ev.Fields["meta"]), ShouldEqual, "a\nb")
+				So(string(ev.Fields["x-vendor"]), ShouldEqual, "")
+				So(string(ev.Data), ShouldEqual, "test")
+			})
+		})
+	})
+}
+
+func TestClientOnError(t *testing.T) {
+	Convey("Given a server sending a corrupted event", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: first\n\ndata: se\x00\x01\x8f\x02cond\n\xfe\xff\n\ndata: third\n\n"))
+		}))
+		defer server.Close()
+
+		Convey("When subscribing", func() {
+			c := NewClient(server.URL)
+
+			var received []string
+			var errs []error
+			var raw []byte
+			c.OnError = func(err error, frame []byte) {
+				errs = append(errs, err)
+				raw = append([]byte(nil), frame...)
+			}
+			err := c.Subscribe("", func(msg *Event) {
+				received = append(received, string(msg.Data))
+			})
+
+			Convey("The corrupted event should be reported and dropped", func() {
+				So(err, ShouldBeNil)
+				So(received, ShouldResemble, []string{"first", "third"})
+				So(errs, ShouldResemble, []error{ErrMalformedEvent})
+				So(string(raw), ShouldStartWith, "data: se")
+			})
+		})
+
+		Convey("When subscribing with AbortOnError", func() {
+			c := NewClient(server.URL)
+			c.AbortOnError = true
+
+			var received []string
+			err := c.Subscribe("", func(msg *Event) {
+				received = append(received, string(msg.Data))
+			})
+
+			Convey("The subscription should end with the error of the corrupted event", func() {
+				So(err, ShouldEqual, ErrMalformedEvent)
+				So(received, ShouldResemble, []string{"first"})
+			})
+		})
+	})
+
+	Convey("Given a server sending an event larger than the client's buffer", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: " + strings.Repeat("a", 100) + "\n\ndata: small\n\n"))
+		}))
+		defer server.Close()
+
+		c := NewClient(server.URL)
+		c.MaxBufferSize = 64
+		var errs []error
+		c.OnError = func(err error, frame []byte) {
+			errs = append(errs, err)
+		}
+
+		var received []string
+		handler := func(msg *Event) {
+			received = append(received, string(msg.Data))
+		}
+
+		Convey("The event should be reported and dropped", func() {
+			So(c.Subscribe("", handler), ShouldBeNil)
+			So(received, ShouldResemble, []string{"small"})
+			So(errs, ShouldResemble, []error{ErrEventTooLarge})
+		})
+
+		Convey("The subscription should end with AbortOnError", func() {
+			c.AbortOnError = true
+			So(c.Subscribe("", handler), ShouldEqual, ErrEventTooLarge)
+			So(received, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given a server sending an event with an id but no data", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("id: 5\n\ndata: next\n\n"))
+		}))
+		defer server.Close()
+
+		Convey("Its id should be taken as the last event id without an error", func() {
+			c := NewClient(server.URL)
+			c.AbortOnError = true
+
+			var ids []string
+			err := c.Subscribe("", func(msg *Event) {
+				ids = append(ids, string(msg.ID))
+			})
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []string{"5"})
+			So(c.EventID, ShouldEqual, "5")
+		})
+	})
+}
+
+func TestClientShouldReconnect(t *testing.T) {
+	Convey("Given a server that fails with a status", t, func() {
+		status := http.StatusServiceUnavailable
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(status)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: ok\n\n"))
+		}))
+		defer server.Close()
+
+		c := NewClient(server.URL)
+		clk := newFakeClock()
+		c.clock = clk
+		c.ShouldReconnect = func(err error, resp *http.Response) bool {
+			return resp != nil && resp.StatusCode >= 500
+		}
+
+		// Fire every backoff timer right away
+		go clk.advanceAll()
+		defer clk.stop()
+
+		var received []string
+		subscribe := func() error {
+			return c.Subscribe("", func(msg *Event) {
+				received = append(received, string(msg.Data))
+			})
+		}
+
+		Convey("Failures the predicate accepts should be retried", func() {
+			So(subscribe(), ShouldBeNil)
+			So(attempts, ShouldEqual, 3)
+			So(received, ShouldResemble, []string{"ok"})
+		})
+
+		Convey("Failures the predicate rejects should end the subscription", func() {
+			status = http.StatusNotFound
+			So(subscribe(), ShouldNotBeNil)
+			So(attempts, ShouldEqual, 1)
+			So(received, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestClientRequest(t *testing.T) {
+	Convey("Given a server taking subscriptions by POST", t, func() {
+		var mu sync.Mutex
+		var bodies, tokens []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			bodies = append(bodies, string(body))
+			tokens = append(tokens, r.Header.Get("Authorization"))
+			attempts := len(tokens)
+			mu.Unlock()
+			if attempts < 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: ok\n\n"))
+		}))
+		defer server.Close()
+
+		c := NewClient(server.URL)
+		clk := newFakeClock()
+		c.clock = clk
+		go clk.advanceAll()
+		defer clk.stop()
+
+		c.Method = http.MethodPost
+		c.Body = []byte(`{"prompt":"hi"}`)
+		c.Headers["Content-Type"] = "application/json"
+		refreshed := 0
+		c.RequestModifier = func(req *http.Request) error {
+			refreshed++
+			req.Header.Set("Authorization", "Bearer "+strconv.Itoa(refreshed))
+			return nil
+		}
+
+		Convey("Every attempt should send the body and a fresh token", func() {
+			So(c.Subscribe("", func(msg *Event) {}), ShouldBeNil)
+			mu.Lock()
+			defer mu.Unlock()
+			So(bodies, ShouldResemble, []string{`{"prompt":"hi"}`, `{"prompt":"hi"}`})
+			So(tokens, ShouldResemble, []string{"Bearer 1", "Bearer 2"})
+		})
+	})
+}
+
+func TestClientMaxDuration(t *testing.T) {
+	Convey("Given a client with a maximum duration", t, func() {
+		srv := New()
+		srv.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		clk := newFakeClock()
+		c := NewClient(server.URL)
+		c.clock = clk
+		c.MaxDuration = time.Minute
+
+		done := make(chan error)
+		subscribe := func() {
+			go func() {
+				done <- c.Subscribe("test", func(msg *Event) {})
+			}()
+		}
+		expectDeadline := func() {
+			select {
+			case err := <-done:
+				So(err, ShouldEqual, ErrDeadlineExceeded)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		}
+
+		Convey("A connected subscription should end once it has passed", func() {
+			subscribe()
+			for srv.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+
+			clk.Advance(time.Minute)
+			expectDeadline()
+		})
+
+		Convey("A subscription waiting to reconnect should end once it has passed", func() {
+			c.Connection = &http.Client{Transport: &failingTransport{}}
+			subscribe()
+
+			// The deadline and the backoff timer
+			clk.WaitForTimers(2)
+			clk.Advance(time.Minute)
+			expectDeadline()
+		})
+
+		Reset(func() {
+			srv.Close()
+		})
+	})
+}
+
+func TestClientContext(t *testing.T) {
+	Convey("Given a server publishing events", t, func() {
+		s := New()
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+		s.CreateStream("test")
+		s.Publish("test", &Event{Data: []byte("hello")})
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		c := NewClient(server.URL)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		Convey("Cancelling should end a subscription", func() {
+			events := make(chan *Event)
+			result := make(chan error)
+			go func() {
+				result <- c.SubscribeWithContext(ctx, "test", func(msg *Event) {
+					events <- msg
+				})
+			}()
+
+			msg, err := wait(events, time.Second)
+			So(err, ShouldBeNil)
+			So(string(msg), ShouldEqual, "hello")
+
+			cancel()
+			select {
+			case err := <-result:
+				So(err, ShouldEqual, context.Canceled)
+			case <-time.After(time.Second):
+				So("subscription not ended", ShouldBeEmpty)
+			}
+		})
+
+		Convey("Cancelling should stop reconnecting", func() {
+			c.URL = server.URL + "/missing"
+			result := make(chan error)
+			go func() {
+				result <- c.SubscribeWithContext(ctx, "none", func(msg *Event) {})
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+			select {
+			case err := <-result:
+				So(err, ShouldEqual, context.Canceled)
+			case <-time.After(time.Second):
+				So("subscription not ended", ShouldBeEmpty)
+			}
+		})
+
+		for _, shared := range []bool{false, true} {
+			Convey("Cancelling should close subscribed channels, sharing connections: "+strconv.FormatBool(shared), func() {
+				c.ShareConnections = shared
+				// Unbuffered, so the reader is blocked sending the next event
+				ch := make(chan *Event)
+				_, err := c.SubscribeChanWithContext(ctx, "test", ch)
+				So(err, ShouldBeNil)
+
+				msg, err := wait(ch, time.Second)
+				So(err, ShouldBeNil)
+				So(string(msg), ShouldEqual, "hello")
+
+				s.Publish("test", &Event{Data: []byte("unread")})
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+
+				closed := false
+				deadline := time.After(time.Second)
+				for !closed {
+					select {
+					case _, ok := <-ch:
+						closed = !ok
+					case <-deadline:
+						So("channel not closed", ShouldBeEmpty)
+						return
+					}
+				}
+				So(closed, ShouldBeTrue)
+			})
+		}
+	})
+}
+
+func TestClientLifecycle(t *testing.T) {
+	Convey("Given a server failing the first request", t, func() {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: hello\n\n"))
+		}))
+		defer server.Close()
+
+		Convey("The client should report each step of the subscription", func() {
+			var steps []string
+			c := NewClient(server.URL)
+			c.ReconnectStrategy = func() backoff.BackOff {
+				return backoff.NewConstantBackOff(time.Millisecond)
+			}
+			c.OnRetry = func(err error, next time.Duration) {
+				steps = append(steps, "retry in "+next.String())
+			}
+			c.OnConnect = func(c *Client, framing Framing) {
+				steps = append(steps, "connect")
+			}
+			c.OnDisconnect = func(c *Client, err error) {
+				steps = append(steps, fmt.Sprint("disconnect: ", err))
+			}
+
+			err := c.Subscribe("test", func(msg *Event) {
+				steps = append(steps, "event")
+			})
+			So(err, ShouldBeNil)
+			So(steps, ShouldResemble, []string{"retry in 1ms", "connect", "event", "disconnect: <nil>"})
+		})
+	})
+}
+
+func TestClientReadTimeout(t *testing.T) {
+	Convey("Given a server that goes silent after the first event", t, func() {
+		var requests int32
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			if atomic.AddInt32(&requests, 1) > 1 {
+				w.Write([]byte("event: done\ndata: bye\n\n"))
+				return
+			}
+			w.Write([]byte("data: hello\n\n"))
+			w.(http.Flusher).Flush()
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		Convey("The client should reconnect once nothing has been received for the read timeout", func() {
+			var ended []error
+			c := NewClient(server.URL)
+			c.ReadTimeout = 50 * time.Millisecond
+			c.ReconnectStrategy = func() backoff.BackOff {
+				return backoff.NewConstantBackOff(time.Millisecond)
+			}
+			c.OnDisconnect = func(c *Client, err error) {
+				ended = append(ended, err)
+			}
+
+			var events []string
+			err := c.Subscribe("test", func(msg *Event) {
+				events = append(events, string(msg.Data))
+			})
+			So(err, ShouldBeNil)
+			So(events, ShouldResemble, []string{"hello", "bye"})
+			So(ended, ShouldHaveLength, 2)
+			So(ended[0], ShouldEqual, ErrReadTimeout)
+			So(ended[1], ShouldBeNil)
+		})
+	})
+
+	Convey("Given a server sending events to a slow handler", t, func() {
+		var requests int32
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			if atomic.AddInt32(&requests, 1) > 1 {
+				w.Write([]byte("event: done\ndata: bye\n\n"))
+				return
+			}
+			for _, data := range []string{"one", "two", "three"} {
+				w.Write([]byte("data: " + data + "\n\n"))
+				w.(http.Flusher).Flush()
+				time.Sleep(10 * time.Millisecond)
+			}
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		Convey("Time spent in the handler should not count towards the read timeout", func() {
+			c := NewClient(server.URL)
+			c.ReadTimeout = 50 * time.Millisecond
+			c.ReconnectStrategy = func() backoff.BackOff {
+				return backoff.NewConstantBackOff(time.Millisecond)
+			}
+
+			var events []string
+			err := c.Subscribe("test", func(msg *Event) {
+				events = append(events, string(msg.Data))
+				time.Sleep(100 * time.Millisecond)
+			})
+			So(err, ShouldBeNil)
+			So(events, ShouldResemble, []string{"one", "two", "three", "bye"})
+			So(atomic.LoadInt32(&requests), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestClientReuseEvents(t *testing.T) {
+	Convey("Given a client reusing events", t, func() {
+		c := NewClient("http://localhost/events")
+		c.Connection = &http.Client{Transport: streamTransport("id: 1\ndata: a\n\ndata: b\n\nid: 2\ndata: c\n\n")}
+		c.ReuseEvents = true
+
+		Convey("Every event should be passed in the same Event, with the last event id", func() {
+			var events []*Event
+			var received []string
+			err := c.Subscribe("", func(msg *Event) {
+				events = append(events, msg)
+				received = append(received, string(msg.ID)+":"+string(msg.Data))
+			})
+			So(err, ShouldBeNil)
+			So(received, ShouldResemble, []string{"1:a", "1:b", "2:c"})
+			So(events[0], ShouldEqual, events[2])
+			So(c.EventID, ShouldEqual, "2")
+		})
+	})
+}
+
+// streamTransport answers every request with the same event stream
+type streamTransport []byte
+
+func (t streamTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{ContentTypeEventStream}},
+		Body:       io.NopCloser(bytes.NewReader(t)),
+		Request:    r,
+	}, nil
+}
+
+func benchmarkClientSubscribe(b *testing.B, reuse bool) {
+	stream := denseStream(1000)
+	c := NewClient("http://localhost/events")
+	c.Connection = &http.Client{Transport: streamTransport(stream)}
+	c.ReuseEvents = reuse
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		c.Subscribe("", func(msg *Event) {})
+	}
+}
+
+func BenchmarkClientSubscribe(b *testing.B) {
+	benchmarkClientSubscribe(b, false)
+}
+
+func BenchmarkClientSubscribeReuseEvents(b *testing.B) {
+	benchmarkClientSubscribe(b, true)
+}
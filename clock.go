@@ -0,0 +1,89 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "time"
+
+// clock is the source of time for anything scheduled by this package, such as
+// reconnect backoff, heartbeats, timeouts and expiry, on clients and servers
+// alike, so that tests can control the passing of time instead of sleeping
+type clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) timer
+	NewTicker(d time.Duration) timer
+	// AfterFunc calls f in its own goroutine once d has passed. The C of the
+	// timer it returns is nil.
+	AfterFunc(d time.Duration, f func()) timer
+}
+
+// timer is a time.Timer or time.Ticker obtained from a clock
+type timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// systemClock is the clock used unless a test replaces it
+var systemClock clock = realClock{}
+
+// clockOrSystem returns c, or the system clock if c is nil
+func clockOrSystem(c clock) clock {
+	if c == nil {
+		return systemClock
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) timer {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r realTimer) C() <-chan time.Time {
+	return r.t.C
+}
+
+func (r realTimer) Stop() bool {
+	return r.t.Stop()
+}
+
+func (r realTimer) Reset(d time.Duration) bool {
+	return r.t.Reset(d)
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (r realTicker) C() <-chan time.Time {
+	return r.t.C
+}
+
+func (r realTicker) Stop() bool {
+	r.t.Stop()
+	return true
+}
+
+func (r realTicker) Reset(d time.Duration) bool {
+	r.t.Reset(d)
+	return true
+}
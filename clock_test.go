@@ -0,0 +1,275 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeClock is a clock whose time only moves when advanced by a test
+type fakeClock struct {
+	mu     sync.Mutex
+	added  *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+	// Set once tests stop waiting for timers, see stop
+	stopped bool
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{now: time.Unix(0, 0)}
+	c.added = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) timer {
+	return c.start(d, 0)
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) timer {
+	return c.start(d, d)
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) timer {
+	t := &fakeTimer{clock: c, fn: f}
+	t.Reset(d)
+	return t
+}
+
+func (c *fakeClock) start(d, period time.Duration) *fakeTimer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1), period: period}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the time forward, firing any timers that become due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	active := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.at.After(c.now) {
+			select {
+			case t.c <- c.now:
+			default:
+				// Like time.Ticker, drop ticks the receiver is not ready for
+			}
+			if t.fn != nil {
+				go t.fn()
+			}
+			if t.period == 0 {
+				continue
+			}
+			for !t.at.After(c.now) {
+				t.at = t.at.Add(t.period)
+			}
+		}
+		active = append(active, t)
+	}
+	c.timers = active
+}
+
+// AdvanceToNext moves the time forward to the earliest pending timer
+func (c *fakeClock) AdvanceToNext() {
+	c.mu.Lock()
+	var next time.Duration
+	for i, t := range c.timers {
+		if d := t.at.Sub(c.now); i == 0 || d < next {
+			next = d
+		}
+	}
+	c.mu.Unlock()
+
+	c.Advance(next)
+}
+
+// WaitForTimers blocks until at least n timers are pending, reporting false
+// if the clock has been stopped instead
+func (c *fakeClock) WaitForTimers(n int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.timers) < n && !c.stopped {
+		c.added.Wait()
+	}
+	return !c.stopped
+}
+
+// stop releases goroutines waiting for timers
+func (c *fakeClock) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stopped = true
+	c.added.Broadcast()
+}
+
+// advanceAll fires every timer as soon as it is started, until the clock is
+// stopped
+func (c *fakeClock) advanceAll() {
+	for c.WaitForTimers(1) {
+		c.AdvanceToNext()
+	}
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	c      chan time.Time
+	at     time.Time
+	period time.Duration
+	// Called instead of sending on c, see AfterFunc
+	fn func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.remove()
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.remove()
+	t.at = t.clock.now.Add(d)
+	if t.period != 0 {
+		t.period = d
+	}
+	t.clock.timers = append(t.clock.timers, t)
+	t.clock.added.Broadcast()
+	return active
+}
+
+func (t *fakeTimer) remove() bool {
+	for i, other := range t.clock.timers {
+		if other == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// failingTransport fails every request, counting the attempts
+type failingTransport struct {
+	attempts int32
+}
+
+func (f *failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	atomic.AddInt32(&f.attempts, 1)
+	return nil, errors.New("connection refused")
+}
+
+func TestFakeClock(t *testing.T) {
+	Convey("Given a fake clock", t, func() {
+		clk := newFakeClock()
+
+		Convey("Timers should only fire once their time has passed", func() {
+			timer := clk.NewTimer(time.Second)
+			clk.Advance(999 * time.Millisecond)
+			So(timer.C(), ShouldHaveLength, 0)
+			clk.Advance(time.Millisecond)
+			So(timer.C(), ShouldHaveLength, 1)
+		})
+
+		Convey("Stopped timers should not fire", func() {
+			timer := clk.NewTimer(time.Second)
+			So(timer.Stop(), ShouldBeTrue)
+			clk.Advance(time.Minute)
+			So(timer.C(), ShouldHaveLength, 0)
+			So(timer.Stop(), ShouldBeFalse)
+		})
+
+		Convey("Tickers should keep firing", func() {
+			ticker := clk.NewTicker(time.Second)
+			for i := 0; i < 3; i++ {
+				clk.Advance(time.Second)
+				So(ticker.C(), ShouldHaveLength, 1)
+				<-ticker.C()
+			}
+		})
+	})
+}
+
+func TestClientBackoffClock(t *testing.T) {
+	Convey("Given a client that can not connect", t, func() {
+		clk := newFakeClock()
+		transport := &failingTransport{}
+
+		c := NewClient("http://localhost/events")
+		c.Connection = &http.Client{Transport: transport}
+		c.clock = clk
+
+		go c.Subscribe("test", func(msg *Event) {})
+
+		Convey("It should only reconnect as the clock advances", func() {
+			for attempt := int32(1); attempt <= 3; attempt++ {
+				clk.WaitForTimers(1)
+				So(atomic.LoadInt32(&transport.attempts), ShouldEqual, attempt)
+				clk.AdvanceToNext()
+			}
+		})
+	})
+}
+
+func TestServerClock(t *testing.T) {
+	Convey("Given a server on a fake clock", t, func() {
+		clk := newFakeClock()
+		s := New()
+		s.clock = clk
+		s.KeepAlive = time.Minute
+		s.ReplayTTL = time.Hour
+		str := s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("Keep-alive comments should be sent as the clock advances", func() {
+			sub := str.addSubscriber("0")
+			clk.WaitForTimers(1)
+			clk.Advance(time.Minute)
+
+			So(string((<-sub.connection).Comment), ShouldEqual, "ping")
+		})
+
+		Convey("Events should expire from the eventlog as the clock advances", func() {
+			sub := str.addSubscriber("0")
+			s.Publish("test", &Event{Data: []byte("old")})
+			So(string((<-sub.connection).Data), ShouldEqual, "old")
+
+			clk.Advance(2 * time.Hour)
+			s.Publish("test", &Event{Data: []byte("new")})
+			for ev := range sub.connection {
+				if string(ev.Data) == "new" {
+					break
+				}
+			}
+
+			So(str.Eventlog, ShouldHaveLength, 1)
+			So(string(str.Eventlog[0].Data), ShouldEqual, "new")
+		})
+	})
+}
@@ -0,0 +1,146 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/r3labs/sse"
+)
+
+// bench collects the measurements of every subscription
+type bench struct {
+	mu              sync.Mutex
+	connectLatency  []time.Duration
+	eventLatency    []time.Duration
+	clients         int
+	connected       int64
+	attempts        int64
+	failedConnects  int64
+	events          int64
+	dropped         int64
+	subscribeErrors int64
+}
+
+func newBench(clients int) *bench {
+	return &bench{clients: clients}
+}
+
+// run opens the subscriptions, spread over rampUp, and waits for duration
+func (b *bench) run(url, stream string, rampUp, duration time.Duration) {
+	interval := rampUp / time.Duration(b.clients)
+
+	for i := 0; i < b.clients; i++ {
+		go b.subscribe(url, stream)
+		time.Sleep(interval)
+	}
+
+	time.Sleep(duration - rampUp)
+}
+
+// subscribe runs a single subscription, reconnecting as the client does
+func (b *bench) subscribe(url, stream string) {
+	client := sse.NewClient(url)
+	client.Connection = &http.Client{Transport: &timingTransport{bench: b}}
+
+	var last uint64
+	seen := false
+
+	err := client.Subscribe(stream, func(ev *sse.Event) {
+		received := time.Now()
+		atomic.AddInt64(&b.events, 1)
+
+		// Ids are sequential when published by the serve mode
+		if id, err := strconv.ParseUint(string(ev.ID), 10, 64); err == nil {
+			if seen && id > last+1 {
+				atomic.AddInt64(&b.dropped, int64(id-last-1))
+			}
+			last, seen = id, true
+		}
+
+		// The data starts with the time the event was published
+		if i := bytes.IndexByte(ev.Data, ' '); i > 0 {
+			if sent, err := strconv.ParseInt(string(ev.Data[:i]), 10, 64); err == nil {
+				b.record(&b.eventLatency, received.Sub(time.Unix(0, sent)))
+			}
+		}
+	})
+	if err != nil {
+		atomic.AddInt64(&b.subscribeErrors, 1)
+	}
+}
+
+func (b *bench) record(samples *[]time.Duration, d time.Duration) {
+	b.mu.Lock()
+	*samples = append(*samples, d)
+	b.mu.Unlock()
+}
+
+// report writes a summary of the measurements
+func (b *bench) report(w io.Writer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Every attempt after a client's first is a reconnect
+	reconnects := atomic.LoadInt64(&b.attempts) - int64(b.clients)
+	if reconnects < 0 {
+		reconnects = 0
+	}
+	connected := atomic.LoadInt64(&b.connected)
+
+	fmt.Fprintf(w, "clients:          %d\n", b.clients)
+	fmt.Fprintf(w, "connections:      %d (%d failed)\n", connected, atomic.LoadInt64(&b.failedConnects))
+	fmt.Fprintf(w, "reconnects:       %d\n", reconnects)
+	fmt.Fprintf(w, "gave up:          %d\n", atomic.LoadInt64(&b.subscribeErrors))
+	fmt.Fprintf(w, "connect latency:  %s\n", percentiles(b.connectLatency))
+	fmt.Fprintf(w, "events:           %d\n", atomic.LoadInt64(&b.events))
+	fmt.Fprintf(w, "dropped:          %d\n", atomic.LoadInt64(&b.dropped))
+	fmt.Fprintf(w, "event latency:    %s\n", percentiles(b.eventLatency))
+}
+
+// percentiles summarizes samples, which are sorted in place
+func percentiles(samples []time.Duration) string {
+	if len(samples) == 0 {
+		return "n/a"
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	at := func(p float64) time.Duration {
+		return samples[int(float64(len(samples)-1)*p)]
+	}
+
+	return fmt.Sprintf("p50 %s  p90 %s  p99 %s  max %s", at(0.5), at(0.9), at(0.99), samples[len(samples)-1])
+}
+
+// timingTransport measures how long each connection takes to be established,
+// up to the response headers
+type timingTransport struct {
+	bench *bench
+}
+
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.bench.attempts, 1)
+
+	start := time.Now()
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		atomic.AddInt64(&t.bench.failedConnects, 1)
+		return resp, err
+	}
+
+	atomic.AddInt64(&t.bench.connected, 1)
+	t.bench.record(&t.bench.connectLatency, time.Since(start))
+	return resp, nil
+}
@@ -0,0 +1,65 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Command sse-bench load tests event stream servers. By default it opens a
+// number of concurrent subscriptions to a target and reports connect latency,
+// event latency percentiles, dropped events and reconnects:
+//
+//	sse-bench -clients 500 -duration 30s http://server/events
+//
+// With -serve, it runs a server publishing events at a fixed rate instead,
+// which the client mode can be pointed at:
+//
+//	sse-bench -serve -addr :8080 -rate 1000 -size 256
+//
+// Event latency and drops can only be measured for events published by the
+// serve mode, whose data starts with the time they were published and whose
+// ids are sequential. Latency assumes both ends share a clock.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	serve := flag.Bool("serve", false, "run a server publishing events instead of subscribing")
+	stream := flag.String("stream", "bench", "name of the stream")
+
+	// Client mode
+	clients := flag.Int("clients", 100, "number of concurrent subscriptions")
+	duration := flag.Duration("duration", 30*time.Second, "how long to run for")
+	rampUp := flag.Duration("ramp-up", time.Second, "time over which subscriptions are opened")
+
+	// Serve mode
+	addr := flag.String("addr", ":8080", "address to listen on")
+	rate := flag.Int("rate", 100, "events published per second")
+	size := flag.Int("size", 64, "size of the data of each event in bytes")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] url\n       %s -serve [flags]\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *serve {
+		runServer(*addr, *stream, *rate, *size)
+		return
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *clients < 1 {
+		fmt.Fprintln(os.Stderr, "-clients must be at least 1")
+		os.Exit(2)
+	}
+
+	b := newBench(*clients)
+	b.run(flag.Arg(0), *stream, *rampUp, *duration)
+	b.report(os.Stdout)
+}
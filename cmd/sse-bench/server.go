@@ -0,0 +1,64 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/r3labs/sse"
+)
+
+// publishTick is how often the serve mode publishes a batch of events
+const publishTick = 10 * time.Millisecond
+
+// runServer serves a stream, publishing rate events per second with size
+// bytes of data each
+func runServer(addr, stream string, rate, size int) {
+	server := sse.New()
+	server.AutoReplay = false
+	server.CreateStream(stream)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", server.HTTPHandler)
+	go func() {
+		log.Fatal(http.ListenAndServe(addr, mux))
+	}()
+
+	log.Printf("publishing %d events per second to stream %q on %s/events", rate, stream, addr)
+
+	padding := bytes.Repeat([]byte("x"), size)
+	ticker := time.NewTicker(publishTick)
+	report := time.NewTicker(time.Second)
+
+	var published, due float64
+	perTick := float64(rate) * publishTick.Seconds()
+	for {
+		select {
+		case <-ticker.C:
+			// Carry fractions of events over to the next tick
+			for due += perTick; due >= 1; due-- {
+				server.Publish(stream, &sse.Event{Data: eventData(padding)})
+				published++
+			}
+		case <-report.C:
+			log.Printf("published %.0f events", published)
+		}
+	}
+}
+
+// eventData returns the publishing time followed by padding, truncated to the
+// size of the padding unless the time does not fit
+func eventData(padding []byte) []byte {
+	data := strconv.AppendInt(nil, time.Now().UnixNano(), 10)
+	data = append(data, ' ')
+	if len(data) < len(padding) {
+		data = append(data, padding[len(data):]...)
+	}
+	return data
+}
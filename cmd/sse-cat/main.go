@@ -0,0 +1,96 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Command sse-cat connects to an event stream and prints its events, either in
+// the event stream format or as newline delimited JSON.
+//
+//	sse-cat -stream messages -H "Authorization: Bearer token" http://server/events
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/r3labs/sse"
+)
+
+// headers collects repeated -H flags
+type headers map[string]string
+
+func (h headers) String() string {
+	return fmt.Sprint(map[string]string(h))
+}
+
+func (h headers) Set(value string) error {
+	i := strings.IndexByte(value, ':')
+	if i < 0 {
+		return fmt.Errorf("header %q is not of the form \"Name: value\"", value)
+	}
+	h[strings.TrimSpace(value[:i])] = strings.TrimSpace(value[i+1:])
+	return nil
+}
+
+func main() {
+	hdrs := headers{}
+	flag.Var(hdrs, "H", "request header of the form \"Name: value\", may be repeated")
+	stream := flag.String("stream", "", "name of the stream to subscribe to")
+	lastEventID := flag.String("last-event-id", "", "id of the last event received, to resume from")
+	base64 := flag.Bool("base64", false, "decode the data of each event from base64")
+	format := flag.String("format", "text", "output format, text or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] url\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	var print func(*sse.Event) error
+	switch *format {
+	case "text":
+		print = func(ev *sse.Event) error {
+			text, err := ev.MarshalText()
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(text)
+			return err
+		}
+	case "json":
+		enc := json.NewEncoder(out)
+		print = func(ev *sse.Event) error {
+			return enc.Encode(ev)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	client := sse.NewClient(flag.Arg(0))
+	client.Headers = hdrs
+	client.EventID = *lastEventID
+	client.EncodingBase64 = *base64
+	client.OnError = func(err error, raw []byte) {
+		fmt.Fprintf(os.Stderr, "sse-cat: %s: %q\n", err, raw)
+	}
+
+	err := client.Subscribe(*stream, func(ev *sse.Event) {
+		if err := print(ev); err != nil {
+			fmt.Fprintln(os.Stderr, "sse-cat:", err)
+		}
+		out.Flush()
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sse-cat:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,77 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Command sse-serve reads lines from stdin and serves each one as an event,
+// for prototyping and for piping the output of a job to a browser.
+//
+//	long-running-job | sse-serve -addr :8080 -stream logs
+//
+// With -json, each line is an event encoded as JSON instead, such as
+// {"event":"progress","data":"50%"}.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/r3labs/sse"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	path := flag.String("path", "/events", "path events are served on")
+	stream := flag.String("stream", "stdin", "name of the stream events are published to")
+	replay := flag.Int("replay", 100, "number of events replayed to new subscribers, 0 disables replay")
+	heartbeat := flag.Duration("heartbeat", 15*time.Second, "interval between comments keeping idle connections open, 0 disables them")
+	jsonLines := flag.Bool("json", false, "read events encoded as JSON, one per line")
+	ndjson := flag.Bool("ndjson", false, "serve newline-delimited JSON to clients preferring it in their Accept header")
+	flag.Parse()
+
+	server := sse.New()
+	server.AutoReplay = *replay > 0
+	server.ReplaySize = *replay
+	server.NDJSON = *ndjson
+	server.DefaultStream = *stream
+	server.CreateStream(*stream)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(*path, server.HTTPHandler)
+
+	go func() {
+		log.Fatal(http.ListenAndServe(*addr, mux))
+	}()
+
+	if *heartbeat > 0 {
+		go func() {
+			for range time.Tick(*heartbeat) {
+				server.Publish(*stream, &sse.Event{Comment: []byte("ping")})
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		ev := &sse.Event{Data: append([]byte(nil), scanner.Bytes()...)}
+		if *jsonLines {
+			ev = &sse.Event{}
+			if err := json.Unmarshal(scanner.Bytes(), ev); err != nil {
+				fmt.Fprintln(os.Stderr, "sse-serve: skipping line:", err)
+				continue
+			}
+		}
+		server.Publish(*stream, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Keep serving the events that have been read
+	select {}
+}
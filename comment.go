@@ -0,0 +1,29 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+// PublishComment sends a comment to every client of a stream, such as a
+// heartbeat or metadata for clients watching with Client.OnComment. Comments
+// on their own are neither numbered nor recorded for replay, and multi-line
+// comments are sent as one comment line each.
+func (s *Server) PublishComment(id, comment string) error {
+	return s.Publish(id, &Event{Comment: []byte(comment)})
+}
+
+// observeFields passes the comment and retry field of a frame to OnComment
+// and OnRetryInterval
+func (c *Client) observeFields(msg *Event) {
+	if msg == nil {
+		return
+	}
+	if c.OnComment != nil && msg.Comment != nil {
+		c.OnComment(msg.Comment)
+	}
+	if c.OnRetryInterval != nil {
+		if retry, ok := msg.RetryInterval(); ok {
+			c.OnRetryInterval(retry)
+		}
+	}
+}
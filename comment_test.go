@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestComments(t *testing.T) {
+	Convey("Given a client watching comments and retry fields", t, func() {
+		s := New()
+		s.AutoReplay = false
+		s.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		comments := make(chan string, 4)
+		retries := make(chan time.Duration, 4)
+		c := NewClient(server.URL)
+		c.OnComment = func(comment []byte) {
+			comments <- string(comment)
+		}
+		c.OnRetryInterval = func(retry time.Duration) {
+			retries <- retry
+		}
+
+		events := make(chan *Event)
+		ctx, cancel := context.WithCancel(context.Background())
+		Reset(cancel)
+		c.OnConnect = func(*Client, Framing) {
+			go func() {
+				s.PublishComment("test", "hello\nworld")
+				s.Publish("test", &Event{Retry: []byte("1500")})
+				s.Publish("test", &Event{Comment: []byte("meta"), Data: []byte("msg")})
+			}()
+		}
+		go c.SubscribeWithContext(ctx, "test", func(msg *Event) {
+			events <- msg
+		})
+
+		Convey("They should be observed along with the events", func() {
+			select {
+			case ev := <-events:
+				So(string(ev.Data), ShouldEqual, "msg")
+				So(string(ev.Comment), ShouldEqual, "meta")
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+			So(<-comments, ShouldEqual, "hello\nworld")
+			So(<-comments, ShouldEqual, "meta")
+			So(<-retries, ShouldEqual, 1500*time.Millisecond)
+		})
+	})
+}
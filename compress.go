@@ -0,0 +1,191 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrCompressWithoutBase64 is returned when publishing with
+// Server.CompressData set, but neither EncodeBase64 nor Keys, as the
+// compressed data is binary, which an event stream can not carry
+var ErrCompressWithoutBase64 = errors.New("compressed data requires EncodeBase64")
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// compressData gzip compresses the data of an event
+func compressData(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(zw)
+
+	zw.Reset(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// minPackedSize is the smallest data compressed in the eventlog, as gzip's
+// overhead outweighs the savings for shorter data
+const minPackedSize = 256
+
+// packEvent returns a copy of an event with its data compressed, for keeping
+// in the eventlog, or the event itself if compression does not pay off
+func packEvent(ev *Event) *Event {
+	if len(ev.Data) < minPackedSize {
+		return ev
+	}
+
+	data := compressData(ev.Data)
+	if len(data) >= len(ev.Data) {
+		return ev
+	}
+
+	packed := *ev
+	packed.Data = data
+	packed.packed = true
+	return &packed
+}
+
+// unpackEvent returns an event compressed by packEvent with its original data
+func unpackEvent(ev *Event) (*Event, error) {
+	if !ev.packed {
+		return ev, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(ev.Data))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	unpacked := *ev
+	unpacked.Data = data
+	unpacked.packed = false
+	return &unpacked, nil
+}
+
+// checkCompression reports ErrCompressWithoutBase64 if the server compresses
+// data without encoding or encrypting it
+func (s *Server) checkCompression() error {
+	if s.CompressData && !s.EncodeBase64 && s.Keys == nil {
+		return ErrCompressWithoutBase64
+	}
+	return nil
+}
+
+// decompress gzip decompressed data into the parser's buffer, which is reused
+// for every event
+func (p *eventParser) decompress(data []byte) ([]byte, error) {
+	src := bytes.NewReader(data)
+	if p.inflate == nil {
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		p.inflate = zr
+	} else if err := p.inflate.Reset(src); err != nil {
+		return nil, err
+	}
+
+	// Data inflating beyond the size of an event is rejected, rather than
+	// decompressed into memory as a whole
+	limit := p.maxSize
+	if limit <= 0 {
+		limit = eventStreamBufferSize
+	}
+	buf := bytes.NewBuffer(p.inflated[:0])
+	if _, err := buf.ReadFrom(io.LimitReader(p.inflate, int64(limit)+1)); err != nil {
+		return nil, err
+	}
+	p.inflated = buf.Bytes()
+	if len(p.inflated) > limit {
+		return nil, ErrEventTooLarge
+	}
+	return p.inflated, nil
+}
+
+// gunzipReader decompresses streamed data as it is read
+type gunzipReader struct {
+	src io.Reader
+	zr  *gzip.Reader
+}
+
+func (g *gunzipReader) Read(p []byte) (int, error) {
+	if g.zr == nil {
+		// Events without data have nothing to decompress, which gzip
+		// reports as io.EOF
+		zr, err := gzip.NewReader(g.src)
+		if err != nil {
+			return 0, err
+		}
+		g.zr = zr
+	}
+	return g.zr.Read(p)
+}
+
+// decodeContent decompresses the body of a response compressed with gzip or
+// deflate as it is read. The bodies of responses in other encodings are
+// closed, and an error is returned.
+func decodeContent(resp *http.Response) error {
+	var open func(r io.Reader) (io.Reader, error)
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		open = func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }
+	case "deflate":
+		open = func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+
+	resp.Body = &decodedBody{body: resp.Body, open: open}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decodedBody decompresses a response body as it is read. The decompressor is
+// only created on the first read, as it reads the header of the compressed
+// stream, which servers may not send before the first event.
+type decodedBody struct {
+	body io.ReadCloser
+	open func(r io.Reader) (io.Reader, error)
+	r    io.Reader
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.r == nil {
+		r, err := b.open(b.body)
+		if err != nil {
+			return 0, err
+		}
+		b.r = r
+	}
+	return b.r.Read(p)
+}
+
+func (b *decodedBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,227 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/cenkalti/backoff.v1"
+)
+
+func TestCompressedData(t *testing.T) {
+	Convey("Given a server compressing event data", t, func() {
+		srv := New()
+		srv.AutoReplay = false
+		srv.CompressData = true
+		srv.EncodeBase64 = true
+		srv.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		c := NewClient(server.URL)
+		c.EncodingBase64 = true
+		c.DecompressData = true
+
+		payload := strings.Repeat("compressible ", 100)
+		publish := func() {
+			for srv.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+			srv.Publish("test", &Event{Data: []byte(payload)})
+		}
+
+		Convey("Subscribe should pass handlers the original data", func() {
+			events := make(chan *Event, 1)
+			go c.Subscribe("test", func(msg *Event) {
+				events <- msg
+			})
+			publish()
+
+			select {
+			case msg := <-events:
+				So(string(msg.Data), ShouldEqual, payload)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("SubscribeReader should stream the original data", func() {
+			data := make(chan []byte, 1)
+			go c.SubscribeReader("test", func(ev *EventReader) {
+				b, _ := io.ReadAll(ev)
+				data <- b
+			})
+			publish()
+
+			select {
+			case b := <-data:
+				So(string(b), ShouldEqual, payload)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Reset(func() {
+			srv.Close()
+		})
+	})
+
+	Convey("Given a parser decompressing event data", t, func() {
+		p := &eventParser{base64: true, gunzip: true}
+
+		Convey("It should reuse its buffers across events", func() {
+			for _, data := range []string{"first", "second"} {
+				var frame bytes.Buffer
+				ev := (&Server{CompressData: true, EncodeBase64: true}).process(&Event{Data: []byte(data)})
+				writeEvent(&frame, ev, 0)
+
+				ev, err := p.parse(frame.Bytes())
+				So(err, ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, data)
+			}
+		})
+
+		Convey("Data that is not compressed should be reported", func() {
+			_, err := p.parse([]byte("data: bm90IGd6aXA=\n"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Data inflating beyond the maximum size should be rejected", func() {
+			p.maxSize = 1024
+			var frame bytes.Buffer
+			ev := (&Server{CompressData: true, EncodeBase64: true}).process(&Event{Data: bytes.Repeat([]byte("a"), 4096)})
+			writeEvent(&frame, ev, 0)
+
+			_, err := p.parse(frame.Bytes())
+			So(errors.Is(err, ErrEventTooLarge), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a server compressing data without encoding it", t, func() {
+		srv := New()
+		srv.CompressData = true
+		srv.CreateStream("test")
+
+		Reset(func() {
+			srv.Close()
+		})
+
+		Convey("Publishing should be rejected", func() {
+			So(srv.Publish("test", &Event{Data: []byte("binary")}), ShouldEqual, ErrCompressWithoutBase64)
+			So(srv.TryPublish("test", &Event{Data: []byte("binary")}), ShouldBeFalse)
+		})
+	})
+}
+
+func TestCompressedReplay(t *testing.T) {
+	Convey("Given a stream compressing its eventlog", t, func() {
+		s := New()
+		s.CompressReplay = true
+		str := s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		large := strings.Repeat("compressible ", 100)
+		s.Publish("test", &Event{Data: []byte(large)})
+		s.Publish("test", &Event{Data: []byte("small")})
+		for str.Sequence() < 2 {
+			str.SubscriberCount()
+		}
+		str.SubscriberCount()
+
+		Convey("Large events should be kept compressed", func() {
+			So(str.Eventlog, ShouldHaveLength, 2)
+			So(str.Eventlog[0].packed, ShouldBeTrue)
+			So(len(str.Eventlog[0].Data), ShouldBeLessThan, len(large))
+			So(str.Eventlog[1].packed, ShouldBeFalse)
+		})
+
+		Convey("Replay should restore the original data", func() {
+			sub := str.addSubscriber("0")
+			events := collect([]*Subscriber{sub}, 2)
+			So(string(events[0][0].Data), ShouldEqual, large)
+			So(string(events[0][1].Data), ShouldEqual, "small")
+			So(events[0][0].packed, ShouldBeFalse)
+		})
+	})
+}
+
+func TestCompressedResponse(t *testing.T) {
+	Convey("Given a gateway compressing event streams", t, func() {
+		var accepted string
+		encoding := "gzip"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accepted = r.Header.Get("Accept-Encoding")
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Content-Encoding", encoding)
+
+			var zw io.WriteCloser
+			switch encoding {
+			case "gzip":
+				zw = gzip.NewWriter(w)
+			case "deflate":
+				zw = zlib.NewWriter(w)
+			default:
+				zw = nopWriteCloser{w}
+			}
+			io.WriteString(zw, "id: 1\ndata: hello\n\n")
+			zw.Close()
+		}))
+		defer server.Close()
+
+		c := NewClient(server.URL)
+		c.AcceptEncoding = "gzip, deflate"
+		subscribe := func() (string, error) {
+			var data string
+			err := c.Subscribe("", func(msg *Event) {
+				data = string(msg.Data)
+			})
+			return data, err
+		}
+
+		Convey("Gzip compressed events should be decompressed", func() {
+			data, err := subscribe()
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, "hello")
+			So(accepted, ShouldEqual, "gzip, deflate")
+		})
+
+		Convey("Deflate compressed events should be decompressed", func() {
+			encoding = "deflate"
+			data, err := subscribe()
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, "hello")
+		})
+
+		Convey("Other encodings should be rejected", func() {
+			encoding = "br"
+			c.ReconnectStrategy = func() backoff.BackOff {
+				return backoff.WithMaxTries(&backoff.ZeroBackOff{}, 1)
+			}
+			_, err := subscribe()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "br")
+		})
+	})
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,76 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "time"
+
+// Config holds the settings of a server that can be changed while it is
+// running, see UpdateConfig. Each field is the server field of the same name.
+type Config struct {
+	KeepAlive             time.Duration
+	MaxSubscribers        int
+	MaxHealthySubscribers int
+	MaxLineLength         int
+	ReplaySize            int
+	AllowedOrigins        []string
+	AllowCredentials      bool
+}
+
+// Config returns the server's current settings
+func (s *Server) Config() Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Config{
+		KeepAlive:             s.KeepAlive,
+		MaxSubscribers:        s.MaxSubscribers,
+		MaxHealthySubscribers: s.MaxHealthySubscribers,
+		MaxLineLength:         s.MaxLineLength,
+		ReplaySize:            s.ReplaySize,
+		AllowedOrigins:        copyOrigins(s.AllowedOrigins),
+		AllowCredentials:      s.AllowCredentials,
+	}
+}
+
+// UpdateConfig changes the settings of a running server, such as from a
+// watcher of its configuration file, without dropping its subscribers. It is
+// safe to call concurrently with the server's handlers, unlike setting the
+// fields directly.
+//
+// Streams take on the stream settings: keep-alive comments are sent at the new
+// interval, eventlogs are trimmed to the new replay size, and the subscriber
+// limit applies to new subscribers, leaving any over it connected. Streams
+// created from templates keep the settings of their template. Requests and
+// health checks take on the other settings as they arrive.
+func (s *Server) UpdateConfig(cfg Config) {
+	s.mu.Lock()
+	s.KeepAlive = cfg.KeepAlive
+	s.MaxSubscribers = cfg.MaxSubscribers
+	s.MaxHealthySubscribers = cfg.MaxHealthySubscribers
+	s.MaxLineLength = cfg.MaxLineLength
+	s.ReplaySize = cfg.ReplaySize
+	s.AllowedOrigins = copyOrigins(cfg.AllowedOrigins)
+	s.AllowCredentials = cfg.AllowCredentials
+	streams := make([]*Stream, 0, len(s.Streams))
+	for _, str := range s.Streams {
+		if !str.templated {
+			streams = append(streams, str)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, str := range streams {
+		str.update(cfg)
+	}
+}
+
+// copyOrigins copies a list of origins, keeping an empty list, which allows no
+// origin, apart from nil, which allows every origin
+func copyOrigins(origins []string) []string {
+	if origins == nil {
+		return nil
+	}
+	return append([]string{}, origins...)
+}
@@ -0,0 +1,133 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpdateConfig(t *testing.T) {
+	Convey("Given a running server", t, func() {
+		s := New()
+		str := s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("Its settings should be returned", func() {
+			s.UpdateConfig(Config{ReplaySize: 3, AllowedOrigins: []string{}})
+			cfg := s.Config()
+			So(cfg.ReplaySize, ShouldEqual, 3)
+			So(cfg.AllowedOrigins, ShouldNotBeNil)
+			So(cfg.AllowedOrigins, ShouldBeEmpty)
+		})
+
+		Convey("Subscribers should receive keep-alive comments at the new interval", func() {
+			sub := str.addSubscriber("0")
+			s.UpdateConfig(Config{KeepAlive: 10 * time.Millisecond})
+
+			select {
+			case ev := <-sub.connection:
+				So(string(ev.Comment), ShouldEqual, "ping")
+			case <-time.After(time.Second):
+				So("no keep-alive", ShouldBeEmpty)
+			}
+		})
+
+		Convey("Streams with a keep-alive interval of their own should keep it", func() {
+			sub := str.addSubscriber("0")
+			str.SetKeepAlive(10 * time.Millisecond)
+			s.UpdateConfig(Config{KeepAlive: time.Hour})
+
+			for i := 0; i < 2; i++ {
+				select {
+				case ev := <-sub.connection:
+					So(string(ev.Comment), ShouldEqual, "ping")
+				case <-time.After(time.Second):
+					So("no keep-alive", ShouldBeEmpty)
+				}
+			}
+		})
+
+		Convey("The eventlog should be trimmed to the new replay size", func() {
+			for i := 0; i < 5; i++ {
+				s.Publish("test", &Event{Data: []byte("msg")})
+			}
+			s.UpdateConfig(Config{ReplaySize: 2})
+
+			sub := str.addSubscriber("0")
+			received := collect([]*Subscriber{sub}, 2)[0]
+			So(string(received[0].ID), ShouldEqual, "3")
+			So(string(received[1].ID), ShouldEqual, "4")
+		})
+
+		Convey("New streams should take on the settings", func() {
+			s.UpdateConfig(Config{MaxSubscribers: 1})
+			So(s.CreateStream("other").MaxSubscribers, ShouldEqual, 1)
+		})
+
+		Convey("New subscribers over the limit should be turned away", func() {
+			s.UpdateConfig(Config{MaxSubscribers: 1})
+			str.addSubscriber("0")
+
+			w := httptest.NewRecorder()
+			s.HTTPHandler(w, httptest.NewRequest(http.MethodGet, "/events?stream=test", nil))
+			So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+		})
+
+		Convey("Subscribers joining at once should not exceed the limit", func() {
+			s.UpdateConfig(Config{MaxSubscribers: 2})
+
+			var wg sync.WaitGroup
+			var joined atomic.Int32
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if str.join(str.newSubscriber("")) {
+						joined.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			So(joined.Load(), ShouldEqual, 2)
+			So(str.SubscriberCount(), ShouldEqual, 2)
+		})
+
+		Convey("Streams created from templates should keep their settings", func() {
+			s.DefineTemplate("small", StreamTemplate{MaxSubscribers: 5, ReplaySize: 10})
+			tmpl, err := s.CreateStreamFrom("small", "templated")
+			So(err, ShouldBeNil)
+
+			s.UpdateConfig(Config{MaxSubscribers: 1, ReplaySize: 1})
+			for i := 0; i < 2; i++ {
+				So(tmpl.join(tmpl.newSubscriber("")), ShouldBeTrue)
+			}
+			So(tmpl.ReplaySize, ShouldEqual, 10)
+		})
+
+		Convey("Only allowed origins should be sent back", func() {
+			s.UpdateConfig(Config{AllowedOrigins: []string{"https://example.com"}})
+
+			origin := func(from string) string {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodGet, "/events", nil)
+				r.Header.Set("Origin", from)
+				s.HTTPHandler(w, r)
+				return w.Header().Get("Access-Control-Allow-Origin")
+			}
+			So(origin("https://example.com"), ShouldEqual, "https://example.com")
+			So(origin("https://evil.example"), ShouldBeEmpty)
+		})
+	})
+}
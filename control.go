@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "errors"
+
+// Names of the control events signalling the end of a connection, see
+// Server.ControlEvents
+const (
+	// GoAwayEvent is sent when the server shuts down, so clients can
+	// reconnect to another node right away
+	GoAwayEvent = "goaway"
+	// StreamClosedEvent is sent when the stream is removed, so clients stop
+	// reconnecting to it
+	StreamClosedEvent = "stream-closed"
+)
+
+// ControlAction is what a client does when it receives a control event
+type ControlAction int
+
+const (
+	// ControlNotify only passes the event to Client.OnControl
+	ControlNotify ControlAction = iota
+	// ControlReconnect drops the connection and reconnects without waiting
+	ControlReconnect
+	// ControlStop ends the subscription without reconnecting
+	ControlStop
+)
+
+// DefaultControlEvents are the actions for the control events a Server sends,
+// for Client.ControlEvents
+var DefaultControlEvents = map[string]ControlAction{
+	GoAwayEvent:       ControlReconnect,
+	StreamClosedEvent: ControlStop,
+}
+
+// errReconnect makes a subscription reconnect without backing off
+var errReconnect = errors.New("reconnect requested by server")
+
+// control reports the action for a control event, passing it to OnControl,
+// or false if the event is not a control event
+func (c *Client) control(ev *Event) (ControlAction, bool) {
+	action, ok := c.ControlEvents[string(ev.Event)]
+	if ok && c.OnControl != nil {
+		c.OnControl(ev)
+	}
+	return action, ok
+}
+
+// endsSubscription reports whether a control action ends the current
+// connection, along with the error to end it with
+func endsSubscription(action ControlAction) (bool, error) {
+	switch action {
+	case ControlReconnect:
+		return true, errReconnect
+	case ControlStop:
+		return true, nil
+	}
+	return false, nil
+}
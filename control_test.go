@@ -0,0 +1,102 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClientControlEvents(t *testing.T) {
+	Convey("Given a server that sends a goaway event on the first connection", t, func() {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				io.WriteString(w, "event: goaway\n\ndata: lost\n\n")
+				return
+			}
+			io.WriteString(w, "data: hello\n\n")
+		}))
+
+		clk := newFakeClock()
+		c := NewClient(server.URL)
+		c.clock = clk
+		c.ControlEvents = DefaultControlEvents
+
+		var control []string
+		c.OnControl = func(ev *Event) {
+			control = append(control, string(ev.Event))
+		}
+
+		var received []string
+		subscribe := func() error {
+			return c.Subscribe("", func(msg *Event) {
+				received = append(received, string(msg.Data))
+			})
+		}
+
+		Convey("The client should reconnect without backing off", func() {
+			So(subscribe(), ShouldBeNil)
+			So(atomic.LoadInt32(&attempts), ShouldEqual, 2)
+			So(control, ShouldResemble, []string{GoAwayEvent})
+			So(received, ShouldResemble, []string{"hello"})
+		})
+
+		Convey("Control events can be handled like any other event", func() {
+			c.ControlEvents = nil
+			So(subscribe(), ShouldBeNil)
+			So(atomic.LoadInt32(&attempts), ShouldEqual, 1)
+			So(control, ShouldBeEmpty)
+			So(received, ShouldResemble, []string{"", "lost"})
+		})
+	})
+}
+
+func TestServerControlEvents(t *testing.T) {
+	Convey("Given a server sending control events", t, func() {
+		srv := New()
+		srv.ControlEvents = true
+		srv.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		c := NewClient(server.URL)
+		c.ControlEvents = DefaultControlEvents
+		control := make(chan string, 1)
+		c.OnControl = func(ev *Event) {
+			control <- string(ev.Event)
+		}
+
+		Convey("Subscriptions should end when their stream is removed", func() {
+			done := make(chan error)
+			go func() {
+				done <- c.Subscribe("test", func(msg *Event) {})
+			}()
+			for srv.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+
+			srv.RemoveStream("test")
+
+			select {
+			case err := <-done:
+				So(err, ShouldBeNil)
+				So(<-control, ShouldEqual, StreamClosedEvent)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Reset(func() {
+			srv.Close()
+		})
+	})
+}
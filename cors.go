@@ -0,0 +1,75 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// preflightMaxAge is how long browsers may cache the answer to a preflight
+// request
+const preflightMaxAge = 10 * time.Minute
+
+// setCORSHeaders allows the request's origin to read the response, if it is
+// one of AllowedOrigins. Credentials are only allowed for origins listed by
+// name, never for any origin.
+func (s *Server) setCORSHeaders(w http.ResponseWriter, r *http.Request, cfg Config) {
+	h := w.Header()
+
+	origin := allowedOrigin(cfg.AllowedOrigins, r)
+	if origin != "" {
+		h.Set("Access-Control-Allow-Origin", origin)
+		if cfg.AllowCredentials && origin != "*" {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+	if cfg.AllowedOrigins != nil {
+		h.Add("Vary", "Origin")
+	}
+}
+
+// preflight answers a CORS preflight request, which browsers send before
+// subscriptions with headers of their own, such as Authorization or
+// Last-Event-ID, or with another method than GET
+func (s *Server) preflight(w http.ResponseWriter, r *http.Request) {
+	s.setCORSHeaders(w, r, s.Config())
+
+	h := w.Header()
+	if h.Get("Access-Control-Allow-Origin") != "" {
+		h.Set("Access-Control-Allow-Methods", "GET, POST")
+		if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(preflightMaxAge.Seconds())))
+	}
+	if s.ResponseHeaders != nil {
+		s.ResponseHeaders(h, r)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin of a response, or ""
+// if the request's origin is not allowed. Origins listed by name take
+// precedence over a "*" entry.
+func allowedOrigin(allowed []string, r *http.Request) string {
+	if allowed == nil {
+		return "*"
+	}
+
+	origin := r.Header.Get("Origin")
+	anyOrigin := false
+	for _, o := range allowed {
+		if origin != "" && o == origin {
+			return origin
+		}
+		anyOrigin = anyOrigin || o == "*"
+	}
+	if anyOrigin {
+		return "*"
+	}
+	return ""
+}
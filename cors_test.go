@@ -0,0 +1,83 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCORS(t *testing.T) {
+	Convey("Given a server allowing a single origin", t, func() {
+		s := New()
+		s.AllowedOrigins = []string{"https://example.com"}
+
+		Reset(func() {
+			s.Close()
+		})
+
+		preflight := func(origin string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodOptions, "/events?stream=test", nil)
+			r.Header.Set("Origin", origin)
+			r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			r.Header.Set("Access-Control-Request-Headers", "authorization, last-event-id")
+			s.HTTPHandler(w, r)
+			return w
+		}
+
+		Convey("Preflight requests from it should be allowed", func() {
+			w := preflight("https://example.com")
+			So(w.Code, ShouldEqual, http.StatusNoContent)
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://example.com")
+			So(w.Header().Get("Access-Control-Allow-Methods"), ShouldContainSubstring, "GET")
+			So(w.Header().Get("Access-Control-Allow-Headers"), ShouldEqual, "authorization, last-event-id")
+			So(w.Header().Get("Access-Control-Max-Age"), ShouldEqual, "600")
+		})
+
+		Convey("Preflight requests from other origins should not be allowed", func() {
+			w := preflight("https://evil.example")
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldBeEmpty)
+			So(w.Header().Get("Access-Control-Allow-Methods"), ShouldBeEmpty)
+		})
+
+		Convey("With credentials, only listed origins should be sent them", func() {
+			s.AllowedOrigins = []string{"*", "https://example.com"}
+			s.AllowCredentials = true
+			w := preflight("https://example.com")
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://example.com")
+			So(w.Header().Get("Access-Control-Allow-Credentials"), ShouldEqual, "true")
+			So(w.Header().Values("Vary"), ShouldContain, "Origin")
+
+			w = preflight("https://other.example")
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "*")
+			So(w.Header().Get("Access-Control-Allow-Credentials"), ShouldBeEmpty)
+		})
+
+		Convey("With credentials, no origin should be sent them if any is allowed", func() {
+			s.AllowedOrigins = nil
+			s.AllowCredentials = true
+			w := preflight("https://other.example")
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "*")
+			So(w.Header().Get("Access-Control-Allow-Credentials"), ShouldBeEmpty)
+		})
+
+		Convey("Headers of its own should be added to responses", func() {
+			s.ResponseHeaders = func(h http.Header, r *http.Request) {
+				h.Set("X-Region", "eu")
+				h.Set("Cache-Control", "no-store")
+			}
+			w := httptest.NewRecorder()
+			s.HTTPHandler(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+			So(w.Header().Get("X-Region"), ShouldEqual, "eu")
+			So(w.Header().Get("Cache-Control"), ShouldEqual, "no-store")
+
+			So(preflight("https://example.com").Header().Get("X-Region"), ShouldEqual, "eu")
+		})
+	})
+}
@@ -0,0 +1,134 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+const (
+	cursorVersion = 1
+	// cursorVersionID is the version of cursors holding an event id
+	cursorVersionID = 2
+)
+
+// ErrInvalidCursor is returned when a resume cursor can not be decoded
+var ErrInvalidCursor = errors.New("invalid resume cursor")
+
+// Cursor is a position in a stream, issued to clients as an opaque token in
+// place of the raw event id. Clients hand the token back as their
+// Last-Event-ID, which leaves the server free to change how it stores and
+// numbers events without breaking resumption.
+type Cursor struct {
+	// Stream the position belongs to
+	Stream string
+	// Epoch identifies the server generation that issued the cursor.
+	// Positions from another epoch are not comparable.
+	Epoch int64
+	// Position of the event within the stream
+	Position uint64
+	// ID of the event, in place of its position, for streams with an
+	// IDGenerator
+	ID string
+}
+
+// String encodes the cursor as an opaque token
+func (c Cursor) String() string {
+	buf := make([]byte, 1, 1+3*binary.MaxVarintLen64+len(c.ID)+len(c.Stream))
+	buf[0] = cursorVersion
+	buf = binary.AppendVarint(buf, c.Epoch)
+	if c.ID != "" {
+		buf[0] = cursorVersionID
+		buf = binary.AppendUvarint(buf, uint64(len(c.ID)))
+		buf = append(buf, c.ID...)
+	} else {
+		buf = binary.AppendUvarint(buf, c.Position)
+	}
+	buf = append(buf, c.Stream...)
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// ParseCursor decodes a token created by Cursor.String
+func ParseCursor(token string) (Cursor, error) {
+	var c Cursor
+
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(buf) < 1 || (buf[0] != cursorVersion && buf[0] != cursorVersionID) {
+		return c, ErrInvalidCursor
+	}
+	version := buf[0]
+	buf = buf[1:]
+
+	epoch, n := binary.Varint(buf)
+	if n <= 0 {
+		return c, ErrInvalidCursor
+	}
+	buf = buf[n:]
+
+	position, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return c, ErrInvalidCursor
+	}
+	buf = buf[n:]
+
+	if version == cursorVersionID {
+		if position == 0 || position > uint64(len(buf)) {
+			return c, ErrInvalidCursor
+		}
+		c.ID = string(buf[:position])
+		buf = buf[position:]
+		position = 0
+	}
+
+	c.Epoch = epoch
+	c.Position = position
+	c.Stream = string(buf)
+
+	return c, nil
+}
+
+// cursorEncoder replaces event ids with cursors for subscribers of a stream.
+// Ids that are not sequence numbers, such as those of an IDGenerator, are
+// kept in the cursor as they are.
+func (s *Server) cursorEncoder(streamID string) func(*Event) *Event {
+	return func(ev *Event) *Event {
+		if len(ev.ID) == 0 {
+			return ev
+		}
+
+		cursor := Cursor{Stream: streamID, Epoch: s.epoch}
+		if position, err := strconv.ParseUint(string(ev.ID), 10, 64); err == nil {
+			cursor.Position = position
+		} else {
+			cursor.ID = string(ev.ID)
+		}
+		out := *ev
+		out.ID = []byte(cursor.String())
+		return &out
+	}
+}
+
+// resumeFrom translates a cursor presented by a reconnecting client into the
+// event id replay starts from. Ids that are not cursors are returned as is.
+func (s *Server) resumeFrom(streamID, eventid string) string {
+	cursor, err := ParseCursor(eventid)
+	if err != nil {
+		return eventid
+	}
+
+	// Positions issued for another stream or by a previous generation of the
+	// server can not be trusted, so replay everything that is available.
+	if cursor.Stream != streamID || cursor.Epoch != s.epoch {
+		return "0"
+	}
+	if cursor.ID != "" {
+		return idAfter(cursor.ID)
+	}
+	return strconv.FormatUint(cursor.Position+1, 10)
+}
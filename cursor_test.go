@@ -0,0 +1,90 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCursor(t *testing.T) {
+	Convey("Given a cursor", t, func() {
+		cursor := Cursor{Stream: "test", Epoch: 1541376000, Position: 42}
+
+		Convey("When encoding and parsing it", func() {
+			parsed, err := ParseCursor(cursor.String())
+
+			Convey("It should be unchanged", func() {
+				So(err, ShouldBeNil)
+				So(parsed, ShouldResemble, cursor)
+			})
+		})
+
+		Convey("When it holds a generated id", func() {
+			cursor := Cursor{Stream: "test", Epoch: 1541376000, ID: "01ARZ3NDEKTSV4RRFFQ69G5FAV"}
+			parsed, err := ParseCursor(cursor.String())
+
+			Convey("It should be unchanged", func() {
+				So(err, ShouldBeNil)
+				So(parsed, ShouldResemble, cursor)
+			})
+		})
+
+		Convey("When parsing a raw event id", func() {
+			_, err := ParseCursor("42")
+
+			Convey("It should be rejected", func() {
+				So(err, ShouldEqual, ErrInvalidCursor)
+			})
+		})
+	})
+
+	Convey("Given a server issuing cursors", t, func() {
+		s := New()
+		s.ResumeCursors = true
+
+		Convey("When a client resumes from one of its cursors", func() {
+			cursor := Cursor{Stream: "test", Epoch: s.epoch, Position: 5}
+
+			Convey("It should replay the events after its position", func() {
+				So(s.resumeFrom("test", cursor.String()), ShouldEqual, "6")
+			})
+		})
+
+		Convey("When a client resumes from a cursor of a previous epoch", func() {
+			cursor := Cursor{Stream: "test", Epoch: s.epoch - 1, Position: 5}
+
+			Convey("It should replay all available events", func() {
+				So(s.resumeFrom("test", cursor.String()), ShouldEqual, "0")
+			})
+		})
+
+		Convey("When events are written to a subscriber", func() {
+			ev := s.cursorEncoder("test")(&Event{ID: []byte("3"), Data: []byte("test")})
+
+			Convey("Their id should be replaced with a cursor", func() {
+				cursor, err := ParseCursor(string(ev.ID))
+				So(err, ShouldBeNil)
+				So(cursor.Position, ShouldEqual, 3)
+				So(cursor.Stream, ShouldEqual, "test")
+			})
+		})
+
+		Convey("When events with generated ids are written to a subscriber", func() {
+			ev := s.cursorEncoder("test")(&Event{ID: []byte("01ARZ3NDEKTSV4RRFFQ69G5FAV"), Data: []byte("test")})
+
+			Convey("Clients should resume after them", func() {
+				cursor, err := ParseCursor(string(ev.ID))
+				So(err, ShouldBeNil)
+				So(cursor.ID, ShouldEqual, "01ARZ3NDEKTSV4RRFFQ69G5FAV")
+
+				id := s.resumeFrom("test", string(ev.ID))
+				So(compareID("01ARZ3NDEKTSV4RRFFQ69G5FAV", id), ShouldBeLessThan, 0)
+				So(compareID("01ARZ3NDEKTSV4RRFFQ69G5FAW", id), ShouldBeGreaterThan, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,164 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DebugEntry is an event recorded by a stream's debug log, along with its
+// delivery to each subscriber
+type DebugEntry struct {
+	ID         string          `json:"id"`
+	Event      string          `json:"event,omitempty"`
+	Published  time.Time       `json:"published"`
+	Deliveries []DebugDelivery `json:"deliveries"`
+}
+
+// DebugDelivery is the outcome of writing an event to a subscriber
+type DebugDelivery struct {
+	// The client id the subscriber connected with, or its remote address
+	Subscriber string    `json:"subscriber"`
+	Time       time.Time `json:"time"`
+	// Why the event could not be written, empty if it was
+	Error string `json:"error,omitempty"`
+}
+
+// debugLog is a ring buffer of the last events published on a stream
+type debugLog struct {
+	mu      sync.Mutex
+	entries []debugRecord
+	next    int
+	// Entries by the event they record, to attribute deliveries
+	events map[*Event]*DebugEntry
+}
+
+// debugRecord is an entry of the debug log and the event it records
+type debugRecord struct {
+	event *Event
+	entry *DebugEntry
+}
+
+func newDebugLog(size int) *debugLog {
+	return &debugLog{
+		entries: make([]debugRecord, 0, size),
+		events:  make(map[*Event]*DebugEntry, size),
+	}
+}
+
+// record adds an event, evicting the oldest one once the log is full
+func (l *debugLog) record(ev *Event) {
+	entry := &DebugEntry{
+		ID:        string(ev.ID),
+		Event:     string(ev.Event),
+		Published: time.Now(),
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, debugRecord{ev, entry})
+	} else {
+		delete(l.events, l.entries[l.next].event)
+		l.entries[l.next] = debugRecord{ev, entry}
+		l.next = (l.next + 1) % len(l.entries)
+	}
+	l.events[ev] = entry
+}
+
+// deliver records the outcome of writing an event to a subscriber. Events
+// that are not in the log, such as replayed ones, are ignored.
+func (l *debugLog) deliver(ev *Event, subscriber string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := l.events[ev]
+	if entry == nil {
+		return
+	}
+
+	delivery := DebugDelivery{Subscriber: subscriber, Time: time.Now()}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	entry.Deliveries = append(entry.Deliveries, delivery)
+}
+
+// snapshot copies the entries, oldest first
+func (l *debugLog) snapshot() []DebugEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := make([]DebugEntry, 0, len(l.entries))
+	for i := range l.entries {
+		entry := *l.entries[(l.next+i)%len(l.entries)].entry
+		entry.Deliveries = append([]DebugDelivery(nil), entry.Deliveries...)
+		out = append(out, entry)
+	}
+	return out
+}
+
+// DebugLog returns the last events published on the stream with their
+// deliveries, oldest first. It is empty unless DebugSize is set.
+func (str *Stream) DebugLog() []DebugEntry {
+	if str.debug == nil {
+		return nil
+	}
+	return str.debug.snapshot()
+}
+
+// DebugHandler serves the debug log of the stream named by the stream query
+// parameter as JSON, see Server.DebugSize. The entries can be narrowed down to
+// an event with the id parameter and to the deliveries to a subscriber with
+// the subscriber parameter. As it reveals who receives what, it should only
+// be exposed to administrators.
+func (s *Server) DebugHandler(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+
+	query := r.URL.Query()
+	if !s.allowed(w, r, query.Get("stream")) {
+		return
+	}
+
+	str := s.getStream(query.Get("stream"))
+	if str == nil {
+		http.Error(w, "Stream not found!", http.StatusNotFound)
+		return
+	}
+
+	entries := str.DebugLog()
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if id := query.Get("id"); id != "" && entry.ID != id {
+			continue
+		}
+		if subscriber := query.Get("subscriber"); subscriber != "" {
+			deliveries := entry.Deliveries[:0]
+			for _, d := range entry.Deliveries {
+				if d.Subscriber == subscriber {
+					deliveries = append(deliveries, d)
+				}
+			}
+			entry.Deliveries = deliveries
+		}
+		filtered = append(filtered, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(filtered)
+}
+
+// subscriberName identifies a subscriber in debug logs
+func subscriberName(r *http.Request) string {
+	if client := r.URL.Query().Get("client"); client != "" {
+		return client
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,111 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDebugLog(t *testing.T) {
+	Convey("Given a debug log of two events", t, func() {
+		log := newDebugLog(2)
+
+		Convey("It should keep the last events, oldest first", func() {
+			for i := 0; i < 3; i++ {
+				log.record(&Event{ID: []byte(strconv.Itoa(i))})
+			}
+
+			entries := log.snapshot()
+			So(entries, ShouldHaveLength, 2)
+			So(entries[0].ID, ShouldEqual, "1")
+			So(entries[1].ID, ShouldEqual, "2")
+			So(log.events, ShouldHaveLength, 2)
+		})
+
+		Convey("It should record the deliveries of logged events", func() {
+			ev := &Event{ID: []byte("1")}
+			log.record(ev)
+			log.deliver(ev, "a", nil)
+			log.deliver(ev, "b", errors.New("broken pipe"))
+			log.deliver(&Event{ID: []byte("0")}, "a", nil)
+
+			deliveries := log.snapshot()[0].Deliveries
+			So(deliveries, ShouldHaveLength, 2)
+			So(deliveries[0].Subscriber, ShouldEqual, "a")
+			So(deliveries[0].Error, ShouldBeEmpty)
+			So(deliveries[1].Error, ShouldEqual, "broken pipe")
+		})
+	})
+}
+
+func TestDebugHandler(t *testing.T) {
+	Convey("Given a server keeping debug logs", t, func() {
+		s := New()
+		s.DebugSize = 10
+		s.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("When an event is delivered to a subscriber", func() {
+			c := NewClient(server.URL + "?client=alice")
+			events := make(chan *Event)
+			_, err := c.SubscribeChan("test", events)
+			So(err, ShouldBeNil)
+
+			for s.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			s.Publish("test", &Event{Data: []byte("hello")})
+			_, err = wait(events, time.Second)
+			So(err, ShouldBeNil)
+
+			query := func(params string) []DebugEntry {
+				rec := httptest.NewRecorder()
+				s.DebugHandler(rec, httptest.NewRequest(http.MethodGet, "/debug?stream=test"+params, nil))
+				So(rec.Code, ShouldEqual, http.StatusOK)
+
+				var entries []DebugEntry
+				So(json.NewDecoder(rec.Body).Decode(&entries), ShouldBeNil)
+				return entries
+			}
+
+			for len(query("")[0].Deliveries) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			Convey("The delivery should be listed under the subscriber's client id", func() {
+				entries := query("&id=0&subscriber=alice")
+				So(entries, ShouldHaveLength, 1)
+				So(entries[0].Deliveries, ShouldHaveLength, 1)
+				So(entries[0].Deliveries[0].Error, ShouldBeEmpty)
+			})
+
+			Convey("Other subscribers should have no deliveries", func() {
+				So(query("&subscriber=bob")[0].Deliveries, ShouldBeEmpty)
+			})
+
+			Convey("Unknown ids should match nothing", func() {
+				So(query("&id=1"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("Unknown streams should not be found", func() {
+			rec := httptest.NewRecorder()
+			s.DebugHandler(rec, httptest.NewRequest(http.MethodGet, "/debug?stream=none", nil))
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
@@ -0,0 +1,106 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "io"
+
+// decoderBufferSize is the size of the reads made by a Decoder
+const decoderBufferSize = 4096
+
+// Decoder reads events from an event stream, such as a file, a pipe or a test
+// fixture, without going through a Client.
+type Decoder struct {
+	r      io.Reader
+	parser *StreamParser
+	buf    []byte
+	// Decoded events waiting to be returned are queue[head:]. The slots are
+	// reused once consumed, along with the storage of their fields.
+	queue []Event
+	head  int
+	err   error
+}
+
+// NewDecoder returns a decoder that reads from r
+func NewDecoder(r io.Reader) *Decoder {
+	d := &Decoder{
+		r:   r,
+		buf: make([]byte, decoderBufferSize),
+	}
+	d.parser = NewStreamParser(d.enqueue)
+	d.parser.borrow = true
+	return d
+}
+
+// enqueue copies an event borrowed from the parser into the next free slot
+func (d *Decoder) enqueue(e *Event) {
+	if len(d.queue) < cap(d.queue) {
+		d.queue = d.queue[:len(d.queue)+1]
+	} else {
+		d.queue = append(d.queue, Event{})
+	}
+
+	slot := &d.queue[len(d.queue)-1]
+	slot.ID = reuseField(slot.ID, e.ID)
+	slot.Data = reuseField(slot.Data, e.Data)
+	slot.Event = reuseField(slot.Event, e.Event)
+	slot.Retry = reuseField(slot.Retry, e.Retry)
+	slot.Comment = reuseField(slot.Comment, e.Comment)
+}
+
+// next returns the slot holding the next event, reading from the stream until
+// one has been decoded. The slot is only valid until the next read.
+func (d *Decoder) next() (*Event, error) {
+	if d.head == len(d.queue) {
+		d.head = 0
+		d.queue = d.queue[:0]
+	}
+
+	for d.head == len(d.queue) {
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		n, err := d.r.Read(d.buf)
+		d.parser.Write(d.buf[:n])
+		if err != nil {
+			d.err = err
+		}
+	}
+
+	d.head++
+	return &d.queue[d.head-1], nil
+}
+
+// Decode returns the next event in the stream. Like StreamParser, it returns
+// every frame containing at least one field or comment. Once the stream has
+// been consumed it returns io.EOF; an incomplete frame at the end of the
+// stream is discarded.
+func (d *Decoder) Decode() (*Event, error) {
+	e, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	return copyEvent(e), nil
+}
+
+// DecodeInto decodes the next event into e, replacing all of its fields. The
+// storage of e's existing fields is reused where it is large enough, so
+// decoding into the same event over and over does not allocate once its
+// fields have grown to fit the stream's events. Fields the next event does
+// not have are set to nil.
+func (d *Decoder) DecodeInto(e *Event) error {
+	next, err := d.next()
+	if err != nil {
+		return err
+	}
+
+	e.ID = reuseField(e.ID, next.ID)
+	e.Data = reuseField(e.Data, next.Data)
+	e.Event = reuseField(e.Event, next.Event)
+	e.Retry = reuseField(e.Retry, next.Retry)
+	e.Comment = reuseField(e.Comment, next.Comment)
+	e.Fields = nil
+	return nil
+}
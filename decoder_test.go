@@ -0,0 +1,107 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecoder(t *testing.T) {
+	Convey("Given a decoder", t, func() {
+		stream := "id: 1\ndata: first\n\nid: 2\nevent: update\ndata: second\n\ndata: incomplete"
+
+		Convey("When decoding a stream", func() {
+			dec := NewDecoder(strings.NewReader(stream))
+
+			Convey("It should return each complete event", func() {
+				ev, err := dec.Decode()
+				So(err, ShouldBeNil)
+				So(string(ev.ID), ShouldEqual, "1")
+				So(string(ev.Data), ShouldEqual, "first")
+
+				ev, err = dec.Decode()
+				So(err, ShouldBeNil)
+				So(string(ev.Event), ShouldEqual, "update")
+				So(string(ev.Data), ShouldEqual, "second")
+			})
+
+			Convey("It should return io.EOF at the end of the stream", func() {
+				dec.Decode()
+				dec.Decode()
+				_, err := dec.Decode()
+				So(err, ShouldEqual, io.EOF)
+			})
+		})
+
+		Convey("When decoding a stream one byte at a time", func() {
+			dec := NewDecoder(iotest.OneByteReader(strings.NewReader(stream)))
+
+			Convey("It should decode into an existing event", func() {
+				var ev Event
+				So(dec.DecodeInto(&ev), ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, "first")
+				So(dec.DecodeInto(&ev), ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, "second")
+			})
+		})
+	})
+}
+
+func TestDecoderDecodeInto(t *testing.T) {
+	Convey("Given a decoder reading a long stream", t, func() {
+		stream := strings.Repeat("id: 1\nevent: update\ndata: {\"price\":101.25}\n\n", 1000)
+		dec := NewDecoder(strings.NewReader(stream))
+
+		Convey("When decoding into the same event repeatedly", func() {
+			var ev Event
+			So(dec.DecodeInto(&ev), ShouldBeNil)
+
+			Convey("It should reuse the event's buffers", func() {
+				data := &ev.Data[0]
+				So(dec.DecodeInto(&ev), ShouldBeNil)
+				So(&ev.Data[0], ShouldEqual, data)
+				So(string(ev.Data), ShouldEqual, `{"price":101.25}`)
+			})
+
+			Convey("It should not allocate", func() {
+				allocs := testing.AllocsPerRun(100, func() {
+					dec.DecodeInto(&ev)
+				})
+				So(allocs, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the next event lacks a field", func() {
+			dec := NewDecoder(strings.NewReader("event: a\ndata: 1\n\ndata: 2\n\n"))
+			var ev Event
+			dec.DecodeInto(&ev)
+			dec.DecodeInto(&ev)
+
+			Convey("The field should be cleared", func() {
+				So(ev.Event, ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, "2")
+			})
+		})
+	})
+}
+
+func BenchmarkDecoderDecodeInto(b *testing.B) {
+	frame := "id: 1\nevent: update\ndata: {\"price\":101.25}\n\n"
+	stream := strings.Repeat(frame, b.N)
+	dec := NewDecoder(strings.NewReader(stream))
+	b.SetBytes(int64(len(frame)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var ev Event
+	for i := 0; i < b.N; i++ {
+		dec.DecodeInto(&ev)
+	}
+}
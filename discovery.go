@@ -0,0 +1,82 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// lookupSRV resolves SRV records, replaced by tests
+var lookupSRV = net.LookupSRV
+
+// endpoint returns the URL to connect to. If SRVName is set, the host of URL
+// is replaced by a target picked from the name's SRV records, which are
+// resolved again on every call.
+func (c *Client) endpoint() (string, error) {
+	if c.SRVName == "" {
+		return c.URL, nil
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", err
+	}
+
+	_, records, err := lookupSRV("", "", c.SRVName)
+	if err != nil {
+		return "", err
+	}
+
+	srv := pickSRV(records)
+	if srv == nil {
+		return "", errors.New("no SRV records found for " + c.SRVName)
+	}
+
+	host := strings.TrimSuffix(srv.Target, ".")
+	u.Host = net.JoinHostPort(host, strconv.Itoa(int(srv.Port)))
+	return u.String(), nil
+}
+
+// pickSRV selects a target as described by RFC 2782: among the records with
+// the lowest priority, each is picked with a probability proportional to its
+// weight. A "." target, meaning the service is unavailable, is never picked.
+func pickSRV(records []*net.SRV) *net.SRV {
+	var candidates []*net.SRV
+	total := 0
+	for _, srv := range records {
+		if srv.Target == "." {
+			continue
+		}
+		if len(candidates) > 0 && srv.Priority > candidates[0].Priority {
+			continue
+		}
+		if len(candidates) > 0 && srv.Priority < candidates[0].Priority {
+			candidates, total = candidates[:0], 0
+		}
+		candidates = append(candidates, srv)
+		total += int(srv.Weight)
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+	if total == 0 {
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	n := rand.Intn(total)
+	for _, srv := range candidates {
+		if n < int(srv.Weight) {
+			return srv
+		}
+		n -= int(srv.Weight)
+	}
+	return candidates[len(candidates)-1]
+}
@@ -0,0 +1,126 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeSRV replaces SRV lookups with the given records for the test
+func fakeSRV(records ...*net.SRV) func() {
+	return fakeSRVFunc(func() ([]*net.SRV, error) {
+		return records, nil
+	})
+}
+
+func fakeSRVFunc(lookup func() ([]*net.SRV, error)) func() {
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		records, err := lookup()
+		return name, records, err
+	}
+	return func() {
+		lookupSRV = net.LookupSRV
+	}
+}
+
+func TestPickSRV(t *testing.T) {
+	Convey("Given SRV records with different priorities", t, func() {
+		records := []*net.SRV{
+			{Target: "backup.", Priority: 20, Weight: 100},
+			{Target: "a.", Priority: 10, Weight: 90},
+			{Target: "b.", Priority: 10, Weight: 10},
+			{Target: "c.", Priority: 10, Weight: 0},
+		}
+
+		Convey("Only targets with the lowest priority should be picked", func() {
+			picked := map[string]int{}
+			for i := 0; i < 1000; i++ {
+				picked[pickSRV(records).Target]++
+			}
+			So(picked["backup."], ShouldEqual, 0)
+
+			Convey("In proportion to their weights", func() {
+				So(picked["a."], ShouldBeGreaterThan, picked["b."])
+				So(picked["b."], ShouldBeGreaterThan, 0)
+				So(picked["c."], ShouldEqual, 0)
+			})
+		})
+
+		Convey("Targets should be picked evenly if none has a weight", func() {
+			unweighted := []*net.SRV{{Target: "a.", Priority: 10}, {Target: "b.", Priority: 10}}
+			picked := map[string]int{}
+			for i := 0; i < 1000; i++ {
+				picked[pickSRV(unweighted).Target]++
+			}
+			So(picked["a."], ShouldBeGreaterThan, 0)
+			So(picked["b."], ShouldBeGreaterThan, 0)
+		})
+
+		Convey("Nothing should be picked if the service is unavailable", func() {
+			So(pickSRV([]*net.SRV{{Target: "."}}), ShouldBeNil)
+		})
+	})
+}
+
+func TestClientSRVDiscovery(t *testing.T) {
+	Convey("Given a client resolving its endpoint from SRV records", t, func() {
+		srv := New()
+		srv.AutoReplay = false
+		srv.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		u, _ := url.Parse(server.URL)
+		port, _ := strconv.Atoi(u.Port())
+
+		c := NewClient("http://events.service/events")
+		c.SRVName = "_events._tcp.example.com"
+
+		Convey("It should connect to the resolved target", func() {
+			defer fakeSRV(&net.SRV{Target: u.Hostname() + ".", Port: uint16(port)})()
+
+			target, err := c.endpoint()
+			So(err, ShouldBeNil)
+			So(target, ShouldEqual, server.URL+"/events")
+
+			events := make(chan *Event)
+			_, err = c.SubscribeChan("test", events)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("It should resolve again when reconnecting", func() {
+			lookups := 0
+			defer fakeSRVFunc(func() ([]*net.SRV, error) {
+				lookups++
+				if lookups == 1 {
+					return nil, errors.New("no such host")
+				}
+				return []*net.SRV{{Target: u.Hostname(), Port: uint16(port)}}, nil
+			})()
+
+			c.clock = newFakeClock()
+			go c.Subscribe("test", func(msg *Event) {})
+			c.clock.(*fakeClock).WaitForTimers(1)
+			c.clock.(*fakeClock).AdvanceToNext()
+
+			for srv.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+			So(lookups, ShouldEqual, 2)
+		})
+
+		Reset(func() {
+			srv.Close()
+		})
+	})
+}
@@ -0,0 +1,336 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDispatchWorkers is the number of writers used by the pooled dispatcher.
+const DefaultDispatchWorkers = 8
+
+// dispatchWriteTimeout bounds a single write to a pooled subscriber's connection,
+// so one stalled client cannot hold up the other subscribers on its writer.
+const dispatchWriteTimeout = 10 * time.Second
+
+// DispatchMode selects how events are written to subscribers
+type DispatchMode int
+
+const (
+	// DispatchPerSubscriber keeps a handler goroutine per subscriber, which
+	// writes and flushes events as they arrive. This is the default.
+	DispatchPerSubscriber DispatchMode = iota
+	// DispatchPooled hijacks each subscriber's connection and hands it to a
+	// central dispatcher, where a small pool of writers serves every
+	// subscriber. This trades per-connection goroutines for shared writers and
+	// suits large numbers of mostly idle connections. Connections that can not
+	// be hijacked, such as HTTP/2, fall back to DispatchPerSubscriber.
+	DispatchPooled
+)
+
+// errSubscriberFailed is reported for events dropped after an earlier write to
+// a pooled subscriber failed
+var errSubscriberFailed = errors.New("subscriber connection failed")
+
+// dispatcher writes queued events to hijacked subscriber connections using a
+// fixed pool of writers. Each subscriber is pinned to a single writer, which
+// preserves the order of its events.
+type dispatcher struct {
+	queues []chan *Subscriber
+	next   uint32
+	quit   chan bool
+	// Guards stopped, so no subscriber is queued once the writers have
+	// stopped
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// newDispatcher starts the writers of a dispatcher with background, or in
+// goroutines of their own if it is nil
+func newDispatcher(workers int, background func(func())) *dispatcher {
+	if workers < 1 {
+		workers = DefaultDispatchWorkers
+	}
+
+	d := &dispatcher{
+		queues: make([]chan *Subscriber, workers),
+		quit:   make(chan bool),
+	}
+
+	for i := range d.queues {
+		queue := make(chan *Subscriber, DefaultBufferSize)
+		d.queues[i] = queue
+		if background == nil {
+			go d.run(queue)
+			continue
+		}
+		background(func() {
+			d.run(queue)
+		})
+	}
+
+	return d
+}
+
+func (d *dispatcher) run(queue chan *Subscriber) {
+	for {
+		select {
+		case sub := <-queue:
+			atomic.StoreInt32(&sub.pending, 0)
+			if sub.labels != nil {
+				pprof.SetGoroutineLabels(sub.labels)
+			}
+			d.drain(sub)
+			pprof.SetGoroutineLabels(context.Background())
+		case <-d.quit:
+			// Close the connections of subscribers queued before stopping,
+			// which are not written to anymore
+			for {
+				select {
+				case sub := <-queue:
+					sub.conn.Close()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// assign pins a subscriber and its connection to one of the writers
+func (d *dispatcher) assign(sub *Subscriber, conn net.Conn) {
+	sub.conn = conn
+	sub.dispatcher = d
+	sub.worker = int(atomic.AddUint32(&d.next, 1) % uint32(len(d.queues)))
+}
+
+// schedule queues a subscriber with its writer, unless it is already waiting
+func (d *dispatcher) schedule(sub *Subscriber) {
+	if !atomic.CompareAndSwapInt32(&sub.pending, 0, 1) {
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.stopped {
+		sub.conn.Close()
+		return
+	}
+	d.queues[sub.worker] <- sub
+}
+
+// watch reads from the connection of a pooled subscriber until it fails, such
+// as once the client disconnects, and disconnects the subscriber then. Clients
+// do not write to the connection, so anything read is discarded.
+func (d *dispatcher) watch(sub *Subscriber, r io.Reader) {
+	io.Copy(io.Discard, r)
+	sub.close()
+}
+
+// drain writes every event currently queued for the subscriber, gathering them
+// into a single vectored write
+func (d *dispatcher) drain(sub *Subscriber) {
+	var bufs net.Buffers
+	var events []*Event
+	var last *Event
+	closed := false
+
+queued:
+	for {
+		// Priority events are written ahead of the others
+		var ev *Event
+		select {
+		case ev = <-sub.urgent:
+		default:
+			if ev = sub.popBacklog(); ev != nil {
+				break
+			}
+			var wait time.Duration
+			if ev, wait = sub.popReplay(); ev != nil {
+				break
+			}
+			if wait > 0 {
+				// Hold back live events, so the stream is not blocked, and
+				// drain again once the next page is due
+				if !sub.pages.scheduled {
+					sub.pages.scheduled = true
+					clockOrSystem(sub.clock).AfterFunc(wait, sub.notify)
+				}
+			hold:
+				for {
+					select {
+					case next, ok := <-sub.connection:
+						if !ok {
+							closed = true
+							break queued
+						}
+						if sub.failed {
+							sub.delivered(next, time.Time{}, errSubscriberFailed)
+						} else if !sub.holdLive(next) {
+							sub.failed = true
+							go sub.close()
+						}
+					default:
+						break hold
+					}
+				}
+				break queued
+			}
+			select {
+			case next, ok := <-sub.connection:
+				if !ok {
+					closed = true
+					break queued
+				}
+				if sub.takeReplay(next) || sub.replayedLive(next) {
+					continue
+				}
+				ev = next
+			default:
+				break queued
+			}
+		}
+
+		if sub.failed {
+			sub.delivered(ev, time.Time{}, errSubscriberFailed)
+			continue
+		}
+		bufs = sub.encode(bufs, ev)
+		if sub.observed() {
+			events = append(events, ev)
+		} else if len(ev.ID) > 0 {
+			last = ev
+		}
+	}
+
+	if len(bufs) > 0 {
+		start := time.Now()
+		sub.conn.SetWriteDeadline(start.Add(dispatchWriteTimeout))
+		n, err := bufs.WriteTo(sub.conn)
+		if sub.counters != nil {
+			sub.counters.written.Add(uint64(n))
+		}
+		for _, ev := range events {
+			sub.delivered(ev, start, err)
+		}
+		if err == nil && last != nil {
+			sub.last.Store(last)
+		}
+		if err != nil && !closed {
+			// The stream will close the subscriber's queue once it has been
+			// deregistered, which closes the connection.
+			sub.failed = true
+			go sub.close()
+		}
+	}
+
+	if closed {
+		sub.conn.Close()
+		sub.ended()
+	}
+}
+
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.stopped {
+		d.stopped = true
+		close(d.quit)
+	}
+}
+
+// pooledConn is a hijacked connection Shutdown waits for until it is closed
+type pooledConn struct {
+	net.Conn
+	once   sync.Once
+	closed func()
+}
+
+func (c *pooledConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.closed)
+	return err
+}
+
+// servePooled hijacks the connection and hands it to the dispatcher. It reports
+// false if the connection can not be hijacked and has been left untouched.
+func (s *Server) servePooled(w http.ResponseWriter, stream *Stream, sub *Subscriber) bool {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return false
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return false
+	}
+	// The handler returns once the connection is handed over, so the
+	// connection is counted until it is closed instead
+	s.connections.Add(1)
+	conn = &pooledConn{Conn: conn, closed: func() {
+		sub.cancel()
+		s.connections.Done()
+	}}
+
+	// The subscriber is not written to until the headers have been, which
+	// can only be once the stream has admitted it
+	atomic.StoreInt32(&sub.pending, 1)
+	d := s.getDispatcher()
+	d.assign(sub, conn)
+	if !stream.join(sub) {
+		rw.WriteString("HTTP/1.1 503 Service Unavailable\r\nContent-Type: text/plain; charset=utf-8\r\nConnection: close\r\n\r\nToo many subscribers!\n")
+		rw.Flush()
+		conn.Close()
+		sub.ended()
+		return true
+	}
+
+	// Without a content length or chunked encoding, the end of the response is
+	// marked by closing the connection.
+	w.Header().Set("Connection", "close")
+
+	rw.WriteString("HTTP/1.1 200 OK\r\n")
+	w.Header().Write(rw)
+	rw.WriteString("\r\n")
+	err = rw.Flush()
+
+	// Events queued meanwhile are written now, or once the subscriber has
+	// been removed for failing, the connection is closed
+	atomic.StoreInt32(&sub.pending, 0)
+	if err != nil {
+		conn.Close()
+		sub.close()
+		sub.notify()
+		return true
+	}
+
+	// Connections may come with the read deadline of the server, which
+	// would end the subscription
+	conn.SetReadDeadline(time.Time{})
+	go d.watch(sub, rw.Reader)
+	sub.notify()
+
+	return true
+}
+
+func (s *Server) getDispatcher() *dispatcher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dispatcher == nil {
+		s.dispatcher = newDispatcher(s.DispatchWorkers, s.background)
+	}
+	return s.dispatcher
+}
@@ -0,0 +1,118 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDispatcher(t *testing.T) {
+	// New Server
+	s := New()
+	s.DispatchMode = DispatchPooled
+	s.DispatchWorkers = 2
+	defer s.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.HTTPHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s.CreateStream("test")
+
+	Convey("Given a server using the pooled dispatcher", t, func() {
+		Convey("When several clients subscribe", func() {
+			var subs []chan *Event
+			for i := 0; i < 3; i++ {
+				c := NewClient(server.URL + "/events")
+				events := make(chan *Event)
+				_, err := c.SubscribeChan("test", events)
+				So(err, ShouldBeNil)
+				subs = append(subs, events)
+			}
+
+			// Wait for subscribers to be registered
+			time.Sleep(time.Millisecond * 100)
+
+			Convey("They should all receive published events in order", func() {
+				s.Publish("test", &Event{Data: []byte("one")})
+				s.Publish("test", &Event{Data: []byte("two")})
+
+				for _, events := range subs {
+					msg, err := wait(events, time.Second*1)
+					So(err, ShouldBeNil)
+					So(string(msg), ShouldEqual, "one")
+
+					msg, err = wait(events, time.Second*1)
+					So(err, ShouldBeNil)
+					So(string(msg), ShouldEqual, "two")
+				}
+			})
+		})
+
+		Convey("When a client subscribes", func() {
+			subscribed := make(chan *Subscriber, 1)
+			s.OnSubscribe = func(stream string, sub *Subscriber) {
+				subscribed <- sub
+			}
+			defer func() {
+				s.OnSubscribe = nil
+			}()
+			s.CreateStream("context")
+
+			events := make(chan *Event)
+			_, err := NewClient(server.URL+"/events").SubscribeChan("context", events)
+			So(err, ShouldBeNil)
+			sub := <-subscribed
+
+			Convey("Its context should last as long as its connection", func() {
+				time.Sleep(time.Millisecond * 50)
+				So(sub.Context().Err(), ShouldBeNil)
+
+				s.RemoveStream("context")
+				select {
+				case <-sub.Context().Done():
+				case <-time.After(time.Second):
+					So("context not done", ShouldBeEmpty)
+				}
+			})
+		})
+
+		Convey("When a client disconnects without events being published", func() {
+			str := s.CreateStream("disconnect")
+			c := NewClient(server.URL + "/events")
+			events := make(chan *Event)
+			_, err := c.SubscribeChan("disconnect", events)
+			So(err, ShouldBeNil)
+			for str.SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			c.Unsubscribe(events)
+
+			Convey("Its subscriber should be removed", func() {
+				deadline := time.Now().Add(time.Second)
+				for str.SubscriberCount() > 0 && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+				}
+				So(str.SubscriberCount(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the dispatcher is stopped twice", func() {
+			d := newDispatcher(1, nil)
+			d.stop()
+
+			Convey("It should not panic", func() {
+				So(d.stop, ShouldNotPanic)
+			})
+		})
+	})
+}
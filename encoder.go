@@ -0,0 +1,186 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var (
+	fieldID      = []byte("id: ")
+	fieldEvent   = []byte("event: ")
+	fieldData    = []byte("data: ")
+	fieldRetry   = []byte("retry: ")
+	fieldComment = []byte(": ")
+	newline      = []byte("\n")
+	colonSpace   = []byte(": ")
+)
+
+// Buffers used to serialize events before they are written
+var writeBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &writeBuffer{}
+	},
+}
+
+type writeBuffer struct {
+	bufs net.Buffers
+	out  []byte
+}
+
+// appendEventBuffers appends the event stream representation of an event to
+// bufs. The buffers reference the event's fields instead of copying them. An
+// empty id would reset the client's last event id, so it is left out. Data
+// lines longer than maxLine bytes are split, see Server.MaxLineLength.
+func appendEventBuffers(bufs net.Buffers, ev *Event, maxLine int) net.Buffers {
+	// Every line of a comment needs its own prefix
+	for comment := ev.Comment; len(comment) > 0; {
+		line, rest := splitLine(comment)
+		bufs = append(bufs, fieldComment, line, newline)
+		comment = rest
+	}
+	if len(ev.ID) > 0 {
+		bufs = append(bufs, fieldID, ev.ID, newline)
+	}
+	if len(ev.Event) > 0 {
+		bufs = append(bufs, fieldEvent, ev.Event, newline)
+	}
+	for _, name := range ev.extraFieldNames() {
+		for value := ev.Fields[name]; ; {
+			line, rest := splitLine(value)
+			bufs = append(bufs, []byte(name), colonSpace, line, newline)
+			if value = rest; len(value) == 0 {
+				break
+			}
+		}
+	}
+	// Line breaks in the data have to be sent as separate data fields
+	for data := ev.Data; len(data) > 0; {
+		line, rest := splitLine(data)
+		for maxLine > 0 && len(line) > maxLine {
+			i := cutLine(line, maxLine)
+			bufs = append(bufs, fieldData, line[:i], newline)
+			line = line[i:]
+		}
+		bufs = append(bufs, fieldData, line, newline)
+		data = rest
+	}
+	if len(ev.Retry) > 0 {
+		bufs = append(bufs, fieldRetry, ev.Retry, newline)
+	}
+	return append(bufs, newline)
+}
+
+// splitLine returns the first line of b and the remainder after its line
+// break, which may be "\r\n", "\r" or "\n".
+func splitLine(b []byte) (line, rest []byte) {
+	i := bytes.IndexAny(b, "\r\n")
+	if i < 0 {
+		return b, nil
+	}
+	if b[i] == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+		return b[:i], b[i+2:]
+	}
+	return b[:i], b[i+1:]
+}
+
+// cutLine returns where to cut a line to make its first part at most max bytes
+// long, without splitting a UTF-8 encoded rune. A rune longer than max is kept
+// whole.
+func cutLine(line []byte, max int) int {
+	for i := max; i > 0; i-- {
+		if utf8.RuneStart(line[i]) {
+			return i
+		}
+	}
+	_, size := utf8.DecodeRune(line)
+	return size
+}
+
+// validateEvent checks that an event can be represented in the event stream
+// format without being altered
+func validateEvent(ev *Event) error {
+	switch {
+	case bytes.ContainsAny(ev.ID, "\r\n"):
+		return errors.New("event id contains a line break")
+	case bytes.ContainsAny(ev.Event, "\r\n"):
+		return errors.New("event name contains a line break")
+	case bytes.ContainsAny(ev.Retry, "\r\n"):
+		return errors.New("event retry contains a line break")
+	}
+	for name := range ev.Fields {
+		switch name {
+		case "", "id", "event", "data", "retry":
+			return fmt.Errorf("event field name %q is reserved", name)
+		}
+		if strings.ContainsAny(name, ":\r\n") {
+			return fmt.Errorf("event field name %q contains a colon or line break", name)
+		}
+	}
+	return nil
+}
+
+// writeEvent writes a single event in the event stream format. The event is
+// serialized up front and handed to w in a single Write, so it can not be
+// interleaved with other writes.
+func writeEvent(w io.Writer, ev *Event, maxLine int) error {
+	wb := writeBufferPool.Get().(*writeBuffer)
+	defer writeBufferPool.Put(wb)
+
+	wb.bufs = appendEventBuffers(wb.bufs[:0], ev, maxLine)
+	wb.out = wb.out[:0]
+	for _, b := range wb.bufs {
+		wb.out = append(wb.out, b...)
+	}
+
+	// Drop references to the event's fields before the buffer is pooled
+	for i := range wb.bufs {
+		wb.bufs[i] = nil
+	}
+
+	_, err := w.Write(wb.out)
+	return err
+}
+
+// Encoder writes events to an event stream, such as the response of a handler
+// of your own, without going through a Server. It is the counterpart of
+// Decoder. Responses should be sent with the ContentTypeEventStream content
+// type.
+type Encoder struct {
+	w io.Writer
+	// Splits data lines longer than this many bytes, see
+	// Server.MaxLineLength. Zero leaves them as they are.
+	MaxLineLength int
+}
+
+// NewEncoder returns an encoder that writes to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes an event with a single Write, flushing w if it is an
+// http.Flusher so the event is sent at once. Multi-line data and comments
+// are split over several fields, while an id, name, retry or field name that
+// can not be represented is rejected without writing anything.
+func (e *Encoder) Encode(ev *Event) error {
+	if err := validateEvent(ev); err != nil {
+		return err
+	}
+	if err := writeEvent(e.w, ev, e.MaxLineLength); err != nil {
+		return err
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
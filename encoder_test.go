@@ -0,0 +1,104 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestWriteEvent(t *testing.T) {
+	Convey("Given an event", t, func() {
+		ev := &Event{
+			ID:    []byte("1"),
+			Event: []byte("update"),
+			Data:  []byte("test"),
+			Retry: []byte("1000"),
+		}
+
+		Convey("When writing it", func() {
+			var w countingWriter
+			err := writeEvent(&w, ev, 0)
+
+			Convey("It should be serialized in a single write", func() {
+				So(err, ShouldBeNil)
+				So(w.writes, ShouldEqual, 1)
+				So(w.String(), ShouldEqual, "id: 1\nevent: update\ndata: test\nretry: 1000\n\n")
+			})
+		})
+
+		Convey("When writing it without an id", func() {
+			var w countingWriter
+			ev.ID = nil
+			writeEvent(&w, ev, 0)
+
+			Convey("The id field should be left out", func() {
+				So(w.String(), ShouldEqual, "event: update\ndata: test\nretry: 1000\n\n")
+			})
+		})
+
+		Convey("When writing it with a comment", func() {
+			var w countingWriter
+			ev.Comment = []byte("first\nsecond")
+			writeEvent(&w, ev, 0)
+
+			Convey("Each comment line should be prefixed with a colon", func() {
+				So(w.String(), ShouldStartWith, ": first\n: second\nid: 1\n")
+			})
+		})
+	})
+}
+
+func TestEncoder(t *testing.T) {
+	Convey("Given an encoder writing to a response", t, func() {
+		w := httptest.NewRecorder()
+		enc := NewEncoder(w)
+
+		Convey("Events should be written and flushed", func() {
+			err := enc.Encode(&Event{ID: []byte("1"), Event: []byte("greeting"), Data: []byte("hello\nworld"), Retry: []byte("100")})
+			So(err, ShouldBeNil)
+			So(w.Flushed, ShouldBeTrue)
+			So(w.Body.String(), ShouldEqual, "id: 1\nevent: greeting\ndata: hello\ndata: world\nretry: 100\n\n")
+		})
+
+		Convey("Comments should be written on their own", func() {
+			So(enc.Encode(&Event{Comment: []byte("ping")}), ShouldBeNil)
+			So(w.Body.String(), ShouldEqual, ": ping\n\n")
+		})
+
+		Convey("Events that can not be represented should be rejected", func() {
+			So(enc.Encode(&Event{ID: []byte("1\n2")}), ShouldNotBeNil)
+			So(w.Body.Len(), ShouldEqual, 0)
+		})
+
+		Convey("Encoded events should be decoded as they were", func() {
+			enc.Encode(&Event{ID: []byte("1"), Data: []byte("a\nb")})
+			enc.Encode(&Event{Event: []byte("other"), Data: []byte("c")})
+
+			dec := NewDecoder(w.Body)
+			ev, err := dec.Decode()
+			So(err, ShouldBeNil)
+			So(string(ev.ID), ShouldEqual, "1")
+			So(string(ev.Data), ShouldEqual, "a\nb")
+			ev, err = dec.Decode()
+			So(err, ShouldBeNil)
+			So(string(ev.Event), ShouldEqual, "other")
+			So(string(ev.Data), ShouldEqual, "c")
+		})
+	})
+}
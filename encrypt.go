@@ -0,0 +1,166 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sealedPrefix starts the data of encrypted events, versioning the envelope
+const sealedPrefix = "enc2."
+
+// ErrUnknownKey is returned by a KeyProvider for key ids it does not know
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyProvider supplies the keys event data is encrypted or signed with, see
+// Server.Keys and Server.SigningKeys. Encryption keys are AES keys, 16, 24 or
+// 32 bytes long. Each key has an id, which is sent along with the encrypted
+// data or signature, so keys can be rotated by having clients accept both the
+// old and the new key for a while.
+type KeyProvider interface {
+	// EncryptionKey returns the key new events are encrypted or signed with
+	EncryptionKey() (id string, key []byte, err error)
+	// DecryptionKey returns the key with the given id, or ErrUnknownKey
+	DecryptionKey(id string) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider holding a single key
+type StaticKey struct {
+	// ID of the key, which may not contain dots
+	ID  string
+	Key []byte
+}
+
+// EncryptionKey returns the key
+func (k StaticKey) EncryptionKey() (string, []byte, error) {
+	return k.ID, k.Key, nil
+}
+
+// DecryptionKey returns the key if the id matches
+func (k StaticKey) DecryptionKey(id string) ([]byte, error) {
+	if id != k.ID {
+		return nil, ErrUnknownKey
+	}
+	return k.Key, nil
+}
+
+// sealedAAD returns the additional data authenticated along with the data of
+// an event, which binds it to its stream and id
+func sealedAAD(stream string, id []byte) []byte {
+	aad := make([]byte, 0, len(stream)+1+len(id))
+	aad = append(aad, stream...)
+	aad = append(aad, 0)
+	return append(aad, id...)
+}
+
+// sealData encrypts data with AES-GCM into an envelope of the form
+// enc2.<key id>.<base64url of nonce and ciphertext>, authenticating aad along
+// with it. The envelope is text, so it can be sent without EncodeBase64.
+func sealData(keys KeyProvider, data, aad []byte) ([]byte, error) {
+	id, key, err := keys.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(id, ".") {
+		return nil, fmt.Errorf("encryption key id %q contains a dot", id)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, sealed); err != nil {
+		return nil, err
+	}
+	sealed = aead.Seal(sealed, sealed, data, aad)
+
+	header := len(sealedPrefix) + len(id) + 1
+	out := make([]byte, header+base64.RawURLEncoding.EncodedLen(len(sealed)))
+	copy(out, sealedPrefix)
+	copy(out[len(sealedPrefix):], id)
+	out[header-1] = '.'
+	base64.RawURLEncoding.Encode(out[header:], sealed)
+	return out, nil
+}
+
+// openData decrypts an envelope created by sealData with the same aad
+func openData(keys KeyProvider, data, aad []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(sealedPrefix)) {
+		return nil, errors.New("data is not encrypted")
+	}
+	data = data[len(sealedPrefix):]
+
+	dot := bytes.IndexByte(data, '.')
+	if dot < 0 {
+		return nil, errors.New("encrypted data has no key id")
+	}
+	key, err := keys.DecryptionKey(string(data[:dot]))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := data[dot+1:]
+	sealed := make([]byte, base64.RawURLEncoding.DecodedLen(len(encoded)))
+	if _, err := base64.RawURLEncoding.Decode(sealed, encoded); err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(ciphertext[:0], nonce, ciphertext, aad)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// openReader decrypts streamed data once it is first read, as the whole
+// envelope is needed to authenticate it
+type openReader struct {
+	src  io.Reader
+	keys KeyProvider
+	aad  []byte
+	data io.Reader
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	if o.data == nil {
+		sealed, err := io.ReadAll(o.src)
+		if err != nil {
+			return 0, err
+		}
+		if len(sealed) == 0 {
+			return 0, io.EOF
+		}
+
+		data, err := openData(o.keys, sealed, o.aad)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt event message: %s", err)
+		}
+		o.data = bytes.NewReader(data)
+	}
+	return o.data.Read(p)
+}
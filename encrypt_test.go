@@ -0,0 +1,159 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncryptedData(t *testing.T) {
+	key := StaticKey{ID: "k1", Key: bytes.Repeat([]byte{1}, 32)}
+
+	Convey("Given data sealed with a key", t, func() {
+		aad := sealedAAD("test", []byte("1"))
+		sealed, err := sealData(key, []byte("secret"), aad)
+		So(err, ShouldBeNil)
+
+		Convey("It should not contain the plain data", func() {
+			So(string(sealed), ShouldStartWith, "enc2.k1.")
+			So(bytes.Contains(sealed, []byte("secret")), ShouldBeFalse)
+		})
+
+		Convey("It should open with the same key", func() {
+			data, err := openData(key, sealed, aad)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "secret")
+		})
+
+		Convey("It should not open with an unknown key id", func() {
+			_, err := openData(StaticKey{ID: "k2", Key: key.Key}, sealed, aad)
+			So(err, ShouldEqual, ErrUnknownKey)
+		})
+
+		Convey("It should not open with a different key", func() {
+			_, err := openData(StaticKey{ID: "k1", Key: bytes.Repeat([]byte{2}, 32)}, sealed, aad)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should not open once tampered with", func() {
+			sealed[len(sealed)-1] ^= 1
+			_, err := openData(key, sealed, aad)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should not open as another event or on another stream", func() {
+			_, err := openData(key, sealed, sealedAAD("test", []byte("2")))
+			So(err, ShouldNotBeNil)
+			_, err = openData(key, sealed, sealedAAD("other", []byte("1")))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a server whose key can not be used", t, func() {
+		reported := make(chan error, 1)
+		s := New()
+		s.Keys = StaticKey{ID: "k1", Key: []byte("short")}
+		s.OnError = func(r *http.Request, err error) {
+			reported <- err
+		}
+		str := s.CreateStream("test")
+		sub := str.addSubscriber("0")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("Published events should be dropped and reported", func() {
+			s.Publish("test", &Event{Data: []byte("secret")})
+			So(<-reported, ShouldNotBeNil)
+			So(str.SubscriberCount(), ShouldEqual, 1)
+			So(len(sub.connection), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given a server encrypting event data", t, func() {
+		srv := New()
+		srv.AutoReplay = false
+		srv.CompressData = true
+		srv.Keys = key
+		srv.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		c := NewClient(server.URL)
+		c.DecompressData = true
+		c.Keys = key
+
+		payload := strings.Repeat("confidential ", 10)
+		publish := func() {
+			for srv.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+			srv.Publish("test", &Event{Data: []byte(payload)})
+		}
+
+		Reset(func() {
+			srv.Close()
+		})
+
+		Convey("Subscribe should pass handlers the original data", func() {
+			events := make(chan *Event, 1)
+			go c.Subscribe("test", func(msg *Event) {
+				events <- msg
+			})
+			publish()
+
+			select {
+			case msg := <-events:
+				So(string(msg.Data), ShouldEqual, payload)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("SubscribeReader should stream the original data", func() {
+			data := make(chan []byte, 1)
+			go c.SubscribeReader("test", func(ev *EventReader) {
+				b, _ := io.ReadAll(ev)
+				data <- b
+			})
+			publish()
+
+			select {
+			case b := <-data:
+				So(string(b), ShouldEqual, payload)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("The published event should keep its data", func() {
+			ev := &Event{Data: []byte(payload)}
+			srv.Publish("test", ev)
+			So(string(ev.Data), ShouldEqual, payload)
+		})
+
+		Convey("A client subscribed to another stream should fail to decrypt", func() {
+			p := &eventParser{keys: key, stream: "other"}
+			sealed, _ := sealData(key, []byte("secret"), sealedAAD("test", nil))
+			_, err := p.parse(append([]byte("data: "), sealed...))
+			So(err.Error(), ShouldContainSubstring, "failed to decrypt")
+		})
+
+		Convey("A client with a different key should fail to decrypt", func() {
+			p := &eventParser{keys: StaticKey{ID: "k2", Key: key.Key}}
+			sealed, _ := sealData(key, []byte("secret"), sealedAAD("", nil))
+			_, err := p.parse(append([]byte("data: "), sealed...))
+			So(err.Error(), ShouldContainSubstring, "failed to decrypt")
+		})
+	})
+}
@@ -8,64 +8,457 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Event holds all of the event source fields
 type Event struct {
-	ID    []byte
-	Data  []byte
-	Event []byte
-	Retry []byte
+	ID      []byte
+	Data    []byte
+	Event   []byte
+	Retry   []byte
+	Comment []byte
+	// Fields other than the standard ones, keyed by name. They are only
+	// captured when enabled, such as with Client.CaptureFields, and are
+	// written after the event name when the event is sent.
+	Fields map[string][]byte
+
+	// When the event was published, set for instrumented servers
+	queued time.Time
+	// When the event was added to the eventlog, see Stream.ReplayTTL
+	recorded time.Time
+	// Set for events published with Server.PublishPriority
+	urgent bool
+	// Set for events whose data is compressed in the eventlog, see
+	// Stream.CompressReplay
+	packed bool
+	// Set for events of a batch other than its last, see Server.PublishBatch
+	batched bool
+	// Carries the history of paginated or stored replay to a subscriber's writer,
+	// such events are not written themselves
+	pages *replayPages
+	// Set for events queued by the stream itself, such as replay markers
+	// and control events, which backpressure does not drop
+	kept bool
+}
+
+// RetryInterval returns the reconnection time carried by the event's retry
+// field. As required by the spec, values that do not consist solely of ASCII
+// digits are ignored, in which case ok is false.
+func (e *Event) RetryInterval() (retry time.Duration, ok bool) {
+	if e == nil || len(e.Retry) == 0 {
+		return 0, false
+	}
+
+	var ms int64
+	for _, c := range e.Retry {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		ms = ms*10 + int64(c-'0')
+		if ms > int64(math.MaxInt64/time.Millisecond) {
+			return 0, false
+		}
+	}
+
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// Equal reports whether both events carry the same fields. Nil and empty
+// fields are considered equal.
+func (e *Event) Equal(other *Event) bool {
+	if e == nil || other == nil {
+		return e == other
+	}
+
+	return bytes.Equal(e.ID, other.ID) &&
+		bytes.Equal(e.Event, other.Event) &&
+		bytes.Equal(e.Data, other.Data) &&
+		bytes.Equal(e.Retry, other.Retry) &&
+		bytes.Equal(e.Comment, other.Comment) &&
+		equalFields(e.Fields, other.Fields)
+}
+
+func equalFields(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		other, ok := b[name]
+		if !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone returns a deep copy of the event, which remains valid after the
+// buffers the event references are reused, such as with Client.ReuseEvents
+func (e *Event) Clone() *Event {
+	if e == nil {
+		return nil
+	}
+	return copyEvent(e)
+}
+
+// eventField is a named field of an event, as rendered by String and GoString
+type eventField struct {
+	name  string
+	value []byte
+}
+
+// namedFields lists the standard fields of an event in the order they are
+// rendered
+func (e *Event) namedFields() []eventField {
+	return []eventField{
+		{"ID", e.ID},
+		{"Event", e.Event},
+		{"Data", e.Data},
+		{"Retry", e.Retry},
+		{"Comment", e.Comment},
+	}
+}
+
+// extraFieldNames returns the names of the event's other fields in order
+func (e *Event) extraFieldNames() []string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String renders the non-empty fields of the event on a single line, with
+// line breaks and other special characters escaped, for use in logs
+func (e *Event) String() string {
+	if e == nil {
+		return "<nil>"
+	}
+
+	var b strings.Builder
+	b.WriteString("{")
+	for _, field := range e.namedFields() {
+		if len(field.value) == 0 {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteString(" ")
+		}
+		b.WriteString(strings.ToLower(field.name))
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(string(field.value)))
+	}
+	for _, name := range e.extraFieldNames() {
+		if b.Len() > 1 {
+			b.WriteString(" ")
+		}
+		b.WriteString(strconv.Quote(name))
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(string(e.Fields[name])))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// GoString renders the event as a Go expression, for use with the %#v verb
+func (e *Event) GoString() string {
+	if e == nil {
+		return "(*sse.Event)(nil)"
+	}
+
+	var b strings.Builder
+	b.WriteString("&sse.Event{")
+	first := true
+	for _, field := range e.namedFields() {
+		if field.value == nil {
+			continue
+		}
+		if !first {
+			b.WriteString(", ")
+		}
+		first = false
+		b.WriteString(field.name)
+		b.WriteString(": []byte(")
+		b.WriteString(strconv.Quote(string(field.value)))
+		b.WriteString(")")
+	}
+	if e.Fields != nil {
+		if !first {
+			b.WriteString(", ")
+		}
+		b.WriteString("Fields: map[string][]byte{")
+		for i, name := range e.extraFieldNames() {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(strconv.Quote(name))
+			b.WriteString(": []byte(")
+			b.WriteString(strconv.Quote(string(e.Fields[name])))
+			b.WriteString(")")
+		}
+		b.WriteString("}")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// MarshalText encodes the event as a frame in the event stream format,
+// including the blank line that terminates it
+func (e *Event) MarshalText() ([]byte, error) {
+	if err := validateEvent(e); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeEvent(&buf, e, 0)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText decodes a single frame in the event stream format, such as one
+// produced by MarshalText. Fields other than the standard ones are captured in
+// Fields.
+func (e *Event) UnmarshalText(text []byte) error {
+	if len(bytes.TrimSpace(text)) == 0 {
+		return errEmptyEvent
+	}
+
+	f := fieldParser{capture: true}
+	for len(text) > 0 {
+		var line []byte
+		line, text = splitLine(text)
+		f.parseLine(line)
+	}
+
+	// The parser's buffers are not reused, so the event can keep them
+	f.fill(e)
+	return nil
 }
 
+// eventStreamBufferSize is the initial size of the EventStreamReader's buffer,
+// which bounds the size of a single read, and the default bound of the size of
+// a single frame
+const eventStreamBufferSize = bufio.MaxScanTokenSize
+
+// maxEmptyReads is the number of reads returning no data and no error that are
+// tolerated before giving up on the stream
+const maxEmptyReads = 100
+
+// lflf terminates a frame in streams using "\n" line endings
+var lflf = []byte("\n\n")
+
 // EventStreamReader scans an io.Reader looking for EventStream messages.
 type EventStreamReader struct {
-	scanner *bufio.Scanner
-	buffer  []byte
-	idx     int
+	// Bounds the size of a single frame, 64KiB if zero. The buffer grows up
+	// to this size for frames that do not fit in it, while larger frames are
+	// dropped. It has to be set before the first call to ReadEvent.
+	MaxBufferSize int
+
+	reader io.Reader
+	buffer []byte
+	// Unread data is buffer[start:end]
+	start int
+	end   int
+	// Number of unread bytes already searched for the end of a frame, so a
+	// partial frame is not searched again from its start after every read
+	scanned int
+	err     error
+
+	// Set while the rest of a frame too large for the buffer is dropped
+	discarding bool
+	lineStart  bool
+	skipLF     bool
+	// Called with the start of each frame that is dropped for being too large
+	tooLarge func(raw []byte)
 }
 
 // NewEventStreamReader creates an instance of EventStreamReader.
 func NewEventStreamReader(eventStream io.Reader) *EventStreamReader {
-	scanner := bufio.NewScanner(eventStream)
-	split := func(data []byte, atEOF bool) (int, []byte, error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
+	return &EventStreamReader{
+		reader: eventStream,
+		buffer: make([]byte, eventStreamBufferSize),
+	}
+}
+
+// splitFrame finds the blank line terminating the first frame in data. Lines
+// may end in "\r\n", "\r" or "\n", and terminators can be mixed within a
+// stream. Blank lines preceding the frame are skipped, in which case a nil
+// frame is returned along with the number of bytes to skip.
+func splitFrame(data []byte, atEOF bool) (frame []byte, advance int, ok bool) {
+	for pos := 0; ; {
+		i := bytes.IndexAny(data[pos:], "\r\n")
+		if i < 0 {
+			return nil, 0, false
 		}
+		end := pos + i
 
-		// We have a full event payload to parse.
-		if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 {
-			return i + 1, data[0:i], nil
+		size := 1
+		if data[end] == '\r' {
+			// Wait for the next byte to tell "\r" and "\r\n" apart
+			if end+1 == len(data) && !atEOF {
+				return nil, 0, false
+			}
+			if end+1 < len(data) && data[end+1] == '\n' {
+				size = 2
+			}
 		}
-		if i := bytes.Index(data, []byte("\r\r")); i >= 0 {
-			return i + 1, data[0:i], nil
+
+		if i == 0 {
+			if pos == 0 {
+				return nil, size, true
+			}
+			return data[:pos], end + size, true
 		}
-		if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
-			return i + 1, data[0:i], nil
+		pos = end + size
+	}
+}
+
+// ReadEvent scans the EventStream for events. The returned frame is only valid
+// until the next call to ReadEvent. Frames larger than MaxBufferSize are
+// dropped, and reading resumes with the next frame.
+func (self *EventStreamReader) ReadEvent() ([]byte, error) {
+	for {
+		if self.discarding && !self.discard() {
+			if self.err != nil {
+				return nil, self.err
+			}
+			self.fill()
+			continue
+		}
+
+		data := self.buffer[self.start:self.end]
+		atEOF := self.err != nil
+
+		if frame, advance, ok := self.split(data, atEOF); ok {
+			self.start += advance
+			self.scanned = 0
+			if frame == nil {
+				continue
+			}
+			return frame, nil
 		}
-		// If we're at EOF, we have all of the data.
+
 		if atEOF {
-			return len(data), data, nil
+			self.start = self.end
+			// A frame cut short by a broken connection is incomplete
+			if len(data) > 0 && self.err == io.EOF {
+				return data, nil
+			}
+			return nil, self.err
+		}
+
+		if !self.fill() {
+			// The frame does not fit in the buffer
+			if self.tooLarge != nil {
+				self.tooLarge(self.buffer[self.start:self.end])
+			}
+			self.discarding = true
+			self.lineStart = true
+			self.scanned = 0
 		}
-		// Request more data.
-		return 0, nil, nil
 	}
-	// Set the split function for the scanning operation.
-	scanner.Split(split)
+}
 
-	return &EventStreamReader{
-		scanner: scanner,
+// discard drops data up to the blank line ending a frame too large for the
+// buffer, reporting whether the end of the frame has been reached
+func (self *EventStreamReader) discard() bool {
+	for self.start < self.end {
+		c := self.buffer[self.start]
+		if self.skipLF {
+			self.skipLF = false
+			if c == '\n' {
+				self.start++
+				continue
+			}
+		}
+
+		if self.lineStart && (c == '\r' || c == '\n') {
+			// A "\n" following a "\r" is skipped like any blank line
+			self.start++
+			self.discarding = false
+			return true
+		}
+
+		i := bytes.IndexAny(self.buffer[self.start:self.end], "\r\n")
+		if i < 0 {
+			self.start = self.end
+			self.lineStart = false
+			return false
+		}
+		self.start += i + 1
+		self.skipLF = self.buffer[self.start-1] == '\r'
+		self.lineStart = true
 	}
+	return false
 }
 
-// ReadEvent scans the EventStream for events.
-func (self *EventStreamReader) ReadEvent() ([]byte, error) {
-	if self.scanner.Scan() {
-		event := self.scanner.Bytes()
-		return event, nil
+// split finds the end of the first frame in data. Streams using "\n" line
+// endings, which is what most servers send, are searched for the blank line
+// in a single pass, resuming where the previous search stopped. Anything
+// containing a carriage return falls back to splitFrame.
+func (self *EventStreamReader) split(data []byte, atEOF bool) (frame []byte, advance int, ok bool) {
+	if len(data) == 0 {
+		return nil, 0, false
 	}
-	if err := self.scanner.Err(); err != nil {
-		return nil, err
+	if data[0] == '\n' {
+		return nil, 1, true
+	}
+
+	from := self.scanned
+	i := bytes.Index(data[from:], lflf)
+	if i < 0 {
+		if bytes.IndexByte(data[from:], '\r') >= 0 {
+			return splitFrame(data, atEOF)
+		}
+		// The final "\n" may be the start of the blank line
+		self.scanned = len(data) - 1
+		return nil, 0, false
+	}
+
+	end := from + i + 1
+	if bytes.IndexByte(data[from:end], '\r') >= 0 {
+		return splitFrame(data, atEOF)
+	}
+	return data[:end], end + 1, true
+}
+
+// fill compacts the buffer and reads more data into it, growing it if needed.
+// It reports false, without reading, if the buffer holds MaxBufferSize bytes.
+func (self *EventStreamReader) fill() bool {
+	if self.start > 0 {
+		self.end = copy(self.buffer, self.buffer[self.start:self.end])
+		self.start = 0
+	}
+
+	limit := self.MaxBufferSize
+	if limit <= 0 {
+		limit = eventStreamBufferSize
+	}
+	if self.end >= limit {
+		return false
+	}
+	if self.end == len(self.buffer) {
+		grown := make([]byte, min(2*len(self.buffer), limit))
+		copy(grown, self.buffer[:self.end])
+		self.buffer = grown
+	}
+	free := self.buffer[self.end:min(len(self.buffer), limit)]
+
+	for i := 0; i < maxEmptyReads; i++ {
+		n, err := self.reader.Read(free)
+		self.end += n
+		if err != nil {
+			self.err = err
+			return true
+		}
+		if n > 0 {
+			return true
+		}
 	}
-	return nil, io.EOF
+	self.err = io.ErrNoProgress
+	return true
 }
@@ -4,14 +4,21 @@
 
 package sse
 
-import "strconv"
+import (
+	"math"
+	"strconv"
+	"strings"
+)
 
 // EventLog holds all of previous events
 type EventLog []*Event
 
-// Add event to eventlog
+// Add event to eventlog. Events without an id are numbered by their position
+// in the log.
 func (e *EventLog) Add(ev *Event) {
-	ev.ID = []byte(e.currentindex())
+	if len(ev.ID) == 0 {
+		ev.ID = []byte(e.currentindex())
+	}
 	(*e) = append((*e), ev)
 }
 
@@ -20,11 +27,17 @@ func (e *EventLog) Clear() {
 	*e = nil
 }
 
-// Replay events to a subscriber
+// Replay events to a subscriber. Events compressed in the log are sent with
+// their original data.
 func (e *EventLog) Replay(s *Subscriber) {
 	for i := 0; i < len((*e)); i++ {
-		if string((*e)[i].ID) >= s.eventid {
-			s.connection <- (*e)[i]
+		if compareID(string((*e)[i].ID), s.eventid) >= 0 {
+			ev, err := unpackEvent((*e)[i])
+			if err != nil || !s.wants(ev) {
+				continue
+			}
+			s.connection <- ev
+			s.notify()
 		}
 	}
 }
@@ -32,3 +45,38 @@ func (e *EventLog) Replay(s *Subscriber) {
 func (e *EventLog) currentindex() string {
 	return strconv.Itoa(len((*e)))
 }
+
+// compareID orders two event ids: sequence numbers numerically, before any
+// other id, and other ids as strings. Keeping the two kinds apart keeps the
+// order consistent when a stream has both.
+func compareID(a, b string) int {
+	x, aerr := strconv.ParseUint(a, 10, 64)
+	y, berr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aerr != nil && berr != nil:
+		return strings.Compare(a, b)
+	case aerr != nil:
+		return 1
+	case berr != nil:
+		return -1
+	}
+
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// idAfter returns the first id ordered after id, which replay, including the
+// event matching the id it starts from, starts from to skip that event. Ids
+// that are not sequence numbers, such as those of an IDGenerator, and the
+// last sequence number are followed by the id with a zero byte appended.
+func idAfter(id string) string {
+	if n, err := strconv.ParseUint(id, 10, 64); err == nil && n < math.MaxUint64 {
+		return strconv.FormatUint(n+1, 10)
+	}
+	return id + "\x00"
+}
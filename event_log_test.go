@@ -32,3 +32,35 @@ func TestEventLog(t *testing.T) {
 		})
 	})
 }
+
+func TestCompareID(t *testing.T) {
+	Convey("Given two event ids", t, func() {
+		Convey("When both are sequence numbers", func() {
+			Convey("They should be compared numerically", func() {
+				So(compareID("10", "2"), ShouldEqual, 1)
+				So(compareID("2", "10"), ShouldEqual, -1)
+				So(compareID("7", "7"), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When neither is a sequence number", func() {
+			Convey("They should be compared as strings", func() {
+				So(compareID("b", "a"), ShouldEqual, 1)
+				So(compareID("a", "a"), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When only one is a sequence number", func() {
+			Convey("It should come first", func() {
+				So(compareID("10", "a"), ShouldEqual, -1)
+				So(compareID("2", "10x"), ShouldEqual, -1)
+				So(compareID("10x", "100"), ShouldEqual, 1)
+			})
+		})
+
+		Convey("The id after the last sequence number should follow it", func() {
+			last := "18446744073709551615"
+			So(compareID(idAfter(last), last), ShouldEqual, 1)
+		})
+	})
+}
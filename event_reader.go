@@ -0,0 +1,278 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// maxLazyLineSize bounds the lines other than data lines buffered by a
+// lazyParser, as only data is streamed
+const maxLazyLineSize = 64 * 1024
+
+// EventReader is an event whose data is streamed from the connection as it is
+// read, instead of being held in memory, so payloads of any size can be
+// processed. Data is nil and the data is read with Read instead.
+//
+// Fields sent before the first data line are set when the event is handed to
+// the handler. Fields sent after it are only set once Read has returned
+// io.EOF. If the stream ends before the event is complete, Read returns
+// io.ErrUnexpectedEOF.
+type EventReader struct {
+	Event
+	data io.Reader
+}
+
+// Read reads the event's data
+func (e *EventReader) Read(p []byte) (int, error) {
+	return e.data.Read(p)
+}
+
+// States of a lazyParser streaming data
+const (
+	lazyLineEnd = iota
+	lazyInLine
+	lazyDone
+)
+
+// lazyParser reads events from a stream, handing out their data as a reader
+// over the stream instead of buffering it
+type lazyParser struct {
+	r      *bufio.Reader
+	fields fieldParser
+	line   []byte
+
+	event *EventReader
+	state int
+	// Data lines are joined with "\n", which is only sent once the next data
+	// line has been seen, as the last one is trimmed
+	pendingLF bool
+	// The previous line ended with "\r", so a leading "\n" completes it
+	skipLF bool
+	err    error
+}
+
+func newLazyParser(r io.Reader) *lazyParser {
+	return &lazyParser{r: bufio.NewReader(r)}
+}
+
+// next returns the next event, once its first data line or the blank line
+// terminating it has been read. Its data is returned as sent, without being
+// decoded. Events that are not dispatched are passed to skipped, so fields
+// such as retry can still be honored. The previous event's remaining data is
+// discarded.
+func (p *lazyParser) next(skipped func(*Event)) (*EventReader, error) {
+	if p.event != nil {
+		if _, err := io.Copy(io.Discard, p); err != nil {
+			return nil, err
+		}
+		p.event = nil
+	}
+
+	p.fields.reset()
+
+	for {
+		line, value, err := p.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if !value && !isDataField(line) {
+			if len(line) > 0 {
+				p.fields.parseLine(line)
+				continue
+			}
+			if p.fields.empty() {
+				continue
+			}
+
+			e := p.fill()
+			p.fields.reset()
+			if !p.fields.dispatch(e) {
+				skipped(e)
+				continue
+			}
+			return &EventReader{Event: *e, data: eofReader{}}, nil
+		}
+
+		// The first data line has been reached, the rest is streamed
+		p.event = &EventReader{Event: *p.fill()}
+		p.event.data = p
+		p.pendingLF = false
+		p.state = lazyLineEnd
+		if value {
+			p.state = lazyInLine
+		}
+		return p.event, nil
+	}
+}
+
+// fill returns a copy of the fields parsed so far, without data
+func (p *lazyParser) fill() *Event {
+	var e Event
+	p.fields.fill(&e)
+	e.Data = nil
+	return copyEvent(&e)
+}
+
+// Read streams the data of the current event
+func (p *lazyParser) Read(b []byte) (int, error) {
+	for {
+		if p.err != nil {
+			return 0, p.err
+		}
+
+		if p.pendingLF && p.state != lazyDone {
+			if len(b) == 0 {
+				return 0, nil
+			}
+			b[0] = '\n'
+			p.pendingLF = false
+			return 1, nil
+		}
+
+		switch p.state {
+		case lazyDone:
+			return 0, io.EOF
+
+		case lazyInLine:
+			chunk, err := p.peek()
+			if err != nil {
+				return 0, p.fail(err)
+			}
+
+			if i := bytes.IndexAny(chunk, "\r\n"); i != 0 {
+				if i > 0 {
+					chunk = chunk[:i]
+				}
+				n := copy(b, chunk)
+				p.r.Discard(n)
+				return n, nil
+			}
+
+			p.consumeLineBreak(chunk[0])
+			p.state = lazyLineEnd
+
+		case lazyLineEnd:
+			line, value, err := p.readLine()
+			if err != nil {
+				return 0, p.fail(err)
+			}
+
+			switch {
+			case value:
+				p.pendingLF = true
+				p.state = lazyInLine
+			case isDataField(line):
+				p.pendingLF = true
+			case len(line) > 0:
+				p.fields.parseLine(line)
+			default:
+				// Fields sent after the data are applied to the event
+				p.event.Event = *p.fill()
+				p.state = lazyDone
+			}
+		}
+	}
+}
+
+// readLine reads a line, without its line break. A data field is returned as
+// soon as its name has been read, with value set, leaving the stream at the
+// start of the value.
+func (p *lazyParser) readLine() (line []byte, value bool, err error) {
+	p.line = p.line[:0]
+	colon := false
+
+	for {
+		chunk, err := p.peek()
+		if err != nil {
+			if err == io.EOF && len(p.line) > 0 {
+				// An incomplete event is discarded
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, false, err
+		}
+
+		if !colon {
+			if i := bytes.IndexAny(chunk, ":\r\n"); i >= 0 && chunk[i] == ':' {
+				colon = true
+				if isDataField(append(p.line, chunk[:i]...)) {
+					p.line = append(p.line, chunk[:i]...)
+					p.r.Discard(i + 1)
+					// Remove optional leading whitespace
+					if next, err := p.peek(); err == nil && next[0] == ' ' {
+						p.r.Discard(1)
+					}
+					return p.line, true, nil
+				}
+			}
+		}
+
+		i := bytes.IndexAny(chunk, "\r\n")
+		n := i
+		if i < 0 {
+			n = len(chunk)
+		}
+		if len(p.line)+n > maxLazyLineSize {
+			return nil, false, bufio.ErrTooLong
+		}
+		p.line = append(p.line, chunk[:n]...)
+		p.r.Discard(n)
+
+		if i >= 0 {
+			p.consumeLineBreak(chunk[i])
+			return p.line, false, nil
+		}
+	}
+}
+
+// isDataField reports whether a field name is "data"
+func isDataField(name []byte) bool {
+	return string(name) == "data"
+}
+
+// consumeLineBreak discards the line break at the start of the buffer
+func (p *lazyParser) consumeLineBreak(c byte) {
+	p.r.Discard(1)
+	p.skipLF = c == '\r'
+}
+
+// peek returns the buffered bytes, reading more if there are none
+func (p *lazyParser) peek() ([]byte, error) {
+	for {
+		if p.r.Buffered() == 0 {
+			if _, err := p.r.Peek(1); err != nil {
+				return nil, err
+			}
+		}
+
+		chunk, _ := p.r.Peek(p.r.Buffered())
+		if p.skipLF {
+			p.skipLF = false
+			if chunk[0] == '\n' {
+				p.r.Discard(1)
+				continue
+			}
+		}
+		return chunk, nil
+	}
+}
+
+func (p *lazyParser) fail(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	p.err = err
+	return err
+}
+
+// eofReader is the data of an event without data
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
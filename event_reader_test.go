@@ -0,0 +1,130 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// readLazy reads every event from a stream with a lazyParser
+func readLazy(r io.Reader) (events []*Event, skipped []*Event, err error) {
+	p := newLazyParser(r)
+	for {
+		ev, err := p.next(func(e *Event) {
+			skipped = append(skipped, e)
+		})
+		if err != nil {
+			return events, skipped, err
+		}
+
+		data, err := io.ReadAll(ev)
+		if err != nil {
+			return events, skipped, err
+		}
+		ev.Data = data
+		events = append(events, &ev.Event)
+	}
+}
+
+func TestLazyParser(t *testing.T) {
+	Convey("Given a lazy parser", t, func() {
+		stream := "id: 1\nevent: update\ndata: first\ndata\ndata: second\nretry: 1000\n\n" +
+			": comment\r\n\r\nretry: 2000\n\nevent: ping\r\rdata:third\r\n\r\n"
+
+		Convey("When reading a stream", func() {
+			events, skipped, err := readLazy(strings.NewReader(stream))
+
+			Convey("It should stream the data of each event", func() {
+				So(err, ShouldEqual, io.EOF)
+				So(len(events), ShouldEqual, 3)
+				So(string(events[0].Data), ShouldEqual, "first\n\nsecond")
+				So(len(events[1].Data), ShouldEqual, 0)
+				So(string(events[2].Data), ShouldEqual, "third")
+			})
+
+			Convey("Fields following the data should be applied", func() {
+				So(string(events[0].ID), ShouldEqual, "1")
+				So(string(events[0].Event), ShouldEqual, "update")
+				So(string(events[0].Retry), ShouldEqual, "1000")
+				So(string(events[1].Event), ShouldEqual, "ping")
+			})
+
+			Convey("Events without data should be skipped", func() {
+				So(len(skipped), ShouldEqual, 2)
+				So(string(skipped[1].Retry), ShouldEqual, "2000")
+			})
+		})
+
+		Convey("When reading a stream one byte at a time", func() {
+			events, _, err := readLazy(iotest.OneByteReader(strings.NewReader(stream)))
+
+			Convey("It should produce the same events", func() {
+				So(err, ShouldEqual, io.EOF)
+				So(len(events), ShouldEqual, 3)
+				So(string(events[0].Data), ShouldEqual, "first\n\nsecond")
+				So(string(events[2].Data), ShouldEqual, "third")
+			})
+		})
+
+		Convey("When the stream ends in the middle of an event", func() {
+			p := newLazyParser(strings.NewReader("data: partial"))
+			ev, err := p.next(func(*Event) {})
+			So(err, ShouldBeNil)
+
+			Convey("Reading its data should fail", func() {
+				_, err := io.ReadAll(ev)
+				So(err, ShouldEqual, io.ErrUnexpectedEOF)
+			})
+		})
+
+		Convey("When an event is not read to the end", func() {
+			p := newLazyParser(strings.NewReader("data: a\ndata: b\n\ndata: c\n\n"))
+			p.next(func(*Event) {})
+
+			Convey("Its data should be skipped", func() {
+				ev, err := p.next(func(*Event) {})
+				So(err, ShouldBeNil)
+				data, _ := io.ReadAll(ev)
+				So(string(data), ShouldEqual, "c")
+			})
+		})
+	})
+}
+
+func TestClientSubscribeReader(t *testing.T) {
+	Convey("Given a server sending a large event", t, func() {
+		payload := strings.Repeat("x", 1<<20)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "id: 7\nevent: blob\ndata: "+payload+"\n\n")
+		}))
+		defer server.Close()
+
+		Convey("When subscribing with a reader", func() {
+			c := NewClient(server.URL)
+
+			var size int64
+			var name string
+			err := c.SubscribeReader("", func(ev *EventReader) {
+				name = string(ev.Event.Event)
+				size, _ = io.Copy(io.Discard, ev)
+			})
+
+			Convey("The data should be streamed to the handler", func() {
+				So(err, ShouldBeNil)
+				So(name, ShouldEqual, "blob")
+				So(size, ShouldEqual, len(payload))
+				So(c.EventID, ShouldEqual, "7")
+			})
+		})
+	})
+}
@@ -0,0 +1,372 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventRetryInterval(t *testing.T) {
+	Convey("Given an event with a retry field", t, func() {
+		Convey("When the value is a number of milliseconds", func() {
+			ev := &Event{Retry: []byte("1500")}
+
+			Convey("It should be parsed into a duration", func() {
+				retry, ok := ev.RetryInterval()
+				So(ok, ShouldBeTrue)
+				So(retry, ShouldEqual, 1500*time.Millisecond)
+			})
+		})
+
+		Convey("When the value contains anything but digits", func() {
+			Convey("It should be ignored", func() {
+				for _, value := range []string{"1.5", "-1", " 100", "1s", ""} {
+					_, ok := (&Event{Retry: []byte(value)}).RetryInterval()
+					So(ok, ShouldBeFalse)
+				}
+			})
+		})
+	})
+}
+
+func TestEventText(t *testing.T) {
+	Convey("Given an event", t, func() {
+		ev := &Event{
+			ID:      []byte("1"),
+			Event:   []byte("update"),
+			Data:    []byte("test"),
+			Retry:   []byte("1000"),
+			Comment: []byte("note"),
+		}
+
+		Convey("When marshaling it", func() {
+			text, err := ev.MarshalText()
+
+			Convey("It should produce an event stream frame", func() {
+				So(err, ShouldBeNil)
+				So(string(text), ShouldEqual, ": note\nid: 1\nevent: update\ndata: test\nretry: 1000\n\n")
+			})
+
+			Convey("It should be unmarshaled unchanged", func() {
+				var out Event
+				So(out.UnmarshalText(text), ShouldBeNil)
+				So(out, ShouldResemble, *ev)
+			})
+		})
+
+		Convey("When its data spans several lines", func() {
+			ev.Comment = nil
+			ev.Data = []byte("first\nsecond")
+			text, _ := ev.MarshalText()
+
+			Convey("Each line should be sent as a data field", func() {
+				So(string(text), ShouldContainSubstring, "data: first\ndata: second\n")
+			})
+
+			Convey("It should be unmarshaled unchanged", func() {
+				var out Event
+				So(out.UnmarshalText(text), ShouldBeNil)
+				So(string(out.Data), ShouldEqual, "first\nsecond")
+			})
+		})
+
+		Convey("When its name contains a line break", func() {
+			ev.Event = []byte("up\ndate")
+
+			Convey("It should not be marshaled", func() {
+				_, err := ev.MarshalText()
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestEventStreamReader(t *testing.T) {
+	Convey("Given an event stream reader", t, func() {
+		Convey("When the stream mixes line terminators", func() {
+			stream := "data: first\r\n\r\ndata: second\n\ndata: third\r\rdata: fourth\n\r\ndata: fifth\r\n\n"
+			reader := NewEventStreamReader(strings.NewReader(stream))
+
+			Convey("It should split every frame at its blank line", func() {
+				for _, expected := range []string{"first", "second", "third", "fourth", "fifth"} {
+					frame, err := reader.ReadEvent()
+					So(err, ShouldBeNil)
+
+					var ev Event
+					So(ev.UnmarshalText(frame), ShouldBeNil)
+					So(string(ev.Data), ShouldEqual, expected)
+				}
+
+				_, err := reader.ReadEvent()
+				So(err, ShouldEqual, io.EOF)
+			})
+		})
+
+		Convey("When a frame spans several lines with mixed terminators", func() {
+			reader := NewEventStreamReader(strings.NewReader("id: 1\rdata: a\r\ndata: b\n\n"))
+
+			Convey("It should be returned as a single frame", func() {
+				frame, err := reader.ReadEvent()
+				So(err, ShouldBeNil)
+
+				var ev Event
+				So(ev.UnmarshalText(frame), ShouldBeNil)
+				So(string(ev.ID), ShouldEqual, "1")
+				So(string(ev.Data), ShouldEqual, "a\nb")
+			})
+		})
+
+		Convey("When the stream is read one byte at a time", func() {
+			reader := NewEventStreamReader(iotest.OneByteReader(strings.NewReader("data: a\r\rdata: b\r\n\r\n")))
+
+			Convey("Carriage returns should not be mistaken for blank lines", func() {
+				frame, _ := reader.ReadEvent()
+				So(string(frame), ShouldEqual, "data: a\r")
+				frame, _ = reader.ReadEvent()
+				So(string(frame), ShouldEqual, "data: b\r\n")
+			})
+		})
+
+		Convey("When a frame arrives in pieces", func() {
+			reader := NewEventStreamReader(iotest.HalfReader(strings.NewReader("id: 1\ndata: " + strings.Repeat("a", 1000) + "\n\ndata: b\n\n")))
+
+			Convey("The search should resume across reads", func() {
+				frame, err := reader.ReadEvent()
+				So(err, ShouldBeNil)
+				So(string(frame), ShouldEqual, "id: 1\ndata: "+strings.Repeat("a", 1000)+"\n")
+				frame, err = reader.ReadEvent()
+				So(err, ShouldBeNil)
+				So(string(frame), ShouldEqual, "data: b\n")
+			})
+		})
+
+		Convey("When the stream ends without a blank line", func() {
+			reader := NewEventStreamReader(strings.NewReader("\n\ndata: a\n"))
+
+			Convey("The remaining data should be returned as a frame", func() {
+				frame, err := reader.ReadEvent()
+				So(err, ShouldBeNil)
+				So(string(frame), ShouldEqual, "data: a\n")
+				_, err = reader.ReadEvent()
+				So(err, ShouldEqual, io.EOF)
+			})
+		})
+
+		Convey("When the connection breaks in the middle of a frame", func() {
+			stream := io.MultiReader(strings.NewReader("data: a\n\ndata: b\n"), iotest.ErrReader(io.ErrUnexpectedEOF))
+			reader := NewEventStreamReader(stream)
+
+			Convey("The incomplete frame should be dropped", func() {
+				frame, err := reader.ReadEvent()
+				So(err, ShouldBeNil)
+				So(string(frame), ShouldEqual, "data: a\n")
+				_, err = reader.ReadEvent()
+				So(err, ShouldEqual, io.ErrUnexpectedEOF)
+			})
+		})
+
+		Convey("When a frame does not fit in the buffer", func() {
+			large := "data: " + strings.Repeat("a", eventStreamBufferSize) + "\r\ndata: b\r\n\r\n"
+			reader := NewEventStreamReader(iotest.HalfReader(strings.NewReader(large + "data: next\n\n")))
+			var dropped []byte
+			reader.tooLarge = func(raw []byte) {
+				dropped = append([]byte(nil), raw...)
+			}
+
+			Convey("It should be dropped and reading should resume with the next frame", func() {
+				frame, err := reader.ReadEvent()
+				So(err, ShouldBeNil)
+				So(string(frame), ShouldEqual, "data: next\n")
+				So(string(dropped), ShouldStartWith, "data: aaa")
+			})
+
+			Convey("It should be read whole if the buffer may grow to fit it", func() {
+				reader.MaxBufferSize = 4 * eventStreamBufferSize
+				frame, err := reader.ReadEvent()
+				So(err, ShouldBeNil)
+				So(len(frame), ShouldEqual, len(large)-2)
+				So(dropped, ShouldBeNil)
+			})
+		})
+
+		Convey("When the buffer is bounded below its initial size", func() {
+			reader := NewEventStreamReader(strings.NewReader("data: " + strings.Repeat("a", 20) + "\n\ndata: b\n\n"))
+			reader.MaxBufferSize = 16
+			var dropped bool
+			reader.tooLarge = func(raw []byte) {
+				dropped = true
+			}
+
+			Convey("Larger frames should be dropped", func() {
+				frame, err := reader.ReadEvent()
+				So(err, ShouldBeNil)
+				So(string(frame), ShouldEqual, "data: b\n")
+				So(dropped, ShouldBeTrue)
+			})
+		})
+	})
+}
+
+// denseStream returns a stream of small events, as sent by busy servers
+func denseStream(events int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < events; i++ {
+		buf.WriteString("id: 12345\nevent: update\ndata: {\"price\":101.25,\"size\":300}\n\n")
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkEventStreamReader(b *testing.B) {
+	stream := denseStream(1000)
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		reader := NewEventStreamReader(bytes.NewReader(stream))
+		for {
+			if _, err := reader.ReadEvent(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkEventStreamReaderScanner measures the bufio.Scanner based reader
+// this package used before, for comparison
+func BenchmarkEventStreamReaderScanner(b *testing.B) {
+	stream := denseStream(1000)
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+
+	split := func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if frame, advance, ok := splitFrame(data, atEOF); ok {
+			return advance, frame, nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+
+	for i := 0; i < b.N; i++ {
+		scanner := bufio.NewScanner(bytes.NewReader(stream))
+		scanner.Split(split)
+		for scanner.Scan() {
+		}
+	}
+}
+
+func TestEventEqual(t *testing.T) {
+	Convey("Given two events", t, func() {
+		a := &Event{ID: []byte("1"), Data: []byte("test")}
+		b := &Event{ID: []byte("1"), Data: []byte("test"), Event: []byte{}}
+
+		Convey("They should be equal when their fields match", func() {
+			So(a.Equal(b), ShouldBeTrue)
+		})
+
+		Convey("They should differ when any field differs", func() {
+			b.Retry = []byte("1000")
+			So(a.Equal(b), ShouldBeFalse)
+		})
+
+		Convey("A nil event should only equal another nil event", func() {
+			var none *Event
+			So(none.Equal(nil), ShouldBeTrue)
+			So(a.Equal(nil), ShouldBeFalse)
+		})
+	})
+}
+
+func TestEventString(t *testing.T) {
+	Convey("Given an event with a multiline payload", t, func() {
+		ev := &Event{ID: []byte("1"), Event: []byte("update"), Data: []byte("a\nb")}
+
+		Convey("String should render it on a single line", func() {
+			So(ev.String(), ShouldEqual, `{id="1" event="update" data="a\nb"}`)
+		})
+
+		Convey("GoString should render it as a Go expression", func() {
+			So(ev.GoString(), ShouldEqual, `&sse.Event{ID: []byte("1"), Event: []byte("update"), Data: []byte("a\nb")}`)
+		})
+	})
+}
+
+func TestEventClone(t *testing.T) {
+	Convey("Given an event", t, func() {
+		ev := &Event{ID: []byte("1"), Data: []byte("test"), Event: []byte{}}
+
+		Convey("When cloning it", func() {
+			clone := ev.Clone()
+
+			Convey("The clone should be equal", func() {
+				So(clone, ShouldResemble, ev)
+			})
+
+			Convey("The clone should not share memory with the event", func() {
+				ev.Data[0] = 'b'
+				So(string(clone.Data), ShouldEqual, "test")
+			})
+		})
+
+		Convey("A nil event should be cloned as nil", func() {
+			var none *Event
+			So(none.Clone(), ShouldBeNil)
+		})
+	})
+}
+
+func TestEventFields(t *testing.T) {
+	Convey("Given an event with non-standard fields", t, func() {
+		ev := &Event{
+			Data:   []byte("test"),
+			Fields: map[string][]byte{"meta": []byte("a\nb"), "x-vendor": []byte("1")},
+		}
+
+		Convey("When marshaling it", func() {
+			text, err := ev.MarshalText()
+
+			Convey("The fields should be written after the name", func() {
+				So(err, ShouldBeNil)
+				So(string(text), ShouldEqual, "meta: a\nmeta: b\nx-vendor: 1\ndata: test\n\n")
+			})
+
+			Convey("It should be unmarshaled unchanged", func() {
+				var out Event
+				So(out.UnmarshalText(text), ShouldBeNil)
+				So(out.Equal(ev), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a field uses a reserved name", func() {
+			ev.Fields["data"] = []byte("x")
+
+			Convey("It should not be marshaled", func() {
+				_, err := ev.MarshalText()
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When cloning it", func() {
+			clone := ev.Clone()
+			ev.Fields["meta"][0] = 'z'
+
+			Convey("The clone should not share its fields", func() {
+				So(string(clone.Fields["meta"]), ShouldEqual, "a\nb")
+			})
+		})
+	})
+}
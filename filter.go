@@ -0,0 +1,32 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+// Filter has the subscriber sent only the events match reports true for, such
+// as those of the user it subscribed for, so a stream can be shared by
+// subscribers interested in different events. It is meant to be called from
+// Server.OnSubscribe, which can derive the filter from the subscriber's
+// request. Events are passed as they are sent, after EncodeBase64, CompressData
+// or Keys have encoded their data. Comments, control events and events queued
+// with Snapshot are sent regardless.
+func (s *Subscriber) Filter(match func(ev *Event) bool) {
+	s.filter = match
+}
+
+// wants reports whether an event passes the subscriber's filter
+func (s *Subscriber) wants(ev *Event) bool {
+	return s.filter == nil || isCommentOnly(ev) || s.filter(ev)
+}
+
+// filterEvents returns the events that pass the subscriber's filter
+func (s *Subscriber) filterEvents(events []*Event) []*Event {
+	kept := events[:0]
+	for _, ev := range events {
+		if s.wants(ev) {
+			kept = append(kept, ev)
+		}
+	}
+	return kept
+}
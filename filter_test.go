@@ -0,0 +1,42 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubscriberFilter(t *testing.T) {
+	Convey("Given a stream shared by several users", t, func() {
+		s := New()
+		str := s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		s.Publish("test", &Event{Event: []byte("alice"), Data: []byte("1")})
+		s.Publish("test", &Event{Event: []byte("bob"), Data: []byte("2")})
+
+		Convey("A filtered subscriber should only receive the events it matches", func() {
+			sub := str.newSubscriber("0")
+			sub.Filter(func(ev *Event) bool {
+				return string(ev.Event) == "alice"
+			})
+			str.register <- sub
+
+			s.Publish("test", &Event{Event: []byte("bob"), Data: []byte("3")})
+			s.Publish("test", &Event{Event: []byte("alice"), Data: []byte("4")})
+			s.Publish("test", &Event{Comment: []byte("ping")})
+
+			received := collect([]*Subscriber{sub}, 3)[0]
+			So(string(received[0].Data), ShouldEqual, "1")
+			So(string(received[1].Data), ShouldEqual, "4")
+			So(string(received[2].Comment), ShouldEqual, "ping")
+		})
+	})
+}
@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// ErrFlushUnsupported is reported to Server.OnError when a response can not
+// be flushed, such as when middleware wraps the http.ResponseWriter without
+// implementing http.Flusher or an Unwrap method. Events would be buffered
+// instead of reaching the subscriber, so the subscription is rejected.
+var ErrFlushUnsupported = errors.New("response writer does not support flushing")
+
+// flusher returns a function flushing w, or nil if it can not be flushed.
+// Like http.ResponseController, it looks through middleware that exposes the
+// writer it wraps with an Unwrap method.
+func flusher(w http.ResponseWriter) func() error {
+	for {
+		switch t := w.(type) {
+		case interface{ FlushError() error }:
+			return t.FlushError
+		case http.Flusher:
+			return func() error {
+				t.Flush()
+				return nil
+			}
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// reportError passes errors serving a request to OnError
+func (s *Server) reportError(r *http.Request, err error) {
+	if s.Logger != nil {
+		args := []any{"error", err}
+		if r != nil {
+			args = append(args, "remote_addr", r.RemoteAddr, "path", r.URL.Path)
+		}
+		s.log(slog.LevelWarn, "server error", args...)
+	}
+	if s.OnError != nil {
+		s.OnError(r, err)
+	}
+}
@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// opaqueWriter is middleware hiding the writer it wraps
+type opaqueWriter struct {
+	http.ResponseWriter
+}
+
+// unwrappingWriter is middleware exposing the writer it wraps
+type unwrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (w unwrappingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// failingFlushWriter can not flush the connection
+type failingFlushWriter struct {
+	http.ResponseWriter
+}
+
+func (w failingFlushWriter) FlushError() error {
+	return errors.New("connection closed")
+}
+
+func TestServerFlushing(t *testing.T) {
+	Convey("Given a server behind middleware", t, func() {
+		s := New()
+		s.CreateStream("test")
+		errs := make(chan error, 1)
+		s.OnError = func(r *http.Request, err error) {
+			errs <- err
+		}
+
+		Reset(func() {
+			s.Close()
+		})
+
+		serve := func(wrap func(http.ResponseWriter) http.ResponseWriter) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				s.HTTPHandler(wrap(w), r)
+			}))
+		}
+
+		Convey("Writers that can not be flushed should be rejected", func() {
+			server := serve(func(w http.ResponseWriter) http.ResponseWriter { return opaqueWriter{w} })
+			resp, err := http.Get(server.URL + "?stream=test")
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+
+			So(resp.StatusCode, ShouldEqual, http.StatusInternalServerError)
+			So(<-errs, ShouldEqual, ErrFlushUnsupported)
+		})
+
+		Convey("Writers exposing the writer they wrap should be flushed", func() {
+			server := serve(func(w http.ResponseWriter) http.ResponseWriter { return unwrappingWriter{w} })
+			c := NewClient(server.URL)
+			events := make(chan *Event)
+			_, err := c.SubscribeChan("test", events)
+			So(err, ShouldBeNil)
+
+			for s.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			s.Publish("test", &Event{Data: []byte("hello")})
+
+			data, err := wait(events, time.Second)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "hello")
+		})
+
+		Convey("Failures to flush should end the subscription", func() {
+			server := serve(func(w http.ResponseWriter) http.ResponseWriter { return failingFlushWriter{w} })
+			go http.Get(server.URL + "?stream=test")
+
+			So((<-errs).Error(), ShouldEqual, "connection closed")
+		})
+	})
+}
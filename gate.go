@@ -0,0 +1,129 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrUnauthorized is wrapped by errors of Server.Authorize to reject requests
+// with 401 Unauthorized, such as those without credentials. Clients are given
+// a ResponseError matching it for such responses.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// IPList is a list of networks, such as for Server.AllowIP
+type IPList []*net.IPNet
+
+// ParseIPList parses networks in CIDR notation. Single addresses are accepted
+// as networks of their own.
+func ParseIPList(networks ...string) (IPList, error) {
+	list := make(IPList, 0, len(networks))
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			if ip := net.ParseIP(network); ip != nil && ip.To4() != nil {
+				network += "/32"
+			} else {
+				network += "/128"
+			}
+		}
+
+		_, ipnet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ipnet)
+	}
+	return list, nil
+}
+
+// Contains reports whether the address is in any of the networks
+func (l IPList) Contains(ip net.IP) bool {
+	for _, ipnet := range l {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteIP returns the address of the connection a request was made on
+func RemoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// ForwardedIP returns a function resolving the address of clients behind the
+// given trusted proxies, for Server.ClientIP. The X-Forwarded-For header is
+// only believed for requests made by a trusted proxy, and is read from the
+// right, skipping further trusted proxies, as clients can prepend anything.
+func ForwardedIP(trusted IPList) func(r *http.Request) net.IP {
+	return func(r *http.Request) net.IP {
+		ip := RemoteIP(r)
+		if ip == nil || !trusted.Contains(ip) {
+			return ip
+		}
+
+		hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+			ip = hop
+			if !trusted.Contains(hop) {
+				break
+			}
+		}
+		return ip
+	}
+}
+
+// allowed checks the client of a request with AllowIP, writing 403 Forbidden
+// and reporting false if it may not connect to the stream
+func (s *Server) allowed(w http.ResponseWriter, r *http.Request, stream string) bool {
+	if s.AllowIP == nil {
+		return true
+	}
+
+	resolve := s.ClientIP
+	if resolve == nil {
+		resolve = RemoteIP
+	}
+	if s.AllowIP(resolve(r), stream) {
+		return true
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// authorize checks a request for a stream with Authorize, writing the error
+// response and reporting false if it is rejected
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, stream string) bool {
+	if s.Authorize == nil {
+		return true
+	}
+	return authorized(w, s.Authorize(r, stream))
+}
+
+// authorized reports whether an authorization hook accepted a request,
+// writing the error response if it did not. The body is generic, as the error
+// may hold details only meant for the server.
+func authorized(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrUnauthorized):
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	default:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}
+	return false
+}
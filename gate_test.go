@@ -0,0 +1,168 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIPList(t *testing.T) {
+	Convey("Given a list of networks", t, func() {
+		list, err := ParseIPList("10.0.0.0/8", "192.168.1.1", "fd00::/8")
+		So(err, ShouldBeNil)
+
+		Convey("It should contain addresses in any of them", func() {
+			So(list.Contains(net.ParseIP("10.1.2.3")), ShouldBeTrue)
+			So(list.Contains(net.ParseIP("192.168.1.1")), ShouldBeTrue)
+			So(list.Contains(net.ParseIP("fd00::1")), ShouldBeTrue)
+			So(list.Contains(net.ParseIP("192.168.1.2")), ShouldBeFalse)
+		})
+
+		Convey("Invalid networks should be rejected", func() {
+			_, err := ParseIPList("10.0.0.0/33")
+			So(err, ShouldNotBeNil)
+			_, err = ParseIPList("localhost")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestForwardedIP(t *testing.T) {
+	Convey("Given clients behind a trusted proxy", t, func() {
+		proxies, _ := ParseIPList("10.0.0.0/8")
+		resolve := ForwardedIP(proxies)
+
+		request := func(remote string, forwarded ...string) *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/events", nil)
+			r.RemoteAddr = remote
+			for _, f := range forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			return r
+		}
+
+		Convey("The forwarded address should be used for requests made by the proxy", func() {
+			So(resolve(request("10.0.0.1:1234", "203.0.113.7")).String(), ShouldEqual, "203.0.113.7")
+		})
+
+		Convey("Addresses prepended by the client should be ignored", func() {
+			ip := resolve(request("10.0.0.1:1234", "10.0.0.9, 203.0.113.7", "10.0.0.2"))
+			So(ip.String(), ShouldEqual, "203.0.113.7")
+		})
+
+		Convey("The header should be ignored for requests made by anyone else", func() {
+			So(resolve(request("203.0.113.9:1234", "10.0.0.5")).String(), ShouldEqual, "203.0.113.9")
+		})
+	})
+}
+
+func TestServerAllowIP(t *testing.T) {
+	Convey("Given a server restricting a stream to internal clients", t, func() {
+		internal, _ := ParseIPList("10.0.0.0/8")
+		s := New()
+		s.CreateStream("internal")
+		s.AllowIP = func(ip net.IP, stream string) bool {
+			return stream != "internal" || internal.Contains(ip)
+		}
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("Other clients should be forbidden", func() {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/events?stream=internal", nil)
+			r.RemoteAddr = "203.0.113.9:1234"
+			s.HTTPHandler(rec, r)
+
+			So(rec.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("Other clients should not reach the stream through the other handlers", func() {
+			for _, handler := range []http.HandlerFunc{s.IngestHandler, s.AckHandler, s.DebugHandler} {
+				rec := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/events?stream=internal&client=a&id=1", nil)
+				r.RemoteAddr = "203.0.113.9:1234"
+				handler(rec, r)
+
+				So(rec.Code, ShouldEqual, http.StatusForbidden)
+			}
+		})
+
+		Convey("Other streams should be open to anyone", func() {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/events?stream=missing", nil)
+			r.RemoteAddr = "203.0.113.9:1234"
+			s.HTTPHandler(rec, r)
+
+			So(rec.Code, ShouldNotEqual, http.StatusForbidden)
+		})
+	})
+}
+
+func TestServerAuthorize(t *testing.T) {
+	Convey("Given a server authorizing subscriptions", t, func() {
+		s := New()
+		s.AutoStream = true
+		s.Authorize = func(r *http.Request, stream string) error {
+			switch r.Header.Get("Authorization") {
+			case "":
+				return fmt.Errorf("%w: missing token", ErrUnauthorized)
+			case "Bearer " + stream:
+				return nil
+			}
+			return errors.New("not allowed")
+		}
+
+		Reset(func() {
+			s.Close()
+		})
+
+		subscribe := func(token string) int {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/events?stream=orders", nil)
+			if token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			s.HTTPHandler(rec, r)
+			return rec.Code
+		}
+
+		Convey("Requests without credentials should be unauthorized", func() {
+			So(subscribe(""), ShouldEqual, http.StatusUnauthorized)
+			So(s.StreamExists("orders"), ShouldBeFalse)
+		})
+
+		Convey("Requests for other streams should be forbidden", func() {
+			So(subscribe("invoices"), ShouldEqual, http.StatusForbidden)
+			So(s.StreamExists("orders"), ShouldBeFalse)
+		})
+
+		Convey("The reason should not be sent to the client", func() {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/events?stream=orders", nil)
+			s.HTTPHandler(rec, r)
+
+			So(rec.Body.String(), ShouldNotContainSubstring, "missing token")
+		})
+
+		Convey("Acknowledgements should be authorized too", func() {
+			s.CreateStream("orders")
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/events?stream=orders&client=a&id=1", nil)
+			r.Header.Set("Authorization", "Bearer invoices")
+			s.AckHandler(rec, r)
+
+			So(rec.Code, ShouldEqual, http.StatusForbidden)
+		})
+	})
+}
@@ -0,0 +1,220 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultHandoffTTL is how long imported subscriber states are kept, unless
+// Server.HandoffTTL is set
+const DefaultHandoffTTL = time.Minute
+
+// maxHandoffs bounds the subscriber states kept at once. Clients of the
+// states imported beyond it reconnect like new subscribers.
+const maxHandoffs = 100000
+
+// SubscriberState is the resume state of a subscriber, which lets another
+// server pick up where this one left off, such as when a proxy drains a server
+// during a deploy. Only subscribers identifying themselves with the client
+// parameter have a state, as that is what they are recognized by when they
+// reconnect.
+type SubscriberState struct {
+	Stream string `json:"stream"`
+	Client string `json:"client"`
+	// Id of the last event written to the subscriber, if any
+	LastEventID string `json:"lastEventId,omitempty"`
+	// Parameters of the subscription other than the stream, such as filters
+	Query string `json:"query,omitempty"`
+}
+
+// ExportSubscribers returns the state of every subscriber identified by the
+// client parameter
+func (s *Server) ExportSubscribers() []SubscriberState {
+	s.mu.Lock()
+	streams := make(map[string]*Stream, len(s.Streams))
+	for id, str := range s.Streams {
+		streams[id] = str
+	}
+	s.mu.Unlock()
+
+	states := make([]SubscriberState, 0)
+	for id, str := range streams {
+		for _, sub := range str.listSubscribers() {
+			if sub.client == "" {
+				continue
+			}
+			state := SubscriberState{Stream: id, Client: sub.client, Query: sub.query}
+			state.LastEventID = sub.lastSent()
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// ImportSubscribers keeps the states exported by another server for HandoffTTL,
+// so their subscribers resume from them once they connect to this server. A
+// subscriber presenting a last event id of its own resumes from that instead,
+// but still gets the parameters of its previous subscription. Event ids are
+// only meaningful to servers sharing the same event history, such as through
+// a Broker.
+func (s *Server) ImportSubscribers(states []SubscriberState) {
+	s.handoffs.put(states, clockOrSystem(s.clock).Now(), s.handoffTTL())
+}
+
+func (s *Server) handoffTTL() time.Duration {
+	if s.HandoffTTL > 0 {
+		return s.HandoffTTL
+	}
+	return DefaultHandoffTTL
+}
+
+// Drain closes the server like Close, returning the state of its subscribers
+// as of just before their connections are closed
+func (s *Server) Drain() []SubscriberState {
+	states := s.ExportSubscribers()
+	s.Close()
+	return states
+}
+
+// HandoffHandler moves subscribers between servers. GET returns the states of
+// the server's subscribers as JSON, POST imports states in the same format and
+// DELETE drains the server, returning the states like GET. Requests are only
+// accepted once Server.AuthorizeHandoff is set, and only if it accepts them.
+func (s *Server) HandoffHandler(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+
+	if !s.allowed(w, r, "") {
+		return
+	}
+	if s.AuthorizeHandoff == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !authorized(w, s.AuthorizeHandoff(r)) {
+		return
+	}
+
+	var states []SubscriberState
+	switch r.Method {
+	case http.MethodGet:
+		states = s.ExportSubscribers()
+	case http.MethodPost:
+		body := http.MaxBytesReader(w, r.Body, maxIngestSize)
+		if err := json.NewDecoder(body).Decode(&states); err != nil {
+			http.Error(w, "Invalid subscriber states!", http.StatusBadRequest)
+			return
+		}
+		s.ImportSubscribers(states)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodDelete:
+		states = s.Drain()
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(states)
+}
+
+// subscriptionQuery returns the parameters of a subscription request other
+// than the stream and the position it resumes from
+func subscriptionQuery(r *http.Request) string {
+	query := r.URL.Query()
+	query.Del("stream")
+	query.Del("lastEventId")
+	return query.Encode()
+}
+
+// restoreQuery adds the parameters of the previous subscription that the
+// request does not set itself
+func (state SubscriberState) restoreQuery(r *http.Request) {
+	previous, err := url.ParseQuery(state.Query)
+	if err != nil || len(previous) == 0 {
+		return
+	}
+
+	query := r.URL.Query()
+	for name, values := range previous {
+		if _, ok := query[name]; !ok {
+			query[name] = values
+		}
+	}
+	r.URL.RawQuery = query.Encode()
+}
+
+// resumeFrom returns the event id replay should start from, which is the one
+// after the last event written to the subscriber
+func (state SubscriberState) resumeFrom() string {
+	if state.LastEventID == "" {
+		return ""
+	}
+	return idAfter(state.LastEventID)
+}
+
+// handoffs holds imported subscriber states until their subscribers connect
+type handoffs struct {
+	mu     sync.Mutex
+	states map[string]handoff
+}
+
+type handoff struct {
+	state    SubscriberState
+	imported time.Time
+}
+
+func (h *handoffs) key(stream, client string) string {
+	return stream + "\x00" + client
+}
+
+// put keeps states, removing the ones that have expired along the way. States
+// beyond maxHandoffs are dropped.
+func (h *handoffs) put(states []SubscriberState, now time.Time, ttl time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.states == nil {
+		h.states = make(map[string]handoff)
+	}
+	for k, ho := range h.states {
+		if now.Sub(ho.imported) > ttl {
+			delete(h.states, k)
+		}
+	}
+
+	for _, state := range states {
+		k := h.key(state.Stream, state.Client)
+		if _, ok := h.states[k]; !ok && len(h.states) >= maxHandoffs {
+			continue
+		}
+		h.states[k] = handoff{state: state, imported: now}
+	}
+}
+
+// take removes and returns the state imported for a subscriber, unless it is
+// older than ttl
+func (h *handoffs) take(stream, client string, now time.Time, ttl time.Duration) (SubscriberState, bool) {
+	if client == "" {
+		return SubscriberState{}, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	k := h.key(stream, client)
+	ho, ok := h.states[k]
+	if !ok {
+		return SubscriberState{}, false
+	}
+	delete(h.states, k)
+	return ho.state, now.Sub(ho.imported) <= ttl
+}
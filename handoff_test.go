@@ -0,0 +1,152 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubscriberHandoff(t *testing.T) {
+	Convey("Given a server with an identified subscriber", t, func() {
+		old := New()
+		str := old.CreateStream("test")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/events?stream=test&client=alice&topic=news", nil)
+		go old.HTTPHandler(httptest.NewRecorder(), req.WithContext(ctx))
+
+		for str.SubscriberCount() == 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+		for _, data := range []string{"a", "b"} {
+			old.Publish("test", &Event{Data: []byte(data)})
+		}
+
+		Reset(func() {
+			cancel()
+			old.Close()
+		})
+
+		Convey("Its state should be exported", func() {
+			var states []SubscriberState
+			for {
+				states = old.ExportSubscribers()
+				if len(states) == 1 && states[0].LastEventID == "1" {
+					break
+				}
+				time.Sleep(time.Millisecond * 10)
+			}
+			So(states[0].Stream, ShouldEqual, "test")
+			So(states[0].Client, ShouldEqual, "alice")
+			So(states[0].Query, ShouldEqual, "client=alice&topic=news")
+		})
+
+		Convey("Another server should resume it from the exported state", func() {
+			for {
+				if states := old.ExportSubscribers(); len(states) == 1 && states[0].LastEventID == "1" {
+					break
+				}
+				time.Sleep(time.Millisecond * 10)
+			}
+
+			authorize := func(r *http.Request) error {
+				if r.Header.Get("Authorization") != "Bearer deploy" {
+					return ErrUnauthorized
+				}
+				return nil
+			}
+			old.AuthorizeHandoff = authorize
+
+			denied := httptest.NewRecorder()
+			old.HandoffHandler(denied, httptest.NewRequest(http.MethodDelete, "/handoff", nil))
+			So(denied.Code, ShouldEqual, http.StatusUnauthorized)
+			So(old.isClosed(), ShouldBeFalse)
+
+			drained := httptest.NewRecorder()
+			drain := httptest.NewRequest(http.MethodDelete, "/handoff", nil)
+			drain.Header.Set("Authorization", "Bearer deploy")
+			old.HandoffHandler(drained, drain)
+			So(drained.Code, ShouldEqual, http.StatusOK)
+
+			next := New()
+			defer next.Close()
+			str = next.CreateStream("test")
+			for _, data := range []string{"a", "b", "c"} {
+				next.Publish("test", &Event{Data: []byte(data)})
+			}
+
+			next.AuthorizeHandoff = authorize
+			imported := httptest.NewRecorder()
+			imports := httptest.NewRequest(http.MethodPost, "/handoff", bytes.NewReader(drained.Body.Bytes()))
+			imports.Header.Set("Authorization", "Bearer deploy")
+			next.HandoffHandler(imported, imports)
+			So(imported.Code, ShouldEqual, http.StatusNoContent)
+
+			var states []SubscriberState
+			json.Unmarshal(drained.Body.Bytes(), &states)
+			So(states, ShouldHaveLength, 1)
+
+			req := httptest.NewRequest(http.MethodGet, "/events?stream=test&client=alice", nil)
+			go next.HTTPHandler(httptest.NewRecorder(), req.WithContext(ctx))
+
+			for str.SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+			subs := str.listSubscribers()
+			So(subs, ShouldHaveLength, 1)
+			So(subs[0].eventid, ShouldEqual, "2")
+			So(subs[0].query, ShouldEqual, "client=alice&topic=news")
+		})
+
+		Convey("Imported states should only be used once", func() {
+			s := New()
+			s.ImportSubscribers([]SubscriberState{{Stream: "test", Client: "alice", LastEventID: "4"}})
+
+			state, ok := s.handoffs.take("test", "alice", time.Now(), time.Minute)
+			So(ok, ShouldBeTrue)
+			So(state.resumeFrom(), ShouldEqual, "5")
+
+			_, ok = s.handoffs.take("test", "alice", time.Now(), time.Minute)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("The handler should reject everything without AuthorizeHandoff", func() {
+			for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+				rec := httptest.NewRecorder()
+				old.HandoffHandler(rec, httptest.NewRequest(method, "/handoff", nil))
+				So(rec.Code, ShouldEqual, http.StatusForbidden)
+			}
+			So(old.isClosed(), ShouldBeFalse)
+		})
+
+		Convey("Imported states should be bounded", func() {
+			s := New()
+			states := make([]SubscriberState, maxHandoffs+1)
+			for i := range states {
+				states[i] = SubscriberState{Stream: "test", Client: strconv.Itoa(i)}
+			}
+			s.ImportSubscribers(states)
+
+			So(s.handoffs.states, ShouldHaveLength, maxHandoffs)
+		})
+
+		Convey("Imported states should expire", func() {
+			s := New()
+			s.ImportSubscribers([]SubscriberState{{Stream: "test", Client: "alice"}})
+
+			_, ok := s.handoffs.take("test", "alice", time.Now().Add(time.Second), time.Millisecond)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,107 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Health statuses reported by Server.Health
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// HealthChecker is implemented by a Broker or StreamProvider that can report
+// whether the system behind it is reachable
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// Health is the state of a server, as reported by HealthHandler
+type Health struct {
+	// HealthOK if the server and every stream are ready
+	Status string `json:"status"`
+	// Error of the broker, if it is unreachable
+	Broker string `json:"broker,omitempty"`
+	// Error of the stream provider, if it is unreachable
+	Provider string                  `json:"provider,omitempty"`
+	Streams  map[string]StreamHealth `json:"streams"`
+}
+
+// StreamHealth is the state of a single stream
+type StreamHealth struct {
+	Subscribers int `json:"subscribers"`
+	// Why the stream is not ready, if it is not
+	Error string `json:"error,omitempty"`
+}
+
+// Health checks the server and each of its streams
+func (s *Server) Health() Health {
+	health := Health{Status: HealthOK, Streams: make(map[string]StreamHealth)}
+
+	if err := checkHealth(s.Broker); err != nil {
+		health.Broker = err.Error()
+		health.Status = HealthUnavailable
+	}
+	if err := checkHealth(s.Provider); err != nil {
+		health.Provider = err.Error()
+		health.Status = HealthUnavailable
+	}
+
+	s.mu.Lock()
+	streams := make(map[string]*Stream, len(s.Streams))
+	for id, str := range s.Streams {
+		streams[id] = str
+	}
+	closed := s.closed
+	s.mu.Unlock()
+
+	if closed {
+		health.Status = HealthUnavailable
+	}
+
+	limit := s.Config().MaxHealthySubscribers
+	for id, str := range streams {
+		sh := StreamHealth{Subscribers: str.SubscriberCount()}
+		if limit > 0 && sh.Subscribers > limit {
+			sh.Error = fmt.Sprintf("%d subscribers exceed the limit of %d", sh.Subscribers, limit)
+			health.Status = HealthUnavailable
+		}
+		health.Streams[id] = sh
+	}
+
+	return health
+}
+
+// HealthHandler serves the server's Health as JSON, for liveness and
+// readiness probes. It responds with 503 Service Unavailable unless the
+// server and all of its streams are ready.
+func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+
+	if !s.allowed(w, r, "") {
+		return
+	}
+
+	health := s.Health()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if health.Status != HealthOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
+
+// checkHealth checks v if it is a HealthChecker
+func checkHealth(v interface{}) error {
+	if checker, ok := v.(HealthChecker); ok {
+		return checker.CheckHealth()
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// unhealthyBroker is a broker that has lost its connection
+type unhealthyBroker struct {
+	*MemoryBroker
+}
+
+func (unhealthyBroker) CheckHealth() error {
+	return errors.New("connection refused")
+}
+
+func TestHealthHandler(t *testing.T) {
+	Convey("Given a server with a stream", t, func() {
+		s := New()
+		s.CreateStream("test")
+		s.getStream("test").addSubscriber("0")
+
+		check := func() (int, Health) {
+			rec := httptest.NewRecorder()
+			s.HealthHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			var health Health
+			So(json.NewDecoder(rec.Body).Decode(&health), ShouldBeNil)
+			return rec.Code, health
+		}
+
+		Convey("It should report it as ready", func() {
+			code, health := check()
+			So(code, ShouldEqual, http.StatusOK)
+			So(health.Status, ShouldEqual, HealthOK)
+			So(health.Streams["test"].Subscribers, ShouldEqual, 1)
+		})
+
+		Convey("Streams with too many subscribers should not be ready", func() {
+			s.getStream("test").addSubscriber("0")
+			s.MaxHealthySubscribers = 1
+
+			code, health := check()
+			So(code, ShouldEqual, http.StatusServiceUnavailable)
+			So(health.Streams["test"].Error, ShouldNotBeEmpty)
+		})
+
+		Convey("An unreachable broker should make the server unavailable", func() {
+			s.Broker = unhealthyBroker{NewMemoryBroker()}
+
+			code, health := check()
+			So(code, ShouldEqual, http.StatusServiceUnavailable)
+			So(health.Broker, ShouldEqual, "connection refused")
+		})
+
+		Convey("A closed server should be unavailable", func() {
+			s.Close()
+
+			code, health := check()
+			So(code, ShouldEqual, http.StatusServiceUnavailable)
+			So(health.Streams, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			s.Close()
+		})
+	})
+}
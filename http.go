@@ -5,22 +5,68 @@
 package sse
 
 import (
-	"fmt"
+	"context"
 	"net/http"
+	"runtime/pprof"
+	"strings"
+	"time"
 )
 
 // HTTPHandler serves new connections with events for a given stream ...
 func (s *Server) HTTPHandler(w http.ResponseWriter, r *http.Request) {
-	flusher, err := w.(http.Flusher)
-	if !err {
+	r = s.defaultStream(r)
+	s.setSecurityHeaders(w)
+
+	if !s.allowed(w, r, r.URL.Query().Get("stream")) {
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		s.preflight(w, r)
+		return
+	}
+
+	if !s.enter() {
+		http.Error(w, "Server is shutting down!", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.connections.Done()
+
+	if s.TrackAcks && r.Method == http.MethodPost && r.URL.Query().Has(AckParameter) {
+		s.AckHandler(w, r)
+		return
+	}
+
+	flush := flusher(w)
+	if flush == nil {
+		s.reportError(r, ErrFlushUnsupported)
 		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/event-stream")
+	// Streams owned by another node are served there
+	if s.Registry != nil {
+		if id := r.URL.Query().Get("stream"); s.getStream(id) == nil && s.forward(w, r, id) {
+			return
+		}
+	}
+
+	framing := s.framing(r)
+	w.Header().Set("Content-Type", framing.String())
 	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	// Connection specific headers are not allowed from HTTP/2 on
+	if r.ProtoMajor < 2 {
+		w.Header().Set("Connection", "keep-alive")
+	}
+	cfg := s.Config()
+	s.setCORSHeaders(w, r, cfg)
+	if s.NDJSON {
+		w.Header().Add("Vary", "Accept")
+	}
+	s.setAffinity(w)
+	if s.ResponseHeaders != nil {
+		s.ResponseHeaders(w.Header(), r)
+	}
 
 	// Get the StreamID from the URL
 	streamID := r.URL.Query().Get("stream")
@@ -29,7 +75,24 @@ func (s *Server) HTTPHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stream := s.getStream(streamID)
+	if !s.authorize(w, r, streamID) {
+		return
+	}
+
+	handoff, handedOff := s.handoffs.take(streamID, r.URL.Query().Get("client"), clockOrSystem(s.clock).Now(), s.handoffTTL())
+	if handedOff {
+		handoff.restoreQuery(r)
+	}
+
+	stream := s.activeStream(streamID)
+
+	if stream == nil && s.Provider != nil {
+		var err error
+		if stream, err = s.provideStream(streamID); err != nil {
+			http.Error(w, "Stream not found!", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	if stream == nil && !s.AutoStream {
 		http.Error(w, "Stream not found!", http.StatusInternalServerError)
@@ -38,40 +101,193 @@ func (s *Server) HTTPHandler(w http.ResponseWriter, r *http.Request) {
 		stream = s.CreateStream(streamID)
 	}
 
-	eventid := r.Header.Get("Last-Event-ID")
+	if stream.Authorize != nil && !authorized(w, stream.Authorize(r)) {
+		return
+	}
+
+	eventid := lastEventID(r)
+	if eventid == "" && handedOff {
+		eventid = handoff.resumeFrom()
+	}
+	resuming := eventid != ""
 	if eventid == "" {
 		eventid = "0"
 	}
 
+	// Redeliver everything the client has not acknowledged yet
+	if client := r.URL.Query().Get("client"); s.TrackAcks && client != "" {
+		if id, ok := s.acks.resume(streamID, client, clockOrSystem(s.clock).Now()); ok {
+			eventid, resuming = id, true
+		}
+	}
+
+	if s.ResumeCursors {
+		eventid = s.resumeFrom(streamID, eventid)
+	}
+
+	// Fill in events the eventlog no longer holds
+	var backlog []*Event
+	if resuming && s.Backfill != nil && stream.AutoReplay {
+		eventid, backlog = s.backfill(r, streamID, stream, eventid)
+	}
+
 	// Create the stream subscriber
-	sub := stream.addSubscriber(eventid)
+	sub := stream.newSubscriber(eventid)
+	// The context of a request is done once its connection is hijacked, so
+	// pooled subscribers are given one that ends with their connection
+	ctx := r.Context()
+	if s.DispatchMode == DispatchPooled {
+		ctx = context.WithoutCancel(ctx)
+	}
+	sub.ctx, sub.cancel = context.WithCancel(ctx)
+	sub.request = r
+	sub.backlog = backlog
+	sub.maxLine, sub.framing = cfg.MaxLineLength, framing
+	s.instrument(r, streamID, sub)
+	sub.debug, sub.name = stream.debug, subscriberName(r)
+	sub.client, sub.query = r.URL.Query().Get("client"), subscriptionQuery(r)
+	sub.remoteAddr, sub.userAgent = r.RemoteAddr, r.UserAgent()
+	if s.Audit != nil {
+		sub.audit = s.auditor().subscriber(streamID, sub)
+	}
+	sub.labels = profileLabels(context.Background(), streamID, sub.name)
+	if s.ResumeCursors {
+		sub.prepare = s.cursorEncoder(streamID)
+	}
+	if s.SigningKeys != nil {
+		sub.prepare = s.signer(r, sub.prepare, sub.maxLine)
+	}
+	s.subscribed(r, streamID, sub)
+
+	if s.DispatchMode == DispatchPooled && s.servePooled(w, stream, sub) {
+		return
+	}
+
+	if !stream.join(sub) {
+		sub.ended()
+		http.Error(w, "Too many subscribers!", http.StatusServiceUnavailable)
+		return
+	}
 	defer sub.close()
+	defer sub.ended()
+
+	// Attribute the request's goroutine to the subscriber in profiles, until
+	// it is done serving it
+	pprof.SetGoroutineLabels(profileLabels(r.Context(), streamID, sub.name))
+	defer pprof.SetGoroutineLabels(r.Context())
+
+	// Send the headers right away, so clients do not wait for the first event
+	// to learn that they are subscribed
+	w.WriteHeader(http.StatusOK)
+	if err := flush(); err != nil {
+		s.reportError(r, err)
+		return
+	}
 
-	notify := w.(http.CloseNotifier).CloseNotify()
 	go func() {
-		<-notify
+		<-r.Context().Done()
 		sub.close()
 	}()
 
 	// Push events to client
+	out := meteredWriter{Writer: w, written: &stream.counters.written}
 	for {
-		select {
-		case ev, ok := <-sub.connection:
-			if !ok {
-				return
-			}
-			fmt.Fprintf(w, "id: %s\n", ev.ID)
-			if len(ev.Event) > 0 {
-				fmt.Fprintf(w, "event: %s\n", ev.Event)
-			}
-			if len(ev.Data) > 0 {
-				fmt.Fprintf(w, "data: %s\n", ev.Data)
-			}
-			if len(ev.Retry) > 0 {
-				fmt.Fprintf(w, "retry: %s\n", ev.Retry)
+		ev, ok := sub.next()
+		if !ok {
+			return
+		}
+		start := time.Now()
+		err := sub.write(out, ev)
+		if err == nil && !(ev.batched && sub.waiting()) {
+			err = flush()
+		}
+		sub.delivered(ev, start, err)
+		if err != nil {
+			s.reportError(r, err)
+			return
+		}
+	}
+}
+
+// subscribed passes a new subscriber to OnSubscribe, queueing the snapshot it
+// is given, and arranges for OnUnsubscribe to be called once it has ended
+func (s *Server) subscribed(r *http.Request, stream string, sub *Subscriber) {
+	if s.Logger != nil {
+		sub.logger = s.Logger.With("stream", stream, "subscriber", sub.id)
+		sub.logger.Info("subscriber connected", "remote_addr", sub.remoteAddr, "last_event_id", sub.eventid)
+	}
+	if s.OnSubscribe != nil {
+		s.OnSubscribe(stream, sub)
+	}
+	if sub.filter != nil {
+		sub.backlog = sub.filterEvents(sub.backlog)
+	}
+	if len(sub.snapshot) > 0 {
+		snapshot := make([]*Event, 0, len(sub.snapshot)+len(sub.backlog))
+		for _, event := range sub.snapshot {
+			processed := s.process(event)
+			if err := s.seal(stream, processed); err != nil {
+				s.reportError(r, err)
+				continue
 			}
-			fmt.Fprint(w, "\n")
-			flusher.Flush()
+			snapshot = append(snapshot, processed)
+		}
+		sub.backlog = append(snapshot, sub.backlog...)
+		sub.snapshot = nil
+	}
+
+	if s.OnUnsubscribe != nil {
+		sub.unsubscribed = func() {
+			s.OnUnsubscribe(stream, sub)
+		}
+	}
+}
+
+// defaultStream returns a copy of a request naming the stream given by
+// StreamFromRequest in its stream query parameter, in place of any it names
+// itself, or DefaultStream if neither names one. Requests already naming the
+// right stream are returned as they are.
+func (s *Server) defaultStream(r *http.Request) *http.Request {
+	query := r.URL.Query()
+	stream := query.Get("stream")
+	// The routed stream wins, so the query can not reach around it
+	if s.StreamFromRequest != nil {
+		if name := s.StreamFromRequest(r); name != "" {
+			stream = name
+		}
+	}
+	if stream == "" {
+		stream = s.DefaultStream
+	}
+	if stream == "" || stream == query.Get("stream") {
+		return r
+	}
+	query.Set("stream", stream)
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query.Encode()
+	return r
+}
+
+// PathStream returns a Server.StreamFromRequest naming the stream by the rest
+// of the URL path after prefix, such as PathStream("/events/") for requests
+// to /events/{stream}
+func PathStream(prefix string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		stream, found := strings.CutPrefix(r.URL.Path, prefix)
+		if !found {
+			return ""
 		}
+		return stream
+	}
+}
+
+// lastEventID returns the position a client is resuming from. Browsers resend
+// the Last-Event-ID header on every reconnect, so it takes precedence over the
+// lastEventId query parameter, which clients behind proxies that strip the
+// header can use instead.
+func lastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
 	}
+	return r.URL.Query().Get("lastEventId")
 }
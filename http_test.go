@@ -5,6 +5,7 @@
 package sse
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -113,5 +114,140 @@ func TestHTTP(t *testing.T) {
 			})
 		})
 
+		Convey("When a client resumes using the query parameter", func() {
+			r := httptest.NewRequest("GET", "/events?stream=test&lastEventId=5", nil)
+
+			Convey("It should be used as the last event id", func() {
+				So(lastEventID(r), ShouldEqual, "5")
+			})
+
+			Convey("It should be overridden by the Last-Event-ID header", func() {
+				r.Header.Set("Last-Event-ID", "7")
+				So(lastEventID(r), ShouldEqual, "7")
+			})
+		})
+
+	})
+}
+
+type principalKey struct{}
+
+func TestHTTPRequestContext(t *testing.T) {
+	Convey("Given middleware placing a value in the request context", t, func() {
+		s := New()
+		s.ReplaySize = 1
+		str := s.CreateStream("test")
+
+		var backfilled interface{}
+		s.Backfill = func(ctx context.Context, stream, from, until string) ([]*Event, error) {
+			backfilled = ctx.Value(principalKey{})
+			return nil, nil
+		}
+
+		for i := 0; i < 3; i++ {
+			s.Publish("test", &Event{Data: []byte("event")})
+		}
+		for str.Sequence() < 3 {
+			str.SubscriberCount()
+		}
+
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), principalKey{}, "alice"))
+		req := httptest.NewRequest(http.MethodGet, "/events?stream=test", nil).WithContext(ctx)
+		req.Header.Set("Last-Event-ID", "0")
+		go s.HTTPHandler(httptest.NewRecorder(), req)
+
+		for str.SubscriberCount() == 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		Reset(func() {
+			cancel()
+			s.Close()
+		})
+
+		Convey("Subscribers should carry the value", func() {
+			subs := str.listSubscribers()
+			So(subs, ShouldHaveLength, 1)
+			So(subs[0].Context().Value(principalKey{}), ShouldEqual, "alice")
+		})
+
+		Convey("Backfill should be passed the value", func() {
+			So(backfilled, ShouldEqual, "alice")
+		})
+	})
+}
+
+func TestHTTPDefaultStream(t *testing.T) {
+	Convey("Given a server with a default stream", t, func() {
+		s := New()
+		s.DefaultStream = "feed"
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+		s.CreateStream("feed")
+		s.Publish("feed", &Event{Data: []byte("hello")})
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		Convey("Raw subscriptions should receive its events", func() {
+			events := make(chan *Event)
+			go NewClient(server.URL).SubscribeRaw(func(msg *Event) {
+				events <- msg
+			})
+
+			msg, err := wait(events, time.Second)
+			So(err, ShouldBeNil)
+			So(string(msg), ShouldEqual, "hello")
+		})
+
+		Convey("Requests naming another stream should not be redirected", func() {
+			w := httptest.NewRecorder()
+			s.HTTPHandler(w, httptest.NewRequest(http.MethodGet, "/events?stream=other", nil))
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
+
+func TestHTTPPathStream(t *testing.T) {
+	Convey("Given a server routing streams by path", t, func() {
+		s := New()
+		s.StreamFromRequest = PathStream("/events/")
+		mux := http.NewServeMux()
+		mux.HandleFunc("/events/", s.HTTPHandler)
+		server := httptest.NewServer(mux)
+		s.CreateStream("feed")
+		s.Publish("feed", &Event{Data: []byte("hello")})
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		Convey("Clients naming the stream in the path should receive its events", func() {
+			c := NewClient(server.URL + "/events")
+			c.StreamInPath = true
+			events := make(chan *Event)
+			go c.Subscribe("feed", func(msg *Event) {
+				events <- msg
+			})
+
+			msg, err := wait(events, time.Second)
+			So(err, ShouldBeNil)
+			So(string(msg), ShouldEqual, "hello")
+		})
+
+		Convey("The stream in the path should win over the query parameter", func() {
+			r := s.defaultStream(httptest.NewRequest(http.MethodGet, "/events/feed?stream=other", nil))
+			So(r.URL.Query().Get("stream"), ShouldEqual, "feed")
+		})
+
+		Convey("Other paths should name no stream", func() {
+			w := httptest.NewRecorder()
+			s.HTTPHandler(w, httptest.NewRequest(http.MethodGet, "/other/feed", nil))
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		})
 	})
 }
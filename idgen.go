@@ -0,0 +1,91 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IDGenerator returns the id of an event published to a stream, given the
+// sequence number it would otherwise be sent with, see Stream.IDGenerator.
+// A stream calls it from its own goroutine in the order events are published,
+// but a generator shared by several streams is called from each of them. Ids
+// have to increase, in numeric order for ids made of digits and in
+// lexicographic order otherwise, for replay to find where clients left off.
+type IDGenerator func(stream string, seq uint64) string
+
+// crockford is the alphabet ULIDs are encoded in
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator generates monotonic ULIDs
+type ulidGenerator struct {
+	mu      sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}
+
+// NewULIDGenerator returns an IDGenerator yielding ULIDs, which sort by the
+// time they were generated at. Ids generated within the same millisecond
+// increase the random part of the previous one, so they keep increasing.
+func NewULIDGenerator() IDGenerator {
+	g := &ulidGenerator{}
+	return g.next
+}
+
+func (g *ulidGenerator) next(string, uint64) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if ms := uint64(time.Now().UnixMilli()); ms > g.ms {
+		g.ms = ms
+		rand.Read(g.entropy[:])
+	} else if !increment(g.entropy[:]) {
+		// The random part has wrapped around, so move on to the next
+		// millisecond instead
+		g.ms++
+	}
+
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], g.ms<<16)
+	copy(id[6:], g.entropy[:])
+	return encodeULID(id)
+}
+
+// increment adds one to a big-endian number, reporting false if it overflows
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID encodes the 128 bits of a ULID as 26 characters of base32
+func encodeULID(id [16]byte) string {
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// nextID returns the id of the event with the given sequence number
+func (str *Stream) nextID(seq uint64) []byte {
+	if str.IDGenerator != nil {
+		return []byte(str.IDGenerator(str.id, seq))
+	}
+	return []byte(strconv.FormatUint(seq, 10))
+}
@@ -0,0 +1,59 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestULIDGenerator(t *testing.T) {
+	Convey("ULIDs should be encoded in 26 characters", t, func() {
+		So(encodeULID([16]byte{}), ShouldEqual, "00000000000000000000000000")
+		max := [16]byte{}
+		for i := range max {
+			max[i] = 0xff
+		}
+		So(encodeULID(max), ShouldEqual, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+	})
+
+	Convey("Generated ids should keep increasing", t, func() {
+		next := NewULIDGenerator()
+		last := next("test", 0)
+		for i := 1; i < 1000; i++ {
+			id := next("test", uint64(i))
+			So(len(id), ShouldEqual, 26)
+			So(compareID(id, last), ShouldEqual, 1)
+			last = id
+		}
+	})
+
+	Convey("Given a stream generating ULIDs", t, func() {
+		s := New()
+		s.IDGenerator = NewULIDGenerator()
+		str := s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		for _, data := range []string{"a", "b", "c"} {
+			s.Publish("test", &Event{Data: []byte(data)})
+		}
+		for str.Sequence() < 3 {
+			str.SubscriberCount()
+		}
+
+		Convey("Events should be replayed from a generated id", func() {
+			first := collect([]*Subscriber{str.addSubscriber("0")}, 3)[0]
+			So(len(first[0].ID), ShouldEqual, 26)
+
+			received := collect([]*Subscriber{str.addSubscriber(string(first[1].ID))}, 2)[0]
+			So(string(received[0].Data), ShouldEqual, "b")
+			So(string(received[1].Data), ShouldEqual, "c")
+		})
+	})
+}
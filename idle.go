@@ -0,0 +1,92 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrReadTimeout ends connections on which nothing has been received for the
+// client's ReadTimeout
+var ErrReadTimeout = errors.New("read timeout")
+
+// idleBody closes the body of a response once a read has waited for data for
+// a while, so reads blocked on a connection the server went away from without
+// closing it return. Time spent between reads, such as in a slow handler, does
+// not count, as the data may be waiting on the connection meanwhile.
+type idleBody struct {
+	body    io.ReadCloser
+	clock   clock
+	timeout time.Duration
+	// Time the current read started waiting for data, in nanoseconds
+	last int64
+	// Whether a read is waiting for data
+	reading int32
+	expired int32
+	done    chan struct{}
+	once    sync.Once
+}
+
+// watchIdle closes body once nothing has been read from it for ReadTimeout
+func (c *Client) watchIdle(body io.ReadCloser) io.ReadCloser {
+	b := &idleBody{
+		body:    body,
+		clock:   clockOrSystem(c.clock),
+		timeout: c.ReadTimeout,
+		done:    make(chan struct{}),
+	}
+	go b.watch()
+	return b
+}
+
+// watch waits for the body to go idle. The timer is not reset on every read,
+// but rearmed for the rest of the timeout when it fires, or for all of it if
+// no read is waiting.
+func (b *idleBody) watch() {
+	t := b.clock.NewTimer(b.timeout)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C():
+			if atomic.LoadInt32(&b.reading) == 0 {
+				t.Reset(b.timeout)
+				continue
+			}
+			last := time.Unix(0, atomic.LoadInt64(&b.last))
+			if remaining := b.timeout - b.clock.Now().Sub(last); remaining > 0 {
+				t.Reset(remaining)
+				continue
+			}
+			atomic.StoreInt32(&b.expired, 1)
+			b.body.Close()
+			return
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	atomic.StoreInt64(&b.last, b.clock.Now().UnixNano())
+	atomic.StoreInt32(&b.reading, 1)
+	n, err := b.body.Read(p)
+	atomic.StoreInt32(&b.reading, 0)
+	if err != nil && atomic.LoadInt32(&b.expired) == 1 {
+		err = ErrReadTimeout
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+	return b.body.Close()
+}
@@ -0,0 +1,218 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// EventIDStore keeps the id of the last event handled on each stream, so a
+// client restarting resumes where it left off, see Client.EventIDStore.
+// Combined with the server replaying events, every event is handled at least
+// once.
+type EventIDStore interface {
+	// Load returns the id saved for a stream, or "" if there is none
+	Load(stream string) (string, error)
+	// Save records the id of the last event handled on a stream
+	Save(stream, id string) error
+}
+
+// MemoryEventIDStore keeps event ids in memory, so subscriptions resume where
+// earlier ones of the same process left off
+type MemoryEventIDStore struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+// NewMemoryEventIDStore creates a store without ids
+func NewMemoryEventIDStore() *MemoryEventIDStore {
+	return &MemoryEventIDStore{ids: make(map[string]string)}
+}
+
+// Load returns the id saved for a stream
+func (m *MemoryEventIDStore) Load(stream string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ids[stream], nil
+}
+
+// Save records the id of the last event handled on a stream
+func (m *MemoryEventIDStore) Save(stream, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ids[stream] = id
+	return nil
+}
+
+// DefaultFlushInterval is how long a FileEventIDStore waits by default before
+// writing ids saved to it
+const DefaultFlushInterval = time.Second
+
+// FileEventIDStore keeps event ids in a file, as a JSON object mapping streams
+// to ids. Saves are written together, at most once per FlushInterval, and the
+// file is replaced as a whole, so it is never left half written. Ids saved
+// since the last write are lost if the process ends without calling Close.
+type FileEventIDStore struct {
+	// FlushInterval is how long saved ids wait to be written, 0 meaning
+	// DefaultFlushInterval. It must be set before the first save.
+	FlushInterval time.Duration
+
+	path string
+	mu   sync.Mutex
+	ids  map[string]string
+	// Set while saved ids are waiting to be written
+	dirty bool
+	timer *time.Timer
+	// Error of the last write in the background, returned by the next save
+	err error
+}
+
+// OpenFileEventIDStore opens the store kept at path, which is created on the
+// first write if it does not exist
+func OpenFileEventIDStore(path string) (*FileEventIDStore, error) {
+	f := &FileEventIDStore{path: path, ids: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &f.ids); err != nil {
+		return nil, fmt.Errorf("invalid event id store %s: %s", path, err)
+	}
+	return f, nil
+}
+
+// Load returns the id saved for a stream
+func (f *FileEventIDStore) Load(stream string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ids[stream], nil
+}
+
+// Save records the id of the last event handled on a stream, to be written
+// once FlushInterval has passed. It returns the error of an earlier write that
+// failed, if any.
+func (f *FileEventIDStore) Save(stream, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.err; err != nil {
+		f.err = nil
+		return err
+	}
+	if current, ok := f.ids[stream]; ok && current == id {
+		return nil
+	}
+	f.ids[stream] = id
+	f.dirty = true
+
+	if f.timer == nil {
+		interval := f.FlushInterval
+		if interval <= 0 {
+			interval = DefaultFlushInterval
+		}
+		f.timer = time.AfterFunc(interval, f.flushLater)
+	}
+	return nil
+}
+
+// Flush writes the ids saved since the last write
+func (f *FileEventIDStore) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	return f.write()
+}
+
+// Close writes the ids saved since the last write. The store should not be
+// saved to afterwards.
+func (f *FileEventIDStore) Close() error {
+	return f.Flush()
+}
+
+func (f *FileEventIDStore) flushLater() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.timer = nil
+	if err := f.write(); err != nil {
+		f.err = err
+	}
+}
+
+// write replaces the file with the saved ids, if any changed since it was last
+// written
+func (f *FileEventIDStore) write() error {
+	if !f.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(f.ids)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+	f.dirty = false
+	return nil
+}
+
+// restoreID resumes a subscription from the id saved for its stream
+func (c *Client) restoreID(pos *position, stream string) error {
+	if c.EventIDStore == nil {
+		return nil
+	}
+
+	id, err := c.EventIDStore.Load(stream)
+	if err != nil {
+		return fmt.Errorf("failed to load last event id: %w", err)
+	}
+	if id != "" {
+		pos.set(id)
+	}
+	return nil
+}
+
+// saveID records the id of an event that has been handled, reporting errors
+// to OnError
+func (c *Client) saveID(stream string, msg *Event) {
+	if c.EventIDStore == nil || len(msg.ID) == 0 {
+		return
+	}
+	if err := c.EventIDStore.Save(stream, string(msg.ID)); err != nil {
+		c.reportError(fmt.Errorf("failed to save last event id: %w", err), nil)
+	}
+}
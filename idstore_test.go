@@ -0,0 +1,143 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFileEventIDStore(t *testing.T) {
+	Convey("Given a file event id store", t, func() {
+		path := filepath.Join(t.TempDir(), "ids.json")
+		store, err := OpenFileEventIDStore(path)
+		So(err, ShouldBeNil)
+
+		Convey("Unknown streams should have no id", func() {
+			id, err := store.Load("test")
+			So(err, ShouldBeNil)
+			So(id, ShouldBeEmpty)
+		})
+
+		Convey("Saved ids should survive closing and reopening it", func() {
+			So(store.Save("test", "41"), ShouldBeNil)
+			So(store.Save("test", "42"), ShouldBeNil)
+			So(store.Save("other", "7"), ShouldBeNil)
+			So(store.Close(), ShouldBeNil)
+
+			reopened, err := OpenFileEventIDStore(path)
+			So(err, ShouldBeNil)
+			id, _ := reopened.Load("test")
+			So(id, ShouldEqual, "42")
+			id, _ = reopened.Load("other")
+			So(id, ShouldEqual, "7")
+		})
+
+		Convey("Saved ids should be written together once the interval has passed", func() {
+			store.FlushInterval = 50 * time.Millisecond
+			So(store.Save("test", "41"), ShouldBeNil)
+			So(store.Save("test", "42"), ShouldBeNil)
+			_, err := os.Stat(path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			var id string
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				if reopened, err := OpenFileEventIDStore(path); err == nil {
+					if id, _ = reopened.Load("test"); id != "" {
+						break
+					}
+				}
+			}
+			So(id, ShouldEqual, "42")
+		})
+	})
+}
+
+func TestClientEventIDStore(t *testing.T) {
+	Convey("Given a client resuming from a stored id", t, func() {
+		s := New()
+		s.CreateStream("test")
+		for i := 0; i < 4; i++ {
+			s.Publish("test", &Event{Data: []byte("msg")})
+		}
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		store := NewMemoryEventIDStore()
+		store.Save("test", "2")
+		c := NewClient(server.URL)
+		c.EventIDStore = store
+
+		Convey("It should receive the events from there and save their ids", func() {
+			events := make(chan *Event)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.SubscribeWithContext(ctx, "test", func(msg *Event) {
+				events <- msg
+			})
+
+			for _, want := range []string{"2", "3"} {
+				select {
+				case ev := <-events:
+					So(string(ev.ID), ShouldEqual, want)
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeEmpty)
+				}
+			}
+			s.Publish("test", &Event{Data: []byte("msg")})
+			<-events
+			cancel()
+
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				if id, _ := store.Load("test"); id == "4" {
+					break
+				}
+			}
+			id, _ := store.Load("test")
+			So(id, ShouldEqual, "4")
+		})
+
+		Convey("Readers should receive the events from there and save their ids", func() {
+			ids := make(chan string)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.SubscribeReaderWithContext(ctx, "test", func(ev *EventReader) {
+				io.Copy(io.Discard, ev)
+				ids <- string(ev.ID)
+			})
+
+			for _, want := range []string{"2", "3"} {
+				select {
+				case id := <-ids:
+					So(id, ShouldEqual, want)
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeEmpty)
+				}
+			}
+			cancel()
+
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				if id, _ := store.Load("test"); id == "3" {
+					break
+				}
+			}
+			id, _ := store.Load("test")
+			So(id, ShouldEqual, "3")
+		})
+	})
+}
@@ -0,0 +1,117 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// maxIngestSize bounds the body of requests to IngestHandler
+const maxIngestSize = 1 << 20
+
+// IngestHandler publishes the events posted to it to the stream named by the
+// stream query parameter, for services that publish over HTTP. The body is
+// read according to its content type: application/json holds a single event
+// as encoded by Event.MarshalJSON, text/event-stream holds any number of
+// event frames, and any other body is the data of a single event.
+//
+// Requests are only accepted once Server.AuthorizeIngest is set, and only if
+// it accepts them. Streams that are ReadOnly can not be published to, and
+// neither can streams that do not exist.
+func (s *Server) IngestHandler(w http.ResponseWriter, r *http.Request) {
+	r = s.defaultStream(r)
+	s.setSecurityHeaders(w)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamID := r.URL.Query().Get("stream")
+	if !s.allowed(w, r, streamID) {
+		return
+	}
+	if s.AuthorizeIngest == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !authorized(w, s.AuthorizeIngest(r, streamID)) {
+		return
+	}
+
+	stream := s.getStream(streamID)
+	if stream == nil {
+		http.Error(w, "Stream not found!", http.StatusNotFound)
+		return
+	}
+	if stream.ReadOnly {
+		http.Error(w, "Stream is read-only!", http.StatusForbidden)
+		return
+	}
+
+	events, err := readIngested(w, r)
+	if err != nil {
+		http.Error(w, "Invalid events!", http.StatusBadRequest)
+		return
+	}
+
+	for _, ev := range events {
+		if s.Ingest == nil {
+			s.Publish(streamID, ev)
+			continue
+		}
+		if err := s.Ingest(streamID, ev); err != nil {
+			s.reportError(r, err)
+			http.Error(w, "Could not publish events!", http.StatusBadGateway)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readIngested reads the events posted to IngestHandler
+func readIngested(w http.ResponseWriter, r *http.Request) ([]*Event, error) {
+	body := http.MaxBytesReader(w, r.Body, maxIngestSize)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/json":
+		ev := &Event{}
+		if err := json.NewDecoder(body).Decode(ev); err != nil {
+			return nil, err
+		}
+		return []*Event{ev}, nil
+
+	case "text/event-stream":
+		var events []*Event
+		reader := NewEventStreamReader(body)
+		for {
+			frame, err := reader.ReadEvent()
+			if err == io.EOF {
+				return events, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			ev := &Event{}
+			if err := ev.UnmarshalText(frame); err != nil {
+				return nil, err
+			}
+			events = append(events, ev)
+		}
+
+	default:
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return []*Event{{Data: data}}, nil
+	}
+}
@@ -0,0 +1,118 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIngestHandler(t *testing.T) {
+	Convey("Given a server with a writable and a read-only stream", t, func() {
+		s := New()
+		sub := s.CreateStream("writable").addSubscriber("0")
+		s.createStream("prices", func(str *Stream) {
+			str.ReadOnly = true
+		})
+		s.AuthorizeIngest = func(r *http.Request, stream string) error {
+			if r.Header.Get("Authorization") != "Bearer publisher" {
+				return ErrUnauthorized
+			}
+			return nil
+		}
+
+		Reset(func() {
+			s.Close()
+		})
+
+		post := func(stream, contentType, body string) int {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/ingest?stream="+stream, strings.NewReader(body))
+			r.Header.Set("Content-Type", contentType)
+			r.Header.Set("Authorization", "Bearer publisher")
+			s.IngestHandler(rec, r)
+			return rec.Code
+		}
+
+		Convey("A JSON event should be published", func() {
+			So(post("writable", "application/json", `{"event":"update","data":"a"}`), ShouldEqual, http.StatusNoContent)
+
+			ev := <-sub.connection
+			So(string(ev.Event), ShouldEqual, "update")
+			So(string(ev.Data), ShouldEqual, "a")
+		})
+
+		Convey("Every frame of an event stream should be published", func() {
+			So(post("writable", "text/event-stream", "data: a\n\nevent: b\ndata: b\n\n"), ShouldEqual, http.StatusNoContent)
+
+			So(string((<-sub.connection).Data), ShouldEqual, "a")
+			So(string((<-sub.connection).Event), ShouldEqual, "b")
+		})
+
+		Convey("Any other body should be published as data", func() {
+			So(post("writable", "text/plain; charset=utf-8", "hello"), ShouldEqual, http.StatusNoContent)
+			So(string((<-sub.connection).Data), ShouldEqual, "hello")
+		})
+
+		Convey("Invalid events should be rejected", func() {
+			So(post("writable", "application/json", `{"data":`), ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("Read-only streams should not accept events", func() {
+			So(post("prices", "text/plain", "hello"), ShouldEqual, http.StatusForbidden)
+			So(s.getStream("prices").Sequence(), ShouldEqual, 0)
+		})
+
+		Convey("Unknown streams should not be found", func() {
+			So(post("none", "text/plain", "hello"), ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("Events should be handed to Ingest if it is set", func() {
+			var ingested []string
+			s.Ingest = func(stream string, ev *Event) error {
+				ingested = append(ingested, stream+":"+string(ev.Data))
+				if len(ingested) > 1 {
+					return errors.New("unavailable")
+				}
+				return nil
+			}
+
+			So(post("writable", "text/plain", "hello"), ShouldEqual, http.StatusNoContent)
+			So(ingested, ShouldResemble, []string{"writable:hello"})
+			So(sub.connection, ShouldBeEmpty)
+
+			So(post("writable", "text/event-stream", "data: a\n\ndata: b\n\n"), ShouldEqual, http.StatusBadGateway)
+			So(ingested, ShouldHaveLength, 2)
+		})
+
+		Convey("Requests AuthorizeIngest rejects should not publish", func() {
+			rec := httptest.NewRecorder()
+			s.IngestHandler(rec, httptest.NewRequest(http.MethodPost, "/ingest?stream=writable", strings.NewReader("hello")))
+			So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+			So(sub.connection, ShouldBeEmpty)
+		})
+
+		Convey("Nothing should be published without AuthorizeIngest", func() {
+			s.AuthorizeIngest = nil
+			So(post("writable", "text/plain", "hello"), ShouldEqual, http.StatusForbidden)
+			So(sub.connection, ShouldBeEmpty)
+		})
+
+		Convey("Oversized bodies should be rejected", func() {
+			So(post("writable", "text/plain", strings.Repeat("a", maxIngestSize+1)), ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("Only POST should be allowed", func() {
+			rec := httptest.NewRecorder()
+			s.IngestHandler(rec, httptest.NewRequest(http.MethodGet, "/ingest?stream=writable", nil))
+			So(rec.Code, ShouldEqual, http.StatusMethodNotAllowed)
+		})
+	})
+}
@@ -0,0 +1,118 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"time"
+)
+
+// Instrumentation observes how a Server delivers events, such as to record
+// traces and metrics. Package sseotel implements it with OpenTelemetry. Its
+// methods are called from the server's goroutines and should not block.
+type Instrumentation interface {
+	// Subscribe is called when a client subscribes to a stream, returning
+	// the instrumentation of the subscription
+	Subscribe(r *http.Request, stream string) SubscriberInstrumentation
+	// Publish is called when an event is published to a stream, before it
+	// is queued for delivery
+	Publish(stream string, event *Event)
+}
+
+// SubscriberInstrumentation observes the delivery of events to a single
+// subscriber
+type SubscriberInstrumentation interface {
+	// Deliver is called once an event has been written to the subscriber,
+	// with the time it spent queued since it was published and the time
+	// writing it took
+	Deliver(event *Event, queued, written time.Duration)
+	// Drop is called when an event could not be written to the subscriber
+	Drop(event *Event, err error)
+	// End is called once the subscription has ended
+	End()
+}
+
+// observePublish stamps an event as it is queued on a stream, reporting it to
+// the server's instrumentation
+func (s *Server) observePublish(id string, event *Event) {
+	if s.Instrumentation == nil {
+		return
+	}
+	event.queued = time.Now()
+	s.Instrumentation.Publish(id, event)
+}
+
+// instrument attaches the server's instrumentation to a new subscriber
+func (s *Server) instrument(r *http.Request, stream string, sub *Subscriber) {
+	if s.Instrumentation != nil {
+		sub.instrument = s.Instrumentation.Subscribe(r, stream)
+	}
+}
+
+// delivered reports an event written to the subscriber, or that could not be
+// written if err is set. The write started at start.
+func (s *Subscriber) delivered(ev *Event, start time.Time, err error) {
+	if err == nil && s.audit != nil {
+		s.audit(ev)
+	}
+	if err == nil && len(ev.ID) > 0 {
+		s.last.Store(ev)
+	}
+	if s.debug != nil {
+		s.debug.deliver(ev, s.name, err)
+	}
+	if err != nil && s.counters != nil {
+		s.counters.dropped.Add(1)
+	}
+	if err != nil && s.logger != nil {
+		s.logDrop(ev, err)
+	}
+	if s.instrument == nil {
+		return
+	}
+	if err != nil {
+		s.instrument.Drop(ev, err)
+		return
+	}
+
+	var queued time.Duration
+	if !ev.queued.IsZero() {
+		queued = start.Sub(ev.queued)
+	}
+	s.instrument.Deliver(ev, queued, time.Since(start))
+}
+
+// logDrop logs an event that could not be delivered. A subscriber falling
+// behind drops many events, so only the first, second, fourth and so on are
+// logged, with the number dropped so far.
+func (s *Subscriber) logDrop(ev *Event, err error) {
+	n := s.drops.Add(1)
+	if n&(n-1) != 0 {
+		return
+	}
+	s.logger.Warn("event not delivered", "id", string(ev.ID), "error", err, "dropped", n)
+}
+
+// observed reports whether deliveries to the subscriber are reported or
+// tracked
+func (s *Subscriber) observed() bool {
+	return s.instrument != nil || s.debug != nil || s.audit != nil || s.client != ""
+}
+
+// ended reports the end of the subscription
+func (s *Subscriber) ended() {
+	if s.logger != nil {
+		s.logger.Info("subscriber disconnected")
+	}
+	if s.instrument != nil {
+		s.instrument.End()
+	}
+	if s.unsubscribed != nil {
+		s.unsubscribed()
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
@@ -0,0 +1,119 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recordingInstrumentation records what it observes
+type recordingInstrumentation struct {
+	mu        sync.Mutex
+	subscribe []string
+	publish   []string
+	deliver   []string
+	queued    []time.Duration
+	ended     int
+}
+
+func (i *recordingInstrumentation) Subscribe(r *http.Request, stream string) SubscriberInstrumentation {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.subscribe = append(i.subscribe, stream)
+	return i
+}
+
+func (i *recordingInstrumentation) Publish(stream string, event *Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.publish = append(i.publish, stream)
+}
+
+func (i *recordingInstrumentation) Deliver(event *Event, queued, written time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if event.Data != nil {
+		i.deliver = append(i.deliver, string(event.Data))
+		i.queued = append(i.queued, queued)
+	}
+}
+
+func (i *recordingInstrumentation) Drop(event *Event, err error) {}
+
+func (i *recordingInstrumentation) End() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.ended++
+}
+
+func (i *recordingInstrumentation) snapshot() recordingInstrumentation {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return recordingInstrumentation{
+		subscribe: append([]string(nil), i.subscribe...),
+		publish:   append([]string(nil), i.publish...),
+		deliver:   append([]string(nil), i.deliver...),
+		queued:    append([]time.Duration(nil), i.queued...),
+		ended:     i.ended,
+	}
+}
+
+func TestServerInstrumentation(t *testing.T) {
+	for _, mode := range []DispatchMode{DispatchPerSubscriber, DispatchPooled} {
+		Convey("Given an instrumented server", t, func() {
+			inst := &recordingInstrumentation{}
+			s := New()
+			s.DispatchMode = mode
+			s.Instrumentation = inst
+			s.CreateStream("test")
+			server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+			Reset(func() {
+				s.Close()
+			})
+
+			Convey("When a client receives an event", func() {
+				c := NewClient(server.URL)
+				events := make(chan *Event)
+				sub, err := c.SubscribeChan("test", events)
+				So(err, ShouldBeNil)
+
+				for s.getStream("test").SubscriberCount() == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				s.Publish("test", &Event{Data: []byte("hello")})
+				_, err = wait(events, time.Second)
+				So(err, ShouldBeNil)
+
+				for len(inst.snapshot().deliver) == 0 {
+					time.Sleep(time.Millisecond)
+				}
+
+				Convey("The subscription, publication and delivery should be observed", func() {
+					seen := inst.snapshot()
+					So(seen.subscribe, ShouldResemble, []string{"test"})
+					So(seen.publish, ShouldResemble, []string{"test"})
+					So(seen.deliver, ShouldResemble, []string{"hello"})
+					So(seen.queued[0], ShouldBeGreaterThan, 0)
+				})
+
+				Convey("The end of the subscription should be observed", func() {
+					sub.Close()
+					s.RemoveStream("test")
+					for inst.snapshot().ended == 0 {
+						time.Sleep(time.Millisecond)
+					}
+					So(inst.snapshot().ended, ShouldEqual, 1)
+				})
+			})
+		})
+	}
+}
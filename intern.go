@@ -0,0 +1,42 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+// Bounds of an interner, so streams with unique values, such as sequential
+// ids, can not grow it without limit
+const (
+	maxInternedValues    = 256
+	maxInternedValueSize = 64
+)
+
+// interner shares a single copy of values that repeat across events, such as
+// event names. Once full, further values are copied instead of interned.
+type interner struct {
+	values map[string][]byte
+}
+
+// value returns a copy of b that is shared with every other event carrying
+// the same value. The copy's capacity is capped, so appending to it does not
+// affect the other events.
+func (in *interner) value(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	// The conversion in the lookup does not allocate
+	if v, ok := in.values[string(b)]; ok {
+		return v
+	}
+
+	v := append(make([]byte, 0, len(b)), b...)
+	if len(b) > maxInternedValueSize || len(in.values) >= maxInternedValues {
+		return v
+	}
+
+	if in.values == nil {
+		in.values = make(map[string][]byte)
+	}
+	in.values[string(v)] = v[:len(v):len(v)]
+	return v
+}
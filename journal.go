@@ -0,0 +1,121 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// Journal spools received events to a file before they are handled, so that
+// events a process was handling when it crashed are handled again once it
+// restarts, see Client.Journal. Events are stored in the event stream format,
+// and the file is emptied whenever no event is being handled, so it only
+// grows while handlers are running.
+//
+// Events are handled at least once: an event whose handler completed just
+// before a crash is handled again after it.
+type Journal struct {
+	mu      sync.Mutex
+	file    *os.File
+	pending int
+}
+
+// OpenJournal opens the journal stored at path, creating it if it does not
+// exist
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{file: file}, nil
+}
+
+// Close closes the journal's file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// append stores an event on disk before it is handled
+func (j *Journal) append(ev *Event) error {
+	var buf bytes.Buffer
+	if err := writeEvent(&buf, ev, 0); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	j.pending++
+	return nil
+}
+
+// done records that an event has been handled, emptying the journal once no
+// other event is being handled
+func (j *Journal) done() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pending--; j.pending > 0 {
+		return nil
+	}
+	return j.truncate()
+}
+
+// replay passes the events left in the journal to handler, and empties it
+// once they have all been handled
+func (j *Journal) replay(handler func(ev *Event)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(j.file)
+	if err != nil {
+		return err
+	}
+
+	// Every event ends with a blank line, anything after the last one is
+	// an event that was only partly written
+	end := bytes.LastIndex(data, lflf)
+	if end < 0 {
+		return j.truncate()
+	}
+	data = data[:end+len(lflf)]
+
+	// The journal is in memory already, so events of any size are replayed
+	reader := NewEventStreamReader(bytes.NewReader(data))
+	reader.MaxBufferSize = max(len(data), eventStreamBufferSize)
+	parser := &eventParser{fields: fieldParser{capture: true}}
+	for {
+		frame, err := reader.ReadEvent()
+		if err != nil {
+			break
+		}
+		if ev, err := parser.parse(frame); err == nil {
+			handler(ev)
+		}
+	}
+
+	return j.truncate()
+}
+
+func (j *Journal) truncate() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
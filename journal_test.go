@@ -0,0 +1,138 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJournal(t *testing.T) {
+	Convey("Given a journal", t, func() {
+		path := filepath.Join(t.TempDir(), "events.journal")
+		j, err := OpenJournal(path)
+		So(err, ShouldBeNil)
+
+		size := func() int64 {
+			info, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			return info.Size()
+		}
+
+		Convey("It should be emptied once events have been handled", func() {
+			So(j.append(&Event{ID: []byte("1"), Data: []byte("a")}), ShouldBeNil)
+			So(j.append(&Event{ID: []byte("2"), Data: []byte("b")}), ShouldBeNil)
+			So(size(), ShouldBeGreaterThan, 0)
+
+			So(j.done(), ShouldBeNil)
+			So(size(), ShouldBeGreaterThan, 0)
+			So(j.done(), ShouldBeNil)
+			So(size(), ShouldEqual, 0)
+		})
+
+		Convey("When it is reopened with events that were not handled", func() {
+			So(j.append(&Event{ID: []byte("1"), Event: []byte("update"), Data: []byte("a\nb")}), ShouldBeNil)
+			So(j.Close(), ShouldBeNil)
+
+			// A write cut short by the crash
+			f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+			f.WriteString("id: 2\ndata: tor")
+			f.Close()
+
+			j, err = OpenJournal(path)
+			So(err, ShouldBeNil)
+
+			Convey("Complete events should be replayed", func() {
+				var replayed []*Event
+				So(j.replay(func(ev *Event) {
+					replayed = append(replayed, ev)
+				}), ShouldBeNil)
+
+				So(replayed, ShouldHaveLength, 1)
+				So(string(replayed[0].ID), ShouldEqual, "1")
+				So(string(replayed[0].Event), ShouldEqual, "update")
+				So(string(replayed[0].Data), ShouldEqual, "a\nb")
+				So(size(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When it is reopened with an event larger than a read buffer", func() {
+			data := strings.Repeat("x", 100*1024)
+			So(j.append(&Event{ID: []byte("1"), Data: []byte(data)}), ShouldBeNil)
+			So(j.Close(), ShouldBeNil)
+
+			j, err = OpenJournal(path)
+			So(err, ShouldBeNil)
+
+			Convey("It should be replayed", func() {
+				var replayed []*Event
+				So(j.replay(func(ev *Event) {
+					replayed = append(replayed, ev)
+				}), ShouldBeNil)
+
+				So(replayed, ShouldHaveLength, 1)
+				So(string(replayed[0].Data), ShouldEqual, data)
+			})
+		})
+
+		Reset(func() {
+			j.Close()
+		})
+	})
+}
+
+func TestClientJournal(t *testing.T) {
+	Convey("Given a client with a journal holding an unhandled event", t, func() {
+		srv := New()
+		srv.AutoReplay = false
+		srv.CreateStream("test")
+
+		lastIDs := make(chan string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lastIDs <- r.Header.Get("Last-Event-ID")
+			srv.HTTPHandler(w, r)
+		}))
+
+		j, err := OpenJournal(filepath.Join(t.TempDir(), "events.journal"))
+		So(err, ShouldBeNil)
+		So(j.append(&Event{ID: []byte("7"), Data: []byte("unhandled")}), ShouldBeNil)
+
+		c := NewClient(server.URL)
+		c.Journal = j
+
+		Convey("It should be handled before subscribing, resuming after it", func() {
+			events := make(chan *Event, 2)
+			go c.Subscribe("test", func(msg *Event) {
+				events <- msg
+			})
+
+			So(string((<-events).Data), ShouldEqual, "unhandled")
+			So(<-lastIDs, ShouldEqual, "7")
+
+			for srv.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+			srv.Publish("test", &Event{Data: []byte("live")})
+
+			select {
+			case msg := <-events:
+				So(string(msg.Data), ShouldEqual, "live")
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Reset(func() {
+			srv.Close()
+		})
+	})
+}
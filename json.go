@@ -0,0 +1,95 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"unicode/utf8"
+)
+
+// jsonEvent is the JSON representation of an Event. Data that is valid UTF-8
+// is stored as a string, anything else is base64 encoded in DataBase64, so
+// binary payloads survive the round trip. Other fields are stored as strings.
+type jsonEvent struct {
+	ID         *string           `json:"id,omitempty"`
+	Event      *string           `json:"event,omitempty"`
+	Data       *string           `json:"data,omitempty"`
+	DataBase64 []byte            `json:"data_base64,omitempty"`
+	Retry      *string           `json:"retry,omitempty"`
+	Comment    *string           `json:"comment,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// MarshalJSON encodes the event as a JSON object. Fields the event does not
+// have are left out, while empty ones are kept.
+func (e *Event) MarshalJSON() ([]byte, error) {
+	out := jsonEvent{
+		ID:      jsonString(e.ID),
+		Event:   jsonString(e.Event),
+		Retry:   jsonString(e.Retry),
+		Comment: jsonString(e.Comment),
+	}
+
+	if e.Fields != nil {
+		out.Fields = make(map[string]string, len(e.Fields))
+		for name, value := range e.Fields {
+			out.Fields[name] = string(value)
+		}
+	}
+
+	if utf8.Valid(e.Data) {
+		out.Data = jsonString(e.Data)
+	} else {
+		out.DataBase64 = e.Data
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes an event encoded by MarshalJSON
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var in jsonEvent
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	if in.Data != nil && in.DataBase64 != nil {
+		return errors.New("event has both data and data_base64")
+	}
+
+	*e = Event{
+		ID:      jsonBytes(in.ID),
+		Event:   jsonBytes(in.Event),
+		Data:    jsonBytes(in.Data),
+		Retry:   jsonBytes(in.Retry),
+		Comment: jsonBytes(in.Comment),
+	}
+	if in.DataBase64 != nil {
+		e.Data = in.DataBase64
+	}
+	if in.Fields != nil {
+		e.Fields = make(map[string][]byte, len(in.Fields))
+		for name, value := range in.Fields {
+			e.Fields[name] = []byte(value)
+		}
+	}
+
+	return nil
+}
+
+func jsonString(field []byte) *string {
+	if field == nil {
+		return nil
+	}
+	s := string(field)
+	return &s
+}
+
+func jsonBytes(s *string) []byte {
+	if s == nil {
+		return nil
+	}
+	return []byte(*s)
+}
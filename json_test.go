@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventJSON(t *testing.T) {
+	Convey("Given an event", t, func() {
+		ev := &Event{ID: []byte("1"), Event: []byte("update"), Data: []byte("a\nb"), Comment: []byte{}}
+
+		Convey("When marshaling it to JSON", func() {
+			b, err := json.Marshal(ev)
+
+			Convey("Its data should be stored as a string", func() {
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, `{"id":"1","event":"update","data":"a\nb","comment":""}`)
+			})
+
+			Convey("It should be unmarshaled unchanged", func() {
+				var out Event
+				So(json.Unmarshal(b, &out), ShouldBeNil)
+				So(out, ShouldResemble, *ev)
+			})
+		})
+
+		Convey("When its data is binary", func() {
+			ev.Data = []byte{0xff, 0x00, 0xfe}
+			b, err := json.Marshal(ev)
+
+			Convey("Its data should be base64 encoded", func() {
+				So(err, ShouldBeNil)
+				So(string(b), ShouldContainSubstring, `"data_base64":"/wD+"`)
+			})
+
+			Convey("It should be unmarshaled unchanged", func() {
+				var out Event
+				So(json.Unmarshal(b, &out), ShouldBeNil)
+				So(out.Data, ShouldResemble, ev.Data)
+			})
+		})
+
+		Convey("When the JSON has both kinds of data", func() {
+			var out Event
+			err := json.Unmarshal([]byte(`{"data":"a","data_base64":"YQ=="}`), &out)
+
+			Convey("It should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
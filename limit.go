@@ -0,0 +1,170 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrPublishRateExceeded is reported to Server.OnError for events dropped by
+// LimitReject, and returned by Publish
+var ErrPublishRateExceeded = errors.New("publish rate exceeded")
+
+// LimitPolicy decides what Publish does with events published faster than the
+// Limiter of their stream allows
+type LimitPolicy int
+
+const (
+	// LimitBlock makes Publish wait until the event is within the limit
+	LimitBlock LimitPolicy = iota
+	// LimitReject drops the event, reporting ErrPublishRateExceeded
+	LimitReject
+	// LimitCoalesce returns at once, holding the event back until it is
+	// within the limit. Events published while one is held back replace it,
+	// so subscribers only receive the latest, which suits streams of state
+	// updates.
+	LimitCoalesce
+)
+
+// coalescer holds the latest event published over the limit of a stream with
+// LimitCoalesce
+type coalescer struct {
+	mu      sync.Mutex
+	pending *Event
+}
+
+// newLimiter returns a limiter of the given rate, or nil if it is unlimited
+func newLimiter(limit rate.Limit, burst int) *rate.Limiter {
+	if limit <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(limit, max(burst, 1))
+}
+
+// throttle applies the stream's Limiter to an event, reporting whether it is
+// to be published now, or else why it was dropped. Coalesced events are
+// published by publish later and are not dropped. Priority events are not
+// limited.
+func (s *Server) throttle(id string, str *Stream, event *Event, publish func(*Event)) (bool, error) {
+	lim := str.Limiter
+	if lim == nil || event.urgent {
+		return true, nil
+	}
+
+	switch str.LimitPolicy {
+	case LimitReject:
+		if lim.Allow() {
+			return true, nil
+		}
+		err := fmt.Errorf("%w: dropped event of stream %s", ErrPublishRateExceeded, id)
+		s.reportError(nil, err)
+		return false, err
+	case LimitCoalesce:
+		return str.coalesce(event, publish), nil
+	}
+
+	r := lim.Reserve()
+	if !r.OK() {
+		err := fmt.Errorf("%w: dropped event of stream %s", ErrPublishRateExceeded, id)
+		s.reportError(nil, err)
+		return false, err
+	}
+	wait := clockOrSystem(str.clock).NewTimer(r.Delay())
+	defer wait.Stop()
+	select {
+	case <-wait.C():
+		return true, nil
+	case <-str.done:
+		r.Cancel()
+		return false, ErrStreamNotFound
+	}
+}
+
+// coalesce reports whether an event is within the stream's limit, holding it
+// back otherwise, in place of any event held back before
+func (str *Stream) coalesce(event *Event, publish func(*Event)) bool {
+	c := &str.coalescer
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Events are not published ahead of the one held back
+	if c.pending == nil && str.Limiter.Allow() {
+		return true
+	}
+
+	held := c.pending != nil
+	c.pending = event
+	if !held {
+		clockOrSystem(str.clock).AfterFunc(str.Limiter.Reserve().Delay(), func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			ev := c.pending
+			c.pending = nil
+			select {
+			case <-str.done:
+			default:
+				publish(ev)
+			}
+		})
+	}
+	return false
+}
+
+// Limit has the subscriber sent live events at no more than the rate of lim,
+// in place of the stream's SubscriberRate. LimitReject drops the events over
+// the limit, while any other policy holds back the latest of them until it is
+// within the limit. Comments, priority and replayed events are not limited.
+// It is meant to be called from Server.OnSubscribe, such as to let clients
+// ask for a rate of their own.
+func (s *Subscriber) Limit(lim *rate.Limiter, policy LimitPolicy) {
+	s.limiter, s.limitPolicy = lim, policy
+}
+
+// admit applies a subscriber's limiter to an event, reporting whether it is
+// to be queued now. Events held back are queued by released once they are
+// within the limit.
+func (str *Stream) admit(sub *Subscriber, event *Event) bool {
+	if sub.limiter == nil || isCommentOnly(event) {
+		return true
+	}
+	if sub.limitPolicy == LimitReject {
+		return sub.limiter.Allow()
+	}
+
+	// Events are not queued ahead of the one held back
+	if sub.held == nil && sub.limiter.Allow() {
+		return true
+	}
+
+	held := sub.held != nil
+	sub.held = event
+	if !held {
+		clockOrSystem(str.clock).AfterFunc(sub.limiter.Reserve().Delay(), func() {
+			select {
+			case str.release <- sub:
+			case <-str.done:
+			}
+		})
+	}
+	return false
+}
+
+// released queues the event held back for a subscriber, unless it has been
+// removed in the meantime
+func (str *Stream) released(sub *Subscriber) {
+	event := sub.held
+	sub.held = nil
+	i := str.getSubIndex(sub)
+	if event == nil || i == -1 {
+		return
+	}
+	if !str.send(sub, sub.connection, event) {
+		str.removeSubscriber(i)
+	}
+}
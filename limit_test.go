@@ -0,0 +1,157 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/time/rate"
+)
+
+func TestPublishLimit(t *testing.T) {
+	Convey("Given a stream limited to an event every 50ms", t, func() {
+		s := New()
+		str := s.CreateStream("test")
+		str.Limiter = rate.NewLimiter(rate.Every(50*time.Millisecond), 1)
+		sub := str.addSubscriber("0")
+
+		var mu sync.Mutex
+		var errs []error
+		s.OnError = func(r *http.Request, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}
+
+		Reset(func() {
+			s.Close()
+		})
+
+		publish := func(n int) {
+			for i := 0; i < n; i++ {
+				s.Publish("test", &Event{Data: []byte(strconv.Itoa(i))})
+			}
+		}
+
+		Convey("Blocking should delay events over the limit", func() {
+			start := time.Now()
+			publish(3)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 90*time.Millisecond)
+
+			received := collect([]*Subscriber{sub}, 3)[0]
+			So(string(received[2].Data), ShouldEqual, "2")
+		})
+
+		Convey("Rejecting should drop events over the limit", func() {
+			str.LimitPolicy = LimitReject
+			publish(2)
+			So(errors.Is(s.Publish("test", &Event{Data: []byte("2")}), ErrPublishRateExceeded), ShouldBeTrue)
+
+			mu.Lock()
+			defer mu.Unlock()
+			So(errs, ShouldHaveLength, 2)
+			So(errors.Is(errs[0], ErrPublishRateExceeded), ShouldBeTrue)
+
+			received := collect([]*Subscriber{sub}, 1)[0]
+			So(string(received[0].Data), ShouldEqual, "0")
+			So(sub.connection, ShouldBeEmpty)
+		})
+
+		Convey("Priority events should not be limited", func() {
+			str.LimitPolicy = LimitReject
+			publish(1)
+			So(s.PublishPriority("test", &Event{Data: []byte("urgent")}), ShouldBeNil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			So(errs, ShouldBeEmpty)
+		})
+
+		Convey("Coalescing should deliver the latest event over the limit", func() {
+			str.LimitPolicy = LimitCoalesce
+			start := time.Now()
+			publish(5)
+			So(time.Since(start), ShouldBeLessThan, 50*time.Millisecond)
+
+			received := collect([]*Subscriber{sub}, 2)[0]
+			So(string(received[0].Data), ShouldEqual, "0")
+			So(string(received[1].Data), ShouldEqual, "4")
+		})
+	})
+
+	Convey("Streams should take on the limit of the server", t, func() {
+		s := New()
+		defer s.Close()
+		s.PublishRate = 10
+		s.LimitPolicy = LimitReject
+
+		str := s.CreateStream("test")
+		So(str.Limiter.Limit(), ShouldEqual, rate.Limit(10))
+		So(str.Limiter.Burst(), ShouldEqual, 1)
+		So(str.LimitPolicy, ShouldEqual, LimitReject)
+	})
+}
+
+func TestSubscriberLimit(t *testing.T) {
+	Convey("Given a subscriber limited to an event every 50ms", t, func() {
+		s := New()
+		str := s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		subscribe := func(policy LimitPolicy) *Subscriber {
+			sub := str.newSubscriber("")
+			sub.Limit(rate.NewLimiter(rate.Every(50*time.Millisecond), 1), policy)
+			str.register <- sub
+			return sub
+		}
+		publish := func() {
+			for i := 1; i <= 5; i++ {
+				s.Publish("test", &Event{Data: []byte(strconv.Itoa(i))})
+			}
+			s.Publish("test", &Event{Comment: []byte("ping")})
+		}
+
+		Convey("Events over the limit should be coalesced into the latest", func() {
+			sub := subscribe(LimitCoalesce)
+			publish()
+
+			received := collect([]*Subscriber{sub}, 3)[0]
+			So(string(received[0].Data), ShouldEqual, "1")
+			So(string(received[1].Comment), ShouldEqual, "ping")
+			So(string(received[2].Data), ShouldEqual, "5")
+		})
+
+		Convey("Events over the limit should be dropped with LimitReject", func() {
+			sub := subscribe(LimitReject)
+			publish()
+
+			received := collect([]*Subscriber{sub}, 2)[0]
+			So(string(received[0].Data), ShouldEqual, "1")
+			So(string(received[1].Comment), ShouldEqual, "ping")
+			select {
+			case ev := <-sub.connection:
+				So(ev, ShouldBeNil)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+
+		Convey("Other subscribers should receive every event", func() {
+			subscribe(LimitCoalesce)
+			sub := str.addSubscriber("")
+			publish()
+
+			So(collect([]*Subscriber{sub}, 6)[0], ShouldHaveLength, 6)
+		})
+	})
+}
@@ -0,0 +1,34 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+)
+
+// log writes a record to the server's Logger, if it has one
+func (s *Server) log(level slog.Level, msg string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Log(context.Background(), level, msg, args...)
+	}
+}
+
+// logURL returns a URL as it is logged, without its query, which may carry
+// tokens, or password
+func logURL(u *url.URL) string {
+	logged := *u
+	logged.RawQuery, logged.ForceQuery = "", false
+	logged.Fragment, logged.RawFragment = "", ""
+	return logged.Redacted()
+}
+
+// log writes a record to the client's Logger, if it has one
+func (c *Client) log(level slog.Level, msg string, args ...any) {
+	if c.Logger != nil {
+		c.Logger.Log(context.Background(), level, msg, args...)
+	}
+}
@@ -0,0 +1,120 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/cenkalti/backoff.v1"
+)
+
+// logBuffer collects log output written from several goroutines
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForLog waits for a message to be logged
+func waitForLog(b *logBuffer, msg string) string {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if out := b.String(); bytes.Contains([]byte(out), []byte(msg)) {
+			return out
+		}
+	}
+	return b.String()
+}
+
+func TestLogger(t *testing.T) {
+	Convey("Given a server and client with loggers", t, func() {
+		serverLog, clientLog := &logBuffer{}, &logBuffer{}
+
+		s := New()
+		s.Logger = slog.New(slog.NewTextHandler(serverLog, nil))
+		s.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		c := NewClient(server.URL)
+		c.Logger = slog.New(slog.NewTextHandler(clientLog, nil))
+
+		Convey("Subscribers connecting and disconnecting should be logged", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			events := make(chan *Event)
+			go c.SubscribeWithContext(ctx, "test", func(msg *Event) {
+				events <- msg
+			})
+			So(waitForLog(serverLog, "subscriber connected"), ShouldContainSubstring, "stream=test")
+			So(waitForLog(clientLog, "msg=connected"), ShouldContainSubstring, "framing=text/event-stream")
+
+			cancel()
+			So(waitForLog(serverLog, "subscriber disconnected"), ShouldContainSubstring, "subscriber=1")
+		})
+
+		Convey("Tokens in the query should not be logged", func() {
+			c.URL = server.URL + "?token=secret"
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.SubscribeWithContext(ctx, "test", func(msg *Event) {})
+			So(waitForLog(clientLog, "msg=connected"), ShouldNotContainSubstring, "secret")
+		})
+
+		Convey("Reconnect attempts should be logged", func() {
+			failing := httptest.NewServer(http.NotFoundHandler())
+			defer failing.Close()
+			c.URL = failing.URL
+			c.ReconnectStrategy = func() backoff.BackOff {
+				return backoff.NewConstantBackOff(time.Millisecond)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.SubscribeWithContext(ctx, "test", func(msg *Event) {})
+			So(waitForLog(clientLog, "reconnecting"), ShouldContainSubstring, "level=WARN")
+		})
+	})
+}
+
+func TestLogDrops(t *testing.T) {
+	Convey("Given a subscriber that drops events", t, func() {
+		log := &logBuffer{}
+		sub := &Subscriber{logger: slog.New(slog.NewTextHandler(log, nil))}
+
+		for i := 0; i < 5; i++ {
+			sub.delivered(&Event{ID: []byte("1")}, time.Time{}, ErrSlowSubscriber)
+		}
+
+		Convey("Only some of the drops should be logged, with their number", func() {
+			out := log.String()
+			So(strings.Count(out, "event not delivered"), ShouldEqual, 3)
+			So(out, ShouldContainSubstring, "dropped=4")
+			So(out, ShouldNotContainSubstring, "dropped=5")
+		})
+	})
+}
@@ -0,0 +1,175 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// defaultEventName is the name of events that are not given one
+const defaultEventName = "message"
+
+// ErrEventSubscribed is returned by SubscribeEvent for a name that is already
+// subscribed to on the stream
+var ErrEventSubscribed = errors.New("event already subscribed to")
+
+// EventMux routes events to handlers registered for their name, and is used
+// as the handler of a subscription:
+//
+//	mux := sse.NewEventMux()
+//	mux.Handle("order.created", onOrderCreated)
+//	client.Subscribe("orders", mux.Dispatch)
+//
+// Events without a name are routed as "message", as browsers do.
+type EventMux struct {
+	mu       sync.RWMutex
+	handlers map[string]func(msg *Event)
+	fallback func(msg *Event)
+}
+
+// NewEventMux creates an empty mux
+func NewEventMux() *EventMux {
+	return &EventMux{
+		handlers: make(map[string]func(msg *Event)),
+	}
+}
+
+// Handle registers the handler for events with the given name, replacing any
+// handler registered before
+func (m *EventMux) Handle(name string, handler func(msg *Event)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers[name] = handler
+}
+
+// Remove unregisters the handler for events with the given name
+func (m *EventMux) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.handlers, name)
+}
+
+// handles reports whether a handler is registered for the given name
+func (m *EventMux) handles(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.handlers[name]
+	return ok
+}
+
+// HandleDefault registers the handler for events no other handler matches.
+// Without one, such events are dropped.
+func (m *EventMux) HandleDefault(handler func(msg *Event)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fallback = handler
+}
+
+// Dispatch passes an event to the handler registered for its name
+func (m *EventMux) Dispatch(msg *Event) {
+	m.mu.RLock()
+	handler, ok := m.handlers[eventName(msg)]
+	if !ok {
+		handler = m.fallback
+	}
+	m.mu.RUnlock()
+
+	if handler != nil {
+		handler(msg)
+	}
+}
+
+// eventSubscription is a connection of SubscribeEvent, routing the events of a
+// stream to the handlers registered for it. It is closed once no names are
+// subscribed to anymore.
+type eventSubscription struct {
+	mux    *EventMux
+	names  int
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// SubscribeEvent subscribes to the events with the given name on a stream,
+// such as "update", or "message" for events without a name. Calls for the
+// same stream share a single connection, with a handler for every name, and
+// all return once it ends. Like Subscribe, it blocks until then. Names that
+// are subscribed to already return ErrEventSubscribed.
+func (c *Client) SubscribeEvent(stream, name string, handler func(msg *Event)) error {
+	return c.SubscribeEventWithContext(context.Background(), stream, name, handler)
+}
+
+// SubscribeEventWithContext subscribes to the events with the given name on a
+// stream like SubscribeEvent, until ctx is done, which removes the handler and
+// returns nil. The shared connection is closed along with the handler of its
+// last name.
+func (c *Client) SubscribeEventWithContext(ctx context.Context, stream, name string, handler func(msg *Event)) error {
+	c.mu.Lock()
+	sub := c.events[stream]
+	if sub != nil && sub.mux.handles(name) {
+		c.mu.Unlock()
+		return ErrEventSubscribed
+	}
+	if sub == nil {
+		subCtx, cancel := context.WithCancel(context.Background())
+		sub = &eventSubscription{mux: NewEventMux(), cancel: cancel, done: make(chan struct{})}
+		if c.events == nil {
+			c.events = make(map[string]*eventSubscription)
+		}
+		c.events[stream] = sub
+
+		go func() {
+			sub.err = c.SubscribeWithContext(subCtx, stream, sub.mux.Dispatch)
+			c.release(stream, sub)
+			close(sub.done)
+		}()
+	}
+	sub.mux.Handle(name, handler)
+	sub.names++
+	c.mu.Unlock()
+
+	select {
+	case <-sub.done:
+		return sub.err
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	sub.mux.Remove(name)
+	sub.names--
+	if sub.names == 0 {
+		sub.cancel()
+		if c.events[stream] == sub {
+			delete(c.events, stream)
+		}
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// release forgets the connection of SubscribeEvent to a stream once it has
+// ended, unless it has been replaced
+func (c *Client) release(stream string, sub *eventSubscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.events[stream] == sub {
+		delete(c.events, stream)
+	}
+}
+
+// eventName returns the name an event is dispatched under
+func eventName(ev *Event) string {
+	if len(ev.Event) == 0 {
+		return defaultEventName
+	}
+	return string(ev.Event)
+}
@@ -0,0 +1,173 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventMux(t *testing.T) {
+	Convey("Given a mux with handlers for some event names", t, func() {
+		var routed []string
+		record := func(route string) func(*Event) {
+			return func(msg *Event) {
+				routed = append(routed, route+":"+string(msg.Data))
+			}
+		}
+
+		mux := NewEventMux()
+		mux.Handle("order.created", record("created"))
+		mux.Handle("message", record("message"))
+
+		Convey("Events should be routed by name", func() {
+			mux.Dispatch(&Event{Event: []byte("order.created"), Data: []byte("1")})
+			mux.Dispatch(&Event{Data: []byte("2")})
+			So(routed, ShouldResemble, []string{"created:1", "message:2"})
+		})
+
+		Convey("Unmatched events should be dropped without a default handler", func() {
+			mux.Dispatch(&Event{Event: []byte("order.deleted"), Data: []byte("3")})
+			So(routed, ShouldBeEmpty)
+		})
+
+		Convey("Unmatched events should be passed to the default handler", func() {
+			mux.HandleDefault(record("default"))
+			mux.Dispatch(&Event{Event: []byte("order.deleted"), Data: []byte("3")})
+			So(routed, ShouldResemble, []string{"default:3"})
+		})
+
+		Convey("It should plug into a subscription", func() {
+			srv := New()
+			srv.AutoReplay = false
+			srv.CreateStream("orders")
+			server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+			done := make(chan *Event, 1)
+			mux.Handle("order.shipped", func(msg *Event) {
+				done <- msg
+			})
+			go NewClient(server.URL).Subscribe("orders", mux.Dispatch)
+			for srv.getStream("orders").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+
+			srv.Publish("orders", &Event{Event: []byte("order.shipped"), Data: []byte("4")})
+			select {
+			case msg := <-done:
+				So(string(msg.Data), ShouldEqual, "4")
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+			srv.Close()
+		})
+	})
+}
+
+func TestSubscribeEvent(t *testing.T) {
+	Convey("Given a stream with events of several names", t, func() {
+		srv := New()
+		srv.AutoReplay = false
+		str := srv.CreateStream("orders")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			srv.Close()
+		})
+
+		Convey("Handlers for each name should share a connection", func() {
+			c := NewClient(server.URL)
+			c.ShouldReconnect = func(err error, resp *http.Response) bool { return false }
+			updates, deletes := make(chan *Event, 1), make(chan *Event, 1)
+			results := make(chan error, 2)
+
+			go func() {
+				results <- c.SubscribeEvent("orders", "update", func(msg *Event) {
+					updates <- msg
+				})
+			}()
+			for str.SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			go func() {
+				results <- c.SubscribeEvent("orders", "delete", func(msg *Event) {
+					deletes <- msg
+				})
+			}()
+			for registered := false; !registered; time.Sleep(time.Millisecond) {
+				c.mu.Lock()
+				mux := c.events["orders"].mux
+				c.mu.Unlock()
+				mux.mu.RLock()
+				registered = mux.handlers["delete"] != nil
+				mux.mu.RUnlock()
+			}
+			So(str.SubscriberCount(), ShouldEqual, 1)
+
+			srv.Publish("orders", &Event{Event: []byte("create"), Data: []byte("1")})
+			srv.Publish("orders", &Event{Event: []byte("update"), Data: []byte("2")})
+			srv.Publish("orders", &Event{Event: []byte("delete"), Data: []byte("3")})
+			So(string((<-updates).Data), ShouldEqual, "2")
+			So(string((<-deletes).Data), ShouldEqual, "3")
+
+			// Names can only be subscribed to once
+			So(c.SubscribeEvent("orders", "update", func(msg *Event) {}), ShouldEqual, ErrEventSubscribed)
+
+			// Both calls return once the connection ends
+			server.CloseClientConnections()
+			srv.Close()
+			for i := 0; i < 2; i++ {
+				select {
+				case <-results:
+				case <-time.After(time.Second):
+					So("subscription not ended", ShouldBeEmpty)
+				}
+			}
+		})
+
+		Convey("The connection should end with the last handler removed", func() {
+			c := NewClient(server.URL)
+			ctx1, cancel1 := context.WithCancel(context.Background())
+			ctx2, cancel2 := context.WithCancel(context.Background())
+			results := make(chan error, 2)
+
+			go func() {
+				results <- c.SubscribeEventWithContext(ctx1, "orders", "update", func(msg *Event) {})
+			}()
+			go func() {
+				results <- c.SubscribeEventWithContext(ctx2, "orders", "delete", func(msg *Event) {})
+			}()
+			var mux *EventMux
+			for mux == nil || !mux.handles("update") || !mux.handles("delete") || str.SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond)
+				c.mu.Lock()
+				if sub := c.events["orders"]; sub != nil {
+					mux = sub.mux
+				}
+				c.mu.Unlock()
+			}
+
+			cancel1()
+			So(<-results, ShouldBeNil)
+			So(mux.handles("update"), ShouldBeFalse)
+			So(mux.handles("delete"), ShouldBeTrue)
+			So(str.SubscriberCount(), ShouldEqual, 1)
+
+			cancel2()
+			So(<-results, ShouldBeNil)
+			for deadline := time.Now().Add(time.Second); str.SubscriberCount() > 0 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			So(str.SubscriberCount(), ShouldEqual, 0)
+		})
+	})
+}
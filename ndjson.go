@@ -0,0 +1,91 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ndjsonLine is an event written with FramingNDJSON
+type ndjsonLine struct {
+	ID    string `json:"id,omitempty"`
+	Event string `json:"event,omitempty"`
+	Data  string `json:"data"`
+	// Set when data is base64 encoded, as it is not valid UTF-8
+	Base64 bool              `json:"base64,omitempty"`
+	Retry  *uint64           `json:"retry,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// encodeNDJSON returns an event as a line of NDJSON. Comments have no place in
+// the object, so events carrying nothing else, such as keep-alives, are sent
+// as empty lines, which still keep connections open.
+func encodeNDJSON(ev *Event) []byte {
+	if len(ev.ID) == 0 && len(ev.Event) == 0 && len(ev.Data) == 0 && len(ev.Retry) == 0 && len(ev.Fields) == 0 {
+		return newline
+	}
+
+	line := ndjsonLine{ID: string(ev.ID), Event: string(ev.Event), Data: string(ev.Data)}
+	if !utf8.Valid(ev.Data) {
+		line.Data, line.Base64 = base64.StdEncoding.EncodeToString(ev.Data), true
+	}
+	if retry, err := strconv.ParseUint(string(ev.Retry), 10, 64); err == nil {
+		line.Retry = &retry
+	}
+	if len(ev.Fields) > 0 {
+		line.Fields = make(map[string]string, len(ev.Fields))
+		for name, value := range ev.Fields {
+			line.Fields[name] = string(value)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// Encoding strings and numbers can not fail
+	enc.Encode(line)
+	return buf.Bytes()
+}
+
+// framing returns the framing to serve a request with, FramingNDJSON only if
+// the server allows it and the request prefers it
+func (s *Server) framing(r *http.Request) Framing {
+	if !s.NDJSON {
+		return FramingEventStream
+	}
+	return preferredFraming(r.Header.Get("Accept"))
+}
+
+// preferredFraming returns the framing an Accept header gives the highest
+// quality value, or the one listed first if they are equal. Wildcards and
+// other media types are ignored, so event streams remain the default.
+func preferredFraming(accept string) Framing {
+	framing, best := FramingEventStream, 0.0
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil || mediaType != ContentTypeEventStream && mediaType != ContentTypeNDJSON {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		if q > best {
+			best = q
+			framing = FramingEventStream
+			if mediaType == ContentTypeNDJSON {
+				framing = FramingNDJSON
+			}
+		}
+	}
+	return framing
+}
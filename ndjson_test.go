@@ -0,0 +1,99 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNDJSON(t *testing.T) {
+	for _, mode := range []DispatchMode{DispatchPerSubscriber, DispatchPooled} {
+		Convey("Given a server serving NDJSON, dispatched in mode "+strconv.Itoa(int(mode)), t, func() {
+			s := New()
+			s.DispatchMode = mode
+			s.NDJSON = true
+			server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+			s.CreateStream("test")
+			s.Publish("test", &Event{Event: []byte("greeting"), Data: []byte("<hello>\nworld"), Retry: []byte("3000")})
+
+			Reset(func() {
+				server.CloseClientConnections()
+				server.Close()
+				s.Close()
+			})
+
+			Convey("Requests preferring NDJSON should receive a line per event", func() {
+				req, _ := http.NewRequest(http.MethodGet, server.URL+"?stream=test", nil)
+				req.Header.Set("Accept", "text/event-stream;q=0.5, application/x-ndjson")
+				resp, err := http.DefaultClient.Do(req)
+				So(err, ShouldBeNil)
+				defer resp.Body.Close()
+				So(resp.Header.Get("Content-Type"), ShouldEqual, ContentTypeNDJSON)
+				So(resp.Header.Values("Vary"), ShouldContain, "Accept")
+
+				lines := bufio.NewReader(resp.Body)
+				line, err := lines.ReadString('\n')
+				So(err, ShouldBeNil)
+				So(line, ShouldEqual, `{"id":"0","event":"greeting","data":"<hello>\nworld","retry":3000}`+"\n")
+
+				s.Publish("test", &Event{Comment: []byte("ping")})
+				line, err = lines.ReadString('\n')
+				So(err, ShouldBeNil)
+				So(line, ShouldEqual, "\n")
+			})
+
+			Convey("Clients accepting NDJSON first should decode it", func() {
+				c := NewClient(server.URL)
+				c.Accept = ContentTypeNDJSON + ", " + ContentTypeEventStream
+				framings := make(chan Framing, 1)
+				c.OnConnect = func(c *Client, f Framing) {
+					framings <- f
+				}
+
+				events := make(chan *Event)
+				go c.Subscribe("test", func(msg *Event) {
+					events <- msg
+				})
+
+				select {
+				case ev := <-events:
+					So(<-framings, ShouldEqual, FramingNDJSON)
+					So(string(ev.Event), ShouldEqual, "greeting")
+					So(string(ev.Data), ShouldEqual, "<hello>\nworld")
+				case <-time.After(time.Second):
+					So("no event", ShouldBeEmpty)
+				}
+			})
+
+			Convey("Other requests should receive an event stream", func() {
+				resp, err := http.Get(server.URL + "?stream=test")
+				So(err, ShouldBeNil)
+				defer resp.Body.Close()
+				So(resp.Header.Get("Content-Type"), ShouldEqual, ContentTypeEventStream)
+			})
+		})
+	}
+
+	Convey("Binary data and extra fields should be encoded", t, func() {
+		line := encodeNDJSON(&Event{Data: []byte{0xff, 0x00}, Fields: map[string][]byte{"trace": []byte("abc")}})
+		So(string(line), ShouldEqual, `{"data":"/wA=","base64":true,"fields":{"trace":"abc"}}`+"\n")
+	})
+
+	Convey("The preferred framing should follow quality values and order", t, func() {
+		So(preferredFraming(""), ShouldEqual, FramingEventStream)
+		So(preferredFraming("*/*"), ShouldEqual, FramingEventStream)
+		So(preferredFraming("application/x-ndjson"), ShouldEqual, FramingNDJSON)
+		So(preferredFraming("text/event-stream, application/x-ndjson"), ShouldEqual, FramingEventStream)
+		So(preferredFraming("application/x-ndjson, text/event-stream"), ShouldEqual, FramingNDJSON)
+		So(preferredFraming("text/event-stream;q=0.1, application/x-ndjson;q=0.2"), ShouldEqual, FramingNDJSON)
+	})
+}
@@ -0,0 +1,261 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Media types of the framings events can be sent in
+const (
+	ContentTypeEventStream = "text/event-stream"
+	ContentTypeNDJSON      = "application/x-ndjson"
+)
+
+// ErrUnacceptableContentType is returned for responses whose content type is
+// not one the client accepts, see Client.Accept. Subscriptions are not retried
+// after it, as the server would keep sending the same type.
+var ErrUnacceptableContentType = errors.New("unacceptable content type")
+
+// Framing is the format a server sends events in
+type Framing int
+
+const (
+	// FramingEventStream frames events as text/event-stream
+	FramingEventStream Framing = iota
+	// FramingNDJSON sends every event as a JSON object on a line of its own,
+	// with id, event, data and retry keys
+	FramingNDJSON
+)
+
+// String returns the media type of the framing
+func (f Framing) String() string {
+	if f == FramingNDJSON {
+		return ContentTypeNDJSON
+	}
+	return ContentTypeEventStream
+}
+
+// accept returns the Accept header of the client's requests
+func (c *Client) accept() string {
+	if c.Accept == "" {
+		return ContentTypeEventStream
+	}
+	return c.Accept
+}
+
+// negotiate checks the content type of a response against Accept, returning
+// the framing of its events along with a reader of them as an event stream.
+// Without Accept, responses are read as event streams whatever their type.
+func (c *Client) negotiate(resp *http.Response) (Framing, io.Reader, error) {
+	if c.Accept == "" {
+		return FramingEventStream, resp.Body, nil
+	}
+
+	mediaType := ContentTypeEventStream
+	if header := resp.Header.Get("Content-Type"); header != "" {
+		mediaType, _, _ = mime.ParseMediaType(header)
+	}
+	if !accepts(c.Accept, mediaType) {
+		return 0, nil, fmt.Errorf("%w: %s", ErrUnacceptableContentType, mediaType)
+	}
+
+	if mediaType == ContentTypeNDJSON {
+		return FramingNDJSON, c.newNDJSONReader(resp.Body), nil
+	}
+	return FramingEventStream, resp.Body, nil
+}
+
+// connected negotiates the framing of a response, passing it to OnConnect
+func (c *Client) connected(resp *http.Response) (io.Reader, error) {
+	framing, body, err := c.negotiate(resp)
+	if err != nil {
+		return nil, err
+	}
+	c.log(slog.LevelInfo, "connected", "url", logURL(resp.Request.URL), "framing", framing.String())
+	if c.OnConnect != nil {
+		c.OnConnect(c, framing)
+	}
+	return body, nil
+}
+
+// accepts reports whether an Accept header lists a media type, ignoring
+// parameters and quality values other than zero
+func accepts(accept, mediaType string) bool {
+	for _, item := range strings.Split(accept, ",") {
+		accepted, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		if accepted == mediaType || accepted == "*/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ndjsonEvent is an event sent with FramingNDJSON. The id and data are usually
+// strings, but any other JSON value is taken as its text.
+type ndjsonEvent struct {
+	ID     json.RawMessage   `json:"id"`
+	Event  string            `json:"event"`
+	Data   json.RawMessage   `json:"data"`
+	Base64 bool              `json:"base64"`
+	Retry  *uint64           `json:"retry"`
+	Fields map[string]string `json:"fields"`
+}
+
+// ndjsonReader translates NDJSON framed events into an event stream, so they
+// are parsed like any other. Lines that are not valid events are reported to
+// OnError and skipped, as are lines longer than the client's MaxBufferSize.
+type ndjsonReader struct {
+	src  *bufio.Reader
+	buf  bytes.Buffer
+	line []byte
+	c    *Client
+}
+
+func (c *Client) newNDJSONReader(r io.Reader) io.Reader {
+	return &ndjsonReader{src: bufio.NewReader(r), c: c}
+}
+
+func (r *ndjsonReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		line, err := r.readLine()
+		if len(bytes.TrimSpace(line)) > 0 {
+			r.translate(line)
+		}
+		if err != nil {
+			if r.buf.Len() > 0 {
+				break
+			}
+			return 0, err
+		}
+	}
+	return r.buf.Read(p)
+}
+
+// readLine returns the next line, or none if it is longer than MaxBufferSize,
+// in which case it is reported as ErrEventTooLarge and the rest of it skipped
+func (r *ndjsonReader) readLine() ([]byte, error) {
+	limit := r.c.MaxBufferSize
+	if limit <= 0 {
+		limit = eventStreamBufferSize
+	}
+
+	r.line = r.line[:0]
+	tooLarge := false
+	for {
+		chunk, err := r.src.ReadSlice('\n')
+		if !tooLarge && len(r.line)+len(chunk) > limit {
+			tooLarge = true
+			r.c.reportError(ErrEventTooLarge, r.line)
+			if r.c.AbortOnError {
+				return nil, ErrEventTooLarge
+			}
+		}
+		if !tooLarge {
+			r.line = append(r.line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLarge {
+			return nil, err
+		}
+		return r.line, err
+	}
+}
+
+// translate writes an NDJSON line as an event stream frame
+func (r *ndjsonReader) translate(line []byte) {
+	var ev ndjsonEvent
+	if err := json.Unmarshal(line, &ev); err != nil {
+		r.c.reportError(fmt.Errorf("invalid NDJSON event: %s", err), line)
+		return
+	}
+	data := jsonText(ev.Data)
+	if ev.Base64 {
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			r.c.reportError(fmt.Errorf("invalid NDJSON event: %s", err), line)
+			return
+		}
+		data = decoded
+	}
+
+	if len(ev.ID) > 0 {
+		r.buf.WriteString("id: ")
+		r.buf.Write(bytes.ReplaceAll(jsonText(ev.ID), newline, nil))
+		r.buf.WriteByte('\n')
+	}
+	if ev.Event != "" {
+		r.buf.WriteString("event: ")
+		r.buf.WriteString(strings.ReplaceAll(ev.Event, "\n", ""))
+		r.buf.WriteByte('\n')
+	}
+	if ev.Retry != nil {
+		fmt.Fprintf(&r.buf, "retry: %d\n", *ev.Retry)
+	}
+	r.translateFields(ev.Fields)
+	if len(ev.Data) > 0 && string(ev.Data) != "null" {
+		if len(data) == 0 {
+			r.buf.WriteString("data:\n")
+		}
+		for len(data) > 0 {
+			line, rest := splitLine(data)
+			r.buf.WriteString("data: ")
+			r.buf.Write(line)
+			r.buf.WriteByte('\n')
+			data = rest
+		}
+	}
+	r.buf.WriteByte('\n')
+}
+
+// translateFields writes the extra fields of an NDJSON event, in the order of
+// their names. Names that would be taken for standard fields or can not be
+// written as a field name are skipped.
+func (r *ndjsonReader) translateFields(fields map[string]string) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		switch name {
+		case "", "id", "event", "data", "retry":
+			continue
+		}
+		if strings.ContainsAny(name, ":\r\n") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		r.buf.WriteString(name)
+		r.buf.WriteString(": ")
+		r.buf.WriteString(strings.NewReplacer("\r", "", "\n", "").Replace(fields[name]))
+		r.buf.WriteByte('\n')
+	}
+}
+
+// jsonText returns the value of a JSON string, or the text of any other value
+func jsonText(raw json.RawMessage) []byte {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []byte(s)
+	}
+	return raw
+}
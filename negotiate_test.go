@@ -0,0 +1,111 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNegotiate(t *testing.T) {
+	Convey("Given a server sending events in NDJSON framing", t, func() {
+		var accept string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accept = r.Header.Get("Accept")
+			w.Header().Set("Content-Type", ContentTypeNDJSON+"; charset=utf-8")
+			io.WriteString(w, `{"id":"1","event":"greeting","data":"hello\nworld"}`+"\n")
+			io.WriteString(w, "not json\n")
+			io.WriteString(w, `{"id":2,"data":{"n":2}}`+"\n")
+		}))
+		defer server.Close()
+
+		c := NewClientWithoutRetry(server.URL)
+
+		Convey("A client accepting NDJSON should receive its events", func() {
+			var framing Framing
+			c.Accept = ContentTypeEventStream + ", " + ContentTypeNDJSON
+			c.OnConnect = func(c *Client, f Framing) {
+				framing = f
+			}
+
+			var events []*Event
+			err := c.Subscribe("test", func(msg *Event) {
+				events = append(events, msg)
+			})
+			So(err, ShouldBeNil)
+			So(accept, ShouldEqual, c.Accept)
+			So(framing, ShouldEqual, FramingNDJSON)
+
+			So(events, ShouldHaveLength, 2)
+			So(string(events[0].ID), ShouldEqual, "1")
+			So(string(events[0].Event), ShouldEqual, "greeting")
+			So(string(events[0].Data), ShouldEqual, "hello\nworld")
+			So(string(events[1].ID), ShouldEqual, "2")
+			So(string(events[1].Data), ShouldEqual, `{"n":2}`)
+		})
+
+		Convey("A client accepting only event streams should fail", func() {
+			c.Accept = ContentTypeEventStream
+
+			err := c.Subscribe("test", func(msg *Event) {})
+			So(errors.Is(err, ErrUnacceptableContentType), ShouldBeTrue)
+		})
+
+		Convey("A client without Accept should ask for an event stream", func() {
+			c.Subscribe("test", func(msg *Event) {})
+			So(accept, ShouldEqual, ContentTypeEventStream)
+		})
+	})
+
+	Convey("Given a server sending binary data, extra fields and overlong lines", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", ContentTypeNDJSON)
+			io.WriteString(w, `{"id":"1","data":"/wA=","base64":true,"fields":{"trace":"abc","id":"x"}}`+"\n")
+			io.WriteString(w, `{"id":"2","data":"`+strings.Repeat("x", 256)+`"}`+"\n")
+			io.WriteString(w, `{"id":"3","data":"short"}`+"\n")
+		}))
+		defer server.Close()
+
+		c := NewClientWithoutRetry(server.URL)
+		c.Accept = ContentTypeNDJSON
+		c.CaptureFields = true
+		c.MaxBufferSize = 128
+		var errs []error
+		c.OnError = func(err error, raw []byte) {
+			errs = append(errs, err)
+		}
+
+		var events []*Event
+		err := c.Subscribe("test", func(msg *Event) {
+			events = append(events, msg)
+		})
+		So(err, ShouldBeNil)
+
+		Convey("Binary data and fields should survive the round trip", func() {
+			So(events, ShouldHaveLength, 2)
+			So(events[0].Data, ShouldResemble, []byte{0xff, 0x00})
+			So(string(events[0].Fields["trace"]), ShouldEqual, "abc")
+			So(string(events[0].ID), ShouldEqual, "1")
+		})
+
+		Convey("Lines over MaxBufferSize should be dropped and reported", func() {
+			So(string(events[1].ID), ShouldEqual, "3")
+			So(errs, ShouldHaveLength, 1)
+			So(errs[0], ShouldEqual, ErrEventTooLarge)
+		})
+	})
+
+	Convey("Accept headers should be matched against media types", t, func() {
+		So(accepts("text/event-stream, application/x-ndjson;q=0.5", ContentTypeNDJSON), ShouldBeTrue)
+		So(accepts("text/event-stream, application/x-ndjson;q=0", ContentTypeNDJSON), ShouldBeFalse)
+		So(accepts("*/*", ContentTypeNDJSON), ShouldBeTrue)
+	})
+}
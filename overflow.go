@@ -0,0 +1,136 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "sync/atomic"
+
+// ChanOverflow selects what SubscribeChan does with events arriving while the
+// channel is full
+type ChanOverflow int
+
+const (
+	// ChanBlock waits for room on the channel, which holds up reading from
+	// the connection until the consumer catches up. This is the default.
+	ChanBlock ChanOverflow = iota
+	// ChanDropNewest drops the arriving event
+	ChanDropNewest
+	// ChanDropOldest drops the oldest event queued on the channel to make
+	// room for the arriving one
+	ChanDropOldest
+)
+
+// ChanStats describes how well the consumer of a channel subscribed with
+// SubscribeChan keeps up, so falling behind can be noticed before events are
+// lost, see Client.ChanStats
+type ChanStats struct {
+	// Number of events sent to the channel
+	Delivered uint64
+	// Number of events dropped as the channel was full, see
+	// Client.ChanOverflow
+	Dropped uint64
+	// Highest number of events seen queued on the channel
+	HighWater int
+	// Capacity of the channel
+	Capacity int
+}
+
+// chanStats counts the deliveries to a channel
+type chanStats struct {
+	delivered uint64
+	dropped   uint64
+	highWater int64
+	capacity  int
+}
+
+// ChanStats returns the statistics of a channel subscribed with SubscribeChan,
+// or false if it is not subscribed. They are kept until it is unsubscribed.
+func (c *Client) ChanStats(ch chan *Event) (ChanStats, bool) {
+	c.mu.Lock()
+	st := c.chanStats[ch]
+	c.mu.Unlock()
+
+	if st == nil {
+		return ChanStats{}, false
+	}
+	return ChanStats{
+		Delivered: atomic.LoadUint64(&st.delivered),
+		Dropped:   atomic.LoadUint64(&st.dropped),
+		HighWater: int(atomic.LoadInt64(&st.highWater)),
+		Capacity:  st.capacity,
+	}, true
+}
+
+// trackChan starts counting the deliveries to a channel
+func (c *Client) trackChan(ch chan *Event) *chanStats {
+	st := &chanStats{capacity: cap(ch)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.chanStats == nil {
+		c.chanStats = make(map[chan *Event]*chanStats)
+	}
+	c.chanStats[ch] = st
+	return st
+}
+
+// untrackChan drops the statistics of an unsubscribed channel
+func (c *Client) untrackChan(ch chan *Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.chanStats, ch)
+}
+
+// send delivers an event to a channel as the overflow policy says, reporting
+// false if the subscription ended first, which is signalled on quit or by
+// closing done
+func (st *chanStats) send(ch chan *Event, msg *Event, policy ChanOverflow, quit <-chan bool, done <-chan struct{}) bool {
+	if policy == ChanBlock {
+		select {
+		case ch <- msg:
+			st.sent(len(ch))
+			return true
+		case <-quit:
+			return false
+		case <-done:
+			return false
+		}
+	}
+
+	for {
+		select {
+		case <-quit:
+			return false
+		case <-done:
+			return false
+		case ch <- msg:
+			st.sent(len(ch))
+			return true
+		default:
+		}
+
+		// Unbuffered channels have no queued event to drop
+		if policy == ChanDropNewest || cap(ch) == 0 {
+			atomic.AddUint64(&st.dropped, 1)
+			return true
+		}
+		// Make room, unless the consumer just did
+		select {
+		case <-ch:
+			atomic.AddUint64(&st.dropped, 1)
+		default:
+		}
+	}
+}
+
+// sent counts a delivery, after which n events were queued on the channel
+func (st *chanStats) sent(n int) {
+	atomic.AddUint64(&st.delivered, 1)
+	for {
+		high := atomic.LoadInt64(&st.highWater)
+		if int64(n) <= high || atomic.CompareAndSwapInt64(&st.highWater, high, int64(n)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// settled waits for the stats of a channel to count n events that arrived
+func settled(c *Client, ch chan *Event, n uint64) ChanStats {
+	deadline := time.Now().Add(time.Second)
+	for {
+		st, _ := c.ChanStats(ch)
+		if st.Delivered+st.Dropped >= n || time.Now().After(deadline) {
+			return st
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestChanOverflow(t *testing.T) {
+	Convey("Given a stream with events waiting to be replayed", t, func() {
+		s := New()
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+		s.CreateStream("test")
+		for i := 0; i < 5; i++ {
+			s.Publish("test", &Event{Data: []byte(strconv.Itoa(i))})
+		}
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		c := NewClient(server.URL)
+		ch := make(chan *Event, 2)
+
+		Convey("Channels should not be tracked until they are subscribed", func() {
+			_, ok := c.ChanStats(ch)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Dropping the newest events should keep the first ones", func() {
+			c.ChanOverflow = ChanDropNewest
+			_, err := c.SubscribeChan("test", ch)
+			So(err, ShouldBeNil)
+
+			st := settled(c, ch, 5)
+			So(st, ShouldResemble, ChanStats{Delivered: 2, Dropped: 3, HighWater: 2, Capacity: 2})
+			So(string((<-ch).Data), ShouldEqual, "0")
+			So(string((<-ch).Data), ShouldEqual, "1")
+		})
+
+		Convey("Dropping the oldest events should keep the last ones", func() {
+			c.ChanOverflow = ChanDropOldest
+			_, err := c.SubscribeChan("test", ch)
+			So(err, ShouldBeNil)
+
+			st := settled(c, ch, 8)
+			So(st, ShouldResemble, ChanStats{Delivered: 5, Dropped: 3, HighWater: 2, Capacity: 2})
+			So(string((<-ch).Data), ShouldEqual, "3")
+			So(string((<-ch).Data), ShouldEqual, "4")
+		})
+
+		Convey("Blocking should count the high-water mark", func() {
+			_, err := c.SubscribeChan("test", ch)
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 5; i++ {
+				So(string((<-ch).Data), ShouldEqual, strconv.Itoa(i))
+			}
+			st := settled(c, ch, 5)
+			So(st.Delivered, ShouldEqual, 5)
+			So(st.Dropped, ShouldEqual, 0)
+			So(st.HighWater, ShouldBeBetweenOrEqual, 1, 2)
+		})
+	})
+}
@@ -0,0 +1,178 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "time"
+
+// ReplayPageEvent is the name of the control event sent after each page of
+// paginated replay, see Stream.ReplayPageSize. Its data is the continuation
+// cursor: the id of the first event of the next page, which a client that
+// disconnects before the next page arrives can resume from with the
+// lastEventId parameter.
+const ReplayPageEvent = "replay-page"
+
+// maxHeldLive bounds the live events a subscriber holds back between pages of
+// replayed history. Subscribers exceeding it are disconnected, and resume from
+// the last event they were sent when they reconnect.
+const maxHeldLive = 4096
+
+// replayPages is the history replayed to a subscriber in pages. It is handed
+// to the subscriber's writer through its queue, ahead of live events, so the
+// stream does not wait for the history to be written.
+type replayPages struct {
+	events   []*Event
+	size     int
+	interval time.Duration
+	// Passes the events of the subscriber's filter
+	wants func(*Event) bool
+	// Events written of the current page
+	paged int
+	// Set between pages, until the next page is due
+	due     time.Time
+	waiting bool
+	// Set once the pooled dispatcher is to be woken up for the next page
+	scheduled bool
+	clock     clock
+	// Live events taken from the subscriber's queue between pages, so the
+	// stream is not held up, which are written after the history
+	live []*Event
+	// Loads the history from the EventStore on the subscriber's writer, in
+	// place of events
+	load func() []*Event
+	// Receives the history loaded for a pooled subscriber, whose writer is
+	// shared with other subscribers, on a goroutine of its own
+	loaded chan []*Event
+}
+
+// loadingWait is reported by popReplay while the history of a pooled
+// subscriber is being loaded. Its writer is notified once the history has
+// been loaded rather than after it.
+const loadingWait = time.Millisecond
+
+// paginate queues the events a subscriber resumes from for paginated replay
+func (str *Stream) paginate(sub *Subscriber, log EventLog) {
+	var events []*Event
+	for _, ev := range log {
+		if compareID(string(ev.ID), sub.eventid) >= 0 {
+			events = append(events, ev)
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	sub.connection <- &Event{kept: true, pages: &replayPages{
+		events:   events,
+		size:     str.ReplayPageSize,
+		interval: str.ReplayPageInterval,
+		wants:    sub.wants,
+		clock:    clockOrSystem(str.clock),
+	}}
+	sub.notify()
+}
+
+// next returns the next replayed event, or a page event once a page is
+// complete. Between pages it returns nil along with how long remains until
+// the next page is due.
+func (p *replayPages) next() (*Event, time.Duration) {
+	if p.waiting {
+		if wait := p.due.Sub(p.clock.Now()); wait > 0 {
+			return nil, wait
+		}
+		p.waiting, p.scheduled, p.paged = false, false, 0
+	}
+
+	for len(p.events) > 0 {
+		if p.size > 0 && p.paged == p.size {
+			p.waiting, p.due = true, p.clock.Now().Add(p.interval)
+			return &Event{Event: []byte(ReplayPageEvent), Data: p.events[0].ID}, 0
+		}
+
+		packed := p.events[0]
+		p.events[0] = nil
+		p.events = p.events[1:]
+		if ev, err := unpackEvent(packed); err == nil && p.wants(ev) {
+			p.paged++
+			return ev, 0
+		}
+	}
+
+	if len(p.live) > 0 {
+		ev := p.live[0]
+		p.live[0] = nil
+		p.live = p.live[1:]
+		return ev, 0
+	}
+	return nil, 0
+}
+
+// popReplay returns the next replayed event for the subscriber, if any. While
+// a page is not due yet, or the history is still being loaded, it returns nil
+// along with how long remains.
+func (s *Subscriber) popReplay() (*Event, time.Duration) {
+	if s.pages == nil {
+		return nil, 0
+	}
+	if s.pages.loaded != nil {
+		select {
+		case events := <-s.pages.loaded:
+			s.pages.loaded, s.pages.scheduled = nil, false
+			s.replayStoredEvents(events)
+		default:
+			return nil, loadingWait
+		}
+	}
+
+	ev, wait := s.pages.next()
+	if ev == nil && wait == 0 {
+		s.pages = nil
+	}
+	return ev, wait
+}
+
+// holdLive keeps a live event taken from the subscriber's queue while a page is
+// not due, to be written after the history. It reports false if the
+// subscriber holds too many of them.
+func (s *Subscriber) holdLive(ev *Event) bool {
+	if s.replayedLive(ev) {
+		return true
+	}
+	if len(s.pages.live) >= maxHeldLive {
+		return false
+	}
+	s.pages.live = append(s.pages.live, ev)
+	return true
+}
+
+// takeReplay starts replaying the pages carried by an event, loading them
+// from the EventStore first if need be. It reports false if the event carries
+// none.
+func (s *Subscriber) takeReplay(ev *Event) bool {
+	if ev.pages == nil {
+		return false
+	}
+	s.pages = ev.pages
+	if load := s.pages.load; load != nil {
+		s.pages.load = nil
+		s.replayed = nil
+		if s.dispatcher == nil {
+			s.replayStoredEvents(load())
+			return true
+		}
+
+		// A slow store would hold up the other subscribers of a pooled
+		// writer, so live events are held back while a goroutine loads the
+		// history
+		pages := s.pages
+		pages.loaded, pages.scheduled = make(chan []*Event, 1), true
+		go func() {
+			pages.loaded <- load()
+			if s.Context().Err() == nil {
+				s.notify()
+			}
+		}()
+	}
+	return true
+}
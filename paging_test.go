@@ -0,0 +1,120 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPaginatedReplay(t *testing.T) {
+	for _, mode := range []DispatchMode{DispatchPerSubscriber, DispatchPooled} {
+		Convey("Given a stream replaying history in pages, dispatched in mode "+strconv.Itoa(int(mode)), t, func() {
+			s := New()
+			s.DispatchMode = mode
+			s.ReplayPageSize = 2
+			s.ReplayPageInterval = 50 * time.Millisecond
+			server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+			s.CreateStream("test")
+			for i := 0; i < 5; i++ {
+				s.Publish("test", &Event{Data: []byte("history")})
+			}
+
+			Reset(func() {
+				server.CloseClientConnections()
+				server.Close()
+				s.Close()
+			})
+
+			Convey("Subscribers should receive it page by page before live events", func() {
+				events := make(chan *Event, 16)
+				c := NewClient(server.URL)
+				start := time.Now()
+				go c.Subscribe("test", func(msg *Event) {
+					events <- msg
+				})
+
+				// Live events are published once the subscriber is connected
+				for !s.HasSubscribers("test") {
+					time.Sleep(time.Millisecond)
+				}
+				s.Publish("test", &Event{Data: []byte("live")})
+
+				var received []string
+				for len(received) < 8 {
+					select {
+					case ev := <-events:
+						if len(ev.Event) > 0 {
+							received = append(received, string(ev.Event)+":"+string(ev.Data))
+						} else {
+							received = append(received, string(ev.ID)+":"+string(ev.Data))
+						}
+					case <-time.After(2 * time.Second):
+						So(received, ShouldHaveLength, 8)
+						return
+					}
+				}
+
+				So(received, ShouldResemble, []string{
+					"0:history", "1:history", ReplayPageEvent + ":2",
+					"2:history", "3:history", ReplayPageEvent + ":4",
+					"4:history", "5:live",
+				})
+				So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+			})
+
+			Convey("Live events should not hold up the stream while a page is not due", func() {
+				str := s.getStream("test")
+				str.SubscriberBuffer = 2
+				str.ReplayPageInterval = 500 * time.Millisecond
+
+				events := make(chan *Event, 64)
+				c := NewClient(server.URL)
+				go c.Subscribe("test", func(msg *Event) {
+					events <- msg
+				})
+				for !s.HasSubscribers("test") {
+					time.Sleep(time.Millisecond)
+				}
+				for i := 0; i < 20; i++ {
+					s.Publish("test", &Event{Data: []byte("live")})
+				}
+				// Let the stream take the events before asking it anything
+				time.Sleep(50 * time.Millisecond)
+
+				counted := make(chan int, 1)
+				go func() {
+					counted <- str.SubscriberCount()
+				}()
+				select {
+				case n := <-counted:
+					So(n, ShouldEqual, 1)
+				case <-time.After(250 * time.Millisecond):
+					So("the stream", ShouldEqual, "not blocked")
+				}
+
+				var ids []string
+				for len(ids) < 25 {
+					select {
+					case ev := <-events:
+						if len(ev.Event) == 0 {
+							ids = append(ids, string(ev.ID))
+						}
+					case <-time.After(3 * time.Second):
+						So(ids, ShouldHaveLength, 25)
+						return
+					}
+				}
+				So(ids[0], ShouldEqual, "0")
+				So(ids[24], ShouldEqual, "24")
+			})
+		})
+	}
+}
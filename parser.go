@@ -0,0 +1,383 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+var (
+	errEmptyEvent   = errors.New("event message was empty")
+	errInvalidEvent = errors.New("invalid event message")
+)
+
+var (
+	// ErrMalformedEvent is reported for frames containing binary garbage
+	// where field names are expected, which are dropped as a whole
+	ErrMalformedEvent = errors.New("malformed event message")
+	// ErrEventTooLarge is reported for frames larger than the reader's
+	// MaxBufferSize, which are dropped
+	ErrEventTooLarge = errors.New("event message too large")
+)
+
+// eventParser turns messages read from an event stream into events. It keeps
+// its buffers between messages, so once they have grown to fit the stream's
+// events, parsing does not allocate.
+type eventParser struct {
+	// Decode the data of each event from base64
+	base64 bool
+	// Verify the signature of each event with these keys, before decoding it
+	verify KeyProvider
+	// Decrypt the data of each event with these keys, after decoding it
+	keys KeyProvider
+	// Stream the events were published to, which their encryption is bound to
+	stream string
+	// Decompress the data of each event with gzip, after decrypting it, to
+	// no more than maxSize bytes, eventStreamBufferSize if zero
+	gunzip  bool
+	maxSize int
+	// Return the parser's own Event for every message. Its fields reference
+	// the parser's buffers, so it is only valid until the next message is
+	// parsed.
+	borrow bool
+	// Share the ids and names of events, see Client.InternValues
+	intern *interner
+
+	fields   fieldParser
+	event    Event
+	decoded  []byte
+	inflate  *gzip.Reader
+	inflated []byte
+	// Holds the last event id given to borrowed events without an id
+	lastID []byte
+}
+
+// parse a single message. Events that are not dispatched, because they carry
+// neither data nor an event name, are returned along with an error, so fields
+// such as retry can still be honored.
+func (p *eventParser) parse(msg []byte) (*Event, error) {
+	if len(msg) < 1 {
+		return nil, errEmptyEvent
+	}
+
+	p.fields.reset()
+
+	// Split the message by "\r\n", "\r" or "\n", per the spec.
+	for len(msg) > 0 {
+		var line []byte
+		line, msg = splitLine(msg)
+		p.fields.parseLine(line)
+	}
+
+	if p.fields.malformed {
+		return nil, ErrMalformedEvent
+	}
+
+	e := &p.event
+	p.fields.fill(e)
+
+	if p.verify != nil && p.fields.dispatch(e) {
+		if err := verifyEvent(p.verify, e); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if len(e.Data) > 0 && p.base64 {
+		size := base64.StdEncoding.DecodedLen(len(e.Data))
+		if cap(p.decoded) < size {
+			p.decoded = make([]byte, size)
+		}
+
+		n, derr := base64.StdEncoding.Decode(p.decoded[:size], e.Data)
+		if derr != nil {
+			err = fmt.Errorf("failed to decode event message: %s", derr)
+		}
+		e.Data = p.decoded[:n]
+	}
+
+	if len(e.Data) > 0 && p.keys != nil && err == nil {
+		data, derr := openData(p.keys, e.Data, sealedAAD(p.stream, e.ID))
+		if derr != nil {
+			err = fmt.Errorf("failed to decrypt event message: %s", derr)
+		} else {
+			e.Data = data
+		}
+	}
+
+	if len(e.Data) > 0 && p.gunzip && err == nil {
+		data, derr := p.decompress(e.Data)
+		if derr != nil {
+			err = fmt.Errorf("failed to decompress event message: %w", derr)
+		} else {
+			e.Data = data
+		}
+	}
+
+	if !p.borrow {
+		e = p.copy(e)
+	}
+
+	if !p.fields.dispatch(e) {
+		return e, errInvalidEvent
+	}
+	return e, err
+}
+
+// copy returns a copy of an event that remains valid once the parser's buffers
+// are reused, interning its id and name if enabled
+func (p *eventParser) copy(e *Event) *Event {
+	if p.intern == nil {
+		return copyEvent(e)
+	}
+
+	id, name := e.ID, e.Event
+	e.ID, e.Event = nil, nil
+	out := copyEvent(e)
+	out.ID = p.intern.value(id)
+	out.Event = p.intern.value(name)
+	return out
+}
+
+// Fields seen by a fieldParser
+const (
+	seenID = 1 << iota
+	seenEvent
+	seenRetry
+	seenData
+	seenComment
+	seenOther
+)
+
+// fieldParser accumulates the fields of an event line by line, following the
+// dispatch rules of the spec: data fields are joined with "\n" in the order
+// they appear, the last id, event and retry fields win, and ids containing NUL
+// are ignored. Values are copied into buffers owned by the parser, which are
+// reused for the next event.
+type fieldParser struct {
+	// Combine data fields the way earlier releases did, see
+	// Client.LegacyParsing
+	legacy bool
+	// Keep fields other than the standard ones instead of ignoring them,
+	// see Client.CaptureFields
+	capture bool
+	// Strip all leading whitespace from values, see Client.TrimLeadingSpace
+	trimSpace bool
+	// Keep the signature field even if other fields are ignored, see
+	// Client.SigningKeys
+	signed bool
+
+	seen int
+	// A field name contained control characters or invalid UTF-8, which
+	// suggests the stream was corrupted
+	malformed bool
+	id        []byte
+	name      []byte
+	retry     []byte
+	data      []byte
+	comment   []byte
+	other     map[string][]byte
+}
+
+// reset prepares the parser for the next event
+func (f *fieldParser) reset() {
+	f.seen = 0
+	f.malformed = false
+	f.id = f.id[:0]
+	f.name = f.name[:0]
+	f.retry = f.retry[:0]
+	f.data = f.data[:0]
+	f.comment = f.comment[:0]
+	// Events may keep the map, so a new one is made for the next event
+	f.other = nil
+}
+
+// empty reports whether no fields have been seen since the last reset
+func (f *fieldParser) empty() bool {
+	return f.seen == 0
+}
+
+// parseLine processes a single line, without its line break. Per the spec, the
+// field name is everything up to the first colon and the value everything after
+// it, minus a single leading space. Any further whitespace is part of the
+// value, unless trimSpace is set. A line without a colon is a field with an
+// empty value, and a line starting with a colon is a comment.
+func (f *fieldParser) parseLine(line []byte) {
+	if len(line) == 0 {
+		return
+	}
+
+	name, value := line, line[len(line):]
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		name, value = line[:i], line[i+1:]
+		// Remove optional leading whitespace
+		if f.trimSpace {
+			value = bytes.TrimLeft(value, " \t")
+		} else if len(value) > 0 && value[0] == ' ' {
+			value = value[1:]
+		}
+	}
+
+	switch string(name) {
+	case "":
+		// Multiple comment lines are joined with "\n", like data lines.
+		if f.seen&seenComment != 0 {
+			f.comment = append(f.comment, '\n')
+		}
+		f.comment = append(f.comment, value...)
+		f.seen |= seenComment
+	case "id":
+		// Ids containing NUL are ignored per the spec.
+		if bytes.IndexByte(value, 0) < 0 {
+			f.id = append(f.id[:0], value...)
+			f.seen |= seenID
+		}
+	case "data":
+		if f.legacy {
+			// Earlier releases prepended each data field.
+			f.data = append(f.data, value...)
+			copy(f.data[len(value):], f.data[:len(f.data)-len(value)])
+			copy(f.data, value)
+		} else {
+			// The spec allows for multiple data fields per event, concatenated them with "\n".
+			f.data = append(f.data, value...)
+		}
+		f.data = append(f.data, '\n')
+		f.seen |= seenData
+	case "event":
+		f.name = append(f.name[:0], value...)
+		f.seen |= seenEvent
+	case "retry":
+		f.retry = append(f.retry[:0], value...)
+		f.seen |= seenRetry
+	default:
+		if !validFieldName(name) {
+			f.malformed = true
+			return
+		}
+		if !f.capture && !(f.signed && string(name) == SignatureField) {
+			// Ignore any garbage that doesn't match what we're looking for.
+			return
+		}
+		// Repeated fields are joined with "\n", like data fields.
+		if f.other == nil {
+			f.other = make(map[string][]byte)
+		}
+		key := string(name)
+		if prev, ok := f.other[key]; ok {
+			value = append(append(prev, '\n'), value...)
+		} else {
+			value = append([]byte(nil), value...)
+		}
+		f.other[key] = value
+		f.seen |= seenOther
+	}
+}
+
+// validFieldName reports whether an unknown field name could have been sent
+// on purpose, as opposed to being garbage: it has to be valid UTF-8 without
+// control characters
+func validFieldName(name []byte) bool {
+	for _, c := range name {
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+	return utf8.Valid(name)
+}
+
+// fill sets the fields of an event to the ones parsed so far. The event
+// references the parser's buffers. Data is nil if there were no data fields,
+// and empty if there were only empty ones.
+func (f *fieldParser) fill(e *Event) {
+	*e = Event{}
+
+	if f.seen&seenID != 0 {
+		e.ID = f.id
+	}
+	if f.seen&seenEvent != 0 {
+		e.Event = f.name
+	}
+	if f.seen&seenRetry != 0 {
+		e.Retry = f.retry
+	}
+	if f.seen&seenComment != 0 {
+		// Empty comments, such as keep-alive lines of a single colon,
+		// are still told apart from frames without one
+		e.Comment = f.comment
+		if e.Comment == nil {
+			e.Comment = []byte{}
+		}
+	}
+	if f.seen&seenOther != 0 {
+		e.Fields = f.other
+	}
+
+	// Trim the last "\n" per the spec.
+	if f.seen&seenData != 0 {
+		e.Data = bytes.TrimSuffix(f.data, []byte("\n"))
+	}
+}
+
+// dispatch reports whether an event filled by the parser should be delivered.
+// Per the spec, that requires data, although this package also delivers named
+// events without data. Earlier releases required the data to be non-empty.
+func (f *fieldParser) dispatch(e *Event) bool {
+	if f.legacy {
+		return len(e.Data) > 0
+	}
+	return e.Data != nil || len(e.Event) > 0
+}
+
+// copyEvent copies the fields of an event into a single new allocation
+func copyEvent(e *Event) *Event {
+	buf := make([]byte, 0, len(e.ID)+len(e.Data)+len(e.Event)+len(e.Retry)+len(e.Comment))
+	out := &Event{}
+
+	out.ID, buf = copyField(buf, e.ID)
+	out.Data, buf = copyField(buf, e.Data)
+	out.Event, buf = copyField(buf, e.Event)
+	out.Retry, buf = copyField(buf, e.Retry)
+	out.Comment, _ = copyField(buf, e.Comment)
+	out.queued = e.queued
+	out.urgent = e.urgent
+	out.packed = e.packed
+
+	if e.Fields != nil {
+		out.Fields = make(map[string][]byte, len(e.Fields))
+		for name, value := range e.Fields {
+			out.Fields[name] = append([]byte(nil), value...)
+		}
+	}
+
+	return out
+}
+
+// copyField appends a field to buf, returning the copy and the remaining buffer
+func copyField(buf, field []byte) ([]byte, []byte) {
+	if field == nil {
+		return nil, buf
+	}
+	start := len(buf)
+	buf = append(buf, field...)
+	return buf[start:len(buf):len(buf)], buf
+}
+
+// reuseField copies a field into dst, reusing its storage if it is large enough
+func reuseField(dst, field []byte) []byte {
+	if field == nil {
+		return nil
+	}
+	if dst == nil {
+		// Keep empty fields apart from missing ones
+		dst = make([]byte, 0, len(field))
+	}
+	return append(dst[:0], field...)
+}
@@ -0,0 +1,184 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var benchmarkMessage = []byte("id: 42\nevent: update\ndata: {\"value\":\"some payload\"}")
+
+func TestEventParser(t *testing.T) {
+	Convey("Given a parser", t, func() {
+		p := &eventParser{}
+
+		Convey("When parsing an event", func() {
+			msg := []byte("id: 1\nevent: update\ndata: test")
+			ev, err := p.parse(msg)
+
+			Convey("It should set every field", func() {
+				So(err, ShouldBeNil)
+				So(string(ev.ID), ShouldEqual, "1")
+				So(string(ev.Event), ShouldEqual, "update")
+				So(string(ev.Data), ShouldEqual, "test")
+			})
+
+			Convey("It should not reference the message", func() {
+				copy(msg, "xxxxxxxxxxxxxxxxxxxxxxxxx")
+				So(string(ev.ID), ShouldEqual, "1")
+				So(string(ev.Data), ShouldEqual, "test")
+			})
+		})
+
+		Convey("When parsing an event with base64 data", func() {
+			p.base64 = true
+			ev, err := p.parse([]byte("data: dGVzdA=="))
+
+			Convey("It should be decoded", func() {
+				So(err, ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, "test")
+			})
+		})
+
+		Convey("When parsing an event without data", func() {
+			ev, err := p.parse([]byte("retry: 1000"))
+
+			Convey("It should return the event with an error", func() {
+				So(err, ShouldNotBeNil)
+				So(string(ev.Retry), ShouldEqual, "1000")
+			})
+		})
+
+		Convey("When parsing an event with several data fields", func() {
+			ev, err := p.parse([]byte("data: first\ndata\ndata: third"))
+
+			Convey("They should be joined in order", func() {
+				So(err, ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, "first\n\nthird")
+			})
+		})
+
+		Convey("When parsing an event with several data fields in legacy mode", func() {
+			p.fields.legacy = true
+			ev, err := p.parse([]byte("data: first\ndata: second"))
+
+			Convey("They should be combined like earlier releases did", func() {
+				So(err, ShouldBeNil)
+				So(string(ev.Data), ShouldEqual, "secondfirst\n")
+			})
+		})
+
+		Convey("When parsing an event with several ids", func() {
+			ev, _ := p.parse([]byte("id: 1\nid: 2\nid: 3\x00\ndata: test"))
+
+			Convey("The last id without NUL should win", func() {
+				So(string(ev.ID), ShouldEqual, "2")
+			})
+		})
+
+		Convey("When parsing a named event without data", func() {
+			ev, err := p.parse([]byte("event: ping"))
+
+			Convey("It should be dispatched", func() {
+				So(err, ShouldBeNil)
+				So(string(ev.Event), ShouldEqual, "ping")
+				So(ev.Data, ShouldBeNil)
+			})
+
+			Convey("It should be dropped in legacy mode", func() {
+				p.fields.legacy = true
+				_, err := p.parse([]byte("event: ping"))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When parsing an event with only an empty data field", func() {
+			ev, err := p.parse([]byte("data"))
+
+			Convey("It should be dispatched with empty data", func() {
+				So(err, ShouldBeNil)
+				So(ev.Data, ShouldNotBeNil)
+				So(len(ev.Data), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When borrowing events", func() {
+			p.borrow = true
+			first, _ := p.parse([]byte("data: one"))
+			second, _ := p.parse([]byte("data: two"))
+
+			Convey("The same event should be reused", func() {
+				So(first, ShouldEqual, second)
+				So(string(second.Data), ShouldEqual, "two")
+			})
+
+			Convey("It should not allocate", func() {
+				allocs := testing.AllocsPerRun(100, func() {
+					p.parse(benchmarkMessage)
+				})
+				So(allocs, ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func BenchmarkEventParser(b *testing.B) {
+	p := &eventParser{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.parse(benchmarkMessage)
+	}
+}
+
+func BenchmarkEventParserBorrowed(b *testing.B) {
+	p := &eventParser{borrow: true}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.parse(benchmarkMessage)
+	}
+}
+
+func TestEventParserIntern(t *testing.T) {
+	Convey("Given a parser interning values", t, func() {
+		p := &eventParser{intern: &interner{}}
+
+		Convey("When parsing events with the same name", func() {
+			first, _ := p.parse([]byte("id: 1\nevent: update\ndata: a"))
+			second, _ := p.parse([]byte("id: 2\nevent: update\ndata: b"))
+
+			Convey("They should share the name", func() {
+				So(&second.Event[0], ShouldEqual, &first.Event[0])
+				So(string(second.ID), ShouldEqual, "2")
+				So(string(second.Data), ShouldEqual, "b")
+			})
+
+			Convey("Appending to the name should not affect other events", func() {
+				_ = append(first.Event, 'x')
+				So(string(second.Event), ShouldEqual, "update")
+			})
+		})
+
+		Convey("When parsing more distinct values than the interner holds", func() {
+			for i := 0; i < maxInternedValues*2; i++ {
+				p.parse([]byte("event: e" + strconv.Itoa(i) + "\ndata: a"))
+			}
+
+			Convey("It should stay bounded", func() {
+				So(len(p.intern.values), ShouldEqual, maxInternedValues)
+			})
+		})
+	})
+}
+
+func BenchmarkEventParserIntern(b *testing.B) {
+	p := &eventParser{intern: &interner{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.parse(benchmarkMessage)
+	}
+}
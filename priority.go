@@ -0,0 +1,94 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+// urgentBufferSize is the number of priority events a subscriber can have
+// waiting
+const urgentBufferSize = 16
+
+// PublishPriority sends an event to every client of a stream ahead of any
+// events still queued for them, so alerts and control events reach slow
+// consumers promptly. As they overtake other events, priority events are
+// neither numbered nor recorded for replay, and clients reconnecting after
+// missing one do not receive it. Subscribers with more priority events waiting
+// than they can hold are subject to the stream's Backpressure.
+func (s *Server) PublishPriority(id string, event *Event) error {
+	urgent := *event
+	urgent.urgent = true
+	return s.Publish(id, &urgent)
+}
+
+// queue returns the queue an event waits in on the stream
+func (str *Stream) queue(event *Event) chan *Event {
+	if event.urgent {
+		return str.urgent
+	}
+	return str.event
+}
+
+// dispatchUrgent sends a priority event to every subscriber, applying the
+// Backpressure policy to those with too many priority events waiting
+func (str *Stream) dispatchUrgent(event *Event) {
+	if !str.encrypt(event) {
+		return
+	}
+
+	var slow []*Subscriber
+	for _, sub := range str.subscribers {
+		if sub.wants(event) && !str.send(sub, sub.urgent, event) {
+			slow = append(slow, sub)
+		}
+	}
+	str.disconnect(slow)
+}
+
+// next waits for the next event to write to the subscriber, taking priority
+// events first, followed by backfilled events and replayed history. It
+// reports false once the subscriber has been removed.
+func (s *Subscriber) next() (*Event, bool) {
+	for {
+		select {
+		case ev := <-s.urgent:
+			return ev, true
+		default:
+		}
+
+		if ev := s.popBacklog(); ev != nil {
+			return ev, true
+		}
+
+		ev, wait := s.popReplay()
+		if ev != nil {
+			return ev, true
+		}
+		if wait > 0 {
+			// Only priority events are written until the next page is due,
+			// while live events are held back so the stream is not blocked
+			timer := clockOrSystem(s.clock).NewTimer(wait)
+			select {
+			case ev := <-s.urgent:
+				timer.Stop()
+				return ev, true
+			case ev, ok := <-s.connection:
+				timer.Stop()
+				if !ok || !s.holdLive(ev) {
+					return nil, false
+				}
+			case <-timer.C():
+			}
+			continue
+		}
+
+		select {
+		case ev := <-s.urgent:
+			return ev, true
+		case ev, ok := <-s.connection:
+			if ok && (s.takeReplay(ev) || s.replayedLive(ev)) {
+				continue
+			}
+			return ev, ok
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPublishPriority(t *testing.T) {
+	Convey("Given a subscriber with a backlog", t, func() {
+		s := New()
+		str := s.CreateStream("test")
+		sub := str.addSubscriber("0")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		for _, data := range []string{"a", "b", "c"} {
+			s.Publish("test", &Event{Data: []byte(data)})
+		}
+		for len(sub.connection) < 3 {
+			str.SubscriberCount()
+		}
+
+		Convey("When a priority event is published", func() {
+			s.PublishPriority("test", &Event{Event: []byte("alert"), Data: []byte("!")})
+			for len(sub.urgent) == 0 {
+				str.SubscriberCount()
+			}
+
+			Convey("It should be delivered ahead of the backlog", func() {
+				var order []string
+				for i := 0; i < 4; i++ {
+					ev, ok := sub.next()
+					So(ok, ShouldBeTrue)
+					order = append(order, string(ev.Data))
+				}
+				So(order, ShouldResemble, []string{"!", "a", "b", "c"})
+			})
+
+			Convey("It should not be numbered or recorded for replay", func() {
+				ev, _ := sub.next()
+				So(ev.ID, ShouldBeNil)
+				So(str.Eventlog, ShouldHaveLength, 3)
+				So(str.Sequence(), ShouldEqual, 3)
+			})
+		})
+
+		Convey("The published event should be left as it is", func() {
+			ev := &Event{Data: []byte("!")}
+			s.PublishPriority("test", ev)
+			So(ev.urgent, ShouldBeFalse)
+		})
+
+		Convey("When more priority events are published than the subscriber can hold", func() {
+			// The policy is set before the stream's goroutine starts
+			s.Backpressure = BackpressureDropNewest
+			dropping := s.CreateStream("dropping")
+			sub := dropping.addSubscriber("0")
+			for i := 0; i < urgentBufferSize+2; i++ {
+				s.PublishPriority("dropping", &Event{Data: []byte("!")})
+			}
+
+			Convey("The stream should apply its backpressure policy", func() {
+				So(dropping.SubscriberCount(), ShouldEqual, 1)
+				So(sub.urgent, ShouldHaveLength, urgentBufferSize)
+			})
+		})
+	})
+}
@@ -0,0 +1,29 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// Names of the pprof labels attributing goroutines to the stream and the
+// subscriber they serve, so CPU and goroutine profiles can be broken down by
+// them, such as with go tool pprof -tagfocus. Stream goroutines carry the
+// stream label, and the goroutines writing to subscribers carry both. The
+// subscriber is identified by its client parameter, or its remote address.
+const (
+	StreamLabel     = "sse_stream"
+	SubscriberLabel = "sse_subscriber"
+)
+
+// profileLabels returns ctx with the labels of a stream, and of a subscriber
+// unless subscriber is empty
+func profileLabels(ctx context.Context, stream, subscriber string) context.Context {
+	if subscriber == "" {
+		return pprof.WithLabels(ctx, pprof.Labels(StreamLabel, stream))
+	}
+	return pprof.WithLabels(ctx, pprof.Labels(StreamLabel, stream, SubscriberLabel, subscriber))
+}
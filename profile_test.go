@@ -0,0 +1,59 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// profiled reports whether a goroutine profile shows a goroutine with the
+// given label, waiting up to a second for it to appear
+func profiled(label string) bool {
+	deadline := time.Now().Add(time.Second)
+	for {
+		var buf bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&buf, 1)
+		if bytes.Contains(buf.Bytes(), []byte(label)) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProfileLabels(t *testing.T) {
+	Convey("Given a server with a stream", t, func() {
+		s := New()
+		s.CreateStream("profiled")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("The stream's goroutine should be labeled", func() {
+			So(profiled(`"sse_stream":"profiled"`), ShouldBeTrue)
+		})
+
+		Convey("Subscriber goroutines should be labeled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			r := httptest.NewRequest(http.MethodGet, "/events?stream=profiled&client=alice", nil)
+			go s.HTTPHandler(httptest.NewRecorder(), r.WithContext(ctx))
+
+			So(profiled(`"sse_subscriber":"alice"`), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "errors"
+
+// ErrStreamNotFound is returned by a StreamProvider for streams it can not
+// provide, and by Publish for streams that do not exist
+var ErrStreamNotFound = errors.New("stream not found")
+
+// StreamProvider materializes streams on demand. The server consults it when a
+// client subscribes to a stream that does not exist yet, which turns the server
+// into a gateway over an existing data source.
+type StreamProvider interface {
+	// ProvideStream is called with the id of an unknown stream. It returns the
+	// events the stream's eventlog is seeded with, or an error such as
+	// ErrStreamNotFound to reject the subscription.
+	ProvideStream(id string) ([]*Event, error)
+	// FeedStream is started in its own goroutine once the stream has been
+	// created. It publishes new events until done is closed, which happens
+	// when the stream is removed or the server is closed.
+	FeedStream(id string, publish func(*Event), done <-chan struct{})
+}
+
+// provideStream creates a stream using the server's StreamProvider
+func (s *Server) provideStream(id string) (*Stream, error) {
+	// The data source is queried without holding the server lock
+	events, err := s.Provider.ProvideStream(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	// Another subscriber materialized the stream in the meantime
+	if str := s.Streams[id]; str != nil {
+		s.mu.Unlock()
+		return str, nil
+	}
+
+	str := s.newStream()
+	str.seed(events)
+	s.startStream(id, str)
+
+	publish := func(ev *Event) {
+		s.Publish(id, ev)
+	}
+	s.background(func() {
+		s.Provider.FeedStream(id, publish, str.done)
+	})
+	s.mu.Unlock()
+
+	if s.OnStreamCreated != nil {
+		s.OnStreamCreated(id, str)
+	}
+	return str, nil
+}
@@ -0,0 +1,66 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testProvider struct{}
+
+func (p testProvider) ProvideStream(id string) ([]*Event, error) {
+	if id != "feed" {
+		return nil, ErrStreamNotFound
+	}
+	return []*Event{{Data: []byte("history 1")}, {Data: []byte("history 2")}}, nil
+}
+
+func (p testProvider) FeedStream(id string, publish func(*Event), done <-chan struct{}) {
+	publish(&Event{Data: []byte("live")})
+	<-done
+}
+
+func TestStreamProvider(t *testing.T) {
+	// New Server
+	s := New()
+	s.Provider = testProvider{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.HTTPHandler)
+	server := httptest.NewServer(mux)
+
+	Convey("Given a server with a stream provider", t, func() {
+		c := NewClient(server.URL + "/events")
+
+		Convey("When subscribing to a stream it provides", func() {
+			events := make(chan *Event)
+			_, err := c.SubscribeChan("feed", events)
+			So(err, ShouldBeNil)
+
+			Convey("It should receive the seeded history and the fed events", func() {
+				for _, expected := range []string{"history 1", "history 2", "live"} {
+					msg, err := wait(events, time.Millisecond*500)
+					So(err, ShouldBeNil)
+					So(string(msg), ShouldEqual, expected)
+				}
+			})
+		})
+
+		Convey("When subscribing to a stream it does not provide", func() {
+			events := make(chan *Event)
+			_, err := c.SubscribeChan("unknown", events)
+
+			Convey("It should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(s.StreamExists("unknown"), ShouldBeFalse)
+			})
+		})
+	})
+}
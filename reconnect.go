@@ -0,0 +1,61 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"time"
+
+	"gopkg.in/cenkalti/backoff.v1"
+)
+
+// reconnection is the reconnection policy of a subscription. Once the server
+// has sent a retry interval, it is waited before the first attempt to
+// reconnect, while the strategy paces any further attempts.
+type reconnection struct {
+	strategy backoff.BackOff
+	retry    time.Duration
+	// Whether the next attempt is the first since the last reset
+	first bool
+}
+
+// newBackOff creates the reconnection policy of a subscription
+func (c *Client) newBackOff() *reconnection {
+	if c.ReconnectStrategy != nil {
+		return &reconnection{strategy: c.ReconnectStrategy()}
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.Clock = clockOrSystem(c.clock)
+	return &reconnection{strategy: b}
+}
+
+// setRetry takes the retry interval sent by the server. The default policy
+// backs off exponentially from it.
+func (r *reconnection) setRetry(retry time.Duration) {
+	if exp, ok := r.strategy.(*backoff.ExponentialBackOff); ok {
+		exp.InitialInterval = retry
+		exp.Reset()
+		return
+	}
+	r.retry = retry
+	r.Reset()
+}
+
+// NextBackOff returns how long to wait before the next attempt, or
+// backoff.Stop to give up
+func (r *reconnection) NextBackOff() time.Duration {
+	next := r.strategy.NextBackOff()
+	if next != backoff.Stop && r.first {
+		r.first = false
+		return r.retry
+	}
+	return next
+}
+
+// Reset starts the policy over, as after connecting
+func (r *reconnection) Reset() {
+	r.strategy.Reset()
+	r.first = r.retry > 0
+}
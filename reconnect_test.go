@@ -0,0 +1,66 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/cenkalti/backoff.v1"
+)
+
+func TestReconnectStrategy(t *testing.T) {
+	Convey("Given a reconnection policy with a custom strategy", t, func() {
+		c := NewClient("")
+		c.ReconnectStrategy = func() backoff.BackOff {
+			return backoff.WithMaxTries(backoff.NewConstantBackOff(10*time.Millisecond), 3)
+		}
+		r := c.newBackOff()
+		r.Reset()
+
+		Convey("The strategy should pace the attempts", func() {
+			So(r.NextBackOff(), ShouldEqual, 10*time.Millisecond)
+			So(r.NextBackOff(), ShouldEqual, 10*time.Millisecond)
+			So(r.NextBackOff(), ShouldEqual, 10*time.Millisecond)
+			So(r.NextBackOff(), ShouldEqual, backoff.Stop)
+		})
+
+		Convey("The retry interval of the server should be waited first", func() {
+			r.NextBackOff()
+			r.setRetry(time.Second)
+			So(r.NextBackOff(), ShouldEqual, time.Second)
+			So(r.NextBackOff(), ShouldEqual, 10*time.Millisecond)
+			So(r.NextBackOff(), ShouldEqual, 10*time.Millisecond)
+			So(r.NextBackOff(), ShouldEqual, backoff.Stop)
+
+			r.Reset()
+			So(r.NextBackOff(), ShouldEqual, time.Second)
+		})
+	})
+
+	Convey("Given a server that keeps failing", t, func() {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		Convey("A client with capped retries should give up", func() {
+			c := NewClient(server.URL)
+			c.ReconnectStrategy = func() backoff.BackOff {
+				return backoff.WithMaxTries(&backoff.ZeroBackOff{}, 2)
+			}
+
+			err := c.Subscribe("test", func(msg *Event) {})
+			So(err, ShouldNotBeNil)
+			So(atomic.LoadInt32(&requests), ShouldEqual, 3)
+		})
+	})
+}
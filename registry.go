@@ -0,0 +1,140 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+)
+
+// forwardedHeader marks subscriptions forwarded by another node, which are
+// not forwarded again, so nodes disagreeing about an owner can not loop
+const forwardedHeader = "X-SSE-Forwarded"
+
+// Registry records which node owns each stream, so streams can be sharded
+// across a cluster without a Broker carrying every event to every node.
+// Implementations are expected to be backed by a consistent store, such as
+// a transaction in etcd or a session lock in Consul, see MemoryRegistry.
+type Registry interface {
+	// Claim records node as the owner of a stream, unless another node owns
+	// it already, and returns the owner
+	Claim(stream, node string) (owner string, err error)
+	// Owner returns the node owning a stream, or "" if no node does
+	Owner(stream string) (string, error)
+	// Release removes the stream's owner, if it is still node
+	Release(stream, node string) error
+}
+
+// MemoryRegistry is a Registry for nodes within a single process
+type MemoryRegistry struct {
+	mu     sync.Mutex
+	owners map[string]string
+}
+
+// NewMemoryRegistry creates a registry without any owners
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{owners: make(map[string]string)}
+}
+
+// Claim makes node the owner of a stream that has none
+func (m *MemoryRegistry) Claim(stream, node string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if owner, ok := m.owners[stream]; ok {
+		return owner, nil
+	}
+	m.owners[stream] = node
+	return node, nil
+}
+
+// Owner returns the owner of a stream
+func (m *MemoryRegistry) Owner(stream string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.owners[stream], nil
+}
+
+// Release removes node as the owner of a stream
+func (m *MemoryRegistry) Release(stream, node string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owners[stream] == node {
+		delete(m.owners, stream)
+	}
+	return nil
+}
+
+// claim registers the server as the owner of a new stream until it is closed.
+// Streams claimed by another node are still served, but reported to OnError,
+// as subscribers on the owner will not see their events.
+func (s *Server) claim(id string, str *Stream) {
+	owner, err := s.Registry.Claim(id, s.NodeURL)
+	if err != nil {
+		s.reportError(nil, fmt.Errorf("failed to claim stream %s: %s", id, err))
+		return
+	}
+	if owner != s.NodeURL {
+		s.reportError(nil, fmt.Errorf("stream %s is owned by %s", id, owner))
+		return
+	}
+
+	<-str.done
+	if err := s.Registry.Release(id, s.NodeURL); err != nil {
+		s.reportError(nil, fmt.Errorf("failed to release stream %s: %s", id, err))
+	}
+}
+
+// forward sends a subscription to the node owning its stream, if that is
+// another node. It reports whether the request has been handled.
+func (s *Server) forward(w http.ResponseWriter, r *http.Request, streamID string) bool {
+	if r.Header.Get(forwardedHeader) != "" {
+		return false
+	}
+
+	owner, err := s.Registry.Owner(streamID)
+	if err != nil {
+		s.reportError(r, err)
+		http.Error(w, "Stream registry unavailable!", http.StatusServiceUnavailable)
+		return true
+	}
+	if owner == "" || owner == s.NodeURL {
+		return false
+	}
+
+	target, err := url.Parse(owner)
+	if err != nil {
+		s.reportError(r, fmt.Errorf("invalid owner %q of stream %s: %s", owner, streamID, err))
+		http.Error(w, "Stream registry unavailable!", http.StatusServiceUnavailable)
+		return true
+	}
+	target.RawQuery = r.URL.RawQuery
+
+	if !s.ProxyRemote {
+		http.Redirect(w, r, target.String(), http.StatusTemporaryRedirect)
+		return true
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL = target
+			req.Host = target.Host
+			req.Header.Set(forwardedHeader, s.NodeURL)
+		},
+		// Events are passed on as soon as they arrive
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			s.reportError(r, err)
+			http.Error(w, "Stream owner unavailable!", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+	return true
+}
@@ -0,0 +1,91 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("Given two nodes sharing a registry", t, func() {
+		registry := NewMemoryRegistry()
+
+		owner := New()
+		owner.Registry = registry
+		ownerServer := httptest.NewServer(http.HandlerFunc(owner.HTTPHandler))
+		owner.NodeURL = ownerServer.URL
+
+		other := New()
+		other.Registry = registry
+		other.AutoStream = true
+		otherServer := httptest.NewServer(http.HandlerFunc(other.HTTPHandler))
+		other.NodeURL = otherServer.URL
+
+		owner.CreateStream("test")
+		for {
+			if node, _ := registry.Owner("test"); node == owner.NodeURL {
+				break
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		Reset(func() {
+			owner.Close()
+			other.Close()
+			ownerServer.Close()
+			otherServer.Close()
+		})
+
+		subscribe := func() string {
+			events := make(chan *Event, 1)
+			go NewClient(otherServer.URL).Subscribe("test", func(msg *Event) {
+				events <- msg
+			})
+
+			for owner.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+			owner.Publish("test", &Event{Data: []byte("owned")})
+			data, _ := wait(events, time.Second)
+			return string(data)
+		}
+
+		Convey("Subscriptions to the other node should be redirected", func() {
+			So(subscribe(), ShouldEqual, "owned")
+			So(other.StreamExists("test"), ShouldBeFalse)
+		})
+
+		Convey("Subscriptions to the other node should be proxied", func() {
+			other.ProxyRemote = true
+			So(subscribe(), ShouldEqual, "owned")
+			So(other.StreamExists("test"), ShouldBeFalse)
+		})
+
+		Convey("Removed streams should be released", func() {
+			owner.RemoveStream("test")
+			for {
+				if node, _ := registry.Owner("test"); node == "" {
+					break
+				}
+				time.Sleep(time.Millisecond * 10)
+			}
+
+			Convey("And be claimed by the next node creating them", func() {
+				other.CreateStream("test")
+				for {
+					if node, _ := registry.Owner("test"); node == other.NodeURL {
+						break
+					}
+					time.Sleep(time.Millisecond * 10)
+				}
+			})
+		})
+	})
+}
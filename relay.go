@@ -0,0 +1,46 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+// Relay subscribes to an upstream stream with a Client and republishes its
+// events onto a local Server stream, so a single upstream connection can be
+// fanned out to any number of local subscribers. Event ids and names are kept
+// as they were received.
+type Relay struct {
+	// Client subscribing to the upstream server
+	Client *Client
+	// Name of the upstream stream, empty to subscribe to the client's URL as is
+	Upstream string
+	// Server the events are republished on
+	Server *Server
+	// Name of the local stream, created if it does not exist
+	Stream string
+}
+
+// NewRelay creates a relay from an upstream stream to a local one
+func NewRelay(client *Client, upstream string, server *Server, stream string) *Relay {
+	return &Relay{
+		Client:   client,
+		Upstream: upstream,
+		Server:   server,
+		Stream:   stream,
+	}
+}
+
+// Run relays events until the upstream subscription ends, which the client
+// retries according to its reconnection policy. If the local stream does not
+// exist yet, it is created keeping the upstream ids, see Stream.KeepIDs.
+func (r *Relay) Run() error {
+	r.Server.createStream(r.Stream, func(str *Stream) {
+		str.KeepIDs = true
+	})
+
+	return r.Client.Subscribe(r.Upstream, func(msg *Event) {
+		if r.Client.ReuseEvents {
+			msg = msg.Clone()
+		}
+		r.Server.Publish(r.Stream, msg)
+	})
+}
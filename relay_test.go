@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRelay(t *testing.T) {
+	Convey("Given a relay from an upstream server", t, func() {
+		upstream := New()
+		upstream.AutoReplay = false
+		upstream.CreateStream("up")
+		server := httptest.NewServer(http.HandlerFunc(upstream.HTTPHandler))
+
+		local := New()
+		relay := NewRelay(NewClient(server.URL), "up", local, "down")
+		go relay.Run()
+
+		for upstream.getStream("up").SubscriberCount() == 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		Convey("When events are published upstream", func() {
+			sub := local.getStream("down").addSubscriber("0")
+			upstream.Publish("up", &Event{ID: []byte("abc"), Event: []byte("update"), Data: []byte("test")})
+
+			Convey("They should be republished locally with their ids and names", func() {
+				select {
+				case ev := <-sub.connection:
+					So(string(ev.ID), ShouldEqual, "abc")
+					So(string(ev.Event), ShouldEqual, "update")
+					So(string(ev.Data), ShouldEqual, "test")
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeEmpty)
+				}
+			})
+		})
+
+		Reset(func() {
+			upstream.Close()
+			local.Close()
+		})
+	})
+}
@@ -0,0 +1,116 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrTooManyRequests is matched by ResponseErrors for responses with status
+// 429 Too Many Requests, whose RetryAfter says when to try again
+var ErrTooManyRequests = errors.New("too many requests")
+
+// ErrNoContent is matched by ResponseErrors for responses with status 204 No
+// Content, with which servers tell clients to stop reconnecting. Subscriptions
+// end with it instead of being retried.
+var ErrNoContent = errors.New("no content")
+
+// maxRetryAfter bounds how long a Retry-After header can hold back reconnect
+// attempts
+const maxRetryAfter = 5 * time.Minute
+
+// ResponseError is returned for responses to subscription requests that do
+// not have a 2xx status, or that have status 204 No Content. It matches
+// ErrUnauthorized for 401 Unauthorized, ErrTooManyRequests for 429 Too Many
+// Requests and ErrNoContent for 204 No Content with errors.Is.
+type ResponseError struct {
+	// Response that was rejected, whose body has been closed
+	Response *http.Response
+	// Time the server asked clients to wait before trying again with the
+	// Retry-After header, zero if it did not. Reconnect attempts wait at
+	// least this long, up to five minutes.
+	RetryAfter time.Duration
+}
+
+func newResponseError(resp *http.Response) *ResponseError {
+	return &ResponseError{Response: resp, RetryAfter: retryAfter(resp.Header.Get("Retry-After"), time.Now())}
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("could not connect to stream: %s", e.Response.Status)
+}
+
+// Is matches the errors of the response's status
+func (e *ResponseError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Response.StatusCode == http.StatusUnauthorized
+	case ErrTooManyRequests:
+		return e.Response.StatusCode == http.StatusTooManyRequests
+	case ErrNoContent:
+		return e.Response.StatusCode == http.StatusNoContent
+	}
+	return false
+}
+
+// ValidateResponse is the default Client.ResponseValidator. It rejects
+// responses without a 2xx status or with status 204 with a ResponseError, and
+// those of another
+// content type than text/event-stream with ErrUnacceptableContentType, so
+// error pages are not read as events. Responses without a content type are
+// accepted.
+func ValidateResponse(resp *http.Response) error {
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	if header := resp.Header.Get("Content-Type"); header != "" {
+		if mediaType, _, _ := mime.ParseMediaType(header); mediaType != ContentTypeEventStream {
+			return fmt.Errorf("%w: %s", ErrUnacceptableContentType, mediaType)
+		}
+	}
+	return nil
+}
+
+// checkStatus rejects responses without a 2xx status, and those with status
+// 204 No Content, which have no events
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || resp.StatusCode == http.StatusNoContent {
+		return newResponseError(resp)
+	}
+	return nil
+}
+
+// validateResponse checks the response to a subscription request with
+// ResponseValidator. Without one, the content type of clients setting Accept
+// is left to negotiate.
+func (c *Client) validateResponse(resp *http.Response) error {
+	switch {
+	case c.ResponseValidator != nil:
+		return c.ResponseValidator(resp)
+	case c.Accept != "":
+		return checkStatus(resp)
+	}
+	return ValidateResponse(resp)
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as a date
+// relative to now, capping it at maxRetryAfter
+func retryAfter(header string, now time.Time) time.Duration {
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		wait = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		wait = t.Sub(now)
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return min(wait, maxRetryAfter)
+}
@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResponseValidation(t *testing.T) {
+	Convey("Given a server answering with an error", t, func() {
+		status, contentType := http.StatusOK, "text/html"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(status)
+			fmt.Fprint(w, "data: <html>\n\n")
+		}))
+
+		Reset(func() {
+			server.Close()
+		})
+
+		c := NewClient(server.URL)
+		c.ShouldReconnect = func(err error, resp *http.Response) bool {
+			return false
+		}
+
+		Convey("Unauthorized responses should match ErrUnauthorized", func() {
+			status = http.StatusUnauthorized
+			err := c.SubscribeRaw(func(msg *Event) {})
+			So(errors.Is(err, ErrUnauthorized), ShouldBeTrue)
+			So(errors.Is(err, ErrTooManyRequests), ShouldBeFalse)
+		})
+
+		Convey("Throttled responses should carry when to try again", func() {
+			status = http.StatusTooManyRequests
+			err := c.SubscribeRaw(func(msg *Event) {})
+			So(errors.Is(err, ErrTooManyRequests), ShouldBeTrue)
+
+			var rejected *ResponseError
+			So(errors.As(err, &rejected), ShouldBeTrue)
+			So(rejected.Response.StatusCode, ShouldEqual, http.StatusTooManyRequests)
+			So(rejected.RetryAfter, ShouldEqual, 30*time.Second)
+		})
+
+		Convey("No content responses should end the subscription", func() {
+			status = http.StatusNoContent
+			c.ShouldReconnect = nil
+			attempts := 0
+			c.OnRetry = func(err error, next time.Duration) { attempts++ }
+			err := c.SubscribeRaw(func(msg *Event) {})
+			So(errors.Is(err, ErrNoContent), ShouldBeTrue)
+			So(attempts, ShouldEqual, 0)
+		})
+
+		Convey("Error pages should not be read as events", func() {
+			received := false
+			err := c.SubscribeRaw(func(msg *Event) { received = true })
+			So(errors.Is(err, ErrUnacceptableContentType), ShouldBeTrue)
+			So(received, ShouldBeFalse)
+
+			_, err = c.SubscribeChanRaw(make(chan *Event))
+			So(errors.Is(err, ErrUnacceptableContentType), ShouldBeTrue)
+		})
+
+		Convey("A validator of its own should decide instead", func() {
+			contentType = "text/plain"
+			c.ResponseValidator = checkStatus
+			events := make(chan *Event, 1)
+			c.SubscribeRaw(func(msg *Event) { events <- msg })
+			So(string((<-events).Data), ShouldEqual, "<html>")
+		})
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	Convey("Given the time now", t, func() {
+		now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		Convey("Dates should be taken relative to it", func() {
+			header := now.Add(time.Minute).Format(http.TimeFormat)
+			So(retryAfter(header, now), ShouldEqual, time.Minute)
+			So(retryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now), ShouldEqual, 0)
+		})
+
+		Convey("Long waits should be capped", func() {
+			So(retryAfter("86400", now), ShouldEqual, maxRetryAfter)
+			So(retryAfter(now.Add(24*time.Hour).Format(http.TimeFormat), now), ShouldEqual, maxRetryAfter)
+		})
+	})
+}
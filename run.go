@@ -0,0 +1,74 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrServerClosed is returned by Publish once the server has been closed
+var ErrServerClosed = errors.New("server closed")
+
+// Run blocks until ctx is done or the server is closed, so the server can be
+// managed alongside other components, such as with an errgroup. It then
+// closes the server and waits for the goroutines it started to return: those
+// of its streams, of the pooled dispatcher and those feeding streams, such as
+// from a StreamProvider.
+func (s *Server) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case <-s.closing():
+	}
+
+	s.Close()
+	s.workers.Wait()
+	return nil
+}
+
+// Shutdown closes the server like Close, sending subscribers GoAwayEvent if
+// ControlEvents is set, then waits for their connections to end and for the
+// goroutines started for streams to return. If ctx is done first, Shutdown
+// returns its error, and the connections end in the background.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.connections.Wait()
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closing returns a channel that is closed along with the server
+func (s *Server) closing() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.quit == nil {
+		s.quit = make(chan struct{})
+		if s.closed {
+			close(s.quit)
+		}
+	}
+	return s.quit
+}
+
+// background runs f in a goroutine Run waits for
+func (s *Server) background(f func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		f()
+	}()
+}
@@ -0,0 +1,217 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRun(t *testing.T) {
+	Convey("Given a running server", t, func() {
+		s := New()
+		s.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- s.Run(ctx)
+		}()
+
+		Reset(func() {
+			cancel()
+			server.Close()
+		})
+
+		Convey("It should close once its context is done", func() {
+			cancel()
+
+			select {
+			case err := <-done:
+				So(err, ShouldBeNil)
+				So(s.StreamExists("test"), ShouldBeFalse)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("It should return once the server is closed", func() {
+			s.Close()
+
+			select {
+			case err := <-done:
+				So(err, ShouldBeNil)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("A running client should return once its context is done", func() {
+			c := NewClient(server.URL)
+			clientCtx, stop := context.WithCancel(context.Background())
+			events := make(chan *Event, 1)
+			finished := make(chan error, 1)
+			go func() {
+				finished <- c.Run(clientCtx, "test", func(msg *Event) {
+					events <- msg
+				})
+			}()
+
+			for s.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+			s.Publish("test", &Event{Data: []byte("running")})
+			data, err := wait(events, time.Second)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "running")
+
+			stop()
+
+			select {
+			case err := <-finished:
+				So(err, ShouldBeNil)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+	})
+}
+
+// blockingStore holds up putting events until it is released
+type blockingStore struct {
+	putting chan bool
+	release chan bool
+}
+
+func (b *blockingStore) Put(stream string, e *Event) {
+	b.putting <- true
+	<-b.release
+}
+
+func (b *blockingStore) Range(stream, fromID string) ([]*Event, error) {
+	return nil, nil
+}
+
+func TestRunWaitsForStreams(t *testing.T) {
+	Convey("Given a running server storing an event", t, func() {
+		store := &blockingStore{putting: make(chan bool, 1), release: make(chan bool)}
+		s := New()
+		s.EventStore = store
+		s.CreateStream("test")
+		s.Publish("test", &Event{Data: []byte("stored")})
+		<-store.putting
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- s.Run(ctx)
+		}()
+
+		Convey("Run should not return before the event has been put", func() {
+			cancel()
+			select {
+			case <-done:
+				So("returned early", ShouldBeEmpty)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			close(store.release)
+			select {
+			case err := <-done:
+				So(err, ShouldBeNil)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	Convey("Given a server with a connected client", t, func() {
+		s := New()
+		s.ControlEvents = true
+		s.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.Close()
+		})
+
+		c := NewClient(server.URL)
+		controls := make(chan string, 1)
+		c.ControlEvents = map[string]ControlAction{GoAwayEvent: ControlStop}
+		c.OnControl = func(ev *Event) {
+			controls <- string(ev.Event)
+		}
+		go c.Subscribe("test", func(msg *Event) {})
+		for s.getStream("test").SubscriberCount() == 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		Convey("Shutdown should say goodbye and wait for the connection to end", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			So(s.Shutdown(ctx), ShouldBeNil)
+
+			select {
+			case name := <-controls:
+				So(name, ShouldEqual, GoAwayEvent)
+			case <-time.After(time.Second):
+				So("no goaway", ShouldBeEmpty)
+			}
+
+			Convey("Events published afterwards should be rejected", func() {
+				So(s.Publish("test", &Event{Data: []byte("late")}), ShouldEqual, ErrServerClosed)
+			})
+
+			Convey("New subscribers should be turned away", func() {
+				w := httptest.NewRecorder()
+				s.HTTPHandler(w, httptest.NewRequest(http.MethodGet, "/events?stream=test", nil))
+				So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+			})
+		})
+	})
+}
+
+func TestShutdownPooled(t *testing.T) {
+	Convey("Given a server with a pooled subscriber", t, func() {
+		s := New()
+		s.DispatchMode = DispatchPooled
+		s.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.Close()
+		})
+
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		_, err = io.WriteString(conn, "GET /?stream=test HTTP/1.1\r\nHost: test\r\n\r\n")
+		So(err, ShouldBeNil)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+		Convey("Shutdown should wait for the hijacked connection to be closed", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			So(s.Shutdown(ctx), ShouldBeNil)
+
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err := io.ReadAll(resp.Body)
+			So(err, ShouldBeNil)
+		})
+	})
+}
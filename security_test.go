@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	Convey("Given a server sending security headers", t, func() {
+		s := New()
+		headers := DefaultSecurityHeaders
+		s.SecurityHeaders = &headers
+
+		Reset(func() {
+			s.Close()
+		})
+
+		handlers := map[string]http.HandlerFunc{
+			"stream": s.HTTPHandler,
+			"ack":    s.AckHandler,
+			"health": s.HealthHandler,
+			"debug":  s.DebugHandler,
+		}
+
+		Convey("Every handler should send them, even with errors", func() {
+			for name, handler := range handlers {
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodGet, "/?stream=missing", nil))
+
+				So(name+" "+rec.Header().Get("X-Content-Type-Options"), ShouldEqual, name+" nosniff")
+				So(rec.Header().Get("Referrer-Policy"), ShouldEqual, "no-referrer")
+				So(rec.Header().Get("Content-Security-Policy"), ShouldEqual, DefaultSecurityHeaders.ContentSecurityPolicy)
+			}
+		})
+
+		Convey("Empty policies should not be sent", func() {
+			headers.ContentSecurityPolicy = ""
+			rec := httptest.NewRecorder()
+			s.HealthHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			So(rec.Header().Get("X-Content-Type-Options"), ShouldEqual, "nosniff")
+			So(rec.Header(), ShouldNotContainKey, "Content-Security-Policy")
+		})
+	})
+}
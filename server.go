@@ -5,8 +5,17 @@
 package sse
 
 import (
+	"context"
 	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
 )
 
 // DefaultBufferSize size of the queue that holds the streams messages.
@@ -19,59 +28,372 @@ type Server struct {
 	// Enables creation of a stream when a client connects
 	AutoStream bool
 	// Enables automatic replay for each new subscriber that connects
-	AutoReplay   bool
+	AutoReplay bool
+	// Delimits replayed events with control events, see Stream.ReplayMarkers
+	ReplayMarkers bool
+	// Bounds the eventlog of each stream, see Stream.ReplaySize
+	ReplaySize int
+	// Expires events in the eventlog of each stream, see Stream.ReplayTTL
+	ReplayTTL time.Duration
+	// Replays history in pages, see Stream.ReplayPageSize
+	ReplayPageSize     int
+	ReplayPageInterval time.Duration
+	// Limits the subscribers of each stream, see Stream.MaxSubscribers
+	MaxSubscribers int
+	// Interval of keep-alive comments on each stream, see Stream.KeepAlive
+	KeepAlive time.Duration
+	// Gives every stream a Limiter allowing this many events per second,
+	// with bursts of PublishBurst, see Stream.Limiter. Zero leaves streams
+	// unlimited.
+	PublishRate  rate.Limit
+	PublishBurst int
+	// What Publish does with events over PublishRate, see Stream.LimitPolicy
+	LimitPolicy LimitPolicy
+	// Limits the rate of live events sent to each subscriber, see
+	// Stream.SubscriberRate
+	SubscriberRate        rate.Limit
+	SubscriberBurst       int
+	SubscriberLimitPolicy LimitPolicy
+	// Sizes the queue of each subscriber, see Stream.SubscriberBuffer
+	SubscriberBuffer int
+	// What streams do with events for slow subscribers, see
+	// Stream.Backpressure
+	Backpressure Backpressure
+	// Observes the events slow subscribers miss, see Stream.OnDrop
+	OnDrop func(stream string, sub *Subscriber, event *Event)
+	// Origins allowed to subscribe from browsers, sent back in the
+	// Access-Control-Allow-Origin header when they match the request's
+	// Origin. A "*" entry allows any origin. Nil allows every origin.
+	AllowedOrigins []string
+	// Lets browsers send cookies and other credentials with cross-origin
+	// subscriptions from the origins listed in AllowedOrigins. Origins only
+	// allowed by nil or a "*" entry are never sent credentials.
+	AllowCredentials bool
+	// Keeps the ids events are published with, see Stream.KeepIDs
+	KeepIDs bool
+	// Generates the ids of events, see Stream.IDGenerator
+	IDGenerator  IDGenerator
 	EncodeBase64 bool
-	Streams      map[string]*Stream
-	mu           sync.Mutex
+	// Compresses the data of events with gzip before publishing them. The
+	// compressed data is binary, so it has to be combined with EncodeBase64
+	// or Keys, or events are rejected with ErrCompressWithoutBase64, and
+	// clients have to decompress it, see Client.DecompressData.
+	CompressData bool
+	// Encrypts the data of events, after compressing it if CompressData is
+	// set. The ciphertext is bound to the stream and the id of the event.
+	// Events that can not be encrypted are dropped and reported to OnError.
+	// Clients decrypt the data with the same keys, see Client.Keys.
+	Keys KeyProvider
+	// Signs every event written to subscribers with an HMAC over its id,
+	// name and data, sent in the SignatureField field, so clients with the
+	// same keys can reject events that were tampered with, see
+	// Client.SigningKeys. Signatures are computed for each subscriber.
+	SigningKeys KeyProvider
+	// Enables redelivery of unacknowledged events to reconnecting clients.
+	// HTTPHandler then takes POST requests with AckParameter as
+	// acknowledgements, see AckHandler.
+	TrackAcks bool
+	// Issues opaque resume cursors to clients in place of event ids
+	ResumeCursors bool
+	// Drops events published to streams without subscribers, see
+	// Stream.SkipUnwatched
+	SkipUnwatched bool
+	// Called with events dropped as their stream has no subscribers
+	OnNoSubscribers func(stream string, event *Event)
+	// Removes streams that have been idle for this long, see
+	// Stream.IdleTTL
+	IdleTTL time.Duration
+	// Called with every stream the server creates, such as for AutoStream,
+	// once it has started
+	OnStreamCreated func(id string, str *Stream)
+	// Called with the id of every stream removed with RemoveStream or for
+	// having been idle for IdleTTL, once its subscribers are disconnected
+	OnStreamRemoved func(id string)
+	// Called with every subscriber connecting through HTTPHandler, before
+	// anything is written to it, such as to record presence or to send it a
+	// Snapshot. The request it connected with is given by
+	// Subscriber.Request.
+	OnSubscribe func(stream string, sub *Subscriber)
+	// Called with every subscriber passed to OnSubscribe once its
+	// connection has ended
+	OnUnsubscribe func(stream string, sub *Subscriber)
+	// Makes streams read-only, see Stream.ReadOnly
+	ReadOnly bool
+	// Compresses the eventlog of each stream, see Stream.CompressReplay
+	CompressReplay bool
+	// Keeps the events of every stream for replay, see Stream.EventStore
+	EventStore EventStore
+	// Fetches the events a reconnecting client missed that are no longer
+	// in the eventlog, such as from a database. It is called with the
+	// context of the client's request, the id the client resumes from and
+	// the id of the first event in the eventlog, and returns the events in
+	// between, which are sent before the eventlog is replayed. Errors are
+	// reported to OnError, and the client then misses the events.
+	Backfill func(ctx context.Context, stream, from, until string) ([]*Event, error)
+	// Sends subscribers GoAwayEvent when the server is closed, and
+	// StreamClosedEvent when their stream is removed, which clients act on
+	// as set by Client.ControlEvents
+	ControlEvents bool
+	// Identifies this node to clients reconnecting through a load balancer.
+	// It is sent with every stream response as both the AffinityHeader
+	// header and the AffinityCookie cookie, and presented again by clients
+	// with Client.Affinity set, so the balancer can route them back here.
+	AffinityToken string
+	// Streams with more subscribers than this are reported as unavailable
+	// by HealthHandler. Zero means no limit.
+	MaxHealthySubscribers int
+	// Carries published events between servers sharing streams. Nil
+	// delivers events to the server's own streams.
+	Broker Broker
+	// Records which node owns each stream, for clusters sharding streams
+	// across nodes. Streams the server creates are claimed as NodeURL, and
+	// subscriptions to streams owned by another node are redirected there.
+	Registry Registry
+	// URL subscriptions to this node's streams are sent to, such as
+	// "http://10.0.0.1:8080/events", see Registry
+	NodeURL string
+	// Proxies subscriptions to streams owned by another node, instead of
+	// redirecting clients to it, for nodes clients can not reach directly
+	ProxyRemote bool
+	// Observes the delivery of events, such as to record traces and metrics
+	Instrumentation Instrumentation
+	// Keeps a debug log of the last events of each stream, see
+	// Stream.DebugSize and DebugHandler
+	DebugSize int
+	// Headers sent with every response, such as DefaultSecurityHeaders.
+	// Nil sends none.
+	SecurityHeaders *SecurityHeaders
+	// Adds headers of your own to the responses of subscriptions and
+	// preflight requests, after the server's, which it may replace
+	ResponseHeaders func(h http.Header, r *http.Request)
+	// Logs subscribers connecting and disconnecting at LevelInfo, and
+	// events that could not be delivered along with the errors reported to
+	// OnError at LevelWarn. Nil logs nothing.
+	Logger *slog.Logger
+	// Decides whether a client may connect to a stream, given its address
+	// as resolved by ClientIP. It guards every handler of the server, which
+	// pass an empty stream if they are not about a single one. Rejected
+	// clients get 403 Forbidden. Use IPList for allow and deny lists.
+	AllowIP func(ip net.IP, stream string) bool
+	// Resolves the address of clients for AllowIP, the remote address of
+	// their connection if nil. See ForwardedIP for clients behind proxies.
+	ClientIP func(r *http.Request) net.IP
+	// Decides whether a request may subscribe to a stream, before the
+	// stream is created for AutoStream, or acknowledge its events. Requests
+	// it returns an error for are rejected with 401 Unauthorized if the error
+	// wraps ErrUnauthorized, and with 403 Forbidden otherwise, without the
+	// error's text. See Stream.Authorize for single streams.
+	Authorize func(r *http.Request, stream string) error
+	// Receives a record of every event written to a subscriber, such as to
+	// prove which client received which event. Records are passed in
+	// batches of up to AuditBatchSize, at least every AuditInterval, from a
+	// single goroutine, and the batch is not used again once it returns.
+	// Deliveries do not wait for it, those it falls too far behind on go
+	// unrecorded, see AuditDropped. Close waits for the last batch.
+	Audit          func(records []AuditRecord)
+	AuditBatchSize int
+	AuditInterval  time.Duration
+	// Receives errors serving subscribers, such as responses that can not
+	// be flushed, and errors publishing events, for which r is nil
+	OnError func(r *http.Request, err error)
+	// Decides whether a request may publish to a stream through
+	// IngestHandler, which rejects every request while it is nil. Errors are
+	// answered like those of Authorize.
+	AuthorizeIngest func(r *http.Request, stream string) error
+	// Publishes the events posted to IngestHandler in place of Publish, such
+	// as to hand them to another system that delivers them back. Requests
+	// fail with 502 Bad Gateway at the first event it returns an error for.
+	Ingest func(stream string, event *Event) error
+	// Materializes streams that are requested but do not exist
+	Provider StreamProvider
+	// Selects how events are written to subscribers
+	DispatchMode DispatchMode
+	// Number of writers used when DispatchMode is DispatchPooled
+	DispatchWorkers int
+	// Decides whether a request may export, import or drain subscribers
+	// through HandoffHandler, which rejects every request while it is nil.
+	// Errors are answered like those of Authorize.
+	AuthorizeHandoff func(r *http.Request) error
+	// How long subscriber states passed to ImportSubscribers are kept for
+	// their clients to reconnect, DefaultHandoffTTL if zero
+	HandoffTTL time.Duration
+	// Stream served to requests that do not name one with the stream query
+	// parameter, such as those of Client.SubscribeRaw. It is not created
+	// automatically.
+	DefaultStream string
+	// Names the stream of requests, such as from their path with PathStream,
+	// or from the URL parameters of a router, in place of any stream query
+	// parameter. Requests it returns "" for are served the stream of their
+	// query parameter, or else DefaultStream.
+	StreamFromRequest func(r *http.Request) string
+	// Serves streams as newline-delimited JSON to requests preferring
+	// ContentTypeNDJSON in their Accept header, one object with id, event,
+	// data, retry and fields keys per event. Data that is not valid UTF-8 is
+	// base64 encoded and flagged by a base64 key. Comments are sent as empty
+	// lines.
+	NDJSON bool
+	// Splits data lines longer than this many bytes into several data fields,
+	// for intermediaries and clients that can not handle very long lines.
+	// Lines are only cut between UTF-8 encoded runes, but clients receive the
+	// parts joined by line breaks, so this only suits payloads where line
+	// breaks are insignificant. Zero leaves lines intact.
+	MaxLineLength int
+	Streams       map[string]*Stream
+	mu            sync.Mutex
+	dispatcher    *dispatcher
+	audit         *auditLog
+	auditDropped  atomic.Uint64
+	templates     map[string]StreamTemplate
+	acks          acknowledgements
+	handoffs      handoffs
+	epoch         int64
+	closed        bool
+	// Closed along with the server, see Run
+	quit chan struct{}
+	// Goroutines started for streams, see Run
+	workers sync.WaitGroup
+	// Requests being served by HTTPHandler and pooled connections, see
+	// Shutdown
+	connections sync.WaitGroup
+	// Source of time of the server and its streams, the system clock if nil
+	clock clock
 }
 
 // New will create a server and setup defaults
 func New() *Server {
 	return &Server{
-		BufferSize: DefaultBufferSize,
-		AutoStream: false,
-		AutoReplay: true,
-		Streams:    make(map[string]*Stream),
+		BufferSize:      DefaultBufferSize,
+		AutoStream:      false,
+		AutoReplay:      true,
+		DispatchWorkers: DefaultDispatchWorkers,
+		Streams:         make(map[string]*Stream),
+		epoch:           time.Now().UnixNano(),
 	}
 }
 
 // Close shuts down the server, closes all of the streams and connections
 func (s *Server) Close() {
+	// The audit log passes on its last batch once the lock is released, as
+	// Audit may call the server
+	var audit *auditLog
+	defer func() {
+		if audit != nil {
+			<-audit.done
+		}
+	}()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.quit != nil && !s.closed {
+		close(s.quit)
+	}
+	s.closed = true
+
 	for id := range s.Streams {
-		s.Streams[id].quit <- true
+		s.Streams[id].shutdown(GoAwayEvent)
 		delete(s.Streams, id)
 	}
+
+	if s.dispatcher != nil {
+		s.dispatcher.stop()
+		s.dispatcher = nil
+	}
+	if s.audit != nil {
+		audit = s.audit
+		s.audit.stop()
+		s.audit = nil
+	}
 }
 
 // CreateStream will create a new stream and register it
 func (s *Server) CreateStream(id string) *Stream {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.createStream(id, nil)
+}
 
-	if s.Streams[id] != nil {
-		return s.Streams[id]
+// createStream returns the stream with the given id, creating it if needed.
+// New streams are passed to configure before they are started.
+func (s *Server) createStream(id string, configure func(*Stream)) *Stream {
+	s.mu.Lock()
+	if str := s.Streams[id]; str != nil {
+		s.mu.Unlock()
+		return str
 	}
 
-	str := newStream(s.BufferSize, s.AutoReplay)
-	str.run()
+	str := s.newStream()
+	if configure != nil {
+		configure(str)
+	}
+	s.startStream(id, str)
+	s.mu.Unlock()
 
-	s.Streams[id] = str
+	if s.OnStreamCreated != nil {
+		s.OnStreamCreated(id, str)
+	}
+	return str
+}
 
+// newStream creates a stream configured with the server's settings
+func (s *Server) newStream() *Stream {
+	str := newStream(s.BufferSize, s.AutoReplay)
+	str.ReplayMarkers = s.ReplayMarkers
+	str.ReplaySize = s.ReplaySize
+	str.ReplayTTL = s.ReplayTTL
+	str.ReplayPageSize = s.ReplayPageSize
+	str.ReplayPageInterval = s.ReplayPageInterval
+	str.KeepIDs = s.KeepIDs
+	str.IDGenerator = s.IDGenerator
+	str.ControlEvents = s.ControlEvents
+	str.DebugSize = s.DebugSize
+	str.SkipUnwatched = s.SkipUnwatched
+	str.ReadOnly = s.ReadOnly
+	str.IdleTTL = s.IdleTTL
+	str.CompressReplay = s.CompressReplay
+	str.EventStore = s.EventStore
+	str.MaxSubscribers = s.MaxSubscribers
+	str.KeepAlive = s.KeepAlive
+	str.Limiter = newLimiter(s.PublishRate, s.PublishBurst)
+	str.LimitPolicy = s.LimitPolicy
+	str.SubscriberBuffer = s.SubscriberBuffer
+	str.SubscriberRate = s.SubscriberRate
+	str.SubscriberBurst = s.SubscriberBurst
+	str.SubscriberLimitPolicy = s.SubscriberLimitPolicy
+	str.Backpressure = s.Backpressure
+	str.OnDrop = s.OnDrop
+	str.clock = s.clock
 	return str
 }
 
 // RemoveStream will remove a stream
 func (s *Server) RemoveStream(id string) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	str := s.Streams[id]
+	if str != nil {
+		str.shutdown(StreamClosedEvent)
+		delete(s.Streams, id)
+	}
+	s.mu.Unlock()
+
+	if str != nil && s.OnStreamRemoved != nil {
+		s.OnStreamRemoved(id)
+	}
+}
 
-	if s.Streams[id] != nil {
-		s.Streams[id].close()
+// removeIdle removes a stream that has expired, unless it has been replaced or
+// removed already, or used since. Streams are only used with the lock held, see
+// activeStream, so it can not be used while being removed.
+func (s *Server) removeIdle(id string, str *Stream) {
+	s.mu.Lock()
+	current := s.Streams[id] == str && str.expired(clockOrSystem(str.clock).Now())
+	if current {
+		str.shutdown(StreamClosedEvent)
 		delete(s.Streams, id)
 	}
+	s.mu.Unlock()
+
+	if current && s.OnStreamRemoved != nil {
+		s.OnStreamRemoved(id)
+	}
 }
 
 // StreamExists checks whether a stream by a given id exists
@@ -82,13 +404,116 @@ func (s *Server) StreamExists(id string) bool {
 	return s.Streams[id] != nil
 }
 
-// Publish sends a mesage to every client in a streamID
-func (s *Server) Publish(id string, event *Event) {
+// Publish sends a mesage to every client in a streamID. With a Broker, the
+// event is handed to the broker instead, which delivers it to every server
+// holding the stream, and errors of the broker are returned. Otherwise
+// ErrStreamNotFound is returned for streams that do not exist. Events dropped
+// by LimitReject return ErrPublishRateExceeded, and events that can not be
+// compressed ErrCompressWithoutBase64. Once the server is closed, events are
+// dropped and ErrServerClosed is returned.
+//
+// The events of a stream are put in a single order, even when published by
+// several goroutines at once: concurrent calls are serialized, the stream
+// numbers events in that order, see Stream.Sequence, and every subscriber
+// receives them in that order. Events published by one goroutine keep the
+// order they were published in. Only priority events, see PublishPriority,
+// and keep-alive comments are sent out of order.
+func (s *Server) Publish(id string, event *Event) error {
+	if s.isClosed() {
+		return ErrServerClosed
+	}
+	if err := s.checkCompression(); err != nil {
+		return err
+	}
+	s.observePublish(id, event)
+
+	if str := s.getStream(id); str != nil {
+		if ok, err := s.throttle(id, str, event, func(ev *Event) { s.publish(id, ev) }); !ok {
+			return err
+		}
+	}
+	return s.enqueue(id, event, true)
+}
+
+// publish sends an event on once it has been admitted by the stream's Limiter
+func (s *Server) publish(id string, event *Event) {
+	s.enqueue(id, event, true)
+}
+
+// enqueue queues an event on its stream. It fails if the stream does not
+// exist, if wait is false and its queue is full, or if the broker failed to
+// publish it, which is also passed to OnError.
+func (s *Server) enqueue(id string, event *Event, wait bool) error {
+	if err := s.checkCompression(); err != nil {
+		return err
+	}
+	if s.Broker != nil {
+		if err := s.Broker.Publish(id, event); err != nil {
+			err = fmt.Errorf("failed to publish to stream %s: %w", id, err)
+			s.reportError(nil, err)
+			return err
+		}
+		return nil
+	}
+
+	if str := s.getStream(id); str != nil && s.unwatched(id, str, event) {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	str := s.Streams[id]
+	if str == nil {
+		return ErrStreamNotFound
+	}
+	// Events are only queued with the lock held, so the queue can not fill
+	// up between checking it and sending
+	queue := str.queue(event)
+	if !wait && len(queue) == cap(queue) {
+		return errQueueFull
+	}
+	str.touch(clockOrSystem(str.clock).Now())
+	queue <- s.process(event)
+	return nil
+}
+
+// HasSubscribers reports whether a stream exists and has subscribers, such
+// as to skip building events nobody would receive
+func (s *Server) HasSubscribers(id string) bool {
+	str := s.getStream(id)
+	return str != nil && str.HasSubscribers()
+}
+
+// unwatched reports whether an event is dropped as nobody is subscribed to its
+// stream, see Stream.SkipUnwatched
+func (s *Server) unwatched(id string, str *Stream, event *Event) bool {
+	if !str.SkipUnwatched || str.HasSubscribers() {
+		return false
+	}
+	if s.OnNoSubscribers != nil {
+		s.OnNoSubscribers(id, event)
+	}
+	return true
+}
+
+// enter counts a new connection towards those Shutdown waits for, reporting
+// false once the server has been closed
+func (s *Server) enter() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.Streams[id] != nil {
-		s.Streams[id].event <- s.process(event)
+
+	if s.closed {
+		return false
 	}
+	s.connections.Add(1)
+	return true
+}
+
+// isClosed reports whether the server has been closed
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
 }
 
 func (s *Server) getStream(id string) *Stream {
@@ -97,11 +522,53 @@ func (s *Server) getStream(id string) *Stream {
 	return s.Streams[id]
 }
 
+// activeStream returns a stream that is about to be subscribed to, marking it
+// as active, so it is not removed as idle meanwhile
+func (s *Server) activeStream(id string) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	str := s.Streams[id]
+	if str != nil {
+		str.touch(clockOrSystem(str.clock).Now())
+	}
+	return str
+}
+
 func (s *Server) process(event *Event) *Event {
+	processed := *event
+	if s.CompressData && len(processed.Data) > 0 {
+		processed.Data = compressData(processed.Data)
+	}
+	// Encrypted data is encoded once it has been sealed
+	if s.EncodeBase64 && s.Keys == nil {
+		processed.Data = encodeBase64(processed.Data)
+	}
+	return &processed
+}
+
+// seal encrypts the data of an event processed for a stream, binding the
+// ciphertext to the stream and the event's id, so it can not be passed off
+// as another event. It is applied once the stream has given the event its id.
+func (s *Server) seal(stream string, event *Event) error {
+	if s.Keys == nil {
+		return nil
+	}
+	if len(event.Data) > 0 {
+		data, err := sealData(s.Keys, event.Data, sealedAAD(stream, event.ID))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt event message: %w", err)
+		}
+		event.Data = data
+	}
 	if s.EncodeBase64 {
-		output := make([]byte, base64.StdEncoding.EncodedLen(len(event.Data)))
-		base64.StdEncoding.Encode(output, event.Data)
-		event.Data = output
+		event.Data = encodeBase64(event.Data)
 	}
-	return event
+	return nil
+}
+
+func encodeBase64(data []byte) []byte {
+	output := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(output, data)
+	return output
 }
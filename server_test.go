@@ -35,7 +35,7 @@ func TestServer(t *testing.T) {
 			s.CreateStream("test")
 
 			Convey("It should be stored", func() {
-				So(s.getStream("test"), ShouldNotBeNil)
+				So(s.getStream("test") != nil, ShouldBeTrue)
 			})
 			Convey("It should be started", func() {
 			})
@@ -46,7 +46,7 @@ func TestServer(t *testing.T) {
 			s.CreateStream("test")
 
 			Convey("It should still be stored", func() {
-				So(s.getStream("test"), ShouldNotBeNil)
+				So(s.getStream("test") != nil, ShouldBeTrue)
 			})
 			Convey("The number of goroutines should not increase", func() {
 				So(runtime.NumGoroutine(), ShouldEqual, numGoRoutines)
@@ -58,7 +58,7 @@ func TestServer(t *testing.T) {
 			s.RemoveStream("test")
 
 			Convey("It should be removed", func() {
-				So(s.getStream("test"), ShouldBeNil)
+				So(s.getStream("test") == nil, ShouldBeTrue)
 			})
 		})
 
@@ -84,10 +84,15 @@ func TestServer(t *testing.T) {
 
 		Convey("When publishing to a stream that doesnt exist", func() {
 			s.Publish("test", &Event{Data: []byte("test")})
-			Convey("It must not cause an error", func() {
+			Convey("It must not panic", func() {
 				So(func() { s.Publish("test", &Event{Data: []byte("test")}) }, ShouldNotPanic)
 			})
 
+			Convey("It must return ErrStreamNotFound", func() {
+				So(s.Publish("missing", &Event{Data: []byte("test")}), ShouldEqual, ErrStreamNotFound)
+				So(s.PublishPriority("missing", &Event{Data: []byte("test")}), ShouldEqual, ErrStreamNotFound)
+			})
+
 		})
 	})
 
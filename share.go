@@ -0,0 +1,211 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// sharedConnection fans the events of one connection out to several channels,
+// see Client.ShareConnections
+type sharedConnection struct {
+	key      string
+	upstream chan *Event
+	closer   io.Closer
+
+	mu     sync.Mutex
+	locals []*sharedLocal
+	closed bool
+}
+
+// sharedLocal is a channel subscribed to a shared connection
+type sharedLocal struct {
+	conn *sharedConnection
+	ch   chan *Event
+	// Closed on unsubscribing, to abandon a send in progress
+	quit chan bool
+	once sync.Once
+	// Deliveries to ch, see Client.ChanStats
+	stats *chanStats
+
+	// mu is held while an event is sent, so ch is never closed during a
+	// send
+	mu     sync.Mutex
+	closed bool
+}
+
+// send passes an event on to the channel, unless it has been closed
+func (l *sharedLocal) send(msg *Event, policy ChanOverflow) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		l.stats.send(l.ch, msg, policy, l.quit, nil)
+	}
+}
+
+// close closes the channel once any send in progress has ended
+func (l *sharedLocal) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		l.closed = true
+		close(l.ch)
+	}
+}
+
+// subscribeShared subscribes a channel to the shared connection for a stream,
+// opening it if there is none. The channel is detached once ctx is done, while
+// the connection stays open for the others.
+func (c *Client) subscribeShared(ctx context.Context, stream string, ch chan *Event) (io.Closer, error) {
+	c.sharedMu.Lock()
+	defer c.sharedMu.Unlock()
+
+	key := c.URL + "\x00" + stream
+	conn := c.shared[key]
+	if conn == nil {
+		conn = &sharedConnection{key: key, upstream: make(chan *Event)}
+		closer, err := c.subscribeChan(context.Background(), c.position(), stream, conn.upstream, ChanBlock, &chanStats{}, nil)
+		if err != nil {
+			return nil, err
+		}
+		conn.closer = closer
+
+		if c.shared == nil {
+			c.shared = make(map[string]*sharedConnection)
+		}
+		c.shared[key] = conn
+		go c.fanOut(conn)
+	}
+
+	local := &sharedLocal{conn: conn, ch: ch, quit: make(chan bool), stats: c.trackChan(ch)}
+	conn.mu.Lock()
+	conn.locals = append(conn.locals, local)
+	conn.mu.Unlock()
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.detach(local)
+			case <-local.quit:
+			}
+		}()
+	}
+
+	return closerFunc(func() error {
+		c.detach(local)
+		return nil
+	}), nil
+}
+
+// fanOut sends every event of a shared connection to each of its channels,
+// closing them once the connection ends. Sends happen without holding the
+// connection's lock, so a slow channel does not hold up channels attaching or
+// detaching.
+func (c *Client) fanOut(conn *sharedConnection) {
+	for ev := range conn.upstream {
+		conn.mu.Lock()
+		locals := append([]*sharedLocal(nil), conn.locals...)
+		conn.mu.Unlock()
+
+		for i, local := range locals {
+			msg := ev
+			if i > 0 {
+				// Every channel gets an event of its own to modify
+				msg = ev.Clone()
+			}
+			local.send(msg, c.ChanOverflow)
+		}
+	}
+
+	c.sharedMu.Lock()
+	if c.shared[conn.key] == conn {
+		delete(c.shared, conn.key)
+	}
+	c.sharedMu.Unlock()
+
+	conn.mu.Lock()
+	locals := conn.locals
+	conn.locals = nil
+	conn.closed = true
+	conn.mu.Unlock()
+
+	for _, local := range locals {
+		local.close()
+	}
+}
+
+// detach unsubscribes a channel from its shared connection, closing the
+// connection once no channel is left
+func (c *Client) detach(local *sharedLocal) {
+	local.once.Do(func() {
+		close(local.quit)
+
+		c.sharedMu.Lock()
+		conn := local.conn
+		conn.mu.Lock()
+		if conn.closed {
+			conn.mu.Unlock()
+			c.sharedMu.Unlock()
+			return
+		}
+
+		for i, other := range conn.locals {
+			if other == local {
+				conn.locals = append(conn.locals[:i], conn.locals[i+1:]...)
+				break
+			}
+		}
+
+		last := len(conn.locals) == 0
+		if last && c.shared[conn.key] == conn {
+			// Later subscriptions open a new connection
+			delete(c.shared, conn.key)
+		}
+		conn.mu.Unlock()
+		c.sharedMu.Unlock()
+
+		// Quit has abandoned any send in progress
+		local.close()
+		if last {
+			conn.closer.Close()
+		}
+	})
+}
+
+// unsubscribeShared detaches a channel subscribed to a shared connection,
+// reporting false if it is not
+func (c *Client) unsubscribeShared(ch chan *Event) bool {
+	c.sharedMu.Lock()
+	var found *sharedLocal
+	for _, conn := range c.shared {
+		conn.mu.Lock()
+		for _, local := range conn.locals {
+			if local.ch == ch {
+				found = local
+			}
+		}
+		conn.mu.Unlock()
+	}
+	c.sharedMu.Unlock()
+
+	if found == nil {
+		return false
+	}
+	c.detach(found)
+	c.untrackChan(ch)
+	return true
+}
+
+// closerFunc adapts a function to io.Closer
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,110 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSharedConnections(t *testing.T) {
+	Convey("Given a client sharing connections", t, func() {
+		srv := New()
+		srv.AutoReplay = false
+		srv.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		c := NewClient(server.URL)
+		c.ShareConnections = true
+
+		subscribers := func() int {
+			return srv.getStream("test").SubscriberCount()
+		}
+		waitFor := func(n int) {
+			deadline := time.Now().Add(time.Second)
+			for subscribers() != n && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond * 10)
+			}
+			So(subscribers(), ShouldEqual, n)
+		}
+		receive := func(ch chan *Event) string {
+			select {
+			case ev := <-ch:
+				return string(ev.Data)
+			case <-time.After(time.Second):
+				return "timeout"
+			}
+		}
+
+		first, second := make(chan *Event), make(chan *Event)
+		closeFirst, err := c.SubscribeChan("test", first)
+		So(err, ShouldBeNil)
+		closeSecond, err := c.SubscribeChan("test", second)
+		So(err, ShouldBeNil)
+
+		Convey("Channels for the same stream should share one connection", func() {
+			waitFor(1)
+
+			srv.Publish("test", &Event{Data: []byte("hello")})
+			So(receive(first), ShouldEqual, "hello")
+			So(receive(second), ShouldEqual, "hello")
+		})
+
+		Convey("A channel not being read should not hold up others", func() {
+			waitFor(1)
+			srv.Publish("test", &Event{Data: []byte("hello")})
+
+			attached := make(chan error, 1)
+			go func() {
+				_, err := c.SubscribeChan("test", make(chan *Event, 1))
+				attached <- err
+			}()
+			select {
+			case err := <-attached:
+				So(err, ShouldBeNil)
+			case <-time.After(time.Second):
+				So("blocked", ShouldBeEmpty)
+			}
+
+			closeFirst.Close()
+			So(receive(second), ShouldEqual, "hello")
+		})
+
+		Convey("The connection should stay open until every channel is closed", func() {
+			waitFor(1)
+			So(closeFirst.Close(), ShouldBeNil)
+
+			_, open := <-first
+			So(open, ShouldBeFalse)
+
+			srv.Publish("test", &Event{Data: []byte("still here")})
+			So(receive(second), ShouldEqual, "still here")
+
+			c.Unsubscribe(second)
+			waitFor(0)
+			_, open = <-second
+			So(open, ShouldBeFalse)
+		})
+
+		Convey("Channels should be closed when the connection ends", func() {
+			waitFor(1)
+			srv.RemoveStream("test")
+
+			_, open := <-first
+			So(open, ShouldBeFalse)
+			_, open = <-second
+			So(open, ShouldBeFalse)
+			So(closeSecond.Close(), ShouldBeNil)
+		})
+
+		Reset(func() {
+			srv.Close()
+		})
+	})
+}
@@ -0,0 +1,180 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// SignatureField is the name of the field carrying the signature of an event
+const SignatureField = "sig"
+
+// ErrInvalidSignature is reported for events whose signature is missing or
+// does not match, which are dropped
+var ErrInvalidSignature = errors.New("invalid event signature")
+
+// eventMAC returns an HMAC-SHA256 over the id, name and retry of an event and
+// the SHA-256 digest of its data. The fields are length prefixed, so the
+// boundaries between them can not be moved. The data is hashed on its own, as
+// clients streaming it only learn of fields sent after it, such as retry, once
+// it has been read.
+func eventMAC(key []byte, ev *Event, digest []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	var n [binary.MaxVarintLen64]byte
+	for _, field := range [][]byte{ev.ID, ev.Event, ev.Retry} {
+		mac.Write(n[:binary.PutUvarint(n[:], uint64(len(field)))])
+		mac.Write(field)
+	}
+	mac.Write(digest)
+	return mac.Sum(nil)
+}
+
+// signEvent returns the signature of an event, of the form
+// <key id>.<base64url of the HMAC>. The data is signed the way clients will
+// receive it: lines split by maxLine and line breaks normalized to "\n".
+func signEvent(keys KeyProvider, ev *Event, maxLine int) ([]byte, error) {
+	id, key, err := keys.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(id, ".") {
+		return nil, fmt.Errorf("signing key id %q contains a dot", id)
+	}
+
+	digest := sha256.New()
+	sep := false
+	for data := ev.Data; len(data) > 0; {
+		line, rest := splitLine(data)
+		for maxLine > 0 && len(line) > maxLine {
+			i := cutLine(line, maxLine)
+			sep = writeLine(digest, line[:i], sep)
+			line = line[i:]
+		}
+		sep = writeLine(digest, line, sep)
+		data = rest
+	}
+
+	sum := eventMAC(key, ev, digest.Sum(nil))
+	out := make([]byte, len(id)+1+base64.RawURLEncoding.EncodedLen(len(sum)))
+	copy(out, id)
+	out[len(id)] = '.'
+	base64.RawURLEncoding.Encode(out[len(id)+1:], sum)
+	return out, nil
+}
+
+// writeLine writes a data line, preceded by "\n" unless it is the first
+func writeLine(w io.Writer, line []byte, sep bool) bool {
+	if sep {
+		w.Write(newline)
+	}
+	w.Write(line)
+	return true
+}
+
+// signer adds a signature to every event written to a subscriber, after any
+// other rewriting. Comments on their own are not dispatched by clients, so
+// they are left unsigned. Events that can not be signed are sent as they are,
+// and will be rejected by clients.
+func (s *Server) signer(r *http.Request, prepare func(*Event) *Event, maxLine int) func(*Event) *Event {
+	return func(ev *Event) *Event {
+		if prepare != nil {
+			ev = prepare(ev)
+		}
+		if isCommentOnly(ev) {
+			return ev
+		}
+
+		sig, err := signEvent(s.SigningKeys, ev, maxLine)
+		if err != nil {
+			s.reportError(r, fmt.Errorf("failed to sign event: %s", err))
+			return ev
+		}
+
+		out := *ev
+		out.Fields = make(map[string][]byte, len(ev.Fields)+1)
+		for name, value := range ev.Fields {
+			out.Fields[name] = value
+		}
+		out.Fields[SignatureField] = sig
+		return &out
+	}
+}
+
+// signatureKey checks the key id of a signature, returning the key and the
+// expected sum
+func signatureKey(keys KeyProvider, ev *Event) ([]byte, []byte, error) {
+	sig := ev.Fields[SignatureField]
+	dot := bytes.IndexByte(sig, '.')
+	if dot < 0 {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	key, err := keys.DecryptionKey(string(sig[:dot]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+
+	encoded := sig[dot+1:]
+	sum := make([]byte, base64.RawURLEncoding.DecodedLen(len(encoded)))
+	if _, err := base64.RawURLEncoding.Decode(sum, encoded); err != nil {
+		return nil, nil, ErrInvalidSignature
+	}
+	return key, sum, nil
+}
+
+// verifyEvent checks the signature of an event as it was received, before its
+// data is decoded
+func verifyEvent(keys KeyProvider, ev *Event) error {
+	key, sum, err := signatureKey(keys, ev)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(ev.Data)
+	if !hmac.Equal(eventMAC(key, ev, digest[:]), sum) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// verifyReader checks the signature of streamed data once it has been read
+// in full, returning ErrInvalidSignature instead of io.EOF if it does not
+// match. The event's fields sent after the data are known by then.
+type verifyReader struct {
+	src    io.Reader
+	ev     *Event
+	key    []byte
+	digest hash.Hash
+	sum    []byte
+	err    error
+}
+
+func newVerifyReader(keys KeyProvider, ev *Event, src io.Reader) io.Reader {
+	key, sum, err := signatureKey(keys, ev)
+	return &verifyReader{src: src, ev: ev, key: key, digest: sha256.New(), sum: sum, err: err}
+}
+
+func (v *verifyReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+
+	n, err := v.src.Read(p)
+	v.digest.Write(p[:n])
+	if err == io.EOF && !hmac.Equal(eventMAC(v.key, v.ev, v.digest.Sum(nil)), v.sum) {
+		err = ErrInvalidSignature
+		v.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,165 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSignedEvents(t *testing.T) {
+	key := StaticKey{ID: "k1", Key: []byte("signing key")}
+
+	Convey("Given an event signed with a key", t, func() {
+		ev := &Event{ID: []byte("1"), Event: []byte("update"), Data: []byte("line 1\r\nline 2"), Retry: []byte("1000")}
+		sig, err := signEvent(key, ev, 0)
+		So(err, ShouldBeNil)
+		So(string(sig), ShouldStartWith, "k1.")
+
+		var buf bytes.Buffer
+		writeEvent(&buf, &Event{ID: ev.ID, Event: ev.Event, Data: ev.Data, Retry: ev.Retry, Fields: map[string][]byte{SignatureField: sig}}, 0)
+		p := &eventParser{verify: key, fields: fieldParser{signed: true}}
+
+		Convey("It should verify as received", func() {
+			received, err := p.parse(bytes.TrimSpace(buf.Bytes()))
+			So(err, ShouldBeNil)
+			So(string(received.Data), ShouldEqual, "line 1\nline 2")
+		})
+
+		Convey("It should not verify once the data is changed", func() {
+			frame := bytes.Replace(buf.Bytes(), []byte("line 2"), []byte("line 3"), 1)
+			_, err := p.parse(bytes.TrimSpace(frame))
+			So(err, ShouldEqual, ErrInvalidSignature)
+		})
+
+		Convey("It should not verify once the id is changed", func() {
+			frame := bytes.Replace(buf.Bytes(), []byte("id: 1"), []byte("id: 2"), 1)
+			_, err := p.parse(bytes.TrimSpace(frame))
+			So(err, ShouldEqual, ErrInvalidSignature)
+		})
+
+		Convey("It should not verify once the retry is changed", func() {
+			frame := bytes.Replace(buf.Bytes(), []byte("retry: 1000"), []byte("retry: 99999"), 1)
+			_, err := p.parse(bytes.TrimSpace(frame))
+			So(err, ShouldEqual, ErrInvalidSignature)
+		})
+
+		Convey("It should not verify with an unknown key", func() {
+			p.verify = StaticKey{ID: "k2", Key: key.Key}
+			_, err := p.parse(bytes.TrimSpace(buf.Bytes()))
+			So(errors.Is(err, ErrInvalidSignature), ShouldBeTrue)
+		})
+
+		Convey("Events without a signature should be rejected", func() {
+			_, err := p.parse([]byte("data: unsigned"))
+			So(err, ShouldEqual, ErrInvalidSignature)
+		})
+
+		Convey("Split data lines should verify as joined", func() {
+			sig, _ := signEvent(key, ev, 3)
+			var split bytes.Buffer
+			writeEvent(&split, &Event{ID: ev.ID, Event: ev.Event, Data: ev.Data, Retry: ev.Retry, Fields: map[string][]byte{SignatureField: sig}}, 3)
+			_, err := p.parse(bytes.TrimSpace(split.Bytes()))
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given a server signing events", t, func() {
+		srv := New()
+		srv.AutoReplay = false
+		srv.EncodeBase64 = true
+		srv.SigningKeys = key
+		srv.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		c := NewClient(server.URL)
+		c.EncodingBase64 = true
+		c.SigningKeys = key
+
+		publish := func() {
+			for srv.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+			srv.Publish("test", &Event{Data: []byte("signed"), Retry: []byte("1000")})
+		}
+
+		Reset(func() {
+			srv.Close()
+		})
+
+		Convey("Subscribe should pass handlers verified events", func() {
+			events := make(chan *Event, 1)
+			go c.Subscribe("test", func(msg *Event) {
+				events <- msg
+			})
+			publish()
+
+			select {
+			case msg := <-events:
+				So(string(msg.Data), ShouldEqual, "signed")
+				So(msg.Fields, ShouldContainKey, SignatureField)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("SubscribeReader should stream verified data", func() {
+			data := make(chan []byte, 1)
+			go c.SubscribeReader("test", func(ev *EventReader) {
+				b, _ := io.ReadAll(ev)
+				data <- b
+			})
+			publish()
+
+			select {
+			case b := <-data:
+				So(string(b), ShouldEqual, "signed")
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("A client with another key should reject the events", func() {
+			errs := make(chan error, 1)
+			c.SigningKeys = StaticKey{ID: "k1", Key: []byte("other key")}
+			c.OnError = func(err error, raw []byte) {
+				errs <- err
+			}
+			go c.Subscribe("test", func(msg *Event) {})
+			publish()
+
+			select {
+			case err := <-errs:
+				So(err, ShouldEqual, ErrInvalidSignature)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("SubscribeReader should fail reading tampered data", func() {
+			c.SigningKeys = StaticKey{ID: "k1", Key: []byte("other key")}
+			errs := make(chan error, 1)
+			go c.SubscribeReader("test", func(ev *EventReader) {
+				_, err := io.ReadAll(ev)
+				errs <- err
+			})
+			publish()
+
+			select {
+			case err := <-errs:
+				So(err, ShouldEqual, ErrInvalidSignature)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+	})
+}
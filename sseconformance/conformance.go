@@ -0,0 +1,200 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package sseconformance provides canonical event stream frames and the events
+// they represent, for checking that parsers and encoders interoperate with
+// this package. Adapter and server authors can run RunDecodeTests and
+// RunEncodeTests from their own tests.
+package sseconformance
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/r3labs/sse"
+)
+
+// DecodeCase is a stream and the events a conforming parser dispatches for it
+type DecodeCase struct {
+	Name   string
+	Stream string
+	Events []sse.Event
+}
+
+// EncodeCase is an event and its canonical encoding
+type EncodeCase struct {
+	Name   string
+	Event  sse.Event
+	Output string
+}
+
+// DecodeFunc parses a complete stream, returning the events it dispatches
+type DecodeFunc func(stream []byte) ([]*sse.Event, error)
+
+// EncodeFunc encodes a single event, including its terminating blank line
+type EncodeFunc func(ev *sse.Event) ([]byte, error)
+
+// DecodeCases lists the canonical streams. Comments are not compared, since
+// parsers are free to discard them.
+var DecodeCases = []DecodeCase{
+	{
+		Name:   "single data field",
+		Stream: "data: hello\n\n",
+		Events: []sse.Event{{Data: []byte("hello")}},
+	},
+	{
+		Name:   "multiple data fields",
+		Stream: "data: first\ndata: second\ndata: third\n\n",
+		Events: []sse.Event{{Data: []byte("first\nsecond\nthird")}},
+	},
+	{
+		Name:   "no space after colon",
+		Stream: "data:hello\n\n",
+		Events: []sse.Event{{Data: []byte("hello")}},
+	},
+	{
+		Name:   "only the first space is removed",
+		Stream: "data:  hello\n\n",
+		Events: []sse.Event{{Data: []byte(" hello")}},
+	},
+	{
+		Name:   "colon in value",
+		Stream: "data: key: value\n\n",
+		Events: []sse.Event{{Data: []byte("key: value")}},
+	},
+	{
+		Name:   "all fields",
+		Stream: "id: 1\nevent: update\nretry: 1000\ndata: hello\n\n",
+		Events: []sse.Event{{ID: []byte("1"), Event: []byte("update"), Retry: []byte("1000"), Data: []byte("hello")}},
+	},
+	{
+		Name:   "last field wins",
+		Stream: "id: 1\nid: 2\nevent: first\nevent: second\ndata: hello\n\n",
+		Events: []sse.Event{{ID: []byte("2"), Event: []byte("second"), Data: []byte("hello")}},
+	},
+	{
+		Name:   "id containing NUL is ignored",
+		Stream: "id: 1\nid: 2\x003\ndata: hello\n\n",
+		Events: []sse.Event{{ID: []byte("1"), Data: []byte("hello")}},
+	},
+	{
+		Name:   "empty data field",
+		Stream: "data\n\n",
+		Events: []sse.Event{{Data: []byte{}}},
+	},
+	{
+		Name:   "field without colon has an empty value",
+		Stream: "event: update\nevent\nid: 1\nid\ndata\ndata\n\n",
+		Events: []sse.Event{{ID: []byte{}, Event: []byte{}, Data: []byte("\n")}},
+	},
+	{
+		Name:   "field with colon and no value",
+		Stream: "event: update\nevent:\ndata:\n\n",
+		Events: []sse.Event{{Event: []byte{}, Data: []byte{}}},
+	},
+	{
+		Name:   "field names must match exactly",
+		Stream: "data: hello\ndatum: ignored\nids: ignored\nEvent: ignored\n\n",
+		Events: []sse.Event{{Data: []byte("hello")}},
+	},
+	{
+		Name:   "comments and unknown fields are ignored",
+		Stream: ": comment\nunknown: field\ndata: hello\n\n",
+		Events: []sse.Event{{Data: []byte("hello")}},
+	},
+	{
+		Name:   "crlf line endings",
+		Stream: "data: first\r\ndata: second\r\n\r\n",
+		Events: []sse.Event{{Data: []byte("first\nsecond")}},
+	},
+	{
+		Name:   "cr line endings",
+		Stream: "data: first\rdata: second\r\r",
+		Events: []sse.Event{{Data: []byte("first\nsecond")}},
+	},
+	{
+		Name:   "multiple events",
+		Stream: "data: first\n\ndata: second\n\n",
+		Events: []sse.Event{{Data: []byte("first")}, {Data: []byte("second")}},
+	},
+	{
+		Name:   "incomplete final event is discarded",
+		Stream: "data: first\n\ndata: second",
+		Events: []sse.Event{{Data: []byte("first")}},
+	},
+}
+
+// EncodeCases lists events and their canonical encoding
+var EncodeCases = []EncodeCase{
+	{
+		Name:   "data",
+		Event:  sse.Event{Data: []byte("hello")},
+		Output: "data: hello\n\n",
+	},
+	{
+		Name:   "all fields",
+		Event:  sse.Event{ID: []byte("1"), Event: []byte("update"), Data: []byte("hello"), Retry: []byte("1000")},
+		Output: "id: 1\nevent: update\ndata: hello\nretry: 1000\n\n",
+	},
+	{
+		Name:   "multi-line data",
+		Event:  sse.Event{Data: []byte("first\nsecond\r\nthird")},
+		Output: "data: first\ndata: second\ndata: third\n\n",
+	},
+	{
+		Name:   "comment",
+		Event:  sse.Event{Comment: []byte("note"), Data: []byte("hello")},
+		Output: ": note\ndata: hello\n\n",
+	},
+}
+
+// RunDecodeTests checks a parser against every DecodeCase
+func RunDecodeTests(t *testing.T, decode DecodeFunc) {
+	for _, c := range DecodeCases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			events, err := decode([]byte(c.Stream))
+			if err != nil {
+				t.Fatalf("decoding %q failed: %s", c.Stream, err)
+			}
+
+			if len(events) != len(c.Events) {
+				t.Fatalf("decoding %q returned %d events, expected %d", c.Stream, len(events), len(c.Events))
+			}
+
+			for i := range events {
+				if !equal(events[i], &c.Events[i]) {
+					t.Errorf("event %d of %q is %+v, expected %+v", i, c.Stream, events[i], c.Events[i])
+				}
+			}
+		})
+	}
+}
+
+// RunEncodeTests checks an encoder against every EncodeCase
+func RunEncodeTests(t *testing.T, encode EncodeFunc) {
+	for _, c := range EncodeCases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			out, err := encode(&c.Event)
+			if err != nil {
+				t.Fatalf("encoding failed: %s", err)
+			}
+
+			if string(out) != c.Output {
+				t.Errorf("encoded as %q, expected %q", out, c.Output)
+			}
+		})
+	}
+}
+
+// equal compares the dispatched fields of two events. Data is compared
+// including whether it is present at all.
+func equal(a, b *sse.Event) bool {
+	return bytes.Equal(a.ID, b.ID) &&
+		bytes.Equal(a.Event, b.Event) &&
+		bytes.Equal(a.Retry, b.Retry) &&
+		bytes.Equal(a.Data, b.Data) &&
+		(a.Data == nil) == (b.Data == nil)
+}
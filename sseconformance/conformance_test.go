@@ -0,0 +1,43 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sseconformance
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/r3labs/sse"
+)
+
+func decode(stream []byte) ([]*sse.Event, error) {
+	var events []*sse.Event
+
+	dec := sse.NewDecoder(bytes.NewReader(stream))
+	for {
+		ev, err := dec.Decode()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Only events with data or a name are dispatched
+		if ev.Data != nil || len(ev.Event) > 0 {
+			events = append(events, ev)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	RunDecodeTests(t, decode)
+}
+
+func TestEncoder(t *testing.T) {
+	RunEncodeTests(t, func(ev *sse.Event) ([]byte, error) {
+		return ev.MarshalText()
+	})
+}
@@ -0,0 +1,89 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package ssehttp3 lets sse clients subscribe over HTTP/3, so streams sharing
+// a connection do not block each other when packets are lost.
+//
+//	client := sse.NewClient("https://example.com/events")
+//	transport := ssehttp3.Configure(client, nil)
+//	defer transport.Close()
+//
+// Events are read from the stream of the request as they arrive. A stream
+// ended by the server ends the subscription, as with HTTP/1.1 and HTTP/2,
+// while a stream reset by the server or a lost connection is an error, after
+// which the client reconnects with its usual backoff. HTTP/3 requires https
+// URLs, and the TCP options of the client do not apply.
+package ssehttp3
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/r3labs/sse"
+)
+
+// DefaultKeepAlive is the interval between QUIC keep-alive packets. They keep
+// the connections of quiet streams from reaching the idle timeout, and NAT
+// bindings from expiring, which happens after 30 seconds on some networks.
+const DefaultKeepAlive = 15 * time.Second
+
+// DefaultIdleTimeout is how long a connection may go without receiving any
+// packets, keep-alives included, before it is considered lost
+const DefaultIdleTimeout = 45 * time.Second
+
+// Transport is an http.RoundTripper sending requests over HTTP/3
+type Transport struct {
+	*http3.Transport
+}
+
+// NewTransport returns a transport suited to event streams, which sends
+// keep-alives on idle connections. A nil tlsConfig uses the default
+// configuration.
+func NewTransport(tlsConfig *tls.Config) *Transport {
+	return &Transport{Transport: &http3.Transport{
+		TLSClientConfig: tlsConfig,
+		QUICConfig: &quic.Config{
+			KeepAlivePeriod: DefaultKeepAlive,
+			MaxIdleTimeout:  DefaultIdleTimeout,
+		},
+	}}
+}
+
+// Configure makes a client subscribe over HTTP/3, keeping the other settings
+// of its connection, and returns the transport, which should be closed once
+// the client is no longer used
+func Configure(c *sse.Client, tlsConfig *tls.Config) *Transport {
+	t := NewTransport(tlsConfig)
+	conn := http.Client{}
+	if c.Connection != nil {
+		conn = *c.Connection
+	}
+	conn.Transport = t
+	c.Connection = &conn
+	return t
+}
+
+// RoundTrip sends a request, retrying it once on a new connection if the
+// cached one turns out to have been closed, as is usual when reconnecting
+// after the server went away. Only requests without a body are retried.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil && connectionLost(err) && (req.Body == nil || req.Body == http.NoBody) {
+		// The failed connection has been removed from the cache
+		resp, err = t.Transport.RoundTrip(req)
+	}
+	return resp, err
+}
+
+// connectionLost reports whether err ended a connection other than by timing
+// out, as the transport retries timeouts itself
+func connectionLost(err error) bool {
+	var closed *quic.ApplicationError
+	var reset *quic.StatelessResetError
+	return errors.As(err, &closed) || errors.As(err, &reset)
+}
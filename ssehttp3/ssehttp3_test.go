@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package ssehttp3
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/r3labs/sse"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// serveHTTP3 serves handler over HTTP/3 on a local port, returning the
+// server's URL and the TLS configuration trusting its certificate
+func serveHTTP3(handler http.Handler) (*http3.Server, string, *tls.Config) {
+	certs := httptest.NewTLSServer(handler)
+	certs.Close()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+
+	server := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(certs.TLS),
+	}
+	go server.Serve(conn)
+
+	trust := certs.Client().Transport.(*http.Transport).TLSClientConfig
+	return server, fmt.Sprintf("https://%s/events", conn.LocalAddr()), trust
+}
+
+func TestHTTP3(t *testing.T) {
+	Convey("Given a server serving events over HTTP/3", t, func() {
+		s := sse.New()
+		defer s.Close()
+		s.CreateStream("test")
+
+		server, url, trust := serveHTTP3(http.HandlerFunc(s.HTTPHandler))
+		defer server.Close()
+
+		Convey("A configured client should receive events", func() {
+			client := sse.NewClient(url)
+			transport := Configure(client, trust)
+			defer transport.Close()
+
+			events := make(chan *sse.Event)
+			go client.Subscribe("test", func(msg *sse.Event) {
+				events <- msg
+			})
+
+			// Publish until the subscriber is connected
+			var ev *sse.Event
+			for ev == nil {
+				s.Publish("test", &sse.Event{Data: []byte("hello")})
+				select {
+				case ev = <-events:
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+			So(string(ev.Data), ShouldEqual, "hello")
+		})
+
+		Convey("A configured client should keep its connection settings", func() {
+			client := sse.NewClient(url)
+			client.Connection = &http.Client{Timeout: time.Minute}
+			Configure(client, trust)
+
+			So(client.Connection.Timeout, ShouldEqual, time.Minute)
+			So(client.Connection.Transport, ShouldHaveSameTypeAs, &Transport{})
+		})
+	})
+}
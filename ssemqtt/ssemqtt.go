@@ -0,0 +1,237 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package ssemqtt bridges MQTT topics and sse streams, so device telemetry
+// published over MQTT reaches browsers as events, and events posted to the
+// server's IngestHandler reach devices as MQTT messages.
+//
+//	bridge := &ssemqtt.Bridge{
+//		Client: mqttClient,
+//		Server: server,
+//		Routes: []ssemqtt.Route{{Topic: "devices/+/telemetry", Stream: "telemetry-{1}"}},
+//	}
+//	if err := bridge.Start(); err != nil {
+//		log.Fatal(err)
+//	}
+//	server.Ingest = bridge.Ingest
+//
+// The payload of a message is the data of its event and the other way round.
+// MQTT messages carry no ids, so the streams number events as usual.
+package ssemqtt
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/r3labs/sse"
+)
+
+// Defaults of the Bridge
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultMaxStreams = 1000
+)
+
+// ErrTimeout is returned when the broker does not complete an operation in time
+var ErrTimeout = errors.New("ssemqtt: timed out waiting for the broker")
+
+// Client is the part of mqtt.Client used by the bridge
+type Client interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token
+	SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token
+	Unsubscribe(topics ...string) mqtt.Token
+}
+
+// Route maps the topics matching a topic filter to streams
+type Route struct {
+	// Topic filter, which may contain the + and # wildcards
+	Topic string
+	// Name of the stream, in which {1}, {2} and so on are replaced by the
+	// topic levels matched by the wildcards of the filter, in order, with #
+	// matching the remaining levels as a whole. Empty names the stream
+	// after the topic.
+	Stream string
+}
+
+// Bridge republishes the messages of MQTT topics on the streams their routes
+// map them to
+type Bridge struct {
+	// Client connected to the MQTT broker
+	Client Client
+	// Server the messages are published on
+	Server *sse.Server
+	// Routes of the topics subscribed to. A message matching several
+	// routes is published on the stream of the first.
+	Routes []Route
+	// Quality of service of subscriptions and of messages published by
+	// Ingest
+	QoS byte
+	// Creates the streams of messages that have none, instead of dropping
+	// them, up to MaxStreams
+	CreateStreams bool
+	// Limits the number of streams CreateStreams keeps at a time, as each
+	// topic matching a wildcard would otherwise get a stream of its own.
+	// Messages for further streams are dropped. Zero means
+	// DefaultMaxStreams.
+	MaxStreams int
+	// Names the topic events ingested for a stream are published on, the
+	// name of the stream if nil
+	IngestTopic func(stream string) string
+	// How long to wait for the broker to complete an operation, zero means
+	// DefaultTimeout
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	created map[string]struct{}
+}
+
+// Start subscribes to the topics of the routes. As subscriptions do not
+// outlive the session of the client with the broker, it should be called
+// again whenever the client reconnects with a clean session, such as from
+// its OnConnect handler.
+func (b *Bridge) Start() error {
+	filters := make(map[string]byte, len(b.Routes))
+	for _, route := range b.Routes {
+		filters[route.Topic] = b.QoS
+	}
+
+	token := b.Client.SubscribeMultiple(filters, func(_ mqtt.Client, msg mqtt.Message) {
+		b.republish(msg.Topic(), msg.Payload())
+	})
+	return b.wait(token)
+}
+
+// Stop unsubscribes from the topics of the routes
+func (b *Bridge) Stop() error {
+	topics := make([]string, len(b.Routes))
+	for i, route := range b.Routes {
+		topics[i] = route.Topic
+	}
+
+	return b.wait(b.Client.Unsubscribe(topics...))
+}
+
+// Ingest publishes an event on the stream's topic, see sse.Server.Ingest.
+// Events of topics the bridge routes back to the same stream reach it with
+// the message, while those of other topics are published on it directly.
+func (b *Bridge) Ingest(stream string, event *sse.Event) error {
+	topic := stream
+	if b.IngestTopic != nil {
+		topic = b.IngestTopic(stream)
+	}
+
+	if err := b.wait(b.Client.Publish(topic, b.QoS, false, event.Data)); err != nil {
+		return err
+	}
+
+	if routed, ok := b.Stream(topic); !ok || routed != stream {
+		b.Server.Publish(stream, event)
+	}
+	return nil
+}
+
+// wait waits for the broker to complete an operation, up to Timeout
+func (b *Bridge) wait(token mqtt.Token) error {
+	timeout := b.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if !token.WaitTimeout(timeout) {
+		return ErrTimeout
+	}
+	return token.Error()
+}
+
+// Stream returns the stream the route of a topic maps it to, reporting false
+// if no route matches it
+func (b *Bridge) Stream(topic string) (string, bool) {
+	for _, route := range b.Routes {
+		wildcards, ok := match(route.Topic, topic)
+		if !ok {
+			continue
+		}
+		if route.Stream == "" {
+			return topic, true
+		}
+
+		stream := route.Stream
+		for i, level := range wildcards {
+			stream = strings.ReplaceAll(stream, "{"+strconv.Itoa(i+1)+"}", level)
+		}
+		return stream, true
+	}
+	return "", false
+}
+
+// republish publishes a message on the stream of its topic
+func (b *Bridge) republish(topic string, payload []byte) {
+	stream, ok := b.Stream(topic)
+	if !ok {
+		return
+	}
+	if b.CreateStreams && !b.Server.StreamExists(stream) && !b.create(stream) {
+		return
+	}
+	b.Server.Publish(stream, &sse.Event{Data: payload})
+}
+
+// create creates a stream, reporting false if MaxStreams of the streams
+// created before still exist
+func (b *Bridge) create(stream string) bool {
+	max := b.MaxStreams
+	if max <= 0 {
+		max = DefaultMaxStreams
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.created == nil {
+		b.created = make(map[string]struct{})
+	}
+	if len(b.created) >= max {
+		// Streams removed from the server no longer count
+		for created := range b.created {
+			if !b.Server.StreamExists(created) {
+				delete(b.created, created)
+			}
+		}
+		if len(b.created) >= max {
+			return false
+		}
+	}
+
+	b.created[stream] = struct{}{}
+	b.Server.CreateStream(stream)
+	return true
+}
+
+// match reports whether a topic matches a filter, returning the levels
+// matched by its wildcards. Topics starting with $ are reserved for the
+// broker, and are not matched by a wildcard in the first level.
+func match(filter, topic string) ([]string, bool) {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return nil, false
+	}
+
+	var wildcards []string
+	filters, levels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range filters {
+		switch {
+		case f == "#":
+			return append(wildcards, strings.Join(levels[i:], "/")), true
+		case i >= len(levels):
+			return nil, false
+		case f == "+":
+			wildcards = append(wildcards, levels[i])
+		case f != levels[i]:
+			return nil, false
+		}
+	}
+	return wildcards, len(levels) == len(filters)
+}
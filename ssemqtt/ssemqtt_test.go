@@ -0,0 +1,218 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package ssemqtt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/r3labs/sse"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// token is a completed mqtt.Token
+type token struct{ err error }
+
+func (t token) Wait() bool                     { return true }
+func (t token) WaitTimeout(time.Duration) bool { return true }
+func (t token) Error() error                   { return t.err }
+
+func (t token) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// pending is an mqtt.Token that never completes
+type pending struct{ token }
+
+func (t pending) WaitTimeout(time.Duration) bool { return false }
+
+// message is an mqtt.Message as delivered by the broker
+type message struct {
+	mqtt.Message
+	topic   string
+	payload []byte
+}
+
+func (m message) Topic() string   { return m.topic }
+func (m message) Payload() []byte { return m.payload }
+
+// broker is a client of an in-memory broker, delivering published messages to
+// its own subscriptions
+type broker struct {
+	mu            sync.Mutex
+	subscriptions map[string]mqtt.MessageHandler
+	published     []string
+}
+
+func (b *broker) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	b.mu.Lock()
+	b.published = append(b.published, topic)
+	var handlers []mqtt.MessageHandler
+	for filter, handler := range b.subscriptions {
+		if _, ok := match(filter, topic); ok {
+			handlers = append(handlers, handler)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(nil, message{topic: topic, payload: payload.([]byte)})
+	}
+	return token{}
+}
+
+func (b *broker) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for filter := range filters {
+		b.subscriptions[filter] = callback
+	}
+	return token{}
+}
+
+func (b *broker) Unsubscribe(topics ...string) mqtt.Token {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, topic := range topics {
+		delete(b.subscriptions, topic)
+	}
+	return token{}
+}
+
+func TestBridge(t *testing.T) {
+	Convey("Topics should match filters", t, func() {
+		wildcards, ok := match("devices/+/telemetry/#", "devices/42/telemetry/temp/inside")
+		So(ok, ShouldBeTrue)
+		So(wildcards, ShouldResemble, []string{"42", "temp/inside"})
+
+		_, ok = match("devices/#", "devices")
+		So(ok, ShouldBeTrue)
+		_, ok = match("devices/+", "devices/42/telemetry")
+		So(ok, ShouldBeFalse)
+		_, ok = match("devices/+/telemetry", "devices/42")
+		So(ok, ShouldBeFalse)
+		_, ok = match("#", "$SYS/uptime")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Given a bridge routing device topics to streams", t, func() {
+		s := sse.New()
+		client := &broker{subscriptions: make(map[string]mqtt.MessageHandler)}
+		bridge := &Bridge{
+			Client: client,
+			Server: s,
+			Routes: []Route{
+				{Topic: "devices/+/telemetry", Stream: "telemetry-{1}"},
+				{Topic: "alerts/#"},
+			},
+		}
+		So(bridge.Start(), ShouldBeNil)
+		s.Ingest = bridge.Ingest
+		s.AuthorizeIngest = func(r *http.Request, stream string) error {
+			return nil
+		}
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		// subscribe returns the events of a stream as they arrive
+		subscribe := func(stream string) chan *sse.Event {
+			events := make(chan *sse.Event, 8)
+			go sse.NewClient(server.URL).Subscribe(stream, func(msg *sse.Event) {
+				events <- msg
+			})
+			for !s.HasSubscribers(stream) {
+				time.Sleep(time.Millisecond)
+			}
+			return events
+		}
+
+		Convey("Topics should map to the streams of their routes", func() {
+			stream, ok := bridge.Stream("devices/42/telemetry")
+			So(ok, ShouldBeTrue)
+			So(stream, ShouldEqual, "telemetry-42")
+
+			stream, ok = bridge.Stream("alerts/fire")
+			So(ok, ShouldBeTrue)
+			So(stream, ShouldEqual, "alerts/fire")
+
+			_, ok = bridge.Stream("other")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Messages should be published on their streams", func() {
+			s.CreateStream("telemetry-42")
+			events := subscribe("telemetry-42")
+
+			client.Publish("devices/42/telemetry", 0, false, []byte(`{"temp":21}`))
+			So(string((<-events).Data), ShouldEqual, `{"temp":21}`)
+		})
+
+		Convey("Streams should only be created if enabled", func() {
+			client.Publish("alerts/fire", 0, false, []byte("fire"))
+			So(s.StreamExists("alerts/fire"), ShouldBeFalse)
+
+			bridge.CreateStreams = true
+			client.Publish("alerts/fire", 0, false, []byte("fire"))
+			So(s.StreamExists("alerts/fire"), ShouldBeTrue)
+		})
+
+		Convey("No more than MaxStreams streams should be created", func() {
+			bridge.CreateStreams = true
+			bridge.MaxStreams = 1
+			client.Publish("alerts/fire", 0, false, []byte("fire"))
+			client.Publish("alerts/flood", 0, false, []byte("flood"))
+			So(s.StreamExists("alerts/fire"), ShouldBeTrue)
+			So(s.StreamExists("alerts/flood"), ShouldBeFalse)
+
+			s.RemoveStream("alerts/fire")
+			client.Publish("alerts/flood", 0, false, []byte("flood"))
+			So(s.StreamExists("alerts/flood"), ShouldBeTrue)
+		})
+
+		Convey("Operations the broker does not complete should time out", func() {
+			bridge.Timeout = time.Millisecond
+			So(bridge.wait(pending{}), ShouldEqual, ErrTimeout)
+		})
+
+		Convey("Ingested events should be published once", func() {
+			ingest := func(stream, data string) int {
+				rec := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/ingest?stream="+stream, strings.NewReader(data))
+				s.IngestHandler(rec, r)
+				return rec.Code
+			}
+
+			s.CreateStream("alerts/fire")
+			s.CreateStream("commands")
+			alerts, commands := subscribe("alerts/fire"), subscribe("commands")
+
+			So(ingest("alerts/fire", "fire"), ShouldEqual, http.StatusNoContent)
+			So(ingest("commands", "reboot"), ShouldEqual, http.StatusNoContent)
+			So(client.published, ShouldResemble, []string{"alerts/fire", "commands"})
+
+			So(string((<-alerts).Data), ShouldEqual, "fire")
+			So(string((<-commands).Data), ShouldEqual, "reboot")
+			time.Sleep(50 * time.Millisecond)
+			So(alerts, ShouldBeEmpty)
+		})
+
+		Convey("Stopping should unsubscribe from the topics", func() {
+			So(bridge.Stop(), ShouldBeNil)
+			So(client.subscriptions, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,235 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package sseotel instruments sse servers with OpenTelemetry, recording a span
+// for every subscription and publication, along with metrics of how long
+// events are queued, how long they take to write and how many are dropped.
+//
+//	inst, err := sseotel.New(nil, nil)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	server := sse.New()
+//	server.Instrumentation = inst
+package sseotel
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/r3labs/sse"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the tracer and meter of this package
+const instrumentationName = "github.com/r3labs/sse/sseotel"
+
+// StreamKey is the attribute holding the name of the stream
+const StreamKey = attribute.Key("sse.stream")
+
+// EventIDKey is the attribute holding the id of an event
+const EventIDKey = attribute.Key("sse.event.id")
+
+// OmittedEventsKey is the attribute holding the number of deliveries and drops
+// not recorded on a subscription's span, see MaxSpanEvents
+const OmittedEventsKey = attribute.Key("sse.span.omitted_events")
+
+// DefaultMaxSpanEvents is the number of deliveries and drops recorded on the
+// span of a subscription by default
+const DefaultMaxSpanEvents = 128
+
+// Instrumentation records traces and metrics of a server, see
+// sse.Server.Instrumentation
+type Instrumentation struct {
+	// Carries trace context in subscription requests and event fields,
+	// W3C trace context if nil
+	Propagator propagation.TextMapPropagator
+	// Writes the trace context of each publication into the event's fields,
+	// so subscribers can continue the trace, see Extract
+	InjectContext bool
+	// Number of deliveries and drops recorded as events on the span of a
+	// subscription, DefaultMaxSpanEvents if 0. Long-lived subscriptions
+	// would otherwise grow their span without bound. The number of those
+	// left out is set as OmittedEventsKey once the span ends.
+	MaxSpanEvents int
+
+	tracer        trace.Tracer
+	subscriptions metric.Int64UpDownCounter
+	published     metric.Int64Counter
+	dropped       metric.Int64Counter
+	queueTime     metric.Float64Histogram
+	writeTime     metric.Float64Histogram
+}
+
+// New creates an instrumentation using the given providers, or the global
+// ones if they are nil
+func New(tp trace.TracerProvider, mp metric.MeterProvider) (*Instrumentation, error) {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+
+	inst := &Instrumentation{tracer: tp.Tracer(instrumentationName)}
+	meter := mp.Meter(instrumentationName)
+
+	var err error
+	if inst.subscriptions, err = meter.Int64UpDownCounter("sse.subscriptions",
+		metric.WithDescription("Number of active subscriptions")); err != nil {
+		return nil, err
+	}
+	if inst.published, err = meter.Int64Counter("sse.events.published",
+		metric.WithDescription("Number of events published")); err != nil {
+		return nil, err
+	}
+	if inst.dropped, err = meter.Int64Counter("sse.events.dropped",
+		metric.WithDescription("Number of events that could not be delivered to a subscriber")); err != nil {
+		return nil, err
+	}
+	if inst.queueTime, err = meter.Float64Histogram("sse.event.queue_time", metric.WithUnit("s"),
+		metric.WithDescription("Time from the publication of an event until it is written to a subscriber")); err != nil {
+		return nil, err
+	}
+	if inst.writeTime, err = meter.Float64Histogram("sse.event.write_time", metric.WithUnit("s"),
+		metric.WithDescription("Time taken to write an event to a subscriber")); err != nil {
+		return nil, err
+	}
+
+	return inst, nil
+}
+
+// Subscribe starts the span of a subscription, continuing the trace of the
+// subscription request
+func (i *Instrumentation) Subscribe(r *http.Request, stream string) sse.SubscriberInstrumentation {
+	ctx := i.propagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	attrs := metric.WithAttributes(StreamKey.String(stream))
+
+	ctx, span := i.tracer.Start(ctx, "sse subscribe",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(StreamKey.String(stream)))
+	i.subscriptions.Add(ctx, 1, attrs)
+
+	return &subscriber{inst: i, ctx: ctx, span: span, attrs: attrs}
+}
+
+// Publish records the span of a publication, continuing the trace carried by
+// the event's fields if there is one
+func (i *Instrumentation) Publish(stream string, event *sse.Event) {
+	ctx := i.propagator().Extract(context.Background(), &fieldCarrier{event: event})
+
+	ctx, span := i.tracer.Start(ctx, "sse publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(StreamKey.String(stream)))
+	if i.InjectContext {
+		i.propagator().Inject(ctx, &fieldCarrier{event: event})
+	}
+	span.End()
+
+	i.published.Add(ctx, 1, metric.WithAttributes(StreamKey.String(stream)))
+}
+
+func (i *Instrumentation) propagator() propagation.TextMapPropagator {
+	if i.Propagator != nil {
+		return i.Propagator
+	}
+	return propagation.TraceContext{}
+}
+
+func (i *Instrumentation) maxSpanEvents() int64 {
+	if i.MaxSpanEvents > 0 {
+		return int64(i.MaxSpanEvents)
+	}
+	return DefaultMaxSpanEvents
+}
+
+// subscriber records the deliveries to a single subscriber
+type subscriber struct {
+	inst  *Instrumentation
+	ctx   context.Context
+	span  trace.Span
+	attrs metric.MeasurementOption
+	// Deliveries and drops so far, see MaxSpanEvents
+	events atomic.Int64
+}
+
+func (s *subscriber) Deliver(event *sse.Event, queued, written time.Duration) {
+	s.inst.queueTime.Record(s.ctx, queued.Seconds(), s.attrs)
+	s.inst.writeTime.Record(s.ctx, written.Seconds(), s.attrs)
+	s.addEvent("deliver", trace.WithAttributes(EventIDKey.String(string(event.ID))))
+}
+
+func (s *subscriber) Drop(event *sse.Event, err error) {
+	s.inst.dropped.Add(s.ctx, 1, s.attrs)
+	s.addEvent("drop", trace.WithAttributes(
+		EventIDKey.String(string(event.ID)),
+		attribute.String("error", err.Error())))
+}
+
+func (s *subscriber) End() {
+	s.inst.subscriptions.Add(s.ctx, -1, s.attrs)
+	if omitted := s.events.Load() - s.inst.maxSpanEvents(); omitted > 0 {
+		s.span.SetAttributes(OmittedEventsKey.Int64(omitted))
+	}
+	s.span.End()
+}
+
+// addEvent records an event on the span, unless it has as many as
+// MaxSpanEvents allows
+func (s *subscriber) addEvent(name string, options ...trace.EventOption) {
+	if s.events.Add(1) <= s.inst.maxSpanEvents() {
+		s.span.AddEvent(name, options...)
+	}
+}
+
+// Inject writes the trace context of ctx into the event's fields, so it can be
+// continued by the server's instrumentation and subscribers. The fields are
+// copied first, leaving any map shared with other events as it was.
+func Inject(ctx context.Context, event *sse.Event) {
+	propagation.TraceContext{}.Inject(ctx, &fieldCarrier{event: event})
+}
+
+// Extract returns ctx with the trace context carried by the event's fields.
+// Clients only receive the fields with sse.Client.CaptureFields set.
+func Extract(ctx context.Context, event *sse.Event) context.Context {
+	return propagation.TraceContext{}.Extract(ctx, &fieldCarrier{event: event})
+}
+
+// fieldCarrier carries trace context in the fields of an event. The fields are
+// copied before the first one is set, as the map may be shared with the
+// publisher's event or other events.
+type fieldCarrier struct {
+	event  *sse.Event
+	copied bool
+}
+
+func (c *fieldCarrier) Get(key string) string {
+	return string(c.event.Fields[key])
+}
+
+func (c *fieldCarrier) Set(key, value string) {
+	if !c.copied {
+		fields := make(map[string][]byte, len(c.event.Fields)+1)
+		for k, v := range c.event.Fields {
+			fields[k] = v
+		}
+		c.event.Fields = fields
+		c.copied = true
+	}
+	c.event.Fields[key] = []byte(value)
+}
+
+func (c *fieldCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.event.Fields))
+	for key := range c.event.Fields {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,154 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sseotel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/r3labs/sse"
+	. "github.com/smartystreets/goconvey/convey"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sum returns the total of an integer sum metric
+func sum(reader *sdkmetric.ManualReader, name string) int64 {
+	var rm metricdata.ResourceMetrics
+	So(reader.Collect(context.Background(), &rm), ShouldBeNil)
+
+	var total int64
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if data, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == name {
+				for _, point := range data.DataPoints {
+					total += point.Value
+				}
+			}
+		}
+	}
+	return total
+}
+
+func TestInstrumentation(t *testing.T) {
+	Convey("Given an instrumented server", t, func() {
+		spans := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+		reader := sdkmetric.NewManualReader()
+		mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+		inst, err := New(tp, mp)
+		So(err, ShouldBeNil)
+		inst.InjectContext = true
+
+		s := sse.New()
+		s.Instrumentation = inst
+		s.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("When an event is published to a subscriber", func() {
+			c := sse.NewClient(server.URL)
+			c.CaptureFields = true
+			events := make(chan *sse.Event)
+			sub, err := c.SubscribeChan("test", events)
+			So(err, ShouldBeNil)
+
+			for sum(reader, "sse.subscriptions") == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+			ev := &sse.Event{Data: []byte("hello")}
+			Inject(ctx, ev)
+			s.Publish("test", ev)
+			parent.End()
+
+			var received *sse.Event
+			select {
+			case received = <-events:
+			case <-time.After(time.Second):
+			}
+			So(received, ShouldNotBeNil)
+
+			Convey("The publication should continue the publisher's trace", func() {
+				var publish sdktrace.ReadOnlySpan
+				for _, span := range spans.GetSpans().Snapshots() {
+					if span.Name() == "sse publish" {
+						publish = span
+					}
+				}
+				So(publish, ShouldNotBeNil)
+				So(publish.Parent().SpanID(), ShouldEqual, parent.SpanContext().SpanID())
+				So(sum(reader, "sse.events.published"), ShouldEqual, 1)
+			})
+
+			Convey("The subscriber should receive the trace context", func() {
+				sc := trace.SpanContextFromContext(Extract(context.Background(), received))
+				So(sc.TraceID(), ShouldEqual, parent.SpanContext().TraceID())
+				So(sc.SpanID(), ShouldNotEqual, parent.SpanContext().SpanID())
+			})
+
+			Convey("The subscription span should end with the subscription", func() {
+				sub.Close()
+				s.RemoveStream("test")
+				for sum(reader, "sse.subscriptions") != 0 {
+					time.Sleep(time.Millisecond)
+				}
+
+				var names []string
+				for _, span := range spans.GetSpans().Snapshots() {
+					names = append(names, span.Name())
+				}
+				So(names, ShouldContain, "sse subscribe")
+			})
+		})
+
+		Convey("Dropped events should be counted", func() {
+			r := httptest.NewRequest(http.MethodGet, "/?stream=test", nil)
+			sub := inst.Subscribe(r, "test")
+			sub.Drop(&sse.Event{ID: []byte("1")}, errors.New("broken pipe"))
+			sub.End()
+
+			So(sum(reader, "sse.events.dropped"), ShouldEqual, 1)
+		})
+
+		Convey("Subscription spans should record a bounded number of events", func() {
+			inst.MaxSpanEvents = 2
+			r := httptest.NewRequest(http.MethodGet, "/?stream=test", nil)
+			sub := inst.Subscribe(r, "test")
+			for i := 0; i < 5; i++ {
+				sub.Deliver(&sse.Event{ID: []byte("1")}, 0, 0)
+			}
+			sub.End()
+
+			var span sdktrace.ReadOnlySpan
+			for _, s := range spans.GetSpans().Snapshots() {
+				if s.Name() == "sse subscribe" {
+					span = s
+				}
+			}
+			So(span, ShouldNotBeNil)
+			So(span.Events(), ShouldHaveLength, 2)
+			So(span.Attributes(), ShouldContain, OmittedEventsKey.Int64(3))
+		})
+
+		Convey("Publishing should leave the publisher's fields as they were", func() {
+			fields := map[string][]byte{"tenant": []byte("a")}
+			s.Publish("test", &sse.Event{Data: []byte("hello"), Fields: fields})
+			So(fields, ShouldHaveLength, 1)
+		})
+	})
+}
@@ -0,0 +1,207 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package sseredis carries the events of sse servers over Redis Pub/Sub, so
+// servers behind a load balancer deliver events published on any of them to
+// all of their subscribers.
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	broker := sseredis.NewBroker(rdb)
+//	defer broker.Close()
+//	server := sse.NewServerWithBroker(broker)
+//
+// Events are sent as JSON, as encoded by sse.Event.MarshalJSON, on a channel
+// per stream. Redis delivers the messages of a channel to every subscriber in
+// the same order, which keeps the ordering guarantee of Server.Publish. Pub/Sub
+// does not keep messages, so servers miss the events published while they are
+// disconnected from Redis, and streams should be created on every server
+// before events are published to them. Each channel is delivered by a
+// goroutine of its own, so a slow stream does not hold up the others; events
+// arriving while QueueSize of them wait for delivery are dropped and reported.
+package sseredis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/r3labs/sse"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultPrefix is prefixed to the names of streams to name their channels
+const DefaultPrefix = "sse:"
+
+// QueueSize is the number of events of a channel waiting for delivery
+const QueueSize = 1024
+
+// Broker is an sse.Broker publishing events on Redis channels
+type Broker struct {
+	// Client connected to Redis
+	Client redis.UniversalClient
+	// Prefixed to the names of streams to name their channels
+	Prefix string
+	// Called with messages that could not be decoded or delivered and failed
+	// subscriptions, which the client retries once it reconnects
+	OnError func(err error)
+
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+	// Subscribed channels by name
+	channels map[string]*channel
+}
+
+// channel holds the subscribers of a channel and the events waiting to be
+// delivered to them
+type channel struct {
+	subscribers map[*subscriber]struct{}
+	events      chan *sse.Event
+}
+
+type subscriber struct {
+	deliver func(event *sse.Event)
+}
+
+// NewBroker creates a broker publishing on channels prefixed by DefaultPrefix
+func NewBroker(client redis.UniversalClient) *Broker {
+	return &Broker{
+		Client: client,
+		Prefix: DefaultPrefix,
+	}
+}
+
+// Publish sends an event on the channel of a stream
+func (b *Broker) Publish(stream string, event *sse.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.Client.Publish(context.Background(), b.channel(stream), payload).Err()
+}
+
+// Subscribe calls deliver with the events received on the channel of a
+// stream. All streams share a single connection to Redis, which the client
+// reconnects and subscribes again on its own.
+func (b *Broker) Subscribe(stream string, deliver func(event *sse.Event)) func() {
+	name := b.channel(stream)
+	sub := &subscriber{deliver: deliver}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.channels == nil {
+		b.channels = make(map[string]*channel)
+	}
+	ch := b.channels[name]
+	if ch == nil {
+		ch = &channel{
+			subscribers: make(map[*subscriber]struct{}),
+			events:      make(chan *sse.Event, QueueSize),
+		}
+		b.channels[name] = ch
+		go b.deliver(ch)
+		b.listen(name)
+	}
+	ch.subscribers[sub] = struct{}{}
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(ch.subscribers, sub)
+		if len(ch.subscribers) == 0 && b.channels[name] == ch {
+			delete(b.channels, name)
+			close(ch.events)
+			if b.pubsub != nil {
+				b.report(b.pubsub.Unsubscribe(context.Background(), name))
+			}
+		}
+	}
+}
+
+// Close closes the broker's connection to Redis, ending its subscriptions.
+// The client is left open.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ch := range b.channels {
+		close(ch.events)
+	}
+	b.channels = nil
+
+	if b.pubsub == nil {
+		return nil
+	}
+	err := b.pubsub.Close()
+	b.pubsub = nil
+	return err
+}
+
+// listen subscribes to a channel, connecting to Redis with the first one. The
+// lock must be held.
+func (b *Broker) listen(channel string) {
+	if b.pubsub != nil {
+		b.report(b.pubsub.Subscribe(context.Background(), channel))
+		return
+	}
+
+	b.pubsub = b.Client.Subscribe(context.Background(), channel)
+	go b.receive(b.pubsub.Channel())
+}
+
+// receive queues the messages of the shared connection on their channels,
+// dropping those of channels with a full queue rather than waiting for them
+func (b *Broker) receive(messages <-chan *redis.Message) {
+	for msg := range messages {
+		event := new(sse.Event)
+		if err := json.Unmarshal([]byte(msg.Payload), event); err != nil {
+			b.report(fmt.Errorf("invalid event on channel %s: %s", msg.Channel, err))
+			continue
+		}
+
+		b.mu.Lock()
+		queued := true
+		if ch := b.channels[msg.Channel]; ch != nil {
+			select {
+			case ch.events <- event:
+			default:
+				queued = false
+			}
+		}
+		b.mu.Unlock()
+
+		if !queued {
+			b.report(fmt.Errorf("dropped event on channel %s: delivery queue is full", msg.Channel))
+		}
+	}
+}
+
+// deliver passes the events queued on a channel to its subscribers, each with
+// an event of its own, until the channel is unsubscribed
+func (b *Broker) deliver(ch *channel) {
+	for event := range ch.events {
+		b.mu.Lock()
+		subscribers := make([]*subscriber, 0, len(ch.subscribers))
+		for sub := range ch.subscribers {
+			subscribers = append(subscribers, sub)
+		}
+		b.mu.Unlock()
+
+		for _, sub := range subscribers {
+			sub.deliver(event.Clone())
+		}
+	}
+}
+
+func (b *Broker) channel(stream string) string {
+	return b.Prefix + stream
+}
+
+func (b *Broker) report(err error) {
+	if err != nil && b.OnError != nil {
+		b.OnError(err)
+	}
+}
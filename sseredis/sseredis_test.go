@@ -0,0 +1,148 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sseredis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/r3labs/sse"
+	"github.com/redis/go-redis/v9"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// receive publishes events with publish until one arrives on events, as
+// subscriptions are confirmed by Redis asynchronously
+func receive(events chan *sse.Event, publish func()) *sse.Event {
+	for i := 0; i < 50; i++ {
+		publish()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+func TestBroker(t *testing.T) {
+	Convey("Given brokers connected to the same Redis", t, func() {
+		mr := miniredis.RunT(t)
+		newBroker := func() *Broker {
+			return NewBroker(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+		}
+		a, b := newBroker(), newBroker()
+
+		Reset(func() {
+			a.Close()
+			b.Close()
+		})
+
+		Convey("Events published on one should be delivered by the other", func() {
+			events := make(chan *sse.Event, 10)
+			b.Subscribe("test", func(ev *sse.Event) {
+				events <- ev
+			})
+
+			ev := receive(events, func() {
+				So(a.Publish("test", &sse.Event{ID: []byte("1"), Event: []byte("greeting"), Data: []byte("hello")}), ShouldBeNil)
+			})
+			So(ev, ShouldNotBeNil)
+			So(string(ev.ID), ShouldEqual, "1")
+			So(string(ev.Event), ShouldEqual, "greeting")
+			So(string(ev.Data), ShouldEqual, "hello")
+		})
+
+		Convey("Events should only be delivered to subscribers of their stream", func() {
+			events := make(chan *sse.Event, 10)
+			b.Subscribe("other", func(ev *sse.Event) {
+				events <- ev
+			})
+			b.Subscribe("test", func(ev *sse.Event) {
+				events <- ev
+			})
+
+			ev := receive(events, func() {
+				a.Publish("test", &sse.Event{Data: []byte("hello")})
+			})
+			So(ev, ShouldNotBeNil)
+			So(len(events), ShouldEqual, 0)
+			So(mr.PubSubChannels(""), ShouldContain, "sse:other")
+		})
+
+		Convey("A slow subscriber should not hold up other streams", func() {
+			blocked := make(chan struct{})
+			defer close(blocked)
+			b.Subscribe("slow", func(ev *sse.Event) {
+				<-blocked
+			})
+			events := make(chan *sse.Event, 10)
+			b.Subscribe("test", func(ev *sse.Event) {
+				events <- ev
+			})
+
+			ev := receive(events, func() {
+				a.Publish("slow", &sse.Event{Data: []byte("stuck")})
+				a.Publish("test", &sse.Event{Data: []byte("hello")})
+			})
+			So(ev, ShouldNotBeNil)
+			So(string(ev.Data), ShouldEqual, "hello")
+		})
+
+		Convey("Closing should forget the subscriptions", func() {
+			b.Subscribe("test", func(ev *sse.Event) {})
+			So(b.Close(), ShouldBeNil)
+			So(b.channels, ShouldBeEmpty)
+
+			events := make(chan *sse.Event, 10)
+			b.Subscribe("test", func(ev *sse.Event) {
+				events <- ev
+			})
+			ev := receive(events, func() {
+				a.Publish("test", &sse.Event{Data: []byte("hello")})
+			})
+			So(ev, ShouldNotBeNil)
+		})
+
+		Convey("Unsubscribing should stop deliveries", func() {
+			unsubscribe := b.Subscribe("test", func(ev *sse.Event) {})
+			unsubscribe()
+
+			for i := 0; i < 50 && len(mr.PubSubChannels("")) > 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(mr.PubSubChannels(""), ShouldBeEmpty)
+		})
+
+		Convey("Servers sharing the broker should deliver each other's events", func() {
+			publisher := sse.NewServerWithBroker(a)
+			publisher.CreateStream("test")
+			subscriber := sse.NewServerWithBroker(b)
+			subscriber.CreateStream("test")
+			server := httptest.NewServer(http.HandlerFunc(subscriber.HTTPHandler))
+
+			Reset(func() {
+				server.CloseClientConnections()
+				server.Close()
+				publisher.Close()
+				subscriber.Close()
+			})
+
+			events := make(chan *sse.Event, 10)
+			go sse.NewClient(server.URL).Subscribe("test", func(ev *sse.Event) {
+				events <- ev
+			})
+
+			ev := receive(events, func() {
+				publisher.Publish("test", &sse.Event{Data: []byte("hello")})
+			})
+			So(ev, ShouldNotBeNil)
+			So(string(ev.Data), ShouldEqual, "hello")
+		})
+	})
+}
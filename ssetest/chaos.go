@@ -0,0 +1,198 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package ssetest
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// errReset stops a script once the connection has been reset
+var errReset = errors.New("connection reset")
+
+// Step is a single action of a chaos script, writing to or otherwise
+// disrupting a connection. Returning an error ends the connection.
+type Step func(w http.ResponseWriter, r *http.Request) error
+
+// Attempt scripts how the server responds to a single connection attempt
+type Attempt struct {
+	// Status of the response, http.StatusOK if zero. Any other status is
+	// sent with an error message instead of a stream.
+	Status int
+	// Steps run in order once the stream has started
+	Steps []Step
+}
+
+// Respond scripts a connection attempt answered with an error status
+func Respond(status int) Attempt {
+	return Attempt{Status: status}
+}
+
+// Serve scripts a connection attempt answered with a stream
+func Serve(steps ...Step) Attempt {
+	return Attempt{Steps: steps}
+}
+
+// ChaosServer serves scripted, misbehaving event streams, for testing how
+// clients cope with faulty servers and networks. Each connection attempt is
+// answered by the next Attempt of the script, and the last one is repeated
+// once the script has run out.
+type ChaosServer struct {
+	// HTTP is the underlying test server
+	HTTP *httptest.Server
+	// URL is the endpoint the script is served on
+	URL string
+
+	mu       sync.Mutex
+	script   []Attempt
+	requests []*http.Request
+}
+
+// NewChaosServer starts a server running the given script, which is closed
+// when the test finishes
+func NewChaosServer(t testing.TB, script ...Attempt) *ChaosServer {
+	t.Helper()
+
+	if len(script) == 0 {
+		t.Fatal("ssetest: chaos server needs at least one attempt")
+	}
+
+	s := &ChaosServer{script: script}
+	s.HTTP = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.HTTP.URL + "/events"
+
+	t.Cleanup(func() {
+		s.HTTP.CloseClientConnections()
+		s.HTTP.Close()
+	})
+	return s
+}
+
+// Attempts returns the number of connection attempts made so far
+func (s *ChaosServer) Attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+// Requests returns the requests of every connection attempt made so far, such
+// as to check the Last-Event-ID header sent when reconnecting
+func (s *ChaosServer) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+func (s *ChaosServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	attempt := s.script[len(s.script)-1]
+	if n := len(s.requests); n < len(s.script) {
+		attempt = s.script[n]
+	}
+	s.requests = append(s.requests, r)
+	s.mu.Unlock()
+
+	if attempt.Status != 0 && attempt.Status != http.StatusOK {
+		http.Error(w, http.StatusText(attempt.Status), attempt.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	for _, step := range attempt.Steps {
+		if err := step(w, r); err != nil {
+			return
+		}
+	}
+}
+
+// Send writes raw data to the stream, such as complete or partial frames
+func Send(data string) Step {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		_, err := io.WriteString(w, data)
+		flush(w)
+		return err
+	}
+}
+
+// SendChunks writes data in chunks of the given size, flushing each one
+// separately, so frames and lines are split at arbitrary byte boundaries
+func SendChunks(data string, size int) Step {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		for len(data) > 0 {
+			n := size
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := io.WriteString(w, data[:n]); err != nil {
+				return err
+			}
+			flush(w)
+			data = data[n:]
+		}
+		return nil
+	}
+}
+
+// Stall pauses the stream, such as in the middle of an event
+func Stall(d time.Duration) Step {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		select {
+		case <-time.After(d):
+			return nil
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	}
+}
+
+// Garbage writes n random bytes, which may include line breaks. The bytes are
+// derived from seed, so a script produces the same garbage on every run.
+func Garbage(n int, seed int64) Step {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		b := make([]byte, n)
+		rand.New(rand.NewSource(seed)).Read(b)
+		_, err := w.Write(b)
+		flush(w)
+		return err
+	}
+}
+
+// Reset aborts the connection, without ending the response properly
+func Reset() Step {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			return errors.New("connection can not be hijacked")
+		}
+
+		conn, _, err := hj.Hijack()
+		if err != nil {
+			return err
+		}
+		// Discard unsent data and send a RST instead of a FIN
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		conn.Close()
+		return errReset
+	}
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package ssetest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/r3labs/sse"
+)
+
+func TestChaosSplitFrames(t *testing.T) {
+	srv := NewChaosServer(t, Serve(
+		SendChunks("id: 1\r\ndata: first\r\n\r\nid: 2\rdata: second\r\r", 1),
+	))
+
+	rec := Record(t, sse.NewClient(srv.URL), "", DefaultTimeout)
+	rec.ExpectEvents(
+		&sse.Event{ID: []byte("1"), Data: []byte("first")},
+		&sse.Event{ID: []byte("2"), Data: []byte("second")},
+	)
+}
+
+func TestChaosStall(t *testing.T) {
+	srv := NewChaosServer(t, Serve(
+		Send("data: sl"),
+		Stall(100*time.Millisecond),
+		Send("ow\n\n"),
+	))
+
+	rec := Record(t, sse.NewClient(srv.URL), "", DefaultTimeout)
+	rec.ExpectData("slow")
+}
+
+func TestChaosGarbage(t *testing.T) {
+	srv := NewChaosServer(t, Serve(
+		Send("data: before\n\n"),
+		Garbage(512, 1),
+		Send("\n\ndata: after\n\n"),
+	))
+
+	c := sse.NewClient(srv.URL)
+	errs := make(chan error, 16)
+	c.OnError = func(err error, raw []byte) {
+		errs <- err
+	}
+
+	rec := Record(t, c, "", DefaultTimeout)
+	rec.ExpectData("before", "after")
+
+	if len(errs) == 0 {
+		t.Error("expected the garbage to be reported")
+	}
+}
+
+func TestChaosReset(t *testing.T) {
+	srv := NewChaosServer(t,
+		Serve(Send("id: 1\ndata: first\n\n"), Send("data: trunc"), Reset()),
+		Serve(Send("id: 2\ndata: second\n\n")),
+	)
+
+	received := make(chan *sse.Event, 2)
+	go sse.NewClient(srv.URL).Subscribe("", func(ev *sse.Event) {
+		received <- ev
+	})
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case ev := <-received:
+			if string(ev.Data) != want {
+				t.Fatalf("received %s, expected data %q", ev, want)
+			}
+		case <-time.After(DefaultTimeout):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	requests := srv.Requests()
+	if got := requests[1].Header.Get("Last-Event-ID"); got != "1" {
+		t.Errorf("reconnected with Last-Event-ID %q, expected \"1\"", got)
+	}
+}
+
+func TestChaosErrorStatus(t *testing.T) {
+	srv := NewChaosServer(t, Respond(http.StatusServiceUnavailable))
+
+	events := make(chan *sse.Event)
+	if _, err := sse.NewClient(srv.URL).SubscribeChan("", events); err == nil {
+		t.Error("expected subscribing to fail")
+	}
+	if srv.Attempts() != 1 {
+		t.Errorf("made %d attempts, expected 1", srv.Attempts())
+	}
+}
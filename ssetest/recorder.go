@@ -0,0 +1,121 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package ssetest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/r3labs/sse"
+)
+
+// Recorder collects the events a client receives on a stream
+type Recorder struct {
+	events  chan *sse.Event
+	client  *sse.Client
+	timeout time.Duration
+	t       testing.TB
+}
+
+// Record subscribes a client to a stream and records the events it receives.
+// The subscription ends when the test finishes. Helpers wait up to timeout
+// for events.
+func Record(t testing.TB, c *sse.Client, stream string, timeout time.Duration) *Recorder {
+	t.Helper()
+
+	r := &Recorder{
+		events:  make(chan *sse.Event, 1024),
+		client:  c,
+		timeout: timeout,
+		t:       t,
+	}
+
+	conn, err := c.SubscribeChan(stream, r.events)
+	if err != nil {
+		t.Fatalf("ssetest: subscribing to stream %q: %s", stream, err)
+	}
+	if conn != nil {
+		t.Cleanup(func() {
+			conn.Close()
+		})
+	}
+
+	return r
+}
+
+// Next returns the next event, failing the test if none arrives in time
+func (r *Recorder) Next() *sse.Event {
+	r.t.Helper()
+
+	select {
+	case ev, ok := <-r.events:
+		if !ok {
+			r.t.Fatal("ssetest: subscription ended while waiting for an event")
+		}
+		return ev
+	case <-time.After(r.timeout):
+		r.t.Fatal("ssetest: timed out waiting for an event")
+	}
+	return nil
+}
+
+// ExpectEvents checks that the next events received match the given ones,
+// ignoring ids unless they are set on the expected event
+func (r *Recorder) ExpectEvents(events ...*sse.Event) {
+	r.t.Helper()
+
+	for i, want := range events {
+		AssertEvent(r.t, r.Next(), want, "event %d", i)
+	}
+}
+
+// ExpectData checks that the next events received carry the given data
+func (r *Recorder) ExpectData(data ...string) {
+	r.t.Helper()
+
+	for i, want := range data {
+		if got := r.Next(); string(got.Data) != want {
+			r.t.Errorf("ssetest: event %d has data %q, expected %q", i, got.Data, want)
+		}
+	}
+}
+
+// ExpectNone checks that no event arrives within the given duration
+func (r *Recorder) ExpectNone(wait time.Duration) {
+	r.t.Helper()
+
+	select {
+	case ev, ok := <-r.events:
+		if ok {
+			r.t.Errorf("ssetest: unexpected event %s", ev)
+		}
+	case <-time.After(wait):
+	}
+}
+
+// AssertEvent checks that an event matches the expected one, ignoring its id
+// unless the expected event has one. The message, formatted with args,
+// identifies the event in failures.
+func AssertEvent(t testing.TB, got, want *sse.Event, msg string, args ...interface{}) {
+	t.Helper()
+
+	if got != nil && want != nil && want.ID == nil {
+		copied := *got
+		copied.ID = nil
+		got = &copied
+	}
+
+	if !got.Equal(want) {
+		t.Errorf("ssetest: "+msg+" is %s, expected %s", append(args, got, want)...)
+	}
+}
+
+// httpHandler serves events on /events
+func httpHandler(s *sse.Server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.HTTPHandler)
+	return mux
+}
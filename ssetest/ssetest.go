@@ -0,0 +1,116 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package ssetest provides an event stream server backed by httptest, along
+// with helpers for publishing events and checking the events a client
+// receives, for use in tests.
+//
+//	srv := ssetest.NewServer(t)
+//	rec := srv.Record("messages")
+//	srv.WaitForSubscriber("messages")
+//	srv.EmitN("messages", 3)
+//	rec.ExpectData("event 0", "event 1", "event 2")
+package ssetest
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/r3labs/sse"
+)
+
+// DefaultTimeout bounds how long helpers wait for subscribers and events
+// before failing the test
+const DefaultTimeout = 5 * time.Second
+
+// Server is an event stream server listening on a local address. Streams are
+// created when first requested.
+type Server struct {
+	*sse.Server
+	// HTTP is the underlying test server
+	HTTP *httptest.Server
+	// URL is the endpoint events are served on
+	URL string
+	// Timeout bounds how long helpers wait, DefaultTimeout by default
+	Timeout time.Duration
+
+	t testing.TB
+}
+
+// NewServer starts a server, which is closed when the test finishes
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	srv := sse.New()
+	srv.AutoStream = true
+
+	s := &Server{
+		Server:  srv,
+		HTTP:    httptest.NewServer(httpHandler(srv)),
+		Timeout: DefaultTimeout,
+		t:       t,
+	}
+	s.URL = s.HTTP.URL + "/events"
+
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close disconnects every client and shuts the server down
+func (s *Server) Close() {
+	// Handlers only return once their client has gone away
+	s.HTTP.CloseClientConnections()
+	s.HTTP.Close()
+	s.Server.Close()
+}
+
+// Client returns a client for the server
+func (s *Server) Client() *sse.Client {
+	return sse.NewClient(s.URL)
+}
+
+// EmitN publishes n events to a stream, with data "event 0" to "event n-1",
+// and returns them
+func (s *Server) EmitN(stream string, n int) []*sse.Event {
+	s.t.Helper()
+
+	s.CreateStream(stream)
+
+	events := make([]*sse.Event, n)
+	for i := range events {
+		events[i] = &sse.Event{Data: []byte(fmt.Sprintf("event %d", i))}
+		s.Publish(stream, events[i])
+	}
+	return events
+}
+
+// WaitForSubscriber waits for a client to subscribe to a stream, failing the
+// test if none does in time. The stream is created if it does not exist yet.
+func (s *Server) WaitForSubscriber(stream string) {
+	s.t.Helper()
+	s.WaitForSubscribers(stream, 1)
+}
+
+// WaitForSubscribers waits for at least n clients to subscribe to a stream
+func (s *Server) WaitForSubscribers(stream string, n int) {
+	s.t.Helper()
+
+	str := s.CreateStream(stream)
+	deadline := time.Now().Add(s.Timeout)
+	for str.SubscriberCount() < n {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("ssetest: timed out waiting for %d subscribers to stream %q", n, stream)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Record subscribes a new client to a stream and records the events it
+// receives
+func (s *Server) Record(stream string) *Recorder {
+	s.t.Helper()
+	return Record(s.t, s.Client(), stream, s.Timeout)
+}
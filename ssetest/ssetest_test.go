@@ -0,0 +1,44 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package ssetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/r3labs/sse"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer(t)
+	rec := srv.Record("messages")
+	srv.WaitForSubscriber("messages")
+
+	events := srv.EmitN("messages", 3)
+	rec.ExpectEvents(events...)
+
+	srv.Publish("messages", &sse.Event{Event: []byte("update"), Data: []byte("test")})
+	rec.ExpectEvents(&sse.Event{Event: []byte("update"), Data: []byte("test")})
+	rec.ExpectNone(50 * time.Millisecond)
+}
+
+func TestServerReplay(t *testing.T) {
+	srv := NewServer(t)
+	srv.EmitN("messages", 2)
+
+	rec := srv.Record("messages")
+	rec.ExpectData("event 0", "event 1")
+}
+
+func TestServerSubscribers(t *testing.T) {
+	srv := NewServer(t)
+	first := srv.Record("messages")
+	second := srv.Record("messages")
+	srv.WaitForSubscribers("messages", 2)
+
+	srv.EmitN("messages", 1)
+	first.ExpectData("event 0")
+	second.ExpectData("event 0")
+}
@@ -0,0 +1,104 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// StreamStats counts the activity of a stream since it was created, such as
+// for exporting as metrics, see Server.Stats
+type StreamStats struct {
+	// Number of subscribers connected to the stream
+	Subscribers int
+	// Number of events published to the stream, not counting comments on
+	// their own such as heartbeats
+	Published uint64
+	// Number of events that were not delivered to a subscriber, as it was
+	// too slow or writing to it failed, see Stream.Backpressure
+	Dropped uint64
+	// Number of bytes written to subscribers
+	BytesWritten uint64
+}
+
+// streamCounters counts the activity of a stream
+type streamCounters struct {
+	published atomic.Uint64
+	dropped   atomic.Uint64
+	written   atomic.Uint64
+}
+
+// Stats returns the counts of the stream's activity
+func (str *Stream) Stats() StreamStats {
+	return StreamStats{
+		Subscribers:  int(atomic.LoadInt32(&str.watchers)),
+		Published:    str.counters.published.Load(),
+		Dropped:      str.counters.dropped.Load(),
+		BytesWritten: str.counters.written.Load(),
+	}
+}
+
+// Stats returns the counts of the activity of every stream, by id. The
+// counts of a stream are gone once it is removed.
+func (s *Server) Stats() map[string]StreamStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]StreamStats, len(s.Streams))
+	for id, str := range s.Streams {
+		stats[id] = str.Stats()
+	}
+	return stats
+}
+
+// meteredWriter counts the bytes written to a subscriber
+type meteredWriter struct {
+	io.Writer
+	written *atomic.Uint64
+}
+
+func (w meteredWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.written.Add(uint64(n))
+	return n, err
+}
+
+// countPublished counts an event as published unless it is only a comment,
+// such as a heartbeat
+func (str *Stream) countPublished(event *Event) {
+	if !isCommentOnly(event) {
+		str.counters.published.Add(1)
+	}
+}
+
+// ClientStats counts the activity of a client's subscriptions since it was
+// created, see Client.Stats
+type ClientStats struct {
+	// Number of events received and passed on to handlers or channels
+	Events uint64
+	// Number of errors reported to OnError, such as for events that could
+	// not be parsed
+	Errors uint64
+	// Number of times a subscription connected again after losing its
+	// connection. Retries of a first connection are not counted.
+	Reconnects uint64
+}
+
+// clientCounters counts the activity of a client
+type clientCounters struct {
+	events     atomic.Uint64
+	errors     atomic.Uint64
+	reconnects atomic.Uint64
+}
+
+// Stats returns the counts of the client's activity
+func (c *Client) Stats() ClientStats {
+	return ClientStats{
+		Events:     c.counters.events.Load(),
+		Errors:     c.counters.errors.Load(),
+		Reconnects: c.counters.reconnects.Load(),
+	}
+}
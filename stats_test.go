@@ -0,0 +1,142 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStats(t *testing.T) {
+	Convey("Given a server and a subscribed client", t, func() {
+		s := New()
+		s.AutoReplay = false
+		s.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		c := NewClient(server.URL)
+		c.EncodingBase64 = true
+		events := make(chan *Event, 10)
+		go c.SubscribeChan("test", events)
+		for s.getStream("test").SubscriberCount() == 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		s.EncodeBase64 = true
+		for i := 0; i < 3; i++ {
+			s.Publish("test", &Event{Data: []byte("hello")})
+		}
+		s.EncodeBase64 = false
+		s.Publish("test", &Event{Data: []byte("not base64!")})
+		for i := 0; i < 3; i++ {
+			_, err := wait(events, time.Second)
+			So(err, ShouldBeNil)
+		}
+		// The invalid event is reported once it has been written
+		for deadline := time.Now().Add(time.Second); c.Stats().Errors == 0 && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		Convey("The server should count what it published and wrote", func() {
+			stats := s.Stats()["test"]
+			So(stats.Subscribers, ShouldEqual, 1)
+			So(stats.Published, ShouldEqual, 4)
+			So(stats.Dropped, ShouldEqual, 0)
+			So(stats.BytesWritten, ShouldBeGreaterThan, 4*len("data: \n\n"))
+		})
+
+		Convey("Comments on their own should not count as published", func() {
+			s.Publish("test", &Event{Comment: []byte("note")})
+			s.Publish("test", &Event{Data: []byte("aGVsbG8=")})
+			_, err := wait(events, time.Second)
+			So(err, ShouldBeNil)
+			So(s.Stats()["test"].Published, ShouldEqual, 5)
+		})
+
+		Convey("The client should count what it received", func() {
+			stats := c.Stats()
+			So(stats.Events, ShouldEqual, 3)
+			So(stats.Errors, ShouldEqual, 1)
+			So(stats.Reconnects, ShouldEqual, 0)
+		})
+
+		Convey("Events slow subscribers miss should be counted", func() {
+			str := s.CreateStream("slow")
+			str.SubscriberBuffer = 1
+			str.Backpressure = BackpressureDropNewest
+			str.addSubscriber("0")
+			for i := 0; i < 3; i++ {
+				s.Publish("slow", &Event{Data: []byte("tick")})
+			}
+
+			for deadline := time.Now().Add(time.Second); str.Stats().Dropped < 2 && time.Now().Before(deadline); {
+				time.Sleep(5 * time.Millisecond)
+			}
+			So(str.Stats().Dropped, ShouldEqual, 2)
+		})
+	})
+
+	Convey("Given a server failing to accept a client and then dropping it", t, func() {
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch attempts.Add(1) {
+			case 1, 2:
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			case 3:
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte("data: first\n\n"))
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: second\n\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+		})
+
+		c := NewClient(server.URL)
+		clk := newFakeClock()
+		c.clock = clk
+		go clk.advanceAll()
+		defer clk.stop()
+
+		Convey("Only reconnecting after the drop should count", func() {
+			received := make(chan string, 2)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.SubscribeWithContext(ctx, "", func(msg *Event) {
+				received <- string(msg.Data)
+			})
+
+			for _, want := range []string{"first", "second"} {
+				select {
+				case data := <-received:
+					So(data, ShouldEqual, want)
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeEmpty)
+				}
+			}
+			So(c.Stats().Reconnects, ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,134 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "fmt"
+
+// storeQueueSize is the number of events waiting to be put in the EventStore,
+// beyond which the stream waits for the store
+const storeQueueSize = 1024
+
+// EventStore keeps the events of streams for replay in place of their
+// eventlogs, such as in Redis or a database, so clients can resume after the
+// server restarts or on another server behind a load balancer. Ids have to be
+// the same on every server for that, see Stream.KeepIDs.
+//
+// Put is called from a goroutine of the stream's own, in the order events are
+// delivered, and Range from the writers of subscribers, so the stream is not
+// held up by the store. Pooled subscribers, see DispatchPooled, range over it
+// on goroutines of their own instead of their shared writers. Subscribers are replayed the events put before they
+// subscribed, and are sent those stored since then live. Servers sharing a
+// store through a Broker each put the events they deliver, so such a store
+// should ignore events whose id it holds already.
+type EventStore interface {
+	// Put stores an event published to a stream, once it has its id
+	Put(stream string, e *Event)
+	// Range returns the events of a stream from the given id on, including
+	// it, oldest first, or all of them if the id is empty
+	Range(stream, fromID string) ([]*Event, error)
+}
+
+// storeOp is an event to put in the EventStore, or else a barrier closed once
+// the events queued before it have been put
+type storeOp struct {
+	event   *Event
+	flushed chan struct{}
+}
+
+// put queues an event to be put in the EventStore, or puts it right away if
+// the stream is not running yet, such as when seeding it
+func (str *Stream) put(event *Event) {
+	if str.stores == nil {
+		str.EventStore.Put(str.id, event)
+		return
+	}
+	str.stores <- storeOp{event: event}
+}
+
+// writeStore puts the events queued by the stream in the EventStore until the
+// stream is closed
+func (str *Stream) writeStore(ops <-chan storeOp) {
+	for op := range ops {
+		if op.flushed != nil {
+			close(op.flushed)
+			continue
+		}
+		str.EventStore.Put(str.id, op.event)
+	}
+}
+
+// replayStored queues the replay of the stored events a subscriber resumes
+// from. It is ranged over once the events published before the subscriber was
+// registered have been put.
+func (str *Stream) replayStored(sub *Subscriber) {
+	flushed := make(chan struct{})
+	if str.stores == nil {
+		// Events are put right away while the stream is not running
+		close(flushed)
+	} else {
+		str.stores <- storeOp{flushed: flushed}
+	}
+
+	sub.connection <- &Event{kept: true, pages: &replayPages{
+		size:     str.ReplayPageSize,
+		interval: str.ReplayPageInterval,
+		wants:    sub.wants,
+		clock:    clockOrSystem(str.clock),
+		load: func() []*Event {
+			<-flushed
+			return str.stored(sub)
+		},
+	}}
+	sub.notify()
+}
+
+// stored returns the events of the EventStore from a subscriber's position.
+// Errors are reported and leave the subscriber with live events only.
+func (str *Stream) stored(sub *Subscriber) []*Event {
+	events, err := str.EventStore.Range(str.id, sub.eventid)
+	if err != nil {
+		if str.report != nil {
+			str.report(fmt.Errorf("failed to replay stream %s: %s", str.id, err))
+		}
+		return nil
+	}
+	return events
+}
+
+// replayStoredEvents starts replaying the events loaded from the EventStore,
+// which live events the subscriber holds already may be among
+func (s *Subscriber) replayStoredEvents(events []*Event) {
+	s.pages.events = events
+	if len(events) == 0 {
+		return
+	}
+	s.replayed = make(map[string]struct{}, len(events))
+	for _, ev := range events {
+		s.replayed[string(ev.ID)] = struct{}{}
+	}
+
+	live := s.pages.live[:0]
+	for _, ev := range s.pages.live {
+		if !s.replayedLive(ev) {
+			live = append(live, ev)
+		}
+	}
+	s.pages.live = live
+}
+
+// replayedLive reports whether a live event was replayed from the EventStore
+// already, having been put before the subscriber's writer ranged over it.
+// Events are put in the order they are delivered, so once one was not
+// replayed, neither were any after it.
+func (s *Subscriber) replayedLive(ev *Event) bool {
+	if s.replayed == nil || len(ev.ID) == 0 {
+		return false
+	}
+	if _, ok := s.replayed[string(ev.ID)]; ok {
+		return true
+	}
+	s.replayed = nil
+	return false
+}
@@ -0,0 +1,334 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// memoryStore is an EventStore keeping events in memory
+type memoryStore struct {
+	mu     sync.Mutex
+	events map[string][]*Event
+	err    error
+	// Puts and ranges wait for these while they are set
+	putGate, rangeGate chan struct{}
+}
+
+func (m *memoryStore) Put(stream string, e *Event) {
+	m.mu.Lock()
+	gate := m.putGate
+	m.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.events == nil {
+		m.events = make(map[string][]*Event)
+	}
+	m.events[stream] = append(m.events[stream], e)
+}
+
+func (m *memoryStore) Range(stream, fromID string) ([]*Event, error) {
+	m.mu.Lock()
+	gate := m.rangeGate
+	m.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	// Ids are in the order they were put, and the position is included
+	var events []*Event
+	for i, e := range m.events[stream] {
+		if fromID == "" || string(e.ID) == fromID {
+			events = m.events[stream][i:]
+			break
+		}
+	}
+	return append([]*Event(nil), events...), nil
+}
+
+func (m *memoryStore) stored(stream string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.events[stream])
+}
+
+// written takes n events from a subscriber as its writer would
+func written(sub *Subscriber, n int) []*Event {
+	events := make(chan *Event, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			ev, ok := sub.next()
+			if !ok {
+				break
+			}
+			events <- ev
+		}
+		close(events)
+	}()
+
+	var received []*Event
+	timeout := time.After(time.Second)
+	for len(received) < n {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return received
+			}
+			received = append(received, ev)
+		case <-timeout:
+			return received
+		}
+	}
+	return received
+}
+
+func TestEventStore(t *testing.T) {
+	Convey("Given a server keeping events in a store", t, func() {
+		store := &memoryStore{}
+		s := New()
+		s.EventStore = store
+		str := s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		for i := 0; i < 3; i++ {
+			s.Publish("test", &Event{Data: []byte(strconv.Itoa(i))})
+		}
+		sub := str.addSubscriber("0")
+		So(written(sub, 3), ShouldHaveLength, 3)
+
+		Convey("Events should be stored instead of kept in the eventlog", func() {
+			So(store.stored("test"), ShouldEqual, 3)
+			So(str.Eventlog, ShouldBeEmpty)
+		})
+
+		Convey("Events should be stored without holding up the stream", func() {
+			store.mu.Lock()
+			store.putGate = make(chan struct{})
+			store.mu.Unlock()
+			defer close(store.putGate)
+
+			s.Publish("test", &Event{Data: []byte("slow")})
+			counted := make(chan int, 1)
+			go func() {
+				counted <- str.SubscriberCount()
+			}()
+
+			select {
+			case n := <-counted:
+				So(n, ShouldEqual, 1)
+			case <-time.After(time.Second):
+				So("stream held up", ShouldBeEmpty)
+			}
+		})
+
+		Convey("Events stored while a subscriber ranges over the store should be sent once", func() {
+			store.mu.Lock()
+			store.rangeGate = make(chan struct{})
+			store.mu.Unlock()
+
+			late := str.addSubscriber("1")
+			received := make(chan []*Event, 1)
+			go func() {
+				received <- written(late, 3)
+			}()
+
+			s.Publish("test", &Event{Data: []byte("3")})
+			for store.stored("test") < 4 {
+				time.Sleep(time.Millisecond)
+			}
+			close(store.rangeGate)
+
+			events := <-received
+			So(events, ShouldHaveLength, 3)
+			for i, ev := range events {
+				So(string(ev.Data), ShouldEqual, strconv.Itoa(i+1))
+			}
+			s.Publish("test", &Event{Data: []byte("4")})
+			So(string(written(late, 1)[0].Data), ShouldEqual, "4")
+		})
+
+		Convey("A server started with the same store", func() {
+			other := New()
+			other.EventStore = store
+			ostr := other.CreateStream("test")
+
+			Reset(func() {
+				other.Close()
+			})
+
+			Convey("Should replay the stored events from a client's position", func() {
+				sub := ostr.addSubscriber("1")
+				received := written(sub, 2)
+				So(received, ShouldHaveLength, 2)
+				So(string(received[0].Data), ShouldEqual, "1")
+				So(string(received[1].Data), ShouldEqual, "2")
+				So(len(sub.connection), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the store fails", func() {
+			errs := make(chan error, 1)
+			s.OnError = func(r *http.Request, err error) {
+				errs <- err
+			}
+			store.mu.Lock()
+			store.err = errors.New("unavailable")
+			store.mu.Unlock()
+
+			sub := str.addSubscriber("0")
+
+			Convey("The error should be reported by the subscriber's writer", func() {
+				// The subscriber's queue is closed along with the server
+				go sub.next()
+				select {
+				case err := <-errs:
+					So(err.Error(), ShouldContainSubstring, "unavailable")
+				case <-time.After(time.Second):
+					So("no error", ShouldBeEmpty)
+				}
+			})
+
+			Convey("The subscriber should receive live events", func() {
+				s.Publish("test", &Event{Data: []byte("live")})
+				received := written(sub, 1)
+				So(received, ShouldHaveLength, 1)
+				So(string(received[0].Data), ShouldEqual, "live")
+			})
+		})
+	})
+
+	Convey("Given a store of events with ids of their own", t, func() {
+		store := &memoryStore{}
+		s := New()
+		s.EventStore = store
+		s.KeepIDs = true
+		str := s.CreateStream("test")
+
+		Reset(func() {
+			s.Close()
+		})
+
+		for _, id := range []string{"a", "b", "c"} {
+			s.Publish("test", &Event{ID: []byte(id), Data: []byte(id)})
+		}
+		for store.stored("test") < 3 {
+			time.Sleep(time.Millisecond)
+		}
+
+		Convey("Replay should start from the client's position like the eventlog does", func() {
+			sub := str.addSubscriber("b")
+			received := written(sub, 2)
+			So(received, ShouldHaveLength, 2)
+			So(string(received[0].ID), ShouldEqual, "b")
+			So(string(received[1].ID), ShouldEqual, "c")
+		})
+	})
+}
+
+func TestEventStorePooled(t *testing.T) {
+	Convey("Given a pooled server with a single writer keeping events in a store", t, func() {
+		store := &memoryStore{}
+		s := New()
+		s.EventStore = store
+		s.DispatchMode = DispatchPooled
+		s.DispatchWorkers = 1
+		s.CreateStream("test")
+
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+		Reset(func() {
+			server.Close()
+			s.Close()
+		})
+
+		s.Publish("test", &Event{Data: []byte("1")})
+		first := make(chan *Event)
+		_, err := NewClient(server.URL).SubscribeChan("test", first)
+		So(err, ShouldBeNil)
+		msg, err := wait(first, time.Second)
+		So(err, ShouldBeNil)
+		So(string(msg), ShouldEqual, "1")
+
+		Convey("A slow store should not hold up the other subscribers of the writer", func() {
+			store.mu.Lock()
+			store.rangeGate = make(chan struct{})
+			store.mu.Unlock()
+
+			second := make(chan *Event)
+			_, err := NewClient(server.URL).SubscribeChan("test", second)
+			So(err, ShouldBeNil)
+			for s.getStream("test").SubscriberCount() < 2 {
+				time.Sleep(time.Millisecond)
+			}
+
+			s.Publish("test", &Event{Data: []byte("2")})
+			msg, err := wait(first, time.Second)
+			So(err, ShouldBeNil)
+			So(string(msg), ShouldEqual, "2")
+
+			Convey("The subscriber should be replayed the store once it has been ranged over", func() {
+				for store.stored("test") < 2 {
+					time.Sleep(time.Millisecond)
+				}
+				close(store.rangeGate)
+
+				for _, data := range []string{"1", "2"} {
+					msg, err := wait(second, time.Second)
+					So(err, ShouldBeNil)
+					So(string(msg), ShouldEqual, data)
+				}
+				s.Publish("test", &Event{Data: []byte("3")})
+				msg, err := wait(second, time.Second)
+				So(err, ShouldBeNil)
+				So(string(msg), ShouldEqual, "3")
+			})
+		})
+	})
+
+	Convey("Given a stream keeping events in a store that is not running", t, func() {
+		store := &memoryStore{}
+		str := newStream(1024, true)
+		str.EventStore = store
+		str.put(&Event{ID: []byte("1"), Data: []byte("1")})
+
+		Convey("Replay should be queued without waiting for the stream", func() {
+			sub := str.newSubscriber("")
+			queued := make(chan struct{})
+			go func() {
+				str.replayStored(sub)
+				close(queued)
+			}()
+
+			select {
+			case <-queued:
+			case <-time.After(time.Second):
+				So("replay held up", ShouldBeEmpty)
+			}
+			received := written(sub, 1)
+			So(received, ShouldHaveLength, 1)
+			So(string(received[0].Data), ShouldEqual, "1")
+		})
+	})
+}
@@ -4,17 +4,157 @@
 
 package sse
 
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Names of the control events delimiting replayed history
+const (
+	ReplayStartEvent = "replay-start"
+	ReplayEndEvent   = "replay-end"
+)
+
 // Stream ...
 type Stream struct {
 	// Enables replaying of eventlog to newly added subscribers
-	AutoReplay  bool
-	Eventlog    EventLog
-	stats       chan chan int
-	subscribers []*Subscriber
-	register    chan *Subscriber
-	deregister  chan *Subscriber
-	event       chan *Event
-	quit        chan bool
+	AutoReplay bool
+	// Wraps replayed events in ReplayStartEvent and ReplayEndEvent control
+	// events, so subscribers can tell history apart from live events
+	ReplayMarkers bool
+	// Bounds the number of events kept in the eventlog for replay, dropping
+	// the oldest ones first. Zero keeps every event.
+	ReplaySize int
+	// Drops events from the eventlog once they have been kept this long, so
+	// reconnecting clients are not sent stale history. Events recorded while
+	// it was zero carry no timestamp and are left to ReplaySize. Zero keeps
+	// events regardless of their age.
+	ReplayTTL time.Duration
+	// Replays history in pages of this many events, each followed by a
+	// ReplayPageEvent, so clients catching up on a large backlog do not
+	// get it in one burst. The history is written by the subscriber's own
+	// writer rather than queued by the stream. Zero replays it at once.
+	ReplayPageSize int
+	// Pause between pages of replayed history, during which no other
+	// events are written to the subscriber apart from priority ones. Live
+	// events are held back meanwhile, and subscribers holding back too many
+	// of them are disconnected.
+	ReplayPageInterval time.Duration
+	// Keeps the ids events are published with when AutoReplay is enabled,
+	// instead of replacing them with sequence numbers. Replay relies on ids
+	// being increasing numbers, so they have to be.
+	KeepIDs bool
+	// Generates the ids of events in place of their sequence numbers, such
+	// as NewULIDGenerator
+	IDGenerator IDGenerator
+	// Keeps the last this many events with their delivery to each
+	// subscriber, see DebugLog. Zero disables the debug log.
+	DebugSize int
+	// Limits the number of subscribers, further clients are turned away
+	// with 503 Service Unavailable. Zero means no limit.
+	MaxSubscribers int
+	// Interval of comments sent to every subscriber, keeping idle
+	// connections open through proxies. Zero disables them.
+	KeepAlive time.Duration
+	// Decides whether a request may subscribe to the stream. Requests it
+	// returns an error for are rejected like those of Server.Authorize.
+	Authorize func(r *http.Request) error
+	// Drops events published while the stream has no subscribers, rather
+	// than recording them for replay, see Server.OnNoSubscribers
+	SkipUnwatched bool
+	// Rejects events posted to Server.IngestHandler, so the stream can only
+	// be published to by the server's own publishers, such as a Relay
+	ReadOnly bool
+	// Removes the stream once it has had neither events published nor
+	// subscribers for this long. Zero keeps it until it is removed.
+	IdleTTL time.Duration
+	// Compresses the data of events kept in the eventlog, which is
+	// decompressed again when they are replayed. This trades CPU for memory
+	// on streams with large, compressible events. The data of compressed
+	// events in Eventlog is gzip compressed.
+	CompressReplay bool
+	// Limits the rate events are published at, see LimitPolicy. Priority
+	// events are not limited. Nil publishes events as they come.
+	Limiter *rate.Limiter
+	// What Publish does with events over the rate of Limiter
+	LimitPolicy LimitPolicy
+	// Gives every subscriber a limiter allowing this many live events per
+	// second, with bursts of SubscriberBurst, so clients that only need a
+	// few updates, such as dashboards, are not sent every one. Zero leaves
+	// subscribers unlimited. See Subscriber.Limit.
+	SubscriberRate  rate.Limit
+	SubscriberBurst int
+	// What happens to events over SubscriberRate. LimitReject drops them,
+	// while any other policy coalesces them, as the stream can not wait for
+	// a single subscriber.
+	SubscriberLimitPolicy LimitPolicy
+	// Number of events queued for each subscriber, DefaultSubscriberBuffer
+	// if zero
+	SubscriberBuffer int
+	// What the stream does with events for subscribers whose queue is full
+	Backpressure Backpressure
+	// Called from the stream's goroutine with every event a subscriber
+	// misses due to Backpressure, which should not block
+	OnDrop func(stream string, sub *Subscriber, event *Event)
+	// Keeps the events replayed to subscribers in place of Eventlog, along
+	// with their ReplaySize, ReplayTTL and CompressReplay, which are left to
+	// the store. Nil keeps them in Eventlog, in memory.
+	EventStore EventStore
+	// Sends subscribers a control event when the stream is closed, see
+	// Server.ControlEvents
+	ControlEvents bool
+	Eventlog      EventLog
+	debug         *debugLog
+	stats         chan chan int
+	listing       chan chan []*Subscriber
+	updates       chan Config
+	keepAlives    chan time.Duration
+	subscribers   []*Subscriber
+	register      chan *Subscriber
+	deregister    chan *Subscriber
+	event         chan *Event
+	urgent        chan *Event
+	// Subscribers whose held back event is within their limit
+	release  chan *Subscriber
+	quit     chan string
+	done     chan struct{}
+	sequence uint64
+	watchers int32
+	// Last id given to a subscriber, see Server.Subscribers
+	subscriberIDs uint64
+	// First event in the eventlog, see Server.Backfill
+	oldest atomic.Pointer[Event]
+	// Called once the stream has been idle for IdleTTL
+	expire func()
+	// When events were last published or subscribers last connected or
+	// left, in nanoseconds, see expired
+	lastActive atomic.Int64
+	// Events waiting to be put in the EventStore, see writeStore
+	stores chan storeOp
+	// Reports errors of the EventStore and of seal
+	report func(error)
+	// Encrypts the data of events once they have their id, see Server.Keys
+	seal func(*Event) error
+	// Id the stream is registered under, see StreamLabel
+	id string
+	// Event held back by LimitCoalesce
+	coalescer coalescer
+	// Set once KeepAlive has been overridden by SetKeepAlive
+	ownKeepAlive bool
+	// Set for streams created from a template, which owns their settings
+	templated bool
+	// Runs the stream's goroutines, see Server.background. Streams not
+	// started by a server run them on their own.
+	background func(func())
+	// Counts the activity of the stream, see Stats
+	counters streamCounters
+	// Source of time, the system clock if nil
+	clock clock
 }
 
 // StreamRegistration ...
@@ -31,20 +171,90 @@ func newStream(bufsize int, replay bool) *Stream {
 		register:    make(chan *Subscriber),
 		deregister:  make(chan *Subscriber),
 		event:       make(chan *Event, bufsize),
-		quit:        make(chan bool),
+		urgent:      make(chan *Event, bufsize),
+		release:     make(chan *Subscriber),
+		stats:       make(chan chan int),
+		listing:     make(chan chan []*Subscriber),
+		updates:     make(chan Config),
+		keepAlives:  make(chan time.Duration),
+		quit:        make(chan string),
+		done:        make(chan struct{}),
 		Eventlog:    make(EventLog, 0),
 	}
 }
 
 func (str *Stream) run() {
-	go func(str *Stream) {
+	if str.DebugSize > 0 {
+		str.debug = newDebugLog(str.DebugSize)
+	}
+
+	if str.EventStore != nil {
+		str.stores = make(chan storeOp, storeQueueSize)
+		stores := str.stores
+		str.goroutine(func() {
+			str.writeStore(stores)
+		})
+	}
+
+	str.goroutine(func() {
+		// Streams may be created while serving a request, whose labels
+		// would otherwise be inherited
+		pprof.SetGoroutineLabels(profileLabels(context.Background(), str.id, ""))
+
+		clk := clockOrSystem(str.clock)
+
+		var keepAlive <-chan time.Time
+		var ticker timer
+		heartbeat := func() {
+			if ticker != nil {
+				ticker.Stop()
+				ticker, keepAlive = nil, nil
+			}
+			if str.KeepAlive > 0 {
+				ticker = clk.NewTicker(str.KeepAlive)
+				keepAlive = ticker.C()
+			}
+		}
+		heartbeat()
+		defer func() {
+			if ticker != nil {
+				ticker.Stop()
+			}
+		}()
+
+		var idle <-chan time.Time
+		var idleTimer timer
+		str.touch(clk.Now())
+		if str.IdleTTL > 0 && str.expire != nil {
+			idleTimer = clk.NewTimer(str.IdleTTL)
+			defer idleTimer.Stop()
+			idle = idleTimer.C()
+		}
+
 		for {
+			// Priority events overtake everything waiting on the stream
+			select {
+			case event := <-str.urgent:
+				str.countPublished(event)
+				str.dispatchUrgent(event)
+				continue
+			default:
+			}
+
 			select {
 			// Add new subscriber
 			case subscriber := <-str.register:
+				if subscriber.admitted != nil {
+					full := str.MaxSubscribers > 0 && len(str.subscribers) >= str.MaxSubscribers
+					subscriber.admitted <- !full
+					if full {
+						break
+					}
+				}
 				str.subscribers = append(str.subscribers, subscriber)
+				str.countSubscribers()
 				if str.AutoReplay {
-					str.Eventlog.Replay(subscriber)
+					str.replay(subscriber)
 				}
 
 			// Remove closed subscriber
@@ -53,28 +263,337 @@ func (str *Stream) run() {
 				if i != -1 {
 					str.removeSubscriber(i)
 				}
+				if len(str.subscribers) == 0 {
+					str.touch(clk.Now())
+				}
 
 			// Publish event to subscribers
 			case event := <-str.event:
-				if str.AutoReplay {
-					str.Eventlog.Add(event)
+				str.touch(clk.Now())
+				// Comments on their own, such as heartbeats, are neither
+				// numbered, counted nor replayed
+				if !isCommentOnly(event) {
+					str.counters.published.Add(1)
+					str.sequenceEvent(event)
+					if !str.encrypt(event) {
+						break
+					}
+					if str.AutoReplay {
+						str.record(event)
+					}
+					if str.debug != nil {
+						str.debug.record(event)
+					}
+				}
+				str.deliver(event)
+
+			// Publish priority event to subscribers
+			case event := <-str.urgent:
+				str.countPublished(event)
+				str.dispatchUrgent(event)
+
+			// Keep idle connections open
+			case <-keepAlive:
+				str.offer(&Event{Comment: []byte("ping")})
+
+			// Remove the stream once it has been idle for long enough. The
+			// timer is not reset on activity, but rearmed for the rest of
+			// the idle period when it fires. The server checks again that
+			// the stream is idle before removing it, as it may have been
+			// used meanwhile, in which case it is checked again later.
+			case <-idle:
+				remaining := str.IdleTTL - clk.Now().Sub(str.activeAt())
+				switch {
+				case len(str.subscribers) > 0:
+					idleTimer.Reset(str.IdleTTL)
+				case remaining > 0:
+					idleTimer.Reset(remaining)
+				default:
+					idleTimer.Reset(str.IdleTTL)
+					str.goroutine(str.expire)
 				}
-				for i := range str.subscribers {
-					str.subscribers[i].connection <- event
+
+			// Queue events held back by a subscriber's limiter
+			case sub := <-str.release:
+				str.released(sub)
+
+			// Report the number of subscribers
+			case reply := <-str.stats:
+				reply <- len(str.subscribers)
+
+			// Report the subscribers themselves
+			case reply := <-str.listing:
+				reply <- append([]*Subscriber(nil), str.subscribers...)
+
+			// Take on settings changed while the server is running
+			case cfg := <-str.updates:
+				str.MaxSubscribers = cfg.MaxSubscribers
+				str.ReplaySize = cfg.ReplaySize
+				str.trim()
+				if !str.ownKeepAlive && str.KeepAlive != cfg.KeepAlive {
+					str.KeepAlive = cfg.KeepAlive
+					heartbeat()
 				}
 
+			// Override the server's keep-alive interval
+			case interval := <-str.keepAlives:
+				str.KeepAlive, str.ownKeepAlive = interval, true
+				heartbeat()
+
 			// Shutdown if the server closes
-			case <-str.quit:
+			case control := <-str.quit:
+				if control != "" && str.ControlEvents {
+					str.sendControl(control)
+				}
 				// remove connections
 				str.removeAllSubscribers()
+				if str.stores != nil {
+					close(str.stores)
+				}
+				close(str.done)
 				return
 			}
 		}
-	}(str)
+	})
+}
+
+// goroutine runs f in a goroutine the server waits for, see Server.Run
+func (str *Stream) goroutine(f func()) {
+	if str.background == nil {
+		go f()
+		return
+	}
+	str.background(f)
+}
+
+// SubscriberCount returns the number of subscribers connected to the stream.
+// It returns zero once the stream has been closed.
+func (str *Stream) SubscriberCount() int {
+	reply := make(chan int, 1)
+	select {
+	case str.stats <- reply:
+		return <-reply
+	case <-str.done:
+		return 0
+	}
+}
+
+// listSubscribers returns the subscribers connected to the stream, or none
+// once it has been closed
+func (str *Stream) listSubscribers() []*Subscriber {
+	reply := make(chan []*Subscriber, 1)
+	select {
+	case str.listing <- reply:
+		return <-reply
+	case <-str.done:
+		return nil
+	}
+}
+
+// join registers sub unless the stream already has as many subscribers as
+// MaxSubscribers allows, and reports whether it did. It returns false once
+// the stream has been closed.
+func (str *Stream) join(sub *Subscriber) bool {
+	sub.admitted = make(chan bool, 1)
+	select {
+	case str.register <- sub:
+		return <-sub.admitted
+	case <-str.done:
+		return false
+	}
+}
+
+// update applies the stream settings of cfg, unless the stream has been closed
+func (str *Stream) update(cfg Config) {
+	select {
+	case str.updates <- cfg:
+	case <-str.done:
+	}
+}
+
+// SetKeepAlive changes the interval of keep-alive comments of a running
+// stream, which then keeps it when the server's settings are updated. Zero
+// disables them.
+func (str *Stream) SetKeepAlive(interval time.Duration) {
+	select {
+	case str.keepAlives <- interval:
+	case <-str.done:
+	}
+}
+
+// HasSubscribers reports whether any subscriber is connected to the stream,
+// such as to skip building events nobody would receive. Unlike
+// SubscriberCount, it does not wait for the stream to process pending
+// registrations.
+func (str *Stream) HasSubscribers() bool {
+	return atomic.LoadInt32(&str.watchers) > 0
+}
+
+// touch records activity on the stream at t
+func (str *Stream) touch(t time.Time) {
+	str.lastActive.Store(t.UnixNano())
+}
+
+// activeAt returns when the stream was last active
+func (str *Stream) activeAt() time.Time {
+	return time.Unix(0, str.lastActive.Load())
+}
+
+// expired reports whether the stream has been idle for IdleTTL at now, with
+// neither subscribers nor events waiting to be published
+func (str *Stream) expired(now time.Time) bool {
+	return atomic.LoadInt32(&str.watchers) == 0 && len(str.event) == 0 && len(str.urgent) == 0 &&
+		now.Sub(str.activeAt()) >= str.IdleTTL
+}
+
+// countSubscribers updates the count reported by HasSubscribers
+func (str *Stream) countSubscribers() {
+	atomic.StoreInt32(&str.watchers, int32(len(str.subscribers)))
+}
+
+// isCommentOnly reports whether an event carries nothing but a comment
+func isCommentOnly(event *Event) bool {
+	return len(event.Comment) > 0 && event.ID == nil && event.Data == nil &&
+		event.Event == nil && event.Retry == nil && len(event.Fields) == 0
+}
+
+// Sequence returns the number of events that have been sequenced on the stream.
+// Events are numbered from zero in the order they are dispatched, regardless of
+// how many goroutines publish to the stream concurrently, and are sent to every
+// subscriber in that order. The stream's goroutine is the only one numbering
+// and dispatching events, which is what enforces the order.
+func (str *Stream) Sequence() uint64 {
+	return atomic.LoadUint64(&str.sequence)
+}
+
+// sequenceEvent assigns the next sequence number to an event as its id, or the
+// id IDGenerator returns for it. Ids set by the publisher are kept, unless the
+// event is recorded in the eventlog, which relies on sequential ids to replay
+// events, and KeepIDs is not set.
+func (str *Stream) sequenceEvent(event *Event) {
+	seq := atomic.AddUint64(&str.sequence, 1) - 1
+	if (str.AutoReplay && !str.KeepIDs) || len(event.ID) == 0 {
+		event.ID = str.nextID(seq)
+	}
+}
+
+// encrypt seals the data of an event with seal, reporting false if the event
+// can not be sent
+func (str *Stream) encrypt(event *Event) bool {
+	if str.seal == nil {
+		return true
+	}
+	if err := str.seal(event); err != nil {
+		str.report(err)
+		return false
+	}
+	return true
+}
+
+// seed records copies of events in the eventlog before the stream is started
+func (str *Stream) seed(events []*Event) {
+	for _, event := range events {
+		seeded := *event
+		str.sequenceEvent(&seeded)
+		if str.AutoReplay {
+			str.record(&seeded)
+		}
+	}
+}
+
+// record adds an event to the eventlog, dropping the oldest event once the
+// log holds ReplaySize events
+func (str *Stream) record(event *Event) {
+	if str.EventStore != nil {
+		str.put(event)
+		return
+	}
+
+	str.Eventlog.Add(event)
+	if str.CompressReplay {
+		str.Eventlog[len(str.Eventlog)-1] = packEvent(event)
+	}
+	if str.ReplayTTL > 0 {
+		str.Eventlog[len(str.Eventlog)-1].recorded = clockOrSystem(str.clock).Now()
+	}
+	str.trim()
+}
+
+// trim drops the oldest events until the eventlog holds at most ReplaySize,
+// along with those kept for longer than ReplayTTL
+func (str *Stream) trim() {
+	for str.ReplaySize > 0 && len(str.Eventlog) > str.ReplaySize {
+		// Reslicing lets append reclaim the dropped events' slots once the
+		// log is reallocated
+		str.Eventlog[0] = nil
+		str.Eventlog = str.Eventlog[1:]
+	}
+	if str.ReplayTTL > 0 {
+		expired := clockOrSystem(str.clock).Now().Add(-str.ReplayTTL)
+		for len(str.Eventlog) > 0 && expiredBefore(str.Eventlog[0], expired) {
+			str.Eventlog[0] = nil
+			str.Eventlog = str.Eventlog[1:]
+		}
+	}
+	if len(str.Eventlog) > 0 {
+		str.oldest.Store(str.Eventlog[0])
+	}
+}
+
+// expiredBefore reports whether an event was recorded before the given time.
+// Events without a timestamp never expire.
+func expiredBefore(ev *Event, t time.Time) bool {
+	return !ev.recorded.IsZero() && ev.recorded.Before(t)
+}
+
+// replay sends the eventlog to a subscriber, delimited by control events when
+// replay markers are enabled
+func (str *Stream) replay(sub *Subscriber) {
+	str.trim()
+	log := str.Eventlog
+	replay := log.Replay
+	if str.EventStore != nil {
+		replay = str.replayStored
+	} else if str.ReplayPageSize > 0 {
+		replay = func(sub *Subscriber) {
+			str.paginate(sub, log)
+		}
+	}
+	if !str.ReplayMarkers {
+		replay(sub)
+		return
+	}
+
+	sub.connection <- &Event{Event: []byte(ReplayStartEvent), kept: true}
+	replay(sub)
+	sub.connection <- &Event{Event: []byte(ReplayEndEvent), kept: true}
+	sub.notify()
 }
 
 func (str *Stream) close() {
-	str.quit <- true
+	str.shutdown("")
+}
+
+// shutdown closes the stream, first sending subscribers the named control
+// event if ControlEvents is enabled
+func (str *Stream) shutdown(control string) {
+	str.quit <- control
+}
+
+// sendControl queues a control event on every subscriber that has room for it
+func (str *Stream) sendControl(name string) {
+	str.offer(&Event{Event: []byte(name), kept: true})
+}
+
+// offer queues an event on every subscriber that has room for it
+func (str *Stream) offer(event *Event) {
+	for _, sub := range str.subscribers {
+		select {
+		case sub.connection <- event:
+			sub.notify()
+		default:
+		}
+	}
 }
 
 func (str *Stream) getSubIndex(sub *Subscriber) int {
@@ -88,24 +607,41 @@ func (str *Stream) getSubIndex(sub *Subscriber) int {
 
 // addSubscriber will create a new subscriber on a stream
 func (str *Stream) addSubscriber(eventid string) *Subscriber {
-	sub := &Subscriber{
-		eventid:    eventid,
-		quit:       str.deregister,
-		connection: make(chan *Event, 64),
-	}
+	sub := str.newSubscriber(eventid)
 
 	str.register <- sub
 	return sub
 }
 
+// newSubscriber creates a subscriber without registering it on the stream
+func (str *Stream) newSubscriber(eventid string) *Subscriber {
+	return &Subscriber{
+		id:          atomic.AddUint64(&str.subscriberIDs, 1),
+		connected:   clockOrSystem(str.clock).Now(),
+		clock:       str.clock,
+		eventid:     eventid,
+		quit:        str.deregister,
+		done:        str.done,
+		connection:  make(chan *Event, str.subscriberBuffer()),
+		urgent:      make(chan *Event, urgentBufferSize),
+		counters:    &str.counters,
+		limiter:     newLimiter(str.SubscriberRate, str.SubscriberBurst),
+		limitPolicy: str.SubscriberLimitPolicy,
+	}
+}
+
 func (str *Stream) removeSubscriber(i int) {
 	close(str.subscribers[i].connection)
+	str.subscribers[i].notify()
 	str.subscribers = append(str.subscribers[:i], str.subscribers[i+1:]...)
+	str.countSubscribers()
 }
 
 func (str *Stream) removeAllSubscribers() {
 	for i := 0; i < len(str.subscribers); i++ {
 		close(str.subscribers[i].connection)
+		str.subscribers[i].notify()
 	}
 	str.subscribers = str.subscribers[:0]
+	str.countSubscribers()
 }
@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "bytes"
+
+// StreamParser incrementally parses an event stream. Bytes are fed to it with
+// Write as they arrive, and each event is handed to the handler as soon as the
+// blank line terminating it has been seen. Only the current line and the
+// fields of the event being parsed are buffered, never a whole frame.
+//
+// Every frame containing at least one field or comment is handed to the
+// handler, including ones that only carry an id, a retry interval or a
+// comment. A frame left incomplete at the end of the stream is discarded, as
+// required by the spec.
+type StreamParser struct {
+	handler func(*Event)
+	fields  fieldParser
+	event   Event
+	line    []byte
+	// Hand the parser's own Event to the handler instead of a copy. It is
+	// only valid until the handler returns.
+	borrow bool
+	// The previous write ended with "\r", so a leading "\n" completes it
+	skipLF bool
+}
+
+// NewStreamParser creates a parser handing each complete event to handler
+func NewStreamParser(handler func(*Event)) *StreamParser {
+	return &StreamParser{handler: handler}
+}
+
+// Write parses the next chunk of the stream. It always consumes all of p.
+func (sp *StreamParser) Write(p []byte) (int, error) {
+	n := len(p)
+
+	for len(p) > 0 {
+		if sp.skipLF {
+			sp.skipLF = false
+			if p[0] == '\n' {
+				p = p[1:]
+				continue
+			}
+		}
+
+		i := bytes.IndexAny(p, "\r\n")
+		if i < 0 {
+			sp.line = append(sp.line, p...)
+			break
+		}
+
+		// Lines split across writes are joined in the line buffer
+		line := p[:i]
+		if len(sp.line) > 0 {
+			sp.line = append(sp.line, line...)
+			line = sp.line
+		}
+
+		if p[i] == '\r' {
+			if i+1 == len(p) {
+				sp.skipLF = true
+			} else if p[i+1] == '\n' {
+				i++
+			}
+		}
+		p = p[i+1:]
+
+		sp.processLine(line)
+		sp.line = sp.line[:0]
+	}
+
+	return n, nil
+}
+
+// processLine parses a complete line, dispatching the event on a blank line
+func (sp *StreamParser) processLine(line []byte) {
+	if len(line) > 0 {
+		sp.fields.parseLine(line)
+		return
+	}
+
+	if sp.fields.malformed {
+		// Drop frames corrupted by garbage
+		sp.fields.reset()
+		return
+	}
+	if sp.fields.empty() {
+		return
+	}
+
+	sp.fields.fill(&sp.event)
+	if sp.borrow {
+		sp.handler(&sp.event)
+	} else {
+		sp.handler(copyEvent(&sp.event))
+	}
+	sp.fields.reset()
+}
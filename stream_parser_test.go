@@ -0,0 +1,64 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStreamParser(t *testing.T) {
+	Convey("Given a stream parser", t, func() {
+		var events []*Event
+		p := NewStreamParser(func(e *Event) {
+			events = append(events, e)
+		})
+
+		Convey("When an event arrives in a single write", func() {
+			p.Write([]byte("id: 1\ndata: test\n\n"))
+
+			Convey("It should be emitted", func() {
+				So(len(events), ShouldEqual, 1)
+				So(string(events[0].ID), ShouldEqual, "1")
+				So(string(events[0].Data), ShouldEqual, "test")
+			})
+		})
+
+		Convey("When an event arrives one byte at a time", func() {
+			stream := []byte("data: first\r\ndata: second\r\n\r\nevent: ping\r\r")
+			for i := range stream {
+				p.Write(stream[i : i+1])
+			}
+
+			Convey("Each event should be emitted once it is terminated", func() {
+				So(len(events), ShouldEqual, 2)
+				So(string(events[0].Data), ShouldEqual, "first\nsecond")
+				So(string(events[1].Event), ShouldEqual, "ping")
+			})
+		})
+
+		Convey("When the blank line has not arrived yet", func() {
+			p.Write([]byte("data: test\n"))
+
+			Convey("Nothing should be emitted", func() {
+				So(len(events), ShouldEqual, 0)
+			})
+
+			Convey("The event should be emitted with the blank line", func() {
+				p.Write([]byte("\n"))
+				So(len(events), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When several blank lines follow each other", func() {
+			p.Write([]byte("\n\n\ndata: test\n\n\n\n"))
+
+			Convey("Only complete events should be emitted", func() {
+				So(len(events), ShouldEqual, 1)
+			})
+		})
+	})
+}
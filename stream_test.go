@@ -5,6 +5,10 @@
 package sse
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
@@ -52,6 +56,129 @@ func TestStream(t *testing.T) {
 			})
 		})
 
+		Convey("When adding a subscriber with replay markers enabled", func() {
+			s.ReplayMarkers = true
+			s.event <- &Event{Data: []byte("test")}
+			time.Sleep(time.Millisecond * 100)
+			sub := s.addSubscriber("0")
+
+			Convey("It should receive the eventlog between control events", func() {
+				So(string((<-sub.connection).Event), ShouldEqual, ReplayStartEvent)
+				So(string((<-sub.connection).Data), ShouldEqual, "test")
+				So(string((<-sub.connection).Event), ShouldEqual, ReplayEndEvent)
+			})
+		})
+
+		Convey("When the eventlog is bounded", func() {
+			s.ReplaySize = 2
+			for i := 0; i < 5; i++ {
+				s.event <- &Event{Data: []byte(strconv.Itoa(i))}
+			}
+			time.Sleep(time.Millisecond * 100)
+			sub := s.addSubscriber("0")
+
+			Convey("Only the latest events should be replayed", func() {
+				So(string((<-sub.connection).Data), ShouldEqual, "3")
+				So(string((<-sub.connection).Data), ShouldEqual, "4")
+				So(len(sub.connection), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When events expire from the eventlog", func() {
+			clk := newFakeClock()
+			timed := newStream(1024, true)
+			timed.clock = clk
+			timed.ReplayTTL = 100 * time.Millisecond
+			timed.run()
+			defer timed.close()
+
+			// Sequenced events are recorded before the stream answers again
+			timed.event <- &Event{Data: []byte("old")}
+			for timed.Sequence() < 1 {
+				timed.SubscriberCount()
+			}
+			clk.Advance(150 * time.Millisecond)
+			timed.event <- &Event{Data: []byte("new")}
+			for timed.Sequence() < 2 {
+				timed.SubscriberCount()
+			}
+			timed.SubscriberCount()
+
+			Convey("Only the events kept for less than the TTL should be replayed", func() {
+				sub := timed.addSubscriber("0")
+				So(string((<-sub.connection).Data), ShouldEqual, "new")
+				So(len(sub.connection), ShouldEqual, 0)
+			})
+
+			Convey("Resuming from an event id should replay the unexpired events from it", func() {
+				sub := timed.addSubscriber("1")
+				So(string((<-sub.connection).ID), ShouldEqual, "1")
+			})
+		})
+
+		Convey("When the TTL is set after events were recorded", func() {
+			clk := newFakeClock()
+			timed := newStream(1024, true)
+			timed.clock = clk
+			timed.seed([]*Event{{Data: []byte("untimed")}})
+			timed.ReplayTTL = 100 * time.Millisecond
+			timed.run()
+			defer timed.close()
+
+			clk.Advance(150 * time.Millisecond)
+			timed.event <- &Event{Data: []byte("new")}
+			for timed.Sequence() < 2 {
+				timed.SubscriberCount()
+			}
+			timed.SubscriberCount()
+
+			Convey("The events recorded without a timestamp should be kept", func() {
+				sub := timed.addSubscriber("0")
+				So(string((<-sub.connection).Data), ShouldEqual, "untimed")
+				So(string((<-sub.connection).Data), ShouldEqual, "new")
+			})
+		})
+
+		Convey("When seeding the eventlog", func() {
+			seeded := newStream(1024, true)
+			seeded.ReplayTTL = time.Hour
+			ev := &Event{Data: []byte("history")}
+			seeded.seed([]*Event{ev})
+
+			Convey("It should record a copy of the event", func() {
+				So(string(seeded.Eventlog[0].ID), ShouldEqual, "0")
+				So(ev.ID, ShouldBeNil)
+				So(ev.recorded.IsZero(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When publishing a comment on its own", func() {
+			sub := s.addSubscriber("0")
+			s.event <- &Event{Comment: []byte("ping")}
+
+			Convey("It should be delivered without an id or being recorded", func() {
+				ev, _ := <-sub.connection
+				So(string(ev.Comment), ShouldEqual, "ping")
+				So(ev.ID, ShouldBeNil)
+				So(len(s.Eventlog), ShouldEqual, 0)
+				So(s.Sequence(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When counting subscribers", func() {
+			s.addSubscriber("0")
+			s.addSubscriber("0")
+
+			Convey("It should report every registered subscriber", func() {
+				So(s.SubscriberCount(), ShouldEqual, 2)
+			})
+
+			Convey("It should report none once the stream is closed", func() {
+				s.close()
+				So(s.SubscriberCount(), ShouldEqual, 0)
+			})
+		})
+
 		Convey("When removing a subscriber", func() {
 			s.addSubscriber("0")
 			time.Sleep(time.Millisecond * 100)
@@ -72,6 +199,28 @@ func TestStream(t *testing.T) {
 			})
 		})
 
+		Convey("When publishing events without an id", func() {
+			s := newStream(1024, false)
+			s.run()
+			defer s.close()
+
+			sub := s.addSubscriber("0")
+			s.event <- &Event{Data: []byte("one")}
+			s.event <- &Event{Data: []byte("two")}
+
+			Convey("They should be numbered in sequence", func() {
+				for i := 0; i < 2; i++ {
+					select {
+					case ev := <-sub.connection:
+						So(string(ev.ID), ShouldEqual, strconv.Itoa(i))
+					case <-time.After(time.Second):
+						So("timeout", ShouldBeEmpty)
+					}
+				}
+				So(s.Sequence(), ShouldEqual, 2)
+			})
+		})
+
 		Convey("When adding multiple subscribers", func() {
 			var subs []*Subscriber
 			for i := 0; i < 10; i++ {
@@ -101,3 +250,200 @@ func TestStream(t *testing.T) {
 		})
 	})
 }
+
+func TestStreamSkipUnwatched(t *testing.T) {
+	Convey("Given a server skipping events nobody watches", t, func() {
+		s := New()
+		s.SkipUnwatched = true
+		str := s.CreateStream("test")
+
+		var skipped []string
+		s.OnNoSubscribers = func(stream string, event *Event) {
+			skipped = append(skipped, stream+" "+string(event.Data))
+		}
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("Events published without subscribers should be dropped", func() {
+			So(s.HasSubscribers("test"), ShouldBeFalse)
+			s.Publish("test", &Event{Data: []byte("lost")})
+
+			So(skipped, ShouldResemble, []string{"test lost"})
+			So(str.Sequence(), ShouldEqual, 0)
+		})
+
+		Convey("Events should be delivered once someone subscribes", func() {
+			sub := str.addSubscriber("0")
+			So(str.SubscriberCount(), ShouldEqual, 1)
+			So(s.HasSubscribers("test"), ShouldBeTrue)
+
+			s.Publish("test", &Event{Data: []byte("seen")})
+			ev := <-sub.connection
+			So(string(ev.Data), ShouldEqual, "seen")
+			So(skipped, ShouldBeEmpty)
+		})
+
+		Convey("Unknown streams should have no subscribers", func() {
+			So(s.HasSubscribers("none"), ShouldBeFalse)
+		})
+	})
+}
+
+// collect reads n events from each subscriber
+func collect(subs []*Subscriber, n int) [][]*Event {
+	received := make([][]*Event, len(subs))
+	done := make(chan struct{})
+	for i, sub := range subs {
+		go func(i int, sub *Subscriber) {
+			for len(received[i]) < n {
+				received[i] = append(received[i], <-sub.connection)
+			}
+			done <- struct{}{}
+		}(i, sub)
+	}
+	for range subs {
+		<-done
+	}
+	return received
+}
+
+func TestStreamOrdering(t *testing.T) {
+	Convey("Given a stream with several subscribers", t, func() {
+		s := New()
+		str := s.CreateStream("test")
+		subs := []*Subscriber{str.addSubscriber("0"), str.addSubscriber("0"), str.addSubscriber("0")}
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("When many goroutines publish at once", func() {
+			const publishers, events = 8, 50
+			for p := 0; p < publishers; p++ {
+				go func(p int) {
+					for i := 0; i < events; i++ {
+						s.Publish("test", &Event{Data: []byte(strconv.Itoa(p) + "/" + strconv.Itoa(i))})
+					}
+				}(p)
+			}
+			received := collect(subs, publishers*events)
+
+			Convey("Every subscriber should receive the same sequence", func() {
+				for i, ev := range received[0] {
+					So(string(ev.ID), ShouldEqual, strconv.Itoa(i))
+					So(received[1][i], ShouldEqual, ev)
+					So(received[2][i], ShouldEqual, ev)
+				}
+			})
+
+			Convey("The events of each publisher should keep their order", func() {
+				next := make(map[string]int)
+				for _, ev := range received[0] {
+					var p, i int
+					for j, c := range ev.Data {
+						if c == '/' {
+							p, _ = strconv.Atoi(string(ev.Data[:j]))
+							i, _ = strconv.Atoi(string(ev.Data[j+1:]))
+						}
+					}
+					key := strconv.Itoa(p)
+					So(i, ShouldEqual, next[key])
+					next[key]++
+				}
+			})
+		})
+	})
+}
+
+func TestStreamIdleTTL(t *testing.T) {
+	Convey("Given a server expiring idle streams", t, func() {
+		s := New()
+		s.IdleTTL = 50 * time.Millisecond
+
+		Reset(func() {
+			s.Close()
+		})
+
+		removed := func(id string) bool {
+			for i := 0; i < 100; i++ {
+				if !s.StreamExists(id) {
+					return true
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			return false
+		}
+
+		Convey("Streams without events or subscribers should be removed", func() {
+			s.CreateStream("idle")
+			So(removed("idle"), ShouldBeTrue)
+		})
+
+		Convey("Publishing should keep a stream alive", func() {
+			s.CreateStream("busy")
+			for i := 0; i < 10; i++ {
+				s.Publish("busy", &Event{Data: []byte("tick")})
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(s.StreamExists("busy"), ShouldBeTrue)
+		})
+
+		Convey("Streams used after expiring should be kept", func() {
+			str := s.CreateStream("late")
+			str.touch(time.Now().Add(-time.Second))
+			s.enqueue("late", &Event{Data: []byte("tick")}, false)
+			s.removeIdle("late", str)
+			So(s.StreamExists("late"), ShouldBeTrue)
+
+			str.touch(time.Now().Add(-time.Second))
+			s.activeStream("late")
+			s.removeIdle("late", str)
+			So(s.StreamExists("late"), ShouldBeTrue)
+		})
+
+		Convey("Streams with subscribers should be kept", func() {
+			sub := s.CreateStream("watched").addSubscriber("0")
+			time.Sleep(100 * time.Millisecond)
+			So(s.StreamExists("watched"), ShouldBeTrue)
+
+			Convey("Until the last subscriber has been gone for long enough", func() {
+				sub.close()
+				So(removed("watched"), ShouldBeTrue)
+			})
+		})
+
+		Convey("Streams created on subscription should be reported until removed", func() {
+			created := make(chan string, 1)
+			gone := make(chan string, 1)
+			s.AutoStream = true
+			s.OnStreamCreated = func(id string, str *Stream) {
+				created <- id
+			}
+			s.OnStreamRemoved = func(id string) {
+				gone <- id
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			r := httptest.NewRequest(http.MethodGet, "/events?stream=user-1", nil).WithContext(ctx)
+			done := make(chan struct{})
+			go func() {
+				s.HTTPHandler(httptest.NewRecorder(), r)
+				close(done)
+			}()
+
+			So(<-created, ShouldEqual, "user-1")
+			cancel()
+			<-done
+
+			select {
+			case id := <-gone:
+				So(id, ShouldEqual, "user-1")
+				So(s.StreamExists("user-1"), ShouldBeFalse)
+			case <-time.After(time.Second):
+				So("stream not removed", ShouldBeEmpty)
+			}
+		})
+	})
+}
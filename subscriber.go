@@ -4,14 +4,162 @@
 
 package sse
 
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
 // Subscriber ...
 type Subscriber struct {
 	eventid    string
 	quit       chan *Subscriber
+	done       chan struct{}
 	connection chan *Event
+	// Priority events, which are written ahead of those on connection
+	urgent chan *Event
+	// Backfilled events, which are written before those on connection
+	backlog []*Event
+	// History being replayed in pages, see Stream.ReplayPageSize
+	pages *replayPages
+	// Ids of the events replayed from the EventStore, which are skipped
+	// when they are sent live as well, see replayedLive
+	replayed map[string]struct{}
+	// Context of the subscription, see Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Request the subscriber connected with, if any
+	request *http.Request
+	// Events queued with Snapshot
+	snapshot []*Event
+	// Passes the events to send the subscriber, see Filter
+	filter func(*Event) bool
+	// Limits the rate of live events sent to the subscriber, see Limit
+	limiter     *rate.Limiter
+	limitPolicy LimitPolicy
+	// Latest event held back by limiter, only touched by the stream
+	held *Event
+	// Called once the subscription has ended, see Server.OnUnsubscribe
+	unsubscribed func()
+	// Counters of the stream, see Stream.Stats
+	counters *streamCounters
+	// Profiler labels of the goroutines writing to the subscriber
+	labels context.Context
+	// Rewrites events before they are written to the subscriber
+	prepare func(*Event) *Event
+	// Data lines longer than this are split, see Server.MaxLineLength
+	maxLine int
+	framing Framing
+	// Observes deliveries, see Server.Instrumentation
+	instrument SubscriberInstrumentation
+	// Logs the subscriber's activity, see Server.Logger
+	logger *slog.Logger
+	// Number of events that could not be delivered, see logDrop
+	drops atomic.Uint64
+	// Records deliveries for Server.Audit
+	audit func(ev *Event)
+	// Records deliveries in the stream's debug log, under name
+	debug *debugLog
+	name  string
+	// Resume state kept for subscribers identified by the client parameter,
+	// see Server.ExportSubscribers
+	client string
+	query  string
+	// Last event written to the subscriber that had an id
+	last atomic.Pointer[Event]
+	// Described by Server.Subscribers
+	id         uint64
+	remoteAddr string
+	userAgent  string
+	connected  time.Time
+	// Source of time, the system clock if nil
+	clock clock
+	// Answered by the stream when joining it, see Stream.join
+	admitted chan bool
+
+	// Set when the subscriber is served by the pooled dispatcher
+	dispatcher *dispatcher
+	conn       net.Conn
+	worker     int
+	pending    int32
+	failed     bool
 }
 
-// Close will let the stream know that the clients connection has terminated
+// Close will let the stream know that the clients connection has terminated,
+// unless the stream has been closed already
 func (s *Subscriber) close() {
-	s.quit <- s
+	select {
+	case s.quit <- s:
+	case <-s.done:
+	}
+}
+
+// Context returns a context carrying the values of the request the subscriber
+// connected with, such as an authenticated principal set by middleware. It is
+// done once the subscriber disconnects, which for pooled subscribers, see
+// DispatchPooled, is once their connection is closed rather than once the
+// request is handed over. Subscribers created without a request have a
+// background context.
+func (s *Subscriber) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// Request returns the request the subscriber connected with, such as to read
+// its remote address or headers, or nil for subscribers created without one
+func (s *Subscriber) Request() *http.Request {
+	return s.request
+}
+
+// ID identifies the subscriber within its stream, see Server.Evict
+func (s *Subscriber) ID() uint64 {
+	return s.id
+}
+
+// Snapshot queues events to be written to the subscriber before any
+// backfilled, replayed or live events, such as the current state of what the
+// stream sends changes of. It may only be called from Server.OnSubscribe.
+func (s *Subscriber) Snapshot(events ...*Event) {
+	s.snapshot = append(s.snapshot, events...)
+}
+
+// render returns the event as it should be written to the subscriber
+func (s *Subscriber) render(ev *Event) *Event {
+	if s.prepare != nil {
+		return s.prepare(ev)
+	}
+	return ev
+}
+
+// encode appends an event to bufs in the subscriber's framing
+func (s *Subscriber) encode(bufs net.Buffers, ev *Event) net.Buffers {
+	ev = s.render(ev)
+	if s.framing == FramingNDJSON {
+		return append(bufs, encodeNDJSON(ev))
+	}
+	return appendEventBuffers(bufs, ev, s.maxLine)
+}
+
+// write writes an event to w in the subscriber's framing
+func (s *Subscriber) write(w io.Writer, ev *Event) error {
+	if s.framing == FramingNDJSON {
+		_, err := w.Write(encodeNDJSON(s.render(ev)))
+		return err
+	}
+	return writeEvent(w, s.render(ev), s.maxLine)
+}
+
+// notify lets the dispatcher know that events are waiting on the connection
+func (s *Subscriber) notify() {
+	if s.dispatcher != nil {
+		s.dispatcher.schedule(s)
+	}
 }
@@ -0,0 +1,75 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "time"
+
+// SubscriberInfo describes a subscriber connected to a stream, such as for
+// support tooling deciding which subscribers to evict
+type SubscriberInfo struct {
+	// Identifies the subscriber within its stream, see Evict
+	ID uint64 `json:"id"`
+	// Client parameter the subscriber identified itself with, if any
+	Client     string `json:"client,omitempty"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	UserAgent  string `json:"userAgent,omitempty"`
+	// When the subscriber connected
+	ConnectedAt time.Time `json:"connectedAt"`
+	// Id of the last event written to the subscriber, if any
+	LastEventID string `json:"lastEventId,omitempty"`
+	// Number of events waiting to be written to the subscriber
+	Queued int `json:"queued"`
+}
+
+// Subscribers describes the subscribers connected to a stream, or returns nil
+// if the stream does not exist
+func (s *Server) Subscribers(stream string) []SubscriberInfo {
+	str := s.getStream(stream)
+	if str == nil {
+		return nil
+	}
+
+	subs := str.listSubscribers()
+	infos := make([]SubscriberInfo, 0, len(subs))
+	for _, sub := range subs {
+		infos = append(infos, SubscriberInfo{
+			ID:          sub.id,
+			Client:      sub.client,
+			RemoteAddr:  sub.remoteAddr,
+			UserAgent:   sub.userAgent,
+			ConnectedAt: sub.connected,
+			LastEventID: sub.lastSent(),
+			Queued:      len(sub.connection) + len(sub.urgent),
+		})
+	}
+	return infos
+}
+
+// Evict disconnects the subscriber of a stream with the given id, reporting
+// whether it was connected. Clients are free to reconnect, unless they are
+// turned away, such as by Stream.Authorize.
+func (s *Server) Evict(stream string, id uint64) bool {
+	str := s.getStream(stream)
+	if str == nil {
+		return false
+	}
+
+	for _, sub := range str.listSubscribers() {
+		if sub.id == id {
+			sub.close()
+			return true
+		}
+	}
+	return false
+}
+
+// lastSent returns the id of the last event written to the subscriber, or
+// "" if there is none
+func (s *Subscriber) lastSent() string {
+	if ev := s.last.Load(); ev != nil {
+		return string(ev.ID)
+	}
+	return ""
+}
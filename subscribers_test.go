@@ -0,0 +1,134 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubscribers(t *testing.T) {
+	Convey("Given a server with a subscriber", t, func() {
+		s := New()
+		s.CreateStream("test")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest(http.MethodGet, "/events?stream=test&client=alice", nil)
+		r.Header.Set("User-Agent", "support-test")
+		done := make(chan struct{})
+		go func() {
+			s.HTTPHandler(httptest.NewRecorder(), r.WithContext(ctx))
+			close(done)
+		}()
+
+		Reset(func() {
+			cancel()
+			s.Close()
+		})
+
+		// Wait for the subscriber to receive an event
+		var infos []SubscriberInfo
+		s.Publish("test", &Event{Data: []byte("hello")})
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if infos = s.Subscribers("test"); len(infos) == 1 && infos[0].LastEventID != "" {
+				break
+			}
+		}
+
+		Convey("It should be described", func() {
+			So(infos, ShouldHaveLength, 1)
+			info := infos[0]
+			So(info.Client, ShouldEqual, "alice")
+			So(info.RemoteAddr, ShouldEqual, r.RemoteAddr)
+			So(info.UserAgent, ShouldEqual, "support-test")
+			So(info.ConnectedAt, ShouldHappenWithin, time.Second, time.Now())
+			So(info.LastEventID, ShouldEqual, "0")
+			So(info.Queued, ShouldEqual, 0)
+		})
+
+		Convey("Unknown streams should have no subscribers", func() {
+			So(s.Subscribers("none"), ShouldBeNil)
+		})
+
+		Convey("It should be evicted by its id", func() {
+			So(s.Evict("test", infos[0].ID+1), ShouldBeFalse)
+			So(s.Evict("test", infos[0].ID), ShouldBeTrue)
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				So("subscriber still connected", ShouldBeEmpty)
+			}
+			So(s.Subscribers("test"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSubscriberHooks(t *testing.T) {
+	Convey("Given a server with subscriber hooks", t, func() {
+		s := New()
+		s.CreateStream("test")
+		s.Publish("test", &Event{Data: []byte("history")})
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		agents := make(chan string, 1)
+		left := make(chan uint64, 1)
+		var joined uint64
+		s.OnSubscribe = func(stream string, sub *Subscriber) {
+			joined = sub.ID()
+			agents <- sub.Request().Header.Get("X-Agent")
+			sub.Snapshot(&Event{Event: []byte("snapshot"), Data: []byte("state")})
+		}
+		s.OnUnsubscribe = func(stream string, sub *Subscriber) {
+			left <- sub.ID()
+		}
+
+		Reset(func() {
+			server.Close()
+			s.Close()
+		})
+
+		c := NewClient(server.URL)
+		c.Headers["X-Agent"] = "hooks-test"
+		events := make(chan *Event, 2)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.SubscribeWithContext(ctx, "test", func(msg *Event) {
+			events <- msg
+		})
+
+		Convey("Subscribers should be passed in with their request", func() {
+			So(<-agents, ShouldEqual, "hooks-test")
+		})
+
+		Convey("The snapshot should be sent ahead of the history", func() {
+			for _, want := range []string{"state", "history"} {
+				select {
+				case ev := <-events:
+					So(string(ev.Data), ShouldEqual, want)
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeEmpty)
+				}
+			}
+		})
+
+		Convey("Subscribers should be reported once they leave", func() {
+			<-agents
+			cancel()
+
+			select {
+			case id := <-left:
+				So(id, ShouldEqual, joined)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+	})
+}
@@ -0,0 +1,180 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// position is the id of the last event a subscription received, which it
+// resumes from when reconnecting. Each subscription has a position of its
+// own, which is copied to the EventID of client, if it is set.
+type position struct {
+	mu     sync.Mutex
+	id     string
+	client *Client
+}
+
+// eventID returns the client's EventID
+func (c *Client) eventID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.EventID
+}
+
+// position returns the position of a subscription that starts from the
+// client's EventID and keeps it up to date, as those started by Subscribe and
+// SubscribeChan do
+func (c *Client) position() *position {
+	return &position{id: c.eventID(), client: c}
+}
+
+func (pos *position) get() string {
+	pos.mu.Lock()
+	defer pos.mu.Unlock()
+	return pos.id
+}
+
+func (pos *position) set(id string) {
+	pos.mu.Lock()
+	defer pos.mu.Unlock()
+	pos.update(id)
+}
+
+// update sets the id, with pos.mu held
+func (pos *position) update(id string) {
+	pos.id = id
+	if pos.client != nil {
+		pos.client.mu.Lock()
+		pos.client.EventID = id
+		pos.client.mu.Unlock()
+	}
+}
+
+// resume takes the id of an event without data, which is not handled, but
+// still resets the last event id, as the spec has it
+func (pos *position) resume(msg *Event, err error) {
+	if err == errInvalidEvent && len(msg.ID) > 0 {
+		pos.set(string(msg.ID))
+	}
+}
+
+// track takes the id of an event as the last event id, or gives an event
+// without one the last event id. Ids that repeat are not copied again, and
+// events reused with ReuseEvents are given the id in a buffer of the parser,
+// so neither allocates.
+func (pos *position) track(p *eventParser, msg *Event) {
+	pos.mu.Lock()
+	defer pos.mu.Unlock()
+
+	if len(msg.ID) > 0 {
+		if string(msg.ID) != pos.id {
+			pos.update(string(msg.ID))
+		}
+		return
+	}
+	if p.borrow {
+		p.lastID = append(p.lastID[:0], pos.id...)
+		msg.ID = p.lastID
+		return
+	}
+	msg.ID = []byte(pos.id)
+}
+
+// Subscription is a subscription started with Client.Open or Client.OpenChan.
+// Unlike those of Subscribe, it keeps the id of the last event it received to
+// itself, so several subscriptions of the same client can resume
+// independently.
+type Subscription struct {
+	stream string
+	pos    position
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Open subscribes to a stream like Subscribe, in the background, until ctx is
+// done or the subscription is closed. The subscription starts from the
+// client's EventID, but does not update it.
+func (c *Client) Open(ctx context.Context, stream string, handler func(msg *Event)) *Subscription {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &Subscription{
+		stream: stream,
+		pos:    position{id: c.eventID()},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(sub.done)
+		err := c.subscribe(ctx, &sub.pos, stream, handler)
+		if ctx.Err() == nil {
+			sub.err = err
+		}
+	}()
+	return sub
+}
+
+// OpenChan subscribes to a stream like SubscribeChan, until ctx is done or the
+// subscription is closed, which closes ch. Like Open, the subscription starts
+// from the client's EventID, but does not update it.
+func (c *Client) OpenChan(ctx context.Context, stream string, ch chan *Event) (*Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &Subscription{
+		stream: stream,
+		pos:    position{id: c.eventID()},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	ended := func(err error) {
+		if ctx.Err() == nil && !errors.Is(err, io.EOF) {
+			sub.err = err
+		}
+		close(sub.done)
+	}
+	if _, err := c.subscribeChan(ctx, &sub.pos, stream, ch, c.ChanOverflow, c.trackChan(ch), ended); err != nil {
+		cancel()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Stream returns the name of the stream subscribed to
+func (s *Subscription) Stream() string {
+	return s.stream
+}
+
+// LastEventID returns the id of the last event received, which the
+// subscription resumes from when reconnecting
+func (s *Subscription) LastEventID() string {
+	return s.pos.get()
+}
+
+// Done returns a channel that is closed once the subscription has ended
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that ended the subscription, or nil if it is still
+// running, ended with the server closing the stream, or was closed
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close ends the subscription, waiting for its handler to return
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
@@ -0,0 +1,151 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubscription(t *testing.T) {
+	Convey("Given a client with two subscriptions", t, func() {
+		s := New()
+		s.CreateStream("orders")
+		s.CreateStream("invoices")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		c := NewClient(server.URL)
+		c.EventID = "start"
+		received := make(chan *Event, 10)
+		handler := func(msg *Event) {
+			received <- msg
+		}
+		orders := c.Open(context.Background(), "orders", handler)
+		invoices := c.Open(context.Background(), "invoices", handler)
+		defer orders.Close()
+		defer invoices.Close()
+
+		for s.getStream("orders").SubscriberCount() == 0 || s.getStream("invoices").SubscriberCount() == 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		Convey("Each should keep the id of its own last event", func() {
+			for i := 0; i < 3; i++ {
+				s.Publish("orders", &Event{Data: []byte("order")})
+			}
+			s.Publish("invoices", &Event{Data: []byte("invoice")})
+			for i := 0; i < 4; i++ {
+				_, err := wait(received, time.Second)
+				So(err, ShouldBeNil)
+			}
+
+			So(orders.LastEventID(), ShouldEqual, "2")
+			So(invoices.LastEventID(), ShouldEqual, "0")
+			So(c.EventID, ShouldEqual, "start")
+		})
+
+		Convey("Closing one should leave the other running", func() {
+			So(orders.Close(), ShouldBeNil)
+			So(orders.Err(), ShouldBeNil)
+
+			select {
+			case <-orders.Done():
+			default:
+				So("still running", ShouldBeEmpty)
+			}
+			select {
+			case <-invoices.Done():
+				So("ended", ShouldBeEmpty)
+			default:
+			}
+		})
+	})
+}
+
+func TestSubscriptionChan(t *testing.T) {
+	Convey("Given a client with a channel subscription", t, func() {
+		s := New()
+		s.CreateStream("orders")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		c := NewClient(server.URL)
+		c.EventID = "start"
+		events := make(chan *Event)
+		sub, err := c.OpenChan(context.Background(), "orders", events)
+		So(err, ShouldBeNil)
+
+		for s.getStream("orders").SubscriberCount() == 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		Convey("It should keep the id of its own last event", func() {
+			s.Publish("orders", &Event{Data: []byte("order")})
+			_, err := wait(events, time.Second)
+			So(err, ShouldBeNil)
+
+			So(sub.LastEventID(), ShouldEqual, "0")
+			So(c.eventID(), ShouldEqual, "start")
+			So(sub.Close(), ShouldBeNil)
+		})
+
+		Convey("Closing it should close the channel", func() {
+			So(sub.Close(), ShouldBeNil)
+			So(sub.Err(), ShouldBeNil)
+
+			_, ok := <-events
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a channel subscription that is not being read", t, func() {
+		s := New()
+		s.CreateStream("orders")
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			server.CloseClientConnections()
+			server.Close()
+			s.Close()
+		})
+
+		c := NewClient(server.URL)
+		events := make(chan *Event)
+		_, err := c.SubscribeChan("orders", events)
+		So(err, ShouldBeNil)
+
+		Convey("Unsubscribe should not wait for it", func() {
+			done := make(chan struct{})
+			go func() {
+				c.Unsubscribe(events)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				So("Unsubscribe blocked", ShouldBeEmpty)
+			}
+
+			for range events {
+			}
+		})
+	})
+}
@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// dialTimeout bounds how long establishing a tuned connection may take, as
+// http.DefaultTransport does
+const dialTimeout = 30 * time.Second
+
+// TCPOptions tunes the sockets of a client's connections, see Client.TCP
+type TCPOptions struct {
+	// Interval between keep-alive probes on idle connections, which detect
+	// dead peers and keep middleboxes from dropping quiet streams. Zero uses
+	// the default of the net package, negative disables keep-alives.
+	KeepAlive time.Duration
+	// Buffers small writes with Nagle's algorithm, by clearing the
+	// TCP_NODELAY option Go sets on every connection
+	Delay bool
+	// Size of the socket's receive buffer in bytes, zero for the system
+	// default
+	ReadBuffer int
+}
+
+// dialContext dials connections with the options applied
+func (o *TCPOptions) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: o.KeepAlive}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		if o.Delay {
+			tcp.SetNoDelay(false)
+		}
+		if o.ReadBuffer > 0 {
+			tcp.SetReadBuffer(o.ReadBuffer)
+		}
+	}
+	return conn, nil
+}
+
+// connection returns the HTTP client requests are sent with. With TCP options
+// set, it is a copy of Connection whose transport applies them, unless the
+// transport is not an *http.Transport, which is used as is.
+func (c *Client) connection() *http.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.TCP == nil {
+		return c.Connection
+	}
+	if c.tuned != nil && c.tunedFrom == c.Connection {
+		return c.tuned
+	}
+
+	var transport *http.Transport
+	switch t := c.Connection.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return c.Connection
+	}
+	transport.DialContext = c.TCP.dialContext
+
+	tuned := *c.Connection
+	tuned.Transport = transport
+	c.tuned, c.tunedFrom = &tuned, c.Connection
+	return c.tuned
+}
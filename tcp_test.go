@@ -0,0 +1,63 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTCPOptions(t *testing.T) {
+	Convey("Given a client with TCP options", t, func() {
+		srv := New()
+		srv.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		c := NewClient(server.URL)
+		c.TCP = &TCPOptions{KeepAlive: 15 * time.Second, Delay: true, ReadBuffer: 64 * 1024}
+		original := c.Connection
+
+		Convey("Requests should use a tuned copy of the connection", func() {
+			tuned := c.connection()
+			So(tuned, ShouldNotEqual, original)
+			So(tuned.Transport.(*http.Transport).DialContext, ShouldNotBeNil)
+			So(original.Transport, ShouldBeNil)
+			So(c.connection(), ShouldEqual, tuned)
+
+			events := make(chan *Event)
+			_, err := c.SubscribeChan("test", events)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Replacing the connection should tune the new one", func() {
+			tuned := c.connection()
+			c.Connection = &http.Client{Timeout: time.Minute}
+			So(c.connection(), ShouldNotEqual, tuned)
+			So(c.connection().Timeout, ShouldEqual, time.Minute)
+		})
+
+		Convey("Custom transports should be left alone", func() {
+			c.Connection = &http.Client{Transport: &failingTransport{}}
+			So(c.connection(), ShouldEqual, c.Connection)
+		})
+
+		Convey("Connections should be dialed with the options", func() {
+			conn, err := c.TCP.dialContext(context.Background(), "tcp", server.Listener.Addr().String())
+			So(err, ShouldBeNil)
+			So(conn, ShouldHaveSameTypeAs, &net.TCPConn{})
+			conn.Close()
+		})
+
+		Reset(func() {
+			srv.Close()
+		})
+	})
+}
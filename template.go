@@ -0,0 +1,107 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrTemplateNotFound is returned when creating a stream from a template that
+// has not been defined
+var ErrTemplateNotFound = errors.New("stream template not found")
+
+// StreamTemplate is a named configuration profile for streams, so services
+// with many similar streams can configure them in one place. Streams created
+// from a template take all of its settings in place of the server's. See the
+// fields of Stream for what each setting does.
+type StreamTemplate struct {
+	AutoReplay            bool
+	ReplayMarkers         bool
+	ReplaySize            int
+	ReplayTTL             time.Duration
+	ReplayPageSize        int
+	ReplayPageInterval    time.Duration
+	KeepIDs               bool
+	IDGenerator           IDGenerator
+	ControlEvents         bool
+	DebugSize             int
+	SkipUnwatched         bool
+	ReadOnly              bool
+	IdleTTL               time.Duration
+	CompressReplay        bool
+	EventStore            EventStore
+	MaxSubscribers        int
+	KeepAlive             time.Duration
+	Authorize             func(r *http.Request) error
+	PublishRate           rate.Limit
+	PublishBurst          int
+	LimitPolicy           LimitPolicy
+	SubscriberBuffer      int
+	SubscriberRate        rate.Limit
+	SubscriberBurst       int
+	SubscriberLimitPolicy LimitPolicy
+	Backpressure          Backpressure
+	OnDrop                func(stream string, sub *Subscriber, event *Event)
+}
+
+// DefineTemplate adds a template under the given name, replacing any template
+// of the same name. Existing streams are not affected.
+func (s *Server) DefineTemplate(name string, template StreamTemplate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.templates == nil {
+		s.templates = make(map[string]StreamTemplate)
+	}
+	s.templates[name] = template
+}
+
+// CreateStreamFrom creates a stream configured by the named template. If the
+// stream exists already, it is returned as it is.
+func (s *Server) CreateStreamFrom(template, id string) (*Stream, error) {
+	s.mu.Lock()
+	t, ok := s.templates[template]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+	return s.createStream(id, t.apply), nil
+}
+
+// apply configures a stream with the template's settings
+func (t StreamTemplate) apply(str *Stream) {
+	str.AutoReplay = t.AutoReplay
+	str.ReplayMarkers = t.ReplayMarkers
+	str.ReplaySize = t.ReplaySize
+	str.ReplayTTL = t.ReplayTTL
+	str.ReplayPageSize = t.ReplayPageSize
+	str.ReplayPageInterval = t.ReplayPageInterval
+	str.KeepIDs = t.KeepIDs
+	str.IDGenerator = t.IDGenerator
+	str.ControlEvents = t.ControlEvents
+	str.DebugSize = t.DebugSize
+	str.SkipUnwatched = t.SkipUnwatched
+	str.ReadOnly = t.ReadOnly
+	str.IdleTTL = t.IdleTTL
+	str.CompressReplay = t.CompressReplay
+	str.EventStore = t.EventStore
+	str.MaxSubscribers = t.MaxSubscribers
+	str.KeepAlive = t.KeepAlive
+	str.Authorize = t.Authorize
+	str.Limiter = newLimiter(t.PublishRate, t.PublishBurst)
+	str.LimitPolicy = t.LimitPolicy
+	str.SubscriberBuffer = t.SubscriberBuffer
+	str.SubscriberRate = t.SubscriberRate
+	str.SubscriberBurst = t.SubscriberBurst
+	str.SubscriberLimitPolicy = t.SubscriberLimitPolicy
+	str.Backpressure = t.Backpressure
+	str.OnDrop = t.OnDrop
+	str.templated = true
+}
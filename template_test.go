@@ -0,0 +1,99 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStreamTemplates(t *testing.T) {
+	Convey("Given a server with a template", t, func() {
+		s := New()
+		s.DefineTemplate("chat", StreamTemplate{
+			ReplaySize:     10,
+			MaxSubscribers: 1,
+			KeepAlive:      10 * time.Millisecond,
+			Authorize: func(r *http.Request) error {
+				if r.Header.Get("Authorization") == "" {
+					return errors.New("not signed in")
+				}
+				return nil
+			},
+		})
+
+		Reset(func() {
+			s.Close()
+		})
+
+		Convey("Streams created from it should take its settings", func() {
+			str, err := s.CreateStreamFrom("chat", "room")
+			So(err, ShouldBeNil)
+			So(str.ReplaySize, ShouldEqual, 10)
+			So(str.AutoReplay, ShouldBeFalse)
+			So(str.MaxSubscribers, ShouldEqual, 1)
+		})
+
+		Convey("Existing streams should be returned as they are", func() {
+			created := s.CreateStream("room")
+			str, err := s.CreateStreamFrom("chat", "room")
+			So(err, ShouldBeNil)
+			So(str, ShouldEqual, created)
+			So(str.ReplaySize, ShouldEqual, 0)
+		})
+
+		Convey("Unknown templates should be reported", func() {
+			_, err := s.CreateStreamFrom("none", "room")
+			So(err, ShouldEqual, ErrTemplateNotFound)
+		})
+
+		Convey("Subscribers should receive keep-alive comments", func() {
+			str, _ := s.CreateStreamFrom("chat", "room")
+			sub := str.addSubscriber("0")
+
+			select {
+			case ev := <-sub.connection:
+				So(string(ev.Comment), ShouldEqual, "ping")
+			case <-time.After(time.Second):
+				So("no keep-alive", ShouldBeEmpty)
+			}
+		})
+
+		Convey("When clients subscribe over HTTP", func() {
+			s.CreateStreamFrom("chat", "room")
+			server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+			get := func(signedIn bool) int {
+				req, _ := http.NewRequest(http.MethodGet, server.URL+"?stream=room", nil)
+				if signedIn {
+					req.Header.Set("Authorization", "Bearer token")
+				}
+				resp, err := http.DefaultClient.Do(req)
+				So(err, ShouldBeNil)
+				if resp.StatusCode != http.StatusOK {
+					resp.Body.Close()
+				}
+				return resp.StatusCode
+			}
+
+			Convey("Unauthorized requests should be forbidden", func() {
+				So(get(false), ShouldEqual, http.StatusForbidden)
+			})
+
+			Convey("Subscribers beyond the limit should be turned away", func() {
+				So(get(true), ShouldEqual, http.StatusOK)
+				for s.getStream("room").SubscriberCount() == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				So(get(true), ShouldEqual, http.StatusServiceUnavailable)
+			})
+		})
+	})
+}
@@ -0,0 +1,222 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Content encodings of the payloads of codecs
+const (
+	// ContentEncodingIdentity sends payloads as they are, for text formats
+	ContentEncodingIdentity = ""
+	// ContentEncodingBase64 sends payloads base64 encoded, for binary formats
+	// that can not be sent in events as they are
+	ContentEncodingBase64 = "base64"
+)
+
+// Codec converts typed payloads to and from the data of events
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	// ContentEncoding returns how payloads are encoded in the data of
+	// events. Payloads are encoded after Marshal and decoded before
+	// Unmarshal, unless Server.EncodeBase64 and Client.EncodingBase64 already
+	// do so for every event.
+	ContentEncoding() string
+}
+
+// JSONCodec encodes payloads as JSON. It is used when no codec is given.
+type JSONCodec struct{}
+
+// ContentEncoding returns ContentEncodingIdentity, as JSON is text
+func (JSONCodec) ContentEncoding() string {
+	return ContentEncodingIdentity
+}
+
+// Marshal encodes v as JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Base64Codec sends the payloads of a codec for a binary format, such as
+// msgpack, base64 encoded
+type Base64Codec struct {
+	Codec
+}
+
+// ContentEncoding returns ContentEncodingBase64
+func (Base64Codec) ContentEncoding() string {
+	return ContentEncodingBase64
+}
+
+// encodePayload marshals v with codec, encoding the result as the codec
+// requires unless every event is base64 encoded anyway
+func encodePayload(codec Codec, v interface{}, encodeBase64 bool) ([]byte, error) {
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event payload: %w", err)
+	}
+	if codec.ContentEncoding() == ContentEncodingBase64 && !encodeBase64 {
+		data = []byte(base64.StdEncoding.EncodeToString(data))
+	}
+	return data, nil
+}
+
+// decodePayload is the reverse of encodePayload
+func decodePayload(codec Codec, data []byte, v interface{}, encodingBase64 bool) error {
+	if codec.ContentEncoding() == ContentEncodingBase64 && !encodingBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return fmt.Errorf("failed to decode event payload: %w", err)
+		}
+		data = decoded
+	}
+	if err := codec.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode event payload: %w", err)
+	}
+	return nil
+}
+
+// TypedStream publishes payloads of type T to a stream, encoding them with its
+// codec, so publishers can not send anything subscribers do not expect. See
+// SubscribeTyped for the client side.
+type TypedStream[T any] struct {
+	server *Server
+	id     string
+	codec  Codec
+}
+
+// NewTypedStream returns a typed view of a stream, creating the stream if it
+// does not exist. A nil codec encodes payloads as JSON.
+func NewTypedStream[T any](s *Server, id string, codec Codec) *TypedStream[T] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	s.CreateStream(id)
+	return &TypedStream[T]{server: s, id: id, codec: codec}
+}
+
+// ID returns the id of the stream
+func (t *TypedStream[T]) ID() string {
+	return t.id
+}
+
+// Publish sends a payload to every subscriber of the stream
+func (t *TypedStream[T]) Publish(v T) error {
+	return t.PublishEvent("", v)
+}
+
+// PublishEvent sends a payload as an event with the given name, which is left
+// out if empty
+func (t *TypedStream[T]) PublishEvent(name string, v T) error {
+	return t.server.publishPayload(t.id, t.codec, name, v)
+}
+
+// SubscribeTyped subscribes to a stream like Client.Subscribe, decoding the
+// data of each event into a T with codec before passing both to the handler.
+// Events that can not be decoded are reported to Client.OnError along with
+// their data, and skipped, unless Client.AbortOnError is set, which ends the
+// subscription with the error instead. A nil codec decodes payloads as JSON.
+func SubscribeTyped[T any](c *Client, stream string, codec Codec, handler func(v T, ev *Event)) error {
+	return subscribeDecoding(context.Background(), c, stream, codec, func(v T, ev *Event) error {
+		handler(v, ev)
+		return nil
+	})
+}
+
+// SubscribeJSON subscribes to a stream like Client.Subscribe, decoding the
+// JSON data of each event into a T before passing both to the handler. Events
+// that can not be decoded, and errors returned by the handler, are reported to
+// Client.OnError along with the data of the event. With Client.AbortOnError,
+// they end the subscription instead, which returns them.
+func SubscribeJSON[T any](c *Client, stream string, handler func(v T, ev *Event) error) error {
+	return subscribeDecoding(context.Background(), c, stream, nil, handler)
+}
+
+// SubscribeJSONWithContext is SubscribeJSON ending once ctx is done
+func SubscribeJSONWithContext[T any](ctx context.Context, c *Client, stream string, handler func(v T, ev *Event) error) error {
+	return subscribeDecoding(ctx, c, stream, nil, handler)
+}
+
+// subscribeDecoding subscribes to a stream with a handler decoding payloads,
+// see decoding, returning the first error to abort the subscription
+func subscribeDecoding[T any](ctx context.Context, c *Client, stream string, codec Codec, handler func(v T, ev *Event) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// The handler is called by the subscription's own goroutine
+	var aborted error
+	err := c.SubscribeWithContext(ctx, stream, decoding(c, codec, handler, func(err error) {
+		if aborted == nil {
+			aborted = err
+			cancel(err)
+		}
+	}))
+	if aborted != nil {
+		return aborted
+	}
+	return err
+}
+
+// decoding returns an event handler decoding payloads with codec, or as JSON
+// if it is nil, before passing them to handler. Errors are reported, and passed
+// to abort if they abort the subscription, see Client.AbortOnError.
+func decoding[T any](c *Client, codec Codec, handler func(v T, ev *Event) error, abort func(error)) func(ev *Event) {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	return func(ev *Event) {
+		var v T
+		err := decodePayload(codec, ev.Data, &v, c.EncodingBase64)
+		if err == nil {
+			err = handler(v, ev)
+		}
+		if err != nil {
+			c.reportError(err, ev.Data)
+			if c.aborts(err) {
+				abort(err)
+			}
+		}
+	}
+}
+
+// PublishJSON sends the JSON encoding of v to every subscriber of a stream
+func (s *Server) PublishJSON(id string, v interface{}) error {
+	return s.publishPayload(id, JSONCodec{}, "", v)
+}
+
+// PublishCodec sends v encoded with codec to every subscriber of a stream. A
+// nil codec encodes v as JSON.
+func (s *Server) PublishCodec(id string, codec Codec, v interface{}) error {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return s.publishPayload(id, codec, "", v)
+}
+
+// publishPayload publishes v encoded with codec as an event with the given
+// name, which is left out if empty
+func (s *Server) publishPayload(id string, codec Codec, name string, v interface{}) error {
+	data, err := encodePayload(codec, v, s.EncodeBase64)
+	if err != nil {
+		return err
+	}
+
+	event := &Event{Data: data}
+	if name != "" {
+		event.Event = []byte(name)
+	}
+	return s.Publish(id, event)
+}
@@ -0,0 +1,195 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type quote struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+}
+
+// gobCodec encodes payloads with gob, a binary format
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (gobCodec) ContentEncoding() string {
+	return ContentEncodingIdentity
+}
+
+func TestTypedStream(t *testing.T) {
+	Convey("Given a typed stream", t, func() {
+		s := New()
+		s.AutoReplay = false
+		quotes := NewTypedStream[quote](s, "quotes", nil)
+		server := httptest.NewServer(http.HandlerFunc(s.HTTPHandler))
+
+		Reset(func() {
+			s.Close()
+			server.Close()
+		})
+
+		c := NewClient(server.URL)
+		subscribed := func() {
+			for s.getStream("quotes").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+		}
+
+		Convey("Typed subscribers should receive the payloads", func() {
+			received := make(chan quote, 1)
+			names := make(chan string, 1)
+			go SubscribeTyped(c, "quotes", nil, func(q quote, ev *Event) {
+				received <- q
+				names <- string(ev.Event)
+			})
+			subscribed()
+
+			So(quotes.PublishEvent("quote", quote{Symbol: "ACME", Price: 12.5}), ShouldBeNil)
+
+			select {
+			case q := <-received:
+				So(q, ShouldResemble, quote{Symbol: "ACME", Price: 12.5})
+				So(<-names, ShouldEqual, "quote")
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("Payloads that can not be decoded should be reported", func() {
+			errs := make(chan []byte, 1)
+			c.OnError = func(err error, raw []byte) {
+				errs <- raw
+			}
+			go SubscribeTyped(c, "quotes", nil, func(q quote, ev *Event) {})
+			subscribed()
+
+			s.Publish("quotes", &Event{Data: []byte("not json")})
+
+			select {
+			case raw := <-errs:
+				So(string(raw), ShouldEqual, "not json")
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("JSON subscribers should receive the payloads and report handler errors", func() {
+			errs := make(chan error, 2)
+			c.OnError = func(err error, raw []byte) {
+				errs <- err
+			}
+			received := make(chan quote, 1)
+			go SubscribeJSON(c, "quotes", func(q quote, ev *Event) error {
+				received <- q
+				return errors.New("rejected")
+			})
+			subscribed()
+
+			s.Publish("quotes", &Event{Data: []byte("not json")})
+			So(quotes.Publish(quote{Symbol: "ACME", Price: 3}), ShouldBeNil)
+
+			for _, want := range []string{"failed to decode", "rejected"} {
+				select {
+				case err := <-errs:
+					So(err.Error(), ShouldContainSubstring, want)
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeEmpty)
+				}
+			}
+			So(<-received, ShouldResemble, quote{Symbol: "ACME", Price: 3})
+		})
+
+		Convey("Handler errors should end the subscription with AbortOnError", func() {
+			c.AbortOnError = true
+			rejected := errors.New("rejected")
+			done := make(chan error, 1)
+			go func() {
+				done <- SubscribeJSON(c, "quotes", func(q quote, ev *Event) error {
+					return rejected
+				})
+			}()
+			subscribed()
+
+			So(quotes.Publish(quote{Symbol: "ACME", Price: 3}), ShouldBeNil)
+
+			select {
+			case err := <-done:
+				So(err, ShouldEqual, rejected)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("Decoding errors should wrap the codec's error", func() {
+			var v quote
+			err := decodePayload(JSONCodec{}, []byte("not json"), &v, false)
+			var syntax *json.SyntaxError
+			So(errors.As(err, &syntax), ShouldBeTrue)
+		})
+
+		Convey("Payloads published as JSON should be received", func() {
+			received := make(chan quote, 1)
+			go SubscribeJSON(c, "quotes", func(q quote, ev *Event) error {
+				received <- q
+				return nil
+			})
+			subscribed()
+
+			So(s.PublishJSON("quotes", quote{Symbol: "ACME", Price: 7}), ShouldBeNil)
+			So(s.PublishJSON("quotes", func() {}), ShouldNotBeNil)
+
+			select {
+			case q := <-received:
+				So(q, ShouldResemble, quote{Symbol: "ACME", Price: 7})
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("Binary payloads should be sent base64 encoded", func() {
+			codec := Base64Codec{gobCodec{}}
+			events := make(chan *Event, 1)
+			received := make(chan quote, 1)
+			go SubscribeTyped(c, "quotes", codec, func(q quote, ev *Event) {
+				events <- ev
+				received <- q
+			})
+			subscribed()
+
+			So(s.PublishCodec("quotes", codec, quote{Symbol: "ACME", Price: 9}), ShouldBeNil)
+
+			select {
+			case q := <-received:
+				So(q, ShouldResemble, quote{Symbol: "ACME", Price: 9})
+				data := string((<-events).Data)
+				So(strings.Trim(data, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="), ShouldBeEmpty)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+	})
+}
@@ -0,0 +1,53 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// ValidationError reports an event rejected by one of Client.Validators
+type ValidationError struct {
+	Event *Event
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %q event: %s", eventName(e.Event), e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateJSON returns a validator accepting events whose data decodes into a
+// value of the same type as schema, without fields the type does not have
+func ValidateJSON(schema interface{}) func(ev *Event) error {
+	t := reflect.TypeOf(schema)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return func(ev *Event) error {
+		dec := json.NewDecoder(bytes.NewReader(ev.Data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(reflect.New(t).Interface())
+	}
+}
+
+// validate checks an event with the validator registered for its name
+func (c *Client) validate(ev *Event) error {
+	validator := c.Validators[eventName(ev)]
+	if validator == nil {
+		return nil
+	}
+	if err := validator(ev); err != nil {
+		return &ValidationError{Event: ev, Err: err}
+	}
+	return nil
+}
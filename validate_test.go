@@ -0,0 +1,98 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateJSON(t *testing.T) {
+	Convey("Given a JSON validator", t, func() {
+		validate := ValidateJSON(struct {
+			ID    int    `json:"id"`
+			Title string `json:"title"`
+		}{})
+
+		Convey("It should accept data matching the schema", func() {
+			So(validate(&Event{Data: []byte(`{"id":1,"title":"a"}`)}), ShouldBeNil)
+		})
+
+		Convey("It should reject fields the schema does not have", func() {
+			So(validate(&Event{Data: []byte(`{"id":1,"name":"a"}`)}), ShouldNotBeNil)
+		})
+
+		Convey("It should reject fields of the wrong type", func() {
+			So(validate(&Event{Data: []byte(`{"id":"1"}`)}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestClientValidators(t *testing.T) {
+	Convey("Given a client validating events", t, func() {
+		srv := New()
+		srv.AutoReplay = false
+		srv.CreateStream("test")
+		server := httptest.NewServer(http.HandlerFunc(srv.HTTPHandler))
+
+		errBad := errors.New("bad payload")
+		c := NewClient(server.URL)
+		c.Validators = map[string]func(*Event) error{
+			"message": func(ev *Event) error {
+				if string(ev.Data) == "bad" {
+					return errBad
+				}
+				return nil
+			},
+		}
+
+		rejected := make(chan error, 1)
+		c.OnError = func(err error, raw []byte) {
+			rejected <- err
+		}
+
+		Convey("Invalid events should be reported instead of handled", func() {
+			events := make(chan *Event, 2)
+			go c.Subscribe("test", func(msg *Event) {
+				events <- msg
+			})
+			for srv.getStream("test").SubscriberCount() == 0 {
+				time.Sleep(time.Millisecond * 10)
+			}
+
+			srv.Publish("test", &Event{Data: []byte("bad")})
+			srv.Publish("test", &Event{Event: []byte("other"), Data: []byte("bad")})
+			srv.Publish("test", &Event{Data: []byte("good")})
+
+			var err error
+			select {
+			case err = <-rejected:
+			case <-time.After(time.Second):
+			}
+			var verr *ValidationError
+			So(errors.As(err, &verr), ShouldBeTrue)
+			So(errors.Is(err, errBad), ShouldBeTrue)
+			So(string(verr.Event.Data), ShouldEqual, "bad")
+
+			for _, want := range []string{"other", "message"} {
+				select {
+				case msg := <-events:
+					So(eventName(msg), ShouldEqual, want)
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeEmpty)
+				}
+			}
+		})
+
+		Reset(func() {
+			srv.Close()
+		})
+	})
+}